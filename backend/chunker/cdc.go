@@ -0,0 +1,638 @@
+package chunker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// Content defined chunking (CDC) splits files where a rolling hash of
+// the last few bytes matches a mask, rather than at fixed offsets, so
+// inserting or removing data only changes the chunks around the edit.
+//
+// Data chunks made this way are named after the SHA-256 of their
+// content and stored once in a chunk pool shared by all files:
+//
+//	<chunk_pool>/<first 2 hex digits>/<64 hex digits>
+//
+// Each composite file has a meta object (simplejson version 3) and a
+// control chunk of type "cdc" next to it which lists the hashes and
+// sizes of its data chunks in order. The meta object holds the SHA-256
+// of this index so a mismatched pair is detected.
+//
+// Chunks are not reference counted on the remote since most remotes
+// can't update a counter atomically. Instead the gc command is a mark
+// and sweep collector: it marks the chunks referenced from every index
+// then sweeps the pool removing the chunks nobody uses.
+//
+// Uploads write their chunks before their index, so gc spares chunks
+// modified less than min-age ago. Every upload sets the modification
+// time of the chunks it uses to now, including chunks it finds in the
+// pool already, so a chunk can't be swept while an upload which hasn't
+// written its index yet is using it, as long as the upload takes less
+// than min-age.
+
+// ctrlTypeCDC is the control chunk type of the chunk index
+const ctrlTypeCDC = "cdc"
+
+// Current/highest supported version of the chunk index
+const cdcIndexVersion = 1
+
+// Limits of cdc_chunk_size. Chunks are between a quarter and four
+// times the average size.
+const (
+	minCDCChunkSize = 256
+	maxCDCChunkSize = 256 * fs.Mebi
+)
+
+// gearTable holds the random values mixed into the rolling hash. It is
+// derived from SHA-256 so chunk boundaries are the same for all
+// releases - changing it would stop new uploads sharing chunks with
+// old ones.
+var gearTable = func() (table [256]uint64) {
+	for i := range table {
+		sum := sha256.Sum256([]byte{byte(i)})
+		table[i] = binary.BigEndian.Uint64(sum[:8])
+	}
+	return table
+}()
+
+// cdcBits returns log2 of the average chunk size, rounding it down
+// to a power of 2.
+func cdcBits(avgSize fs.SizeSuffix) (uint, error) {
+	if avgSize < minCDCChunkSize || avgSize > maxCDCChunkSize {
+		return 0, fmt.Errorf("cdc_chunk_size must be between %v and %v", fs.SizeSuffix(minCDCChunkSize), fs.SizeSuffix(maxCDCChunkSize))
+	}
+	return uint(bits.Len64(uint64(avgSize)) - 1), nil
+}
+
+// cdcSplitter cuts a stream into content defined chunks using the
+// normalized chunking of FastCDC.
+type cdcSplitter struct {
+	in      io.Reader
+	buf     []byte // data read but not returned yet, from the start
+	cut     int    // length of the chunk returned last
+	eof     bool   // in has been read to the end
+	minSize int
+	avgSize int
+	maxSize int
+	maskS   uint64 // harder to match mask used below the average size
+	maskL   uint64 // easier to match mask used above the average size
+}
+
+func newCDCSplitter(in io.Reader, avgBits uint) *cdcSplitter {
+	avgSize := 1 << avgBits
+	return &cdcSplitter{
+		in:      in,
+		buf:     make([]byte, 0, 4*avgSize),
+		minSize: avgSize / 4,
+		avgSize: avgSize,
+		maxSize: 4 * avgSize,
+		maskS:   ^uint64(0) << (64 - (avgBits + 2)),
+		maskL:   ^uint64(0) << (64 - (avgBits - 2)),
+	}
+}
+
+// next returns the next chunk or io.EOF when there is no more data.
+// The chunk is only valid until next is called again.
+func (s *cdcSplitter) next() ([]byte, error) {
+	if s.cut > 0 {
+		n := copy(s.buf, s.buf[s.cut:])
+		s.buf = s.buf[:n]
+		s.cut = 0
+	}
+	if !s.eof && len(s.buf) < s.maxSize {
+		n, err := io.ReadFull(s.in, s.buf[len(s.buf):s.maxSize])
+		s.buf = s.buf[:len(s.buf)+n]
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			s.eof = true
+		default:
+			return nil, err
+		}
+	}
+	if len(s.buf) == 0 {
+		return nil, io.EOF
+	}
+	s.cut = s.boundary(s.buf)
+	return s.buf[:s.cut], nil
+}
+
+// done returns true if the chunk returned last was the final one
+func (s *cdcSplitter) done() bool {
+	return s.eof && s.cut == len(s.buf)
+}
+
+// boundary returns the length of the chunk at the start of data
+func (s *cdcSplitter) boundary(data []byte) int {
+	n := len(data)
+	if n <= s.minSize {
+		return n
+	}
+	normal := s.avgSize
+	if n < normal {
+		normal = n
+	}
+	var fp uint64
+	i := s.minSize
+	for ; i < normal; i++ {
+		fp = fp<<1 + gearTable[data[i]]
+		if fp&s.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = fp<<1 + gearTable[data[i]]
+		if fp&s.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// cdcIndex is the content of the chunk index
+type cdcIndex struct {
+	Version int        `json:"ver"`
+	Chunks  []cdcChunk `json:"chunks"`
+}
+
+// cdcChunk describes a data chunk in the pool
+type cdcChunk struct {
+	Hash string `json:"sha256"`
+	Size int64  `json:"size"`
+}
+
+// poolChunkName returns the name of a data chunk in the pool
+func poolChunkName(sum string) string {
+	return sum[:2] + "/" + sum
+}
+
+// inPool returns true if remote is the chunk pool or inside it
+func (f *Fs) inPool(remote string) bool {
+	return f.poolRemote != "" && (remote == f.poolRemote || strings.HasPrefix(remote, f.poolRemote+"/"))
+}
+
+// chunkPool holds the Fs of the chunk pool pinned in the cache
+type chunkPool struct {
+	fs.Fs
+}
+
+// getPool returns the Fs of the chunk pool, making it if needed
+func (f *Fs) getPool(ctx context.Context) (fs.Fs, error) {
+	f.poolMu.Lock()
+	defer f.poolMu.Unlock()
+	if f.pool == nil {
+		pool, err := cache.Get(ctx, f.poolRoot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make chunk pool %q: %w", f.poolRoot, err)
+		}
+		f.pool = &chunkPool{Fs: pool}
+		cache.PinUntilFinalized(pool, f.pool)
+	}
+	return f.pool.Fs, nil
+}
+
+// putPoolChunk uploads a data chunk to the pool unless it is there
+// already.
+//
+// The modification time of the chunk is set to now either way, as gc
+// uses it to spare chunks of uploads in progress.
+func (f *Fs) putPoolChunk(ctx context.Context, pool fs.Fs, sum string, data []byte) error {
+	name := poolChunkName(sum)
+	size := int64(len(data))
+	existing, err := pool.NewObject(ctx, name)
+	switch {
+	case err == nil && existing.Size() == size:
+		err = existing.SetModTime(ctx, time.Now())
+		if err == nil {
+			fs.Debugf(existing, "Reusing chunk from pool")
+			return nil
+		}
+		if !errors.Is(err, fs.ErrorCantSetModTime) && !errors.Is(err, fs.ErrorCantSetModTimeWithoutDelete) {
+			return fmt.Errorf("failed to mark pooled chunk as in use: %w", err)
+		}
+		fs.Debugf(existing, "Uploading chunk again as its modification time can't be set")
+	case err == nil:
+		fs.Infof(existing, "Replacing pooled chunk with wrong size %d != %d", existing.Size(), size)
+	case !errors.Is(err, fs.ErrorObjectNotFound):
+		return err
+	}
+	info := object.NewStaticObjectInfo(name, time.Now(), size, true, nil, pool)
+	_, err = pool.Put(ctx, bytes.NewReader(data), info)
+	return err
+}
+
+// putCDC implements put for content defined chunking
+func (f *Fs) putCDC(ctx context.Context, in io.Reader, src fs.ObjectInfo, remote string, options []fs.OpenOption) (obj fs.Object, err error) {
+	pool, err := f.getPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let chunkingReader do hashing and accounting, the splitter
+	// decides where chunks end.
+	c := f.newChunkingReader(src)
+	c.chunkLimit = math.MaxInt64
+	s := newCDCSplitter(c.wrapStream(ctx, in, src), f.cdcBits)
+
+	xactID, err := f.newXactID(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.next()
+	if err == io.EOF {
+		data, err = nil, nil // empty file
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Finalize small object as non-chunked unless its contents look
+	// like metadata or consistent hashing needs metadata.
+	if s.done() && !f.hashAll {
+		needMeta := false
+		if len(data) <= maxMetadataSize {
+			_, needMeta, _ = unmarshalSimpleJSON(ctx, nil, data)
+		}
+		if !needMeta {
+			return f.putCDCSingle(ctx, data, src, remote, xactID, options)
+		}
+	}
+
+	// Transfer data chunks to the pool
+	index := cdcIndex{Version: cdcIndexVersion}
+	uploaded := make(map[string]bool)
+	for err == nil {
+		if len(index.Chunks) > maxSafeChunkNumber {
+			return nil, ErrChunkOverflow
+		}
+		sum := sha256.Sum256(data)
+		hexSum := hex.EncodeToString(sum[:])
+		if !uploaded[hexSum] {
+			if err := f.putPoolChunk(ctx, pool, hexSum, data); err != nil {
+				return nil, err
+			}
+			uploaded[hexSum] = true
+		}
+		index.Chunks = append(index.Chunks, cdcChunk{Hash: hexSum, Size: int64(len(data))})
+		data, err = s.next()
+	}
+	if err != io.EOF {
+		return nil, err
+	}
+
+	// Validate uploaded size
+	if c.sizeTotal != -1 && c.readCount != c.sizeTotal {
+		return nil, fmt.Errorf("incorrect upload size %d != %d", c.readCount, c.sizeTotal)
+	}
+
+	indexData, err := json.Marshal(&index)
+	if err != nil {
+		return nil, err
+	}
+	indexSum := sha256.Sum256(indexData)
+	c.updateHashes()
+	metadata, err := marshalSimpleJSON(ctx, c.readCount, len(index.Chunks), c.md5, c.sha1, "", hex.EncodeToString(indexSum[:]))
+	if err != nil {
+		return nil, err
+	}
+
+	// Put the index under a temporary name, then swap it for the old
+	// chunks. Pooled chunks are left for gc if this fails.
+	tempRemote := f.makeChunkName(remote, -1, ctrlTypeCDC, xactID)
+	indexInfo := object.NewStaticObjectInfo(tempRemote, src.ModTime(ctx), int64(len(indexData)), true, nil, f.base)
+	indexObject, err := f.base.Put(ctx, bytes.NewReader(indexData), indexInfo)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			silentlyRemove(ctx, indexObject)
+		}
+	}()
+
+	// If previous object was chunked, remove its chunks
+	f.removeOldChunks(ctx, remote)
+
+	indexMoved, err := f.baseMove(ctx, indexObject, f.makeChunkName(remote, -1, ctrlTypeCDC, ""), delFailed)
+	if err != nil {
+		return nil, err
+	}
+	indexObject = indexMoved
+
+	metaInfo := f.wrapInfo(src, remote, int64(len(metadata)))
+	metaObject, err := f.base.Put(ctx, bytes.NewReader(metadata), metaInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	o := f.newObject("", metaObject, nil)
+	o.index = indexObject
+	o.size = c.readCount
+	o.md5 = c.md5
+	o.sha1 = c.sha1
+	o.cdcSum = hex.EncodeToString(indexSum[:])
+	o.cdcCount = len(index.Chunks)
+	o.cdcChunks = index.Chunks
+	o.isFull = true
+	return o, nil
+}
+
+// putCDCSingle stores data which fits in a single chunk as a
+// non-chunked file.
+func (f *Fs) putCDCSingle(ctx context.Context, data []byte, src fs.ObjectInfo, remote, xactID string, options []fs.OpenOption) (fs.Object, error) {
+	tempRemote := f.makeChunkName(remote, 0, "", xactID)
+	info := f.wrapInfo(src, tempRemote, int64(len(data)))
+	chunk, err := f.base.Put(ctx, bytes.NewReader(data), info, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	// If previous object was chunked, remove its chunks
+	f.removeOldChunks(ctx, remote)
+
+	// Rename single data chunk in place
+	chunkMoved, err := f.baseMove(ctx, chunk, remote, delAlways)
+	if err != nil {
+		silentlyRemove(ctx, chunk)
+		return nil, err
+	}
+	return f.newObject("", chunkMoved, nil), nil
+}
+
+// readCDCIndex reads a chunk index checking its SHA-256 against
+// indexSum unless that is empty.
+func readCDCIndex(ctx context.Context, indexObject fs.Object, indexSum string) (*cdcIndex, error) {
+	reader, err := indexObject.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(reader)
+	_ = reader.Close() // ensure file handle is freed on windows
+	if err != nil {
+		return nil, err
+	}
+	if indexSum != "" {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != indexSum {
+			return nil, errors.New("chunk index doesn't match metadata")
+		}
+	}
+	var index cdcIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("invalid chunk index: %w", err)
+	}
+	if index.Version > cdcIndexVersion {
+		return nil, ErrMetaUnknown
+	}
+	if index.Version < 1 {
+		return nil, errors.New("invalid chunk index: wrong version")
+	}
+	for _, chunk := range index.Chunks {
+		_, err := hex.DecodeString(chunk.Hash)
+		if len(chunk.Hash) != 2*sha256.Size || err != nil || chunk.Size < 0 {
+			return nil, errors.New("invalid chunk index: wrong chunk")
+		}
+	}
+	return &index, nil
+}
+
+// readIndex reads, checks and caches the chunk index of a composite
+// file made by content defined chunking.
+func (o *Object) readIndex(ctx context.Context) ([]cdcChunk, error) {
+	if o.cdcChunks != nil {
+		return o.cdcChunks, nil
+	}
+	if err := o.readMetadata(ctx); err != nil {
+		return nil, err
+	}
+	index, err := readCDCIndex(ctx, o.index, o.cdcSum)
+	if err != nil {
+		return nil, err
+	}
+	var totalSize int64
+	for _, chunk := range index.Chunks {
+		totalSize += chunk.Size
+	}
+	if len(index.Chunks) != o.cdcCount || totalSize != o.size {
+		return nil, errors.New("chunk index doesn't match file size")
+	}
+	o.cdcChunks = index.Chunks
+	return o.cdcChunks, nil
+}
+
+// poolChunks returns the data chunks of a composite file made by
+// content defined chunking.
+func (o *Object) poolChunks(ctx context.Context) ([]chunkOpener, error) {
+	index, err := o.readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := o.f.getPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	chunks := make([]chunkOpener, len(index))
+	for i, chunk := range index {
+		chunks[i] = &poolChunk{pool: pool, name: poolChunkName(chunk.Hash), size: chunk.Size}
+	}
+	return chunks, nil
+}
+
+// poolChunk is a data chunk in the pool which is looked up when opened
+type poolChunk struct {
+	pool fs.Fs
+	name string
+	size int64
+}
+
+// Size returns the size of the chunk
+func (c *poolChunk) Size() int64 {
+	return c.size
+}
+
+// Open opens the chunk for read
+func (c *poolChunk) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	o, err := c.pool.NewObject(ctx, c.name)
+	if err != nil {
+		return nil, fmt.Errorf("can't find chunk %q in pool: %w", c.name, err)
+	}
+	if o.Size() != c.size {
+		return nil, fmt.Errorf("chunk %q in pool has wrong size %d != %d", c.name, o.Size(), c.size)
+	}
+	return o.Open(ctx, options...)
+}
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "gc",
+	Short: "Remove unused chunks from the chunk pool",
+	Long: `This removes chunks made by content defined chunking which no file
+refers to any more from the chunk pool.
+
+It reads the chunk index of every file on the remote to count the
+references to each chunk, so it must be run on the root of the
+chunker remote. If any index can't be read nothing is removed.
+
+This is a mark and sweep garbage collector rather than reference
+counting. Uploads set the modification time of every chunk they use,
+including chunks already in the pool, and chunks modified less than
+min-age ago are kept to protect uploads which haven't written their
+index yet. Set min-age longer than the longest upload which might be
+running.
+
+Use --dry-run to see what would be removed.
+
+Usage Example:
+
+    rclone backend gc chunker:
+    rclone backend gc chunker: -o min-age=24h
+
+It returns the number of chunk indexes read, the number of chunks in
+the pool, how many of them are referenced and the number and size of
+the chunks removed.
+`,
+	Opts: map[string]string{
+		"min-age": "Keep chunks modified more recently than this (default 1h)",
+	},
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "gc":
+		minAge := time.Hour
+		if value, ok := opt["min-age"]; ok {
+			minAge, err = fs.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid min-age: %w", err)
+			}
+		}
+		return f.gc(ctx, minAge)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// gcStats counts what gc did
+type gcStats struct {
+	Indexes      int64 `json:"indexes"`      // chunk indexes read
+	Chunks       int64 `json:"chunks"`       // chunks in the pool
+	Referenced   int64 `json:"referenced"`   // chunks used by at least one index
+	Removed      int64 `json:"removed"`      // chunks removed
+	RemovedBytes int64 `json:"removedBytes"` // total size of chunks removed
+}
+
+// gc removes the chunks in the pool which no index refers to
+func (f *Fs) gc(ctx context.Context, minAge time.Duration) (*gcStats, error) {
+	if f.root != "" {
+		return nil, errors.New("gc must be run on the root of the chunker remote")
+	}
+	pool, err := f.getPool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats := new(gcStats)
+
+	// Count references from all indexes, including those of
+	// uploads in progress or left by interrupted operations.
+	refs := make(map[string]int)
+	err = walk.Walk(ctx, f.base, "", true, -1, func(dirPath string, entries fs.DirEntries, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.inPool(dirPath) {
+			return walk.ErrorSkipDir
+		}
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok || f.inPool(o.Remote()) {
+				continue
+			}
+			mainRemote, _, ctrlType, _ := f.parseChunkName(o.Remote())
+			if mainRemote == "" || ctrlType != ctrlTypeCDC {
+				continue
+			}
+			index, err := readCDCIndex(ctx, o, "")
+			if err != nil {
+				return fmt.Errorf("failed to read chunk index %q: %w", o.Remote(), err)
+			}
+			stats.Indexes++
+			for _, chunk := range index.Chunks {
+				refs[chunk.Hash]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	// Remove chunks with no references
+	now := time.Now()
+	err = walk.ListR(ctx, pool, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			stats.Chunks++
+			if refs[path.Base(o.Remote())] > 0 {
+				stats.Referenced++
+				continue
+			}
+			if now.Sub(o.ModTime(ctx)) < minAge {
+				fs.Debugf(o, "Keeping unused chunk as it is newer than min-age")
+				continue
+			}
+			// Read the chunk again in case an upload has started
+			// using it since the pool was listed
+			o, err := pool.NewObject(ctx, o.Remote())
+			if errors.Is(err, fs.ErrorObjectNotFound) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if time.Since(o.ModTime(ctx)) < minAge {
+				fs.Debugf(o, "Keeping unused chunk as an upload is using it")
+				continue
+			}
+			if err := operations.DeleteFile(ctx, o); err != nil {
+				return err
+			}
+			stats.Removed++
+			stats.RemovedBytes += o.Size()
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		err = nil
+	}
+	return stats, err
+}
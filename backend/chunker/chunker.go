@@ -108,7 +108,7 @@ const (
 )
 
 // Current/highest supported metadata format.
-const metadataVersion = 2
+const metadataVersion = 3
 
 // optimizeFirstChunk enables the following optimization in the Put:
 // If a single chunk is expected, put the first chunk using the
@@ -146,6 +146,7 @@ func init() {
 		Name:        "chunker",
 		Description: "Transparently chunk/split large files",
 		NewFs:       NewFs,
+		CommandHelp: commandHelp,
 		Options: []fs.Option{{
 			Name:     "remote",
 			Required: true,
@@ -158,6 +159,40 @@ Normally should contain a ':' and a path, e.g. "myremote:path/to/dir",
 			Advanced: false,
 			Default:  fs.SizeSuffix(2147483648), // 2 GiB
 			Help:     `Files larger than chunk size will be split in chunks.`,
+		}, {
+			Name:     "chunking",
+			Advanced: false,
+			Default:  "fixed",
+			Help:     `Choose how chunker splits files in chunks.`,
+			Examples: []fs.OptionExample{{
+				Value: "fixed",
+				Help:  `Split files every chunk size bytes.`,
+			}, {
+				Value: "cdc",
+				Help: `Split files at boundaries found from their content.
+Chunks are named after their SHA-256 and stored once in a pool
+shared by all files, so unchanged parts of a file aren't uploaded again.
+Unused chunks are removed by the gc backend command.
+Requires meta format "simplejson".`,
+			}},
+		}, {
+			Name:     "cdc_chunk_size",
+			Advanced: true,
+			Default:  fs.SizeSuffix(fs.Mebi),
+			Help: `Average chunk size for content defined chunking.
+
+This is rounded down to a power of 2. Chunks are between a quarter
+and four times this size. Files smaller than a chunk aren't chunked.
+
+Changing it stops new uploads sharing chunks with old ones.`,
+		}, {
+			Name:     "chunk_pool",
+			Advanced: true,
+			Default:  ".rclone_chunks",
+			Help: `Directory of the chunk pool used by content defined chunking.
+
+This is relative to the root of the remote being chunked, so every
+path of the chunker remote shares the pool. It is hidden from listings.`,
 		}, {
 			Name:     "name_format",
 			Advanced: true,
@@ -313,6 +348,14 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	if err := f.configure(opt.NameFormat, opt.MetaFormat, opt.HashType, opt.Transactions); err != nil {
 		return nil, err
 	}
+	if err := f.setChunking(opt.Chunking, opt.CDCChunkSize); err != nil {
+		return nil, err
+	}
+	poolPath := path.Clean(strings.TrimPrefix(opt.ChunkPool, "/"))
+	if poolPath == "." || poolPath == ".." || strings.HasPrefix(poolPath, "../") {
+		return nil, fmt.Errorf("invalid chunk pool %q", opt.ChunkPool)
+	}
+	f.poolRoot = baseName + fspath.JoinRootPath(basePath, poolPath)
 
 	// Handle the tricky case detected by FsMkdir/FsPutFiles/FsIsFile
 	// when `rpath` points to a composite multi-chunk file without metadata,
@@ -336,6 +379,9 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 			f.root = ""
 		}
 	}
+	if f.root == "" {
+		f.poolRemote = poolPath // hide the pool from listings
+	}
 
 	// Note 1: the features here are ones we could support, and they are
 	// ANDed with the ones from wrappedFs.
@@ -371,6 +417,9 @@ type Options struct {
 	HashType     string        `config:"hash_type"`
 	FailHard     bool          `config:"fail_hard"`
 	Transactions string        `config:"transactions"`
+	Chunking     string        `config:"chunking"`
+	CDCChunkSize fs.SizeSuffix `config:"cdc_chunk_size"`
+	ChunkPool    string        `config:"chunk_pool"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -393,6 +442,12 @@ type Fs struct {
 	features     *fs.Features   // optional features
 	dirSort      bool           // reserved for future, ignored
 	useNoRename  bool           // can be set with the transactions option
+	useCDC       bool           // true if chunking is "cdc"
+	cdcBits      uint           // log2 of average cdc chunk size
+	poolRoot     string         // path of the chunk pool passed to cache.Get
+	poolRemote   string         // path of the chunk pool relative to root or "" if outside
+	pool         *chunkPool     // chunk pool, made on first use
+	poolMu       sync.Mutex     // mutex for pool
 }
 
 // configure sets up chunker for given name format, meta format and hash type.
@@ -491,6 +546,34 @@ func (f *Fs) setTransactionMode(transactionMode string) error {
 	return nil
 }
 
+// setChunking sets up the chunking mode.
+// It must be called *after* setTransactionMode.
+func (f *Fs) setChunking(chunking string, cdcChunkSize fs.SizeSuffix) error {
+	switch chunking {
+	case "fixed":
+		f.useCDC = false
+	case "cdc":
+		if !f.useMeta {
+			return errors.New("cdc chunking requires metadata")
+		}
+		if f.useNoRename {
+			if f.opt.Transactions == "norename" {
+				return errors.New("cdc chunking doesn't support norename transactions")
+			}
+			f.useNoRename = false // auto
+		}
+		bits, err := cdcBits(cdcChunkSize)
+		if err != nil {
+			return err
+		}
+		f.useCDC = true
+		f.cdcBits = bits
+	default:
+		return fmt.Errorf("unsupported chunking '%s'", chunking)
+	}
+	return nil
+}
+
 // setChunkNameFormat converts pattern based chunk name format
 // into Printf format and Regular expressions for data and
 // control chunks.
@@ -795,6 +878,13 @@ func (f *Fs) processEntries(ctx context.Context, origEntries fs.DirEntries, dirP
 			// this is some kind of chunk
 			// metobject should have been created above if present
 			mainObject := byRemote[mainRemote]
+			if ctrlType == ctrlTypeCDC && xactID == "" && f.useMeta && mainObject != nil && mainObject.size <= maxMetadataSize {
+				// chunk index of a file made by content defined chunking,
+				// metadata must be read to be sure and to get the size
+				mainObject.index = entry
+				mainObject.unsure = true
+				break
+			}
 			isSpecial := xactID != txnByRemote[mainRemote] || ctrlType != ""
 			if mainObject == nil && f.useMeta && !isSpecial {
 				fs.Debugf(f, "skip orphan data chunk %q", remote)
@@ -829,6 +919,9 @@ func (f *Fs) processEntries(ctx context.Context, origEntries fs.DirEntries, dirP
 				badEntry[mainRemote] = true
 			}
 		case fs.Directory:
+			if f.inPool(entry.Remote()) {
+				break
+			}
 			isSubdir[entry.Remote()] = true
 			wrapDir := fs.NewDirWrapper(entry.Remote(), entry)
 			tempEntries = append(tempEntries, wrapDir)
@@ -860,6 +953,15 @@ func (f *Fs) processEntries(ctx context.Context, origEntries fs.DirEntries, dirP
 				fs.Debugf(f, "invalid chunks in object %q", remote)
 				continue
 			}
+			if object.index != nil {
+				if err := object.readMetadata(ctx); err != nil && err != ErrMetaUnknown {
+					if f.opt.FailHard {
+						return nil, err
+					}
+					fs.Debugf(f, "invalid metadata in object %q: %v", remote, err)
+					continue
+				}
+			}
 		}
 		newEntries = append(newEntries, entry)
 	}
@@ -974,6 +1076,12 @@ func (f *Fs) scanObject(ctx context.Context, remote string, quickScan bool) (fs.
 		if !sameMain {
 			continue // skip alien chunks
 		}
+		if ctrlType == ctrlTypeCDC && xactID == "" && f.useMeta {
+			// chunk index of a file made by content defined chunking
+			o.index = entry
+			o.unsure = true
+			continue
+		}
 		if ctrlType != "" || xactID != currentXactID {
 			if f.useMeta {
 				// temporary/control chunk calls for lazy metadata read
@@ -1016,6 +1124,13 @@ func (f *Fs) scanObject(ctx context.Context, remote string, quickScan bool) (fs.
 		if err := o.validate(); err != nil {
 			return nil, err
 		}
+		if o.index != nil {
+			// the size of a file made by content defined chunking
+			// is only known from its metadata
+			if err := o.readMetadata(ctx); err != nil && err != ErrMetaUnknown {
+				return nil, err
+			}
+		}
 	}
 	return o, nil
 }
@@ -1047,6 +1162,7 @@ func (o *Object) readMetadata(ctx context.Context) error {
 			// this is not metadata but a foreign object
 			o.unsure = false
 			o.chunks = nil  // make isComposite return false
+			o.index = nil   // ditto
 			o.isFull = true // cache results
 			return nil
 		}
@@ -1072,6 +1188,7 @@ func (o *Object) readMetadata(ctx context.Context) error {
 			if !madeByChunker {
 				// this is not metadata but a foreign object
 				o.chunks = nil  // make isComposite return false
+				o.index = nil   // ditto
 				o.isFull = true // cache results
 				return nil
 			}
@@ -1084,8 +1201,18 @@ func (o *Object) readMetadata(ctx context.Context) error {
 		default:
 			return fmt.Errorf("invalid metadata: %w", err)
 		}
-		if o.size != metaInfo.Size() || len(o.chunks) != metaInfo.nChunks {
-			return errors.New("metadata doesn't match file size")
+		if metaInfo.cdcSum != "" {
+			if o.index == nil {
+				return errors.New("chunk index is missing")
+			}
+			o.size = metaInfo.Size()
+			o.cdcSum = metaInfo.cdcSum
+			o.cdcCount = metaInfo.nChunks
+		} else {
+			o.index = nil // ignore index left by an interrupted upload
+			if o.size != metaInfo.Size() || len(o.chunks) != metaInfo.nChunks {
+				return errors.New("metadata doesn't match file size")
+			}
 		}
 		o.md5 = metaInfo.md5
 		o.sha1 = metaInfo.sha1
@@ -1164,6 +1291,9 @@ func (f *Fs) put(
 			return nil, fmt.Errorf("refusing to %s: %w", action, err)
 		}
 	}
+	if f.useCDC {
+		return f.putCDC(ctx, in, src, remote, options)
+	}
 
 	// Prepare to upload
 	c := f.newChunkingReader(src)
@@ -1322,7 +1452,7 @@ func (f *Fs) put(
 	switch f.opt.MetaFormat {
 	case "simplejson":
 		c.updateHashes()
-		metadata, err = marshalSimpleJSON(ctx, sizeTotal, len(c.chunks), c.md5, c.sha1, xactID)
+		metadata, err = marshalSimpleJSON(ctx, sizeTotal, len(c.chunks), c.md5, c.sha1, xactID, "")
 	}
 	if err == nil {
 		metaInfo := f.wrapInfo(src, baseRemote, int64(len(metadata)))
@@ -1510,6 +1640,11 @@ func (f *Fs) removeOldChunks(ctx context.Context, remote string) {
 				fs.Errorf(chunk, "Failed to remove old chunk: %v", err)
 			}
 		}
+		if oldObject.index != nil {
+			if err := oldObject.index.Remove(ctx); err != nil {
+				fs.Errorf(oldObject.index, "Failed to remove old chunk index: %v", err)
+			}
+		}
 	}
 }
 
@@ -1675,7 +1810,14 @@ func (o *Object) Remove(ctx context.Context) (err error) {
 		}
 	}
 
-	// There are no known control chunks to remove atm.
+	// Remove the chunk index of content defined chunking. The data
+	// chunks stay in the pool until the gc command removes them.
+	if o.index != nil {
+		indexErr := o.index.Remove(ctx)
+		if err == nil {
+			err = indexErr
+		}
+	}
 	return err
 }
 
@@ -1719,8 +1861,17 @@ func (f *Fs) copyOrMove(ctx context.Context, o *Object, remote string, do copyMo
 		newChunks = append(newChunks, chunkResult)
 	}
 
+	// Copy or move the chunk index of content defined chunking.
+	// Its data chunks are in the pool shared with the destination.
+	var indexObject fs.Object
+	if err == nil && o.index != nil {
+		indexObject, err = do(ctx, o.index, f.makeChunkName(remote, -1, ctrlTypeCDC, ""))
+		if err == nil {
+			newChunks = append(newChunks, indexObject) // for removal on failure
+		}
+	}
+
 	// Copy or move old metadata.
-	// There are no known control chunks to move/copy atm.
 	var metaObject fs.Object
 	if err == nil && o.main != nil {
 		metaObject, err = do(ctx, o.main, remote)
@@ -1733,18 +1884,29 @@ func (f *Fs) copyOrMove(ctx context.Context, o *Object, remote string, do copyMo
 	}
 
 	// Create wrapping object, calculate and validate total size
+	nChunks := len(newChunks)
+	if indexObject != nil {
+		newChunks = nil
+		nChunks = o.cdcCount
+	}
 	newObj := f.newObject(remote, metaObject, newChunks)
+	newObj.index = indexObject
 	err = newObj.validate()
 	if err != nil {
 		silentlyRemove(ctx, newObj)
 		return nil, err
 	}
+	if indexObject != nil {
+		newObj.size = o.size
+		newObj.cdcSum = o.cdcSum
+		newObj.cdcCount = o.cdcCount
+	}
 
 	// Update metadata
 	var metadata []byte
 	switch f.opt.MetaFormat {
 	case "simplejson":
-		metadata, err = marshalSimpleJSON(ctx, newObj.size, len(newChunks), md5, sha1, o.xactID)
+		metadata, err = marshalSimpleJSON(ctx, newObj.size, nChunks, md5, sha1, o.xactID, o.cdcSum)
 		if err == nil {
 			metaInfo := f.wrapInfo(metaObject, "", int64(len(metadata)))
 			err = newObj.main.Update(ctx, bytes.NewReader(metadata), metaInfo)
@@ -1782,6 +1944,10 @@ func (f *Fs) okForServerSide(ctx context.Context, src fs.Object, opName string)
 		diff = "chunk numbering"
 	case f.opt.MetaFormat != obj.f.opt.MetaFormat:
 		diff = "meta formats"
+	case f.opt.Chunking != obj.f.opt.Chunking:
+		diff = "chunking modes"
+	case f.useCDC && f.cdcBits != obj.f.cdcBits:
+		diff = "cdc chunk sizes"
 	}
 	if diff != "" {
 		fs.Debugf(src, "Can't %s - different %s", opName, diff)
@@ -1793,6 +1959,11 @@ func (f *Fs) okForServerSide(ctx context.Context, src fs.Object, opName string)
 		// ensure object is composite if need to re-read metadata
 		_ = obj.readMetadata(ctx)
 	}
+	if obj.index != nil && f.poolRoot != obj.f.poolRoot {
+		fs.Debugf(src, "Can't %s - different chunk pools", opName)
+		ok = false
+		return
+	}
 	requireMetaHash := obj.isComposite() && f.opt.MetaFormat == "simplejson"
 	if !requireMetaHash && !f.hashAll {
 		ok = true // hash is not required for metadata
@@ -2005,6 +2176,10 @@ type Object struct {
 	xactID    string      // transaction ID for "norename" or empty string for "renamed" chunks
 	md5       string
 	sha1      string
+	index     fs.Object  // chunk index if file is made by content defined chunking
+	cdcSum    string     // SHA-256 of the chunk index from metadata
+	cdcCount  int        // number of data chunks from metadata
+	cdcChunks []cdcChunk // data chunks if the chunk index has been read
 	f         *Fs
 }
 
@@ -2045,6 +2220,10 @@ func (o *Object) validate() error {
 		return fmt.Errorf("%q metadata is too large", o.remote)
 	}
 
+	if o.index != nil {
+		return nil // the total data size is read from metadata
+	}
+
 	var totalSize int64
 	for _, chunk := range o.chunks {
 		if chunk == nil {
@@ -2090,7 +2269,7 @@ func (o *Object) mainChunk() fs.Object {
 }
 
 func (o *Object) isComposite() bool {
-	return o.chunks != nil
+	return o.chunks != nil || o.index != nil
 }
 
 // Fs returns read only access to the Fs that this object is part of
@@ -2222,10 +2401,28 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 	return o.newLinearReader(ctx, offset, limit, openOptions)
 }
 
+// chunkOpener is a data chunk as used by linearReader
+type chunkOpener interface {
+	Size() int64
+	Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error)
+}
+
+// dataChunks returns the data chunks of a composite file in order
+func (o *Object) dataChunks(ctx context.Context) ([]chunkOpener, error) {
+	if o.index != nil {
+		return o.poolChunks(ctx)
+	}
+	chunks := make([]chunkOpener, len(o.chunks))
+	for i, chunk := range o.chunks {
+		chunks[i] = chunk
+	}
+	return chunks, nil
+}
+
 // linearReader opens and reads file chunks sequentially, without read-ahead
 type linearReader struct {
 	ctx     context.Context
-	chunks  []fs.Object
+	chunks  []chunkOpener
 	options []fs.OpenOption
 	limit   int64
 	count   int64
@@ -2235,15 +2432,19 @@ type linearReader struct {
 }
 
 func (o *Object) newLinearReader(ctx context.Context, offset, limit int64, options []fs.OpenOption) (io.ReadCloser, error) {
+	chunks, err := o.dataChunks(ctx)
+	if err != nil {
+		return nil, err
+	}
 	r := &linearReader{
 		ctx:     ctx,
-		chunks:  o.chunks,
+		chunks:  chunks,
 		options: options,
 		limit:   limit,
 	}
 
 	// skip to chunk for given offset
-	err := io.EOF
+	err = io.EOF
 	for offset >= 0 && err != nil {
 		offset, err = r.nextChunk(offset)
 	}
@@ -2337,6 +2538,7 @@ type ObjectInfo struct {
 	remote  string // overrides remote name
 	md5     string // overrides MD5 checksum
 	sha1    string // overrides SHA1 checksum
+	cdcSum  string // SHA-256 of the chunk index of content defined chunking
 }
 
 func (f *Fs) wrapInfo(src fs.ObjectInfo, newRemote string, totalSize int64) *ObjectInfo {
@@ -2434,6 +2636,7 @@ type metaSimpleJSON struct {
 	MD5    string `json:"md5,omitempty"`
 	SHA1   string `json:"sha1,omitempty"`
 	XactID string `json:"txn,omitempty"` // transaction ID for norename transactions
+	CDC    string `json:"cdc,omitempty"` // SHA-256 of the chunk index of content defined chunking
 }
 
 // marshalSimpleJSON
@@ -2442,10 +2645,16 @@ type metaSimpleJSON struct {
 // - for files larger than chunk size
 // - if file contents can be mistaken as meta object
 // - if consistent hashing is On but wrapped remote can't provide given hash
-func marshalSimpleJSON(ctx context.Context, size int64, nChunks int, md5, sha1, xactID string) ([]byte, error) {
-	version := metadataVersion
-	if xactID == "" && version == 2 {
-		version = 1
+//
+// The oldest version which can hold the given fields is written so
+// older releases can still read the metadata.
+func marshalSimpleJSON(ctx context.Context, size int64, nChunks int, md5, sha1, xactID, cdcSum string) ([]byte, error) {
+	version := 1
+	switch {
+	case cdcSum != "":
+		version = 3
+	case xactID != "":
+		version = 2
 	}
 	metadata := metaSimpleJSON{
 		// required core fields
@@ -2456,6 +2665,7 @@ func marshalSimpleJSON(ctx context.Context, size int64, nChunks int, md5, sha1,
 		MD5:    md5,
 		SHA1:   sha1,
 		XactID: xactID,
+		CDC:    cdcSum,
 	}
 	data, err := json.Marshal(&metadata)
 	if err == nil && data != nil && len(data) >= maxMetadataSizeWritten {
@@ -2518,6 +2728,12 @@ func unmarshalSimpleJSON(ctx context.Context, metaObject fs.Object, data []byte)
 			return nil, false, errors.New("wrong sha1 hash")
 		}
 	}
+	if metadata.CDC != "" {
+		_, err = hex.DecodeString(metadata.CDC)
+		if len(metadata.CDC) != 64 || err != nil {
+			return nil, false, errors.New("wrong chunk index hash")
+		}
+	}
 	// ChunkNum is allowed to be 0 in future versions
 	if *metadata.ChunkNum < 1 && *metadata.Version <= metadataVersion {
 		return nil, false, errors.New("wrong number of chunks")
@@ -2533,6 +2749,7 @@ func unmarshalSimpleJSON(ctx context.Context, metaObject fs.Object, data []byte)
 	info.md5 = metadata.MD5
 	info.sha1 = metadata.SHA1
 	info.xactID = metadata.XactID
+	info.cdcSum = metadata.CDC
 	return info, true, nil
 }
 
@@ -2588,6 +2805,7 @@ var (
 	_ fs.Wrapper         = (*Fs)(nil)
 	_ fs.ChangeNotifier  = (*Fs)(nil)
 	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
 	_ fs.ObjectInfo      = (*ObjectInfo)(nil)
 	_ fs.Object          = (*Object)(nil)
 	_ fs.ObjectUnWrapper = (*Object)(nil)
@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
@@ -17,6 +18,7 @@ import (
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
 	"github.com/rclone/rclone/lib/random"
@@ -679,7 +681,7 @@ func testMetadataInput(t *testing.T, f *Fs) {
 		}
 	}
 
-	metaData, err := marshalSimpleJSON(ctx, 3, 1, "", "", "")
+	metaData, err := marshalSimpleJSON(ctx, 3, 1, "", "", "", "")
 	require.NoError(t, err)
 	todaysMeta := string(metaData)
 	runSubtest(todaysMeta, "today")
@@ -870,6 +872,7 @@ func testMD5AllSlow(t *testing.T, f *Fs) {
 		"hash_type":    "md5all",
 		"transactions": "rename",
 		"meta_format":  "simplejson",
+		"chunking":     "fixed",
 	})
 	chunkFs, ok := fsResult.(*Fs)
 	require.True(t, ok, "fs must be a chunker remote")
@@ -899,6 +902,137 @@ func testMD5AllSlow(t *testing.T, f *Fs) {
 	require.NoError(t, operations.Purge(ctx, baseFs, ""))
 }
 
+// test that content defined chunking only stores changed chunks
+// and that gc removes the unused ones
+func testCDC(t *testing.T, f *Fs) {
+	ctx := context.Background()
+	const dir = "cdc"
+	m := configmap.Simple{
+		"remote":         fspath.JoinRootPath(fs.ConfigStringFull(f.base), dir),
+		"chunk_size":     "2G",
+		"name_format":    "*.rclone_chunk.###",
+		"start_from":     "1",
+		"meta_format":    "simplejson",
+		"hash_type":      "md5",
+		"fail_hard":      "true",
+		"transactions":   "rename",
+		"chunking":       "cdc",
+		"cdc_chunk_size": "1k",
+		"chunk_pool":     ".rclone_chunks",
+	}
+	newFs, err := NewFs(ctx, "TestChunkerCDCInternal", "", m)
+	require.NoError(t, err)
+	cdcFs := newFs.(*Fs)
+	defer func() {
+		_ = operations.Purge(ctx, f.base, dir)
+	}()
+	pool, err := cdcFs.getPool(ctx)
+	require.NoError(t, err)
+	countChunks := func() int {
+		n := 0
+		err := walk.ListR(ctx, pool, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+			n += len(entries)
+			return nil
+		})
+		require.NoError(t, err)
+		return n
+	}
+	readFile := func(name string, options ...fs.OpenOption) string {
+		obj, err := cdcFs.NewObject(ctx, name)
+		require.NoError(t, err)
+		in, err := obj.Open(ctx, options...)
+		require.NoError(t, err)
+		data, err := io.ReadAll(in)
+		require.NoError(t, err)
+		require.NoError(t, in.Close())
+		return string(data)
+	}
+
+	// Inserting data only changes the chunks around it
+	contents := random.String(64 * 1024)
+	edited := contents[:100] + "inserted" + contents[100:]
+	testPutFile(ctx, t, cdcFs, "file1", contents, "first version", true)
+	chunks1 := countChunks()
+	assert.Greater(t, chunks1, 8)
+	testPutFile(ctx, t, cdcFs, "file2", edited, "edited version", true)
+	chunks2 := countChunks()
+	assert.LessOrEqual(t, chunks2-chunks1, 2, "only the edited chunks should be added")
+	assert.Equal(t, edited, readFile("file2"))
+	assert.Equal(t, edited[1000:3000], readFile("file2", &fs.RangeOption{Start: 1000, End: 2999}))
+
+	// Files are listed with their real size and the pool is hidden
+	entries, err := cdcFs.List(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	assert.Equal(t, int64(len(contents)), entries[0].Size())
+	assert.Equal(t, int64(len(edited)), entries[1].Size())
+
+	// Small files aren't chunked
+	testPutFile(ctx, t, cdcFs, "small", "tiny", "small file", true)
+	assert.Equal(t, chunks2, countChunks())
+	obj, err := cdcFs.NewObject(ctx, "small")
+	require.NoError(t, err)
+	assert.False(t, obj.(*Object).isComposite())
+
+	// Server side copy shares the chunks
+	copied, err := operations.Copy(ctx, cdcFs, nil, "copied", obj)
+	require.NoError(t, err)
+	assert.Equal(t, "tiny", readFile(copied.Remote()))
+	obj, err = cdcFs.NewObject(ctx, "file2")
+	require.NoError(t, err)
+	moved, err := operations.Move(ctx, cdcFs, nil, "sub/moved", obj)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(edited)), moved.Size())
+	assert.Equal(t, edited, readFile("sub/moved"))
+	assert.Equal(t, chunks2, countChunks())
+
+	// gc must run on the root
+	_, err = cdcFs.Command(ctx, "gc", nil, nil)
+	require.NoError(t, err)
+	subFs, err := NewFs(ctx, "TestChunkerCDCInternal", "sub", m)
+	require.NoError(t, err)
+	_, err = subFs.(*Fs).Command(ctx, "gc", nil, nil)
+	assert.Error(t, err)
+
+	// gc keeps new chunks, then removes unused ones
+	obj, err = cdcFs.NewObject(ctx, "file1")
+	require.NoError(t, err)
+	require.NoError(t, obj.Remove(ctx))
+	out, err := cdcFs.Command(ctx, "gc", nil, nil)
+	require.NoError(t, err)
+	stats := out.(*gcStats)
+	assert.Equal(t, int64(1), stats.Indexes)
+	assert.Equal(t, int64(chunks2), stats.Chunks)
+	assert.Equal(t, int64(0), stats.Removed)
+	out, err = cdcFs.Command(ctx, "gc", nil, map[string]string{"min-age": "0"})
+	require.NoError(t, err)
+	stats = out.(*gcStats)
+	assert.Equal(t, stats.Chunks-stats.Referenced, stats.Removed)
+	assert.Greater(t, stats.Removed, int64(0))
+	assert.LessOrEqual(t, stats.Removed, int64(2))
+	assert.Equal(t, int(stats.Referenced), countChunks())
+	assert.Equal(t, edited, readFile("sub/moved"))
+
+	// Reusing a chunk from the pool marks it as in use for gc
+	old := time.Now().Add(-24 * time.Hour)
+	err = walk.ListR(ctx, pool, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			require.NoError(t, entry.(fs.Object).SetModTime(ctx, old))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	testPutFile(ctx, t, cdcFs, "file3", edited, "reusing version", true)
+	assert.Equal(t, int(stats.Referenced), countChunks())
+	err = walk.ListR(ctx, pool, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			assert.WithinDuration(t, time.Now(), entry.ModTime(ctx), time.Hour, entry.Remote())
+		}
+		return nil
+	})
+	require.NoError(t, err)
+}
+
 // InternalTest dispatches all internal tests
 func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("PutLarge", func(t *testing.T) {
@@ -934,6 +1068,9 @@ func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("MD5AllSlow", func(t *testing.T) {
 		testMD5AllSlow(t, f)
 	})
+	t.Run("CDC", func(t *testing.T) {
+		testCDC(t, f)
+	})
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
@@ -46,6 +46,7 @@ func TestIntegration(t *testing.T) {
 			"DirCacheFlush",
 			"UserInfo",
 			"Disconnect",
+			"ListP", // all the chunks of a file must be listed together to assemble it
 		},
 	}
 	if *fstest.RemoteName == "" {
@@ -60,3 +61,42 @@ func TestIntegration(t *testing.T) {
 	}
 	fstests.Run(t, &opt)
 }
+
+// TestIntegrationCDC runs integration tests with content defined
+// chunking over a local temporary directory.
+func TestIntegrationCDC(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	name := "TestChunkerCDC"
+	tempDir := filepath.Join(os.TempDir(), "rclone-chunker-test-cdc")
+	fstests.Run(t, &fstests.Opt{
+		RemoteName:               name + ":",
+		NilObject:                (*chunker.Object)(nil),
+		SkipBadWindowsCharacters: !*UseBadChars,
+		UnimplementableObjectMethods: []string{
+			"MimeType",
+			"GetTier",
+			"SetTier",
+			"Metadata",
+			"SetMetadata",
+		},
+		UnimplementableFsMethods: []string{
+			"PublicLink",
+			"OpenWriterAt",
+			"OpenChunkWriter",
+			"MergeDirs",
+			"DirCacheFlush",
+			"UserInfo",
+			"Disconnect",
+			"ListP", // all the chunks of a file must be listed together to assemble it
+		},
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "chunker"},
+			{Name: name, Key: "remote", Value: tempDir},
+			{Name: name, Key: "chunking", Value: "cdc"},
+			{Name: name, Key: "cdc_chunk_size", Value: "256"},
+		},
+		QuickTestOK: true,
+	})
+}
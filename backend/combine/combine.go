@@ -265,6 +265,16 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (outFs fs
 		}
 	}
 
+	// Enable ListP when any upstreams support it
+	if features.ListP == nil {
+		for _, u := range f.upstreams {
+			if u.f.Features().ListP != nil {
+				features.ListP = f.ListP
+				break
+			}
+		}
+	}
+
 	// Enable Purge when any upstreams support it
 	if features.Purge == nil {
 		for _, u := range f.upstreams {
@@ -892,6 +902,45 @@ func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (
 	return err
 }
 
+// ListP lists the objects and directories of the Fs in dir calling
+// callback with each tranche of entries read.
+//
+// Upstreams which can't list in tranches are listed with List.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) ListP(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	if f.root == "" && dir == "" {
+		rootEntries, err := f.List(ctx, "")
+		if err != nil {
+			return err
+		}
+		return callback(rootEntries)
+	}
+	u, uRemote, err := f.findUpstream(dir)
+	if err != nil {
+		return err
+	}
+	wrapCallback := func(entries fs.DirEntries) error {
+		entries, err := u.wrapEntries(ctx, entries)
+		if err != nil {
+			return err
+		}
+		return callback(entries)
+	}
+	if do := u.f.Features().ListP; do != nil {
+		return do(ctx, uRemote, wrapCallback)
+	}
+	entries, err := u.f.List(ctx, uRemote)
+	if err != nil {
+		return err
+	}
+	return wrapCallback(entries)
+}
+
 // NewObject creates a new remote combine file object
 func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 	u, uRemote, err := f.findUpstream(remote)
@@ -1152,6 +1201,7 @@ var (
 	_ fs.ChangeNotifier  = (*Fs)(nil)
 	_ fs.Abouter         = (*Fs)(nil)
 	_ fs.ListRer         = (*Fs)(nil)
+	_ fs.ListPer         = (*Fs)(nil)
 	_ fs.Shutdowner      = (*Fs)(nil)
 	_ fs.PublicLinker    = (*Fs)(nil)
 	_ fs.PutUncheckeder  = (*Fs)(nil)
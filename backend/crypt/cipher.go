@@ -5,12 +5,16 @@ import (
 	"context"
 	"crypto/aes"
 	gocipher "crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base32"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
+	"path"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,12 +22,14 @@ import (
 	"unicode/utf8"
 
 	"github.com/Max-Sum/base32768"
+	"github.com/rclone/rclone/backend/crypt/keywrap"
 	"github.com/rclone/rclone/backend/crypt/pkcs7"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/lib/readers"
 	"github.com/rclone/rclone/lib/version"
 	"github.com/rfjakob/eme"
+	"golang.org/x/crypto/hkdf"
 	"golang.org/x/crypto/nacl/secretbox"
 	"golang.org/x/crypto/scrypt"
 )
@@ -31,10 +37,15 @@ import (
 // Constants
 const (
 	nameCipherBlockSize = aes.BlockSize
+	nameTagSize         = 16 // size of the synthetic IV in authenticated names
 	fileMagic           = "RCLONE\x00\x00"
 	fileMagicSize       = len(fileMagic)
 	fileNonceSize       = 24
 	fileHeaderSize      = fileMagicSize + fileNonceSize
+	fileMagicV2         = "RCLONE\x02" // followed by the key id
+	fileMagicV2Size     = len(fileMagicV2)
+	fileSecretSize      = 16                 // size of the per file secret in format v2
+	fileWrappedSize     = fileSecretSize + 8 // size of the secret when wrapped
 	blockHeaderSize     = secretbox.Overhead
 	blockDataSize       = 64 * 1024
 	blockSize           = blockHeaderSize + blockDataSize
@@ -56,13 +67,16 @@ var (
 	ErrorNotAnEncryptedFile      = errors.New("not an encrypted file - does not match suffix")
 	ErrorBadSeek                 = errors.New("Seek beyond end of file")
 	ErrorSuffixMissingDot        = errors.New("suffix config setting should include a '.'")
+	ErrorEncryptedUnknownKey     = errors.New("failed to unwrap file key - bad key_password?")
+	ErrorBadNameAuthentication   = errors.New("failed to authenticate file name - moved, renamed or bad password?")
 	defaultSalt                  = []byte{0xA8, 0x0D, 0xF4, 0x3A, 0x8F, 0xBD, 0x03, 0x08, 0xA7, 0xCA, 0xB8, 0x3E, 0x58, 0x1F, 0x86, 0xB1}
 	obfuscQuoteRune              = '!'
 )
 
 // Global variables
 var (
-	fileMagicBytes = []byte(fileMagic)
+	fileMagicBytes   = []byte(fileMagic)
+	fileMagicV2Bytes = []byte(fileMagicV2)
 )
 
 // ReadSeekCloser is the interface of the read handles
@@ -84,6 +98,7 @@ const (
 	NameEncryptionOff NameEncryptionMode = iota
 	NameEncryptionStandard
 	NameEncryptionObfuscated
+	NameEncryptionAuthenticated
 )
 
 // NewNameEncryptionMode turns a string into a NameEncryptionMode
@@ -96,6 +111,8 @@ func NewNameEncryptionMode(s string) (mode NameEncryptionMode, err error) {
 		mode = NameEncryptionStandard
 	case "obfuscate":
 		mode = NameEncryptionObfuscated
+	case "authenticated":
+		mode = NameEncryptionAuthenticated
 	default:
 		err = fmt.Errorf("unknown file name encryption mode %q", s)
 	}
@@ -111,12 +128,49 @@ func (mode NameEncryptionMode) String() (out string) {
 		out = "standard"
 	case NameEncryptionObfuscated:
 		out = "obfuscate"
+	case NameEncryptionAuthenticated:
+		out = "authenticated"
 	default:
 		out = fmt.Sprintf("Unknown mode #%d", mode)
 	}
 	return out
 }
 
+// FileFormat defines the format of the encrypted file data
+type FileFormat int
+
+// Encryption formats for the file data
+const (
+	FileFormatV1 FileFormat = iota + 1 // data encrypted with a key derived from the password
+	FileFormatV2                       // data encrypted with a random key wrapped in the header
+)
+
+// NewFileFormat turns a string into a FileFormat
+func NewFileFormat(s string) (format FileFormat, err error) {
+	switch s = strings.ToLower(s); s {
+	case "", "v1":
+		format = FileFormatV1
+	case "v2":
+		format = FileFormatV2
+	default:
+		err = fmt.Errorf("unknown file format %q", s)
+	}
+	return format, err
+}
+
+// String turns format into a human readable string
+func (format FileFormat) String() (out string) {
+	switch format {
+	case FileFormatV1:
+		out = "v1"
+	case FileFormatV2:
+		out = "v2"
+	default:
+		out = fmt.Sprintf("Unknown file format %d", int(format))
+	}
+	return out
+}
+
 // fileNameEncoding are the encoding methods dealing with encrypted file names
 type fileNameEncoding interface {
 	EncodeToString(src []byte) string
@@ -181,6 +235,36 @@ type Cipher struct {
 	dirNameEncrypt  bool
 	passBadBlocks   bool // if set passed bad blocks as zeroed blocks
 	encryptedSuffix string
+	fileFormat      FileFormat         // format to write file data in
+	keks            []keyEncryptionKey // keys for wrapping the file keys - the first is used for writing
+	passwordKEK     keyEncryptionKey   // key encryption key derived from the password
+	root            string             // path of the root - names are bound to their path from here
+}
+
+// keyEncryptionKey is used to wrap the per file secrets in file
+// format v2
+type keyEncryptionKey struct {
+	id    byte // stored in the file header to identify the key
+	block gocipher.Block
+}
+
+// newKeyEncryptionKey makes a key encryption key from the key
+// material passed in
+func newKeyEncryptionKey(key []byte) (kek keyEncryptionKey, err error) {
+	derived := deriveKey(key, "rclone crypt key encryption key")
+	id := sha256.Sum256(append([]byte("rclone crypt key id"), derived[:]...))
+	kek.id = id[0]
+	kek.block, err = aes.NewCipher(derived[:])
+	return kek, err
+}
+
+// deriveKey derives a 32 byte key from secret for the purpose in info
+func deriveKey(secret []byte, info string) (key [32]byte) {
+	_, err := io.ReadFull(hkdf.New(sha256.New, secret, nil, []byte(info)), key[:])
+	if err != nil {
+		panic(err) // can only fail if we read too much
+	}
+	return key
 }
 
 // newCipher initialises the cipher.  If salt is "" then it uses a built in salt val
@@ -191,6 +275,7 @@ func newCipher(mode NameEncryptionMode, password, salt string, dirNameEncrypt bo
 		cryptoRand:      rand.Reader,
 		dirNameEncrypt:  dirNameEncrypt,
 		encryptedSuffix: ".bin",
+		fileFormat:      FileFormatV1,
 	}
 	c.buffers.New = func() interface{} {
 		return new([blockSize]byte)
@@ -220,6 +305,67 @@ func (c *Cipher) setPassBadBlocks(passBadBlocks bool) {
 	c.passBadBlocks = passBadBlocks
 }
 
+// SetRoot sets the path of the directory that names passed to the
+// cipher are relative to.
+//
+// This is only needed in NameEncryptionAuthenticated mode where the
+// encrypted names depend on the full path of their parent.
+func (c *Cipher) SetRoot(root string) {
+	c.root = root
+}
+
+// setFileFormat sets the format new files are written in
+func (c *Cipher) setFileFormat(format FileFormat) {
+	c.fileFormat = format
+}
+
+// setKeyPasswords sets the key encryption keys used by file format v2.
+//
+// New files are keyed with keyPassword, or password if that is
+// empty. Files keyed with previousKeyPassword or password can still
+// be read.
+func (c *Cipher) setKeyPasswords(keyPassword, previousKeyPassword, salt string) error {
+	c.keks = c.keks[:0]
+	for _, password := range []string{keyPassword, previousKeyPassword} {
+		if password == "" {
+			continue
+		}
+		key, err := scryptKey(password, salt, 32)
+		if err != nil {
+			return err
+		}
+		kek, err := newKeyEncryptionKey(key)
+		if err != nil {
+			return err
+		}
+		c.keks = append(c.keks, kek)
+	}
+	if keyPassword == "" {
+		// Write with the password if no key password
+		c.keks = append([]keyEncryptionKey{c.passwordKEK}, c.keks...)
+	} else {
+		c.keks = append(c.keks, c.passwordKEK)
+	}
+	return nil
+}
+
+// scryptKey derives a key of size bytes from password and salt.
+//
+// If salt is "" we use a fixed salt.
+//
+// Note that empty password makes all 0x00 keys which is used in the
+// tests.
+func scryptKey(password, salt string, size int) ([]byte, error) {
+	var saltBytes = defaultSalt
+	if salt != "" {
+		saltBytes = []byte(salt)
+	}
+	if password == "" {
+		return make([]byte, size), nil
+	}
+	return scrypt.Key([]byte(password), saltBytes, 16384, 8, 1, size)
+}
+
 // Key creates all the internal keys from the password passed in using
 // scrypt.
 //
@@ -230,25 +376,25 @@ func (c *Cipher) setPassBadBlocks(passBadBlocks bool) {
 // tests.
 func (c *Cipher) Key(password, salt string) (err error) {
 	const keySize = len(c.dataKey) + len(c.nameKey) + len(c.nameTweak)
-	var saltBytes = defaultSalt
-	if salt != "" {
-		saltBytes = []byte(salt)
-	}
-	var key []byte
-	if password == "" {
-		key = make([]byte, keySize)
-	} else {
-		key, err = scrypt.Key([]byte(password), saltBytes, 16384, 8, 1, keySize)
-		if err != nil {
-			return err
-		}
+	key, err := scryptKey(password, salt, keySize)
+	if err != nil {
+		return err
 	}
 	copy(c.dataKey[:], key)
 	copy(c.nameKey[:], key[len(c.dataKey):])
 	copy(c.nameTweak[:], key[len(c.dataKey)+len(c.nameKey):])
 	// Key the name cipher
 	c.block, err = aes.NewCipher(c.nameKey[:])
-	return err
+	if err != nil {
+		return err
+	}
+	// Make the key encryption key for file format v2
+	c.passwordKEK, err = newKeyEncryptionKey(c.dataKey[:])
+	if err != nil {
+		return err
+	}
+	c.keks = []keyEncryptionKey{c.passwordKEK}
+	return nil
 }
 
 // getBlock gets a block from the pool of size blockSize
@@ -311,6 +457,76 @@ func (c *Cipher) decryptSegment(ciphertext string) (string, error) {
 	return string(plaintext), err
 }
 
+// authenticatedNameKeys derives the keys used to encrypt the names in
+// the directory parent in NameEncryptionAuthenticated mode
+func (c *Cipher) authenticatedNameKeys(parent string) (macKey, encKey [32]byte) {
+	macKey = deriveKey(c.nameKey[:], "rclone crypt name mac key\x00"+parent)
+	encKey = deriveKey(c.nameKey[:], "rclone crypt name encryption key\x00"+parent)
+	return macKey, encKey
+}
+
+// encryptAuthenticatedSegment encrypts a path segment in the
+// directory parent
+//
+// This uses a SIV construction with keys derived from the path of the
+// parent directory. The padded plaintext is authenticated with
+// HMAC-SHA256 and the truncated MAC is used as the IV to encrypt it
+// with AES-CTR. The output is the MAC followed by the ciphertext.
+//
+// This is deterministic, as is needed to look names up, but
+//   - the same name in different directories encrypts differently
+//   - a name moved to a different directory or altered won't decrypt
+func (c *Cipher) encryptAuthenticatedSegment(parent, plaintext string) string {
+	if plaintext == "" {
+		return ""
+	}
+	macKey, encKey := c.authenticatedNameKeys(parent)
+	paddedPlaintext := pkcs7.Pad(nameCipherBlockSize, []byte(plaintext))
+	mac := hmac.New(sha256.New, macKey[:])
+	_, _ = mac.Write(paddedPlaintext)
+	ciphertext := mac.Sum(nil)[:nameTagSize]
+	ciphertext = append(ciphertext, paddedPlaintext...)
+	block, _ := aes.NewCipher(encKey[:]) // can't fail with a 32 byte key
+	gocipher.NewCTR(block, ciphertext[:nameTagSize]).XORKeyStream(ciphertext[nameTagSize:], ciphertext[nameTagSize:])
+	return c.fileNameEnc.EncodeToString(ciphertext)
+}
+
+// decryptAuthenticatedSegment decrypts a path segment in the
+// directory parent
+func (c *Cipher) decryptAuthenticatedSegment(parent, ciphertext string) (string, error) {
+	if ciphertext == "" {
+		return "", nil
+	}
+	rawCiphertext, err := c.fileNameEnc.DecodeString(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if len(rawCiphertext) <= nameTagSize {
+		return "", ErrorTooShortAfterDecode
+	}
+	if len(rawCiphertext) > 2048 {
+		return "", ErrorTooLongAfterDecode
+	}
+	if (len(rawCiphertext)-nameTagSize)%nameCipherBlockSize != 0 {
+		return "", ErrorNotAMultipleOfBlocksize
+	}
+	macKey, encKey := c.authenticatedNameKeys(parent)
+	tag := rawCiphertext[:nameTagSize]
+	paddedPlaintext := make([]byte, len(rawCiphertext)-nameTagSize)
+	block, _ := aes.NewCipher(encKey[:]) // can't fail with a 32 byte key
+	gocipher.NewCTR(block, tag).XORKeyStream(paddedPlaintext, rawCiphertext[nameTagSize:])
+	mac := hmac.New(sha256.New, macKey[:])
+	_, _ = mac.Write(paddedPlaintext)
+	if subtle.ConstantTimeCompare(mac.Sum(nil)[:nameTagSize], tag) != 1 {
+		return "", ErrorBadNameAuthentication
+	}
+	plaintext, err := pkcs7.Unpad(nameCipherBlockSize, paddedPlaintext)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
 // Simple obfuscation routines
 func (c *Cipher) obfuscateSegment(plaintext string) string {
 	if plaintext == "" {
@@ -488,6 +704,7 @@ func (c *Cipher) deobfuscateSegment(ciphertext string) (string, error) {
 // encryptFileName encrypts a file path
 func (c *Cipher) encryptFileName(in string) string {
 	segments := strings.Split(in, "/")
+	plaintext := strings.Split(in, "/")
 	for i := range segments {
 		// Skip directory name encryption if the user chose to
 		// leave them intact
@@ -509,9 +726,13 @@ func (c *Cipher) encryptFileName(in string) string {
 			}
 		}
 
-		if c.mode == NameEncryptionStandard {
+		switch c.mode {
+		case NameEncryptionStandard:
 			segments[i] = c.encryptSegment(segments[i])
-		} else {
+		case NameEncryptionAuthenticated:
+			parent := path.Join(c.root, strings.Join(plaintext[:i], "/"))
+			segments[i] = c.encryptAuthenticatedSegment(parent, segments[i])
+		default:
 			segments[i] = c.obfuscateSegment(segments[i])
 		}
 
@@ -565,9 +786,14 @@ func (c *Cipher) decryptFileName(in string) (string, error) {
 			}
 		}
 
-		if c.mode == NameEncryptionStandard {
+		switch c.mode {
+		case NameEncryptionStandard:
 			segments[i], err = c.decryptSegment(segments[i])
-		} else {
+		case NameEncryptionAuthenticated:
+			// segments before i have been decrypted already
+			parent := path.Join(c.root, strings.Join(segments[:i], "/"))
+			segments[i], err = c.decryptAuthenticatedSegment(parent, segments[i])
+		default:
 			segments[i], err = c.deobfuscateSegment(segments[i])
 		}
 
@@ -677,11 +903,102 @@ func (n *nonce) add(x uint64) {
 	}
 }
 
+// fileHeader is the decoded header of an encrypted file.
+//
+// In file format v1 the header is the magic followed by the initial
+// nonce, and the data is encrypted with the data key derived from the
+// password.
+//
+// In file format v2 the header is the v2 magic, the id of the key
+// encryption key and a random per file secret wrapped with the key
+// encryption key. The data is encrypted with a key derived from the
+// secret and the nonce starts from 0. Changing the key encryption key
+// only needs the header to be rewritten.
+type fileHeader struct {
+	format FileFormat
+	raw    [fileHeaderSize]byte // header as stored
+	nonce  nonce                // initial nonce for the data blocks
+	key    *[32]byte            // key for the data blocks
+	kek    int                  // index of the key encryption key in Cipher.keks - v2 only
+	secret [fileSecretSize]byte // v2 only
+}
+
+// newFileHeader makes a header for a new file in the current format
+func (c *Cipher) newFileHeader() (*fileHeader, error) {
+	h := &fileHeader{format: c.fileFormat}
+	if c.fileFormat == FileFormatV2 {
+		_, err := readers.ReadFill(c.cryptoRand, h.secret[:])
+		if err != nil {
+			return nil, fmt.Errorf("short read of file secret: %w", err)
+		}
+		return h, c.wrapFileHeader(h)
+	}
+	err := h.nonce.fromReader(c.cryptoRand)
+	if err != nil {
+		return nil, err
+	}
+	h.key = &c.dataKey
+	copy(h.raw[:], fileMagicBytes)
+	copy(h.raw[fileMagicSize:], h.nonce[:])
+	return h, nil
+}
+
+// wrapFileHeader wraps the secret of the v2 header h with the current
+// key encryption key and sets the key from it
+func (c *Cipher) wrapFileHeader(h *fileHeader) error {
+	kek := c.keks[0]
+	wrapped, err := keywrap.Wrap(kek.block, h.secret[:])
+	if err != nil {
+		return err
+	}
+	h.kek = 0
+	copy(h.raw[:], fileMagicV2Bytes)
+	h.raw[fileMagicV2Size] = kek.id
+	copy(h.raw[fileMagicV2Size+1:], wrapped)
+	key := deriveKey(h.secret[:], "rclone crypt data key")
+	h.key = &key
+	return nil
+}
+
+// readFileHeader decodes the file header in buf
+func (c *Cipher) readFileHeader(buf []byte) (*fileHeader, error) {
+	h := &fileHeader{}
+	copy(h.raw[:], buf)
+	switch {
+	case bytes.Equal(buf[:fileMagicSize], fileMagicBytes):
+		h.format = FileFormatV1
+		h.nonce.fromBuf(buf[fileMagicSize:])
+		h.key = &c.dataKey
+		return h, nil
+	case bytes.Equal(buf[:fileMagicV2Size], fileMagicV2Bytes):
+		h.format = FileFormatV2
+		id := buf[fileMagicV2Size]
+		wrapped := buf[fileMagicV2Size+1 : fileMagicV2Size+1+fileWrappedSize]
+		for i, kek := range c.keks {
+			if kek.id != id {
+				continue
+			}
+			secret, err := keywrap.Unwrap(kek.block, wrapped)
+			if err != nil {
+				continue
+			}
+			h.kek = i
+			copy(h.secret[:], secret)
+			key := deriveKey(h.secret[:], "rclone crypt data key")
+			h.key = &key
+			return h, nil
+		}
+		return nil, ErrorEncryptedUnknownKey
+	}
+	return nil, ErrorEncryptedBadMagic
+}
+
 // encrypter encrypts an io.Reader on the fly
 type encrypter struct {
 	mu       sync.Mutex
 	in       io.Reader
 	c        *Cipher
+	header   *fileHeader
 	nonce    nonce
 	buf      *[blockSize]byte
 	readBuf  *[blockSize]byte
@@ -691,27 +1008,28 @@ type encrypter struct {
 }
 
 // newEncrypter creates a new file handle encrypting on the fly
-func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
+//
+// If header is nil a new one is made, otherwise the data is encrypted
+// exactly as it was for the file with that header.
+func (c *Cipher) newEncrypter(in io.Reader, header *fileHeader) (*encrypter, error) {
+	if header == nil {
+		var err error
+		header, err = c.newFileHeader()
+		if err != nil {
+			return nil, err
+		}
+	}
 	fh := &encrypter{
 		in:      in,
 		c:       c,
+		header:  header,
+		nonce:   header.nonce,
 		buf:     c.getBlock(),
 		readBuf: c.getBlock(),
 		bufSize: fileHeaderSize,
 	}
-	// Initialise nonce
-	if nonce != nil {
-		fh.nonce = *nonce
-	} else {
-		err := fh.nonce.fromReader(c.cryptoRand)
-		if err != nil {
-			return nil, err
-		}
-	}
-	// Copy magic into buffer
-	copy((*fh.buf)[:], fileMagicBytes)
-	// Copy nonce into buffer
-	copy((*fh.buf)[fileMagicSize:], fh.nonce[:])
+	// Copy header into buffer
+	copy((*fh.buf)[:], header.raw[:])
 	return fh, nil
 }
 
@@ -734,7 +1052,7 @@ func (fh *encrypter) Read(p []byte) (n int, err error) {
 		// possibly err != nil here, but we will process the
 		// data and the next call to ReadFill will return 0, err
 		// Encrypt the block using the nonce
-		secretbox.Seal((*fh.buf)[:0], readBuf[:n], fh.nonce.pointer(), &fh.c.dataKey)
+		secretbox.Seal((*fh.buf)[:0], readBuf[:n], fh.nonce.pointer(), fh.header.key)
 		fh.bufIndex = 0
 		fh.bufSize = blockHeaderSize + n
 		fh.nonce.increment()
@@ -777,6 +1095,7 @@ func (c *Cipher) EncryptData(in io.Reader) (io.Reader, error) {
 type decrypter struct {
 	mu           sync.Mutex
 	rc           io.ReadCloser
+	header       *fileHeader
 	nonce        nonce
 	initialNonce nonce
 	c            *Cipher
@@ -807,12 +1126,12 @@ func (c *Cipher) newDecrypter(rc io.ReadCloser) (*decrypter, error) {
 	} else if err != io.EOF && err != nil {
 		return nil, fh.finishAndClose(err)
 	}
-	// check the magic
-	if !bytes.Equal(readBuf[:fileMagicSize], fileMagicBytes) {
-		return nil, fh.finishAndClose(ErrorEncryptedBadMagic)
+	// check the magic and retrieve the key and nonce
+	fh.header, err = c.readFileHeader(readBuf)
+	if err != nil {
+		return nil, fh.finishAndClose(err)
 	}
-	// retrieve the nonce
-	fh.nonce.fromBuf(readBuf[fileMagicSize:])
+	fh.nonce = fh.header.nonce
 	fh.initialNonce = fh.nonce
 	return fh, nil
 }
@@ -877,7 +1196,7 @@ func (fh *decrypter) fillBuffer() (err error) {
 		return ErrorEncryptedFileBadHeader
 	}
 	// Decrypt the block using the nonce
-	_, ok := secretbox.Open((*fh.buf)[:0], (*readBuf)[:n], fh.nonce.pointer(), &fh.c.dataKey)
+	_, ok := secretbox.Open((*fh.buf)[:0], (*readBuf)[:n], fh.nonce.pointer(), fh.header.key)
 	if !ok {
 		if err != nil && err != io.EOF {
 			return err // return pending error as it is likely more accurate
@@ -27,6 +27,7 @@ func TestNewNameEncryptionMode(t *testing.T) {
 		{"off", NameEncryptionOff, ""},
 		{"standard", NameEncryptionStandard, ""},
 		{"obfuscate", NameEncryptionObfuscated, ""},
+		{"authenticated", NameEncryptionAuthenticated, ""},
 		{"potato", NameEncryptionOff, "unknown file name encryption mode \"potato\""},
 	} {
 		actual, actualErr := NewNameEncryptionMode(test.in)
@@ -43,7 +44,32 @@ func TestNewNameEncryptionModeString(t *testing.T) {
 	assert.Equal(t, NameEncryptionOff.String(), "off")
 	assert.Equal(t, NameEncryptionStandard.String(), "standard")
 	assert.Equal(t, NameEncryptionObfuscated.String(), "obfuscate")
-	assert.Equal(t, NameEncryptionMode(3).String(), "Unknown mode #3")
+	assert.Equal(t, NameEncryptionAuthenticated.String(), "authenticated")
+	assert.Equal(t, NameEncryptionMode(4).String(), "Unknown mode #4")
+}
+
+func TestNewFileFormat(t *testing.T) {
+	for _, test := range []struct {
+		in          string
+		expected    FileFormat
+		expectedErr string
+	}{
+		{"", FileFormatV1, ""},
+		{"v1", FileFormatV1, ""},
+		{"V2", FileFormatV2, ""},
+		{"potato", 0, "unknown file format \"potato\""},
+	} {
+		actual, actualErr := NewFileFormat(test.in)
+		assert.Equal(t, test.expected, actual)
+		if test.expectedErr == "" {
+			assert.NoError(t, actualErr)
+		} else {
+			assert.EqualError(t, actualErr, test.expectedErr)
+		}
+	}
+	assert.Equal(t, "v1", FileFormatV1.String())
+	assert.Equal(t, "v2", FileFormatV2.String())
+	assert.Equal(t, "Unknown file format 3", FileFormat(3).String())
 }
 
 type EncodingTestCase struct {
@@ -530,6 +556,8 @@ func TestEncDecMatches(t *testing.T) {
 			{NameEncryptionOff, "1/2/3/4"},
 			{NameEncryptionObfuscated, "1/2/3/4/!hello\u03a0"},
 			{NameEncryptionObfuscated, "Avatar The Last Airbender"},
+			{NameEncryptionAuthenticated, "1/2/3/4"},
+			{NameEncryptionAuthenticated, "Avatar The Last Airbender/Avatar The Last Airbender"},
 		} {
 			c, _ := newCipher(test.mode, "", "", true, enc)
 			out, err := c.DecryptFileName(c.EncryptFileName(test.in))
@@ -540,6 +568,71 @@ func TestEncDecMatches(t *testing.T) {
 	}
 }
 
+func TestAuthenticatedEncryptFileName(t *testing.T) {
+	for _, test := range []struct {
+		encoding string
+		in       string
+		expected string
+	}{
+		{"base32", "1", "e6sdbhntp05vkn8r0cvcsuuqhbu2uuv2gtlclnhqnb7v94v5rlm0"},
+		{"base32", "1/1", "e6sdbhntp05vkn8r0cvcsuuqhbu2uuv2gtlclnhqnb7v94v5rlm0/n67nnqdn7l5ovk05bcqic2v5h27jf9ie046tu1tjtk8cl9hh83ag"},
+		{"base32", "2/1", "02hfkksthughr6ddebl14ceho2kqo0hr6k43god8fncqq3h5dnmg/n4d2v2imeug27i0kqag6rg5vh5hqj8vr646vbjv7mgpo5pnp418g"},
+		{"base32", "1/12/123-v2001-02-03-040506-123.txt", "e6sdbhntp05vkn8r0cvcsuuqhbu2uuv2gtlclnhqnb7v94v5rlm0/ls6n1j48adrku8bsr05mvuuc0di0ntctcvjr0fga0ktdml0s8fmg/hq99qalm5agdu1m5qirat2cva7qlte1434mq1kq37k341f7bqpe0-v2001-02-03-040506-123"},
+		{"base64", "1/12", "cbjVxv3IC_pdGwM-znvaivwve-KHasreOrrP9JPl3Ww/rw1wzIhTd08hfNgLb_vMA2QL9Z1n57A-CgU621QcQ-0"},
+		{"base32768", "1/12", "弼寑蘙ޟ祈鉬ꐼꉺ毞⩞ꋰ鴌絑酋䘩㨥锖ɟ/緦芓㝊巔齫駀㴟ꉬᇲᑽ娌ꕻሰ乴鰖穼䠶ʟ"},
+	} {
+		enc, _ := NewNameEncoding(test.encoding)
+		c, _ := newCipher(NameEncryptionAuthenticated, "", "", true, enc)
+		assert.Equal(t, test.expected, c.EncryptFileName(test.in), test.in)
+		actual, err := c.DecryptFileName(test.expected)
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.in, actual)
+	}
+}
+
+func TestAuthenticatedFileNameBinding(t *testing.T) {
+	enc, _ := NewNameEncoding("base32")
+	c, _ := newCipher(NameEncryptionAuthenticated, "", "", true, enc)
+
+	// The same name in different directories encrypts differently
+	a := strings.Split(c.EncryptFileName("a/file"), "/")
+	b := strings.Split(c.EncryptFileName("b/file"), "/")
+	assert.NotEqual(t, a[1], b[1])
+
+	// Moving the encrypted name to a different directory is detected
+	_, err := c.DecryptFileName(b[0] + "/" + a[1])
+	assert.Equal(t, ErrorBadNameAuthentication, err)
+
+	// As is changing it
+	changed := []byte(a[1])
+	changed[len(changed)-1] ^= 1
+	_, err = c.DecryptFileName(a[0] + "/" + string(changed))
+	assert.Error(t, err)
+
+	// Too short to have a tag
+	_, err = c.DecryptFileName(c.fileNameEnc.EncodeToString(make([]byte, nameTagSize)))
+	assert.Equal(t, ErrorTooShortAfterDecode, err)
+	_, err = c.DecryptFileName(c.fileNameEnc.EncodeToString(make([]byte, nameTagSize+15)))
+	assert.Equal(t, ErrorNotAMultipleOfBlocksize, err)
+
+	// Names are bound to their path from the root
+	c.SetRoot("a")
+	assert.Equal(t, a[1], c.EncryptFileName("file"))
+	name, err := c.DecryptFileName(a[1])
+	require.NoError(t, err)
+	assert.Equal(t, "file", name)
+	_, err = c.DecryptFileName(b[1])
+	assert.Equal(t, ErrorBadNameAuthentication, err)
+
+	// Directory names left intact still bind the file names
+	c, _ = newCipher(NameEncryptionAuthenticated, "", "", false, enc)
+	a = strings.Split(c.EncryptFileName("a/file"), "/")
+	assert.Equal(t, "a", a[0])
+	_, err = c.DecryptFileName("b/" + a[1])
+	assert.Equal(t, ErrorBadNameAuthentication, err)
+	assert.Equal(t, "a", c.EncryptDirName("a"))
+}
+
 func testStandardEncryptDirName(t *testing.T, encoding string, testCases []EncodingTestCase) {
 	enc, _ := NewNameEncoding(encoding)
 	c, _ := newCipher(NameEncryptionStandard, "", "", true, enc)
@@ -1643,3 +1736,138 @@ func TestKey(t *testing.T) {
 	assert.Equal(t, [32]byte{}, c.nameKey)
 	assert.Equal(t, [16]byte{}, c.nameTweak)
 }
+
+// encryptString encrypts in with c returning the encrypted data and
+// the header used
+func encryptString(t *testing.T, c *Cipher, in string) ([]byte, *fileHeader) {
+	fh, err := c.newEncrypter(bytes.NewBufferString(in), nil)
+	require.NoError(t, err)
+	out, err := io.ReadAll(fh)
+	require.NoError(t, err)
+	return out, fh.header
+}
+
+// decryptBytes decrypts in with c
+func decryptBytes(c *Cipher, in []byte) (string, error) {
+	fh, err := c.newDecrypter(io.NopCloser(bytes.NewBuffer(in)))
+	if err != nil {
+		return "", err
+	}
+	out, err := io.ReadAll(fh)
+	return string(out), err
+}
+
+func TestFileFormatV2(t *testing.T) {
+	const plaintext = "Hello, World!"
+	c, err := newCipher(NameEncryptionStandard, "potato", "", true, nil)
+	require.NoError(t, err)
+	c.setFileFormat(FileFormatV2)
+
+	// Round trip
+	encrypted, header := encryptString(t, c, plaintext)
+	assert.Equal(t, FileFormatV2, header.format)
+	assert.Equal(t, c.EncryptedSize(int64(len(plaintext))), int64(len(encrypted)))
+	assert.Equal(t, fileMagicV2, string(encrypted[:fileMagicV2Size]))
+	assert.Equal(t, c.passwordKEK.id, encrypted[fileMagicV2Size])
+	assert.Equal(t, nonce{}, header.nonce)
+	assert.NotEqual(t, c.dataKey, *header.key)
+	decrypted, err := decryptBytes(c, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	// Each file has a different key
+	encrypted2, header2 := encryptString(t, c, plaintext)
+	assert.NotEqual(t, *header.key, *header2.key)
+	assert.NotEqual(t, encrypted, encrypted2)
+
+	// Re-encrypting with the header gives the same data
+	fh, err := c.newEncrypter(bytes.NewBufferString(plaintext), header)
+	require.NoError(t, err)
+	again, err := io.ReadAll(fh)
+	require.NoError(t, err)
+	assert.Equal(t, encrypted, again)
+
+	// v1 files can still be read
+	c.setFileFormat(FileFormatV1)
+	encryptedV1, headerV1 := encryptString(t, c, plaintext)
+	assert.Equal(t, FileFormatV1, headerV1.format)
+	assert.Equal(t, len(encrypted), len(encryptedV1))
+	c.setFileFormat(FileFormatV2)
+	decrypted, err = decryptBytes(c, encryptedV1)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	// Corrupt the wrapped key
+	corrupted := bytes.Clone(encrypted)
+	corrupted[fileHeaderSize-1] ^= 1
+	_, err = decryptBytes(c, corrupted)
+	assert.Equal(t, ErrorEncryptedUnknownKey, err)
+
+	// A different password can't read it
+	other, err := newCipher(NameEncryptionStandard, "sausage", "", true, nil)
+	require.NoError(t, err)
+	_, err = decryptBytes(other, encrypted)
+	assert.Equal(t, ErrorEncryptedUnknownKey, err)
+}
+
+func TestFileFormatV2KeyPasswords(t *testing.T) {
+	const plaintext = "Hello, World!"
+	newV2Cipher := func(keyPassword, previousKeyPassword string) *Cipher {
+		c, err := newCipher(NameEncryptionStandard, "potato", "", true, nil)
+		require.NoError(t, err)
+		c.setFileFormat(FileFormatV2)
+		require.NoError(t, c.setKeyPasswords(keyPassword, previousKeyPassword, ""))
+		return c
+	}
+	password := newV2Cipher("", "")
+	old := newV2Cipher("old", "")
+	current := newV2Cipher("new", "old")
+	other := newV2Cipher("new", "")
+
+	encryptedPassword, _ := encryptString(t, password, plaintext)
+	encryptedOld, _ := encryptString(t, old, plaintext)
+	encryptedCurrent, _ := encryptString(t, current, plaintext)
+
+	for _, test := range []struct {
+		name      string
+		c         *Cipher
+		encrypted []byte
+		kek       int
+		err       error
+	}{
+		{"password/password", password, encryptedPassword, 0, nil},
+		{"password/old", password, encryptedOld, 0, ErrorEncryptedUnknownKey},
+		{"old/password", old, encryptedPassword, 1, nil},
+		{"old/old", old, encryptedOld, 0, nil},
+		{"current/password", current, encryptedPassword, 2, nil},
+		{"current/old", current, encryptedOld, 1, nil},
+		{"current/current", current, encryptedCurrent, 0, nil},
+		{"other/old", other, encryptedOld, 0, ErrorEncryptedUnknownKey},
+		{"other/current", other, encryptedCurrent, 0, nil},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			header, err := test.c.readFileHeader(test.encrypted)
+			assert.Equal(t, test.err, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, test.kek, header.kek)
+			decrypted, err := decryptBytes(test.c, test.encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, decrypted)
+		})
+	}
+
+	// Rewrapping the header with the current key keeps the data
+	header, err := current.readFileHeader(encryptedOld)
+	require.NoError(t, err)
+	require.NoError(t, current.wrapFileHeader(header))
+	rewrapped := append(header.raw[:], encryptedOld[fileHeaderSize:]...)
+	assert.Equal(t, encryptedOld[fileHeaderSize:], rewrapped[fileHeaderSize:])
+	assert.NotEqual(t, encryptedOld[:fileHeaderSize], rewrapped[:fileHeaderSize])
+	_, err = old.readFileHeader(rewrapped)
+	assert.Equal(t, ErrorEncryptedUnknownKey, err)
+	decrypted, err := decryptBytes(other, rewrapped)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"io"
 	"path"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rclone/rclone/fs"
@@ -18,6 +20,8 @@ import (
 	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/fspath"
 	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
 )
 
 // Globals
@@ -49,6 +53,9 @@ func init() {
 				}, {
 					Value: "off",
 					Help:  "Don't encrypt the file names.\nAdds a \".bin\", or \"suffix\" extension only.",
+				}, {
+					Value: "authenticated",
+					Help:  "Encrypt and authenticate the filenames bound to their directory.\nSee the docs for the details.",
 				},
 			},
 		}, {
@@ -171,6 +178,46 @@ Setting suffix to "none" will result in an empty suffix. This may be useful
 when the path length is critical.`,
 			Default:  ".bin",
 			Advanced: true,
+		}, {
+			Name: "file_format",
+			Help: `Format to encrypt the file data in.
+
+Files in either format can always be read, this only controls how new
+files are written. See the rekey command for converting existing files.`,
+			Default: "v1",
+			Examples: []fs.OptionExample{
+				{
+					Value: "v1",
+					Help:  "Encrypt the data with a key derived from password.",
+				},
+				{
+					Value: "v2",
+					Help:  "Encrypt the data with a random key per file.\nThe key is encrypted with key_password in the file header so key_password can be changed.",
+				},
+			},
+			Advanced: true,
+		}, {
+			Name: "key_password",
+			Help: `Password or pass phrase for the file keys in file format v2.
+
+The random key of each file is encrypted with this and stored in the
+file header. If not set the key is encrypted with password.
+
+This can be changed without re-encrypting the data. Put the old value
+in previous_key_password then run the rekey command to rewrite the
+file headers.`,
+			IsPassword: true,
+			Advanced:   true,
+		}, {
+			Name: "previous_key_password",
+			Help: `Previous key_password.
+
+Set this to the old key_password when changing key_password so that
+files not yet rewritten by the rekey command can still be read.
+
+Files keyed with password can always be read.`,
+			IsPassword: true,
+			Advanced:   true,
 		}},
 	})
 }
@@ -205,6 +252,28 @@ func newCipherForConfig(opt *Options) (*Cipher, error) {
 	}
 	cipher.setEncryptedSuffix(opt.Suffix)
 	cipher.setPassBadBlocks(opt.PassBadBlocks)
+	format, err := NewFileFormat(opt.FileFormat)
+	if err != nil {
+		return nil, err
+	}
+	cipher.setFileFormat(format)
+	var keyPassword, previousKeyPassword string
+	if opt.KeyPassword != "" {
+		keyPassword, err = obscure.Reveal(opt.KeyPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt key_password: %w", err)
+		}
+	}
+	if opt.PreviousKeyPassword != "" {
+		previousKeyPassword, err = obscure.Reveal(opt.PreviousKeyPassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt previous_key_password: %w", err)
+		}
+	}
+	err = cipher.setKeyPasswords(keyPassword, previousKeyPassword, salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make key encryption keys: %w", err)
+	}
 	return cipher, nil
 }
 
@@ -270,6 +339,7 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 			f.root = ""
 		}
 	}
+	cipher.SetRoot(f.root)
 	// the features here are ones we could support, and they are
 	// ANDed with the ones from wrappedFs
 	f.features = (&fs.Features{
@@ -293,6 +363,14 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 		PartialUploads:           true,
 	}).Fill(ctx, f).Mask(ctx, wrappedFs).WrapsFs(f, wrappedFs)
 
+	// In authenticated mode DirMove moves each file with Move
+	if cipher.mode == NameEncryptionAuthenticated {
+		f.features.DirMove = nil
+		if wrappedFs.Features().Move != nil {
+			f.features.DirMove = f.DirMove
+		}
+	}
+
 	return f, err
 }
 
@@ -310,6 +388,9 @@ type Options struct {
 	FilenameEncoding        string `config:"filename_encoding"`
 	Suffix                  string `config:"suffix"`
 	StrictNames             bool   `config:"strict_names"`
+	FileFormat              string `config:"file_format"`
+	KeyPassword             string `config:"key_password"`
+	PreviousKeyPassword     string `config:"previous_key_password"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -449,6 +530,24 @@ func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (
 	})
 }
 
+// ListP lists the objects and directories of the Fs in dir calling
+// callback with each tranche of entries read.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) ListP(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	return f.Fs.Features().ListP(ctx, f.cipher.EncryptDirName(dir), func(entries fs.DirEntries) error {
+		newEntries, err := f.encryptEntries(ctx, entries)
+		if err != nil {
+			return err
+		}
+		return callback(newEntries)
+	})
+}
+
 // NewObject finds the Object at remote.
 func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
 	o, err := f.Fs.NewObject(ctx, f.cipher.EncryptFileName(remote))
@@ -465,7 +564,7 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 	ci := fs.GetConfig(ctx)
 
 	if f.opt.NoDataEncryption {
-		o, err := put(ctx, in, f.newObjectInfo(src, nonce{}), options...)
+		o, err := put(ctx, in, f.newObjectInfo(src, nil), options...)
 		if err == nil && o != nil {
 			o = f.newObject(o)
 		}
@@ -500,7 +599,7 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 	}
 
 	// Transfer the data
-	o, err := put(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce), options...)
+	o, err := put(ctx, wrappedIn, f.newObjectInfo(src, encrypter.header), options...)
 	if err != nil {
 		return nil, err
 	}
@@ -658,7 +757,8 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 }
 
 // DirMove moves src, srcRemote to this remote at dstRemote
-// using server-side move operations.
+// using server-side move operations. In authenticated mode this
+// isn't atomic, see dirMoveAuthenticated.
 //
 // Will only be called if src.Fs().Name() == f.Name()
 //
@@ -666,6 +766,9 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 //
 // If destination exists then return fs.ErrorDirExists
 func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	if f.cipher.mode == NameEncryptionAuthenticated {
+		return f.dirMoveAuthenticated(ctx, src, srcRemote, dstRemote)
+	}
 	do := f.Fs.Features().DirMove
 	if do == nil {
 		return fs.ErrorCantDirMove
@@ -678,6 +781,144 @@ func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string
 	return do(ctx, srcFs.Fs, f.cipher.EncryptDirName(srcRemote), f.cipher.EncryptDirName(dstRemote))
 }
 
+// DirMoveError is returned by DirMove in authenticated mode if the
+// directory was only partly moved.
+//
+// Files which hadn't been listed when the move stopped are in
+// neither list and are still in the source.
+type DirMoveError struct {
+	Moved   []string // files moved, as paths in the destination
+	Unmoved []string // files not moved, as paths in the source
+	Err     error    // the error which stopped the move
+}
+
+// Error satisfies the error interface
+func (e *DirMoveError) Error() string {
+	return fmt.Sprintf("directory move incomplete - moved %d files, failed to move %d: %v", len(e.Moved), len(e.Unmoved), e.Err)
+}
+
+// Unwrap returns the error which stopped the move
+func (e *DirMoveError) Unwrap() error {
+	return e.Err
+}
+
+// dirMoveAuthenticated moves src, srcRemote to dstRemote using a
+// server-side Move for each file.
+//
+// In authenticated mode the encrypted names of everything in a
+// directory depend on its path, so the directory can't be renamed on
+// the underlying remote in one go.
+//
+// This is NOT atomic. If it fails part way through some files will
+// be in dstRemote and the rest still in srcRemote. A *DirMoveError
+// listing the files which were and weren't moved is returned, and the
+// files not moved are logged, so the move can be finished by running
+// it again.
+func (f *Fs) dirMoveAuthenticated(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	do := f.Fs.Features().Move
+	if do == nil {
+		return fs.ErrorCantDirMove
+	}
+	srcFs, ok := src.(*Fs)
+	if !ok {
+		fs.Debugf(src, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	_, err := f.Fs.List(ctx, f.cipher.EncryptDirName(dstRemote))
+	if err == nil {
+		return fs.ErrorDirExists
+	} else if !errors.Is(err, fs.ErrorDirNotFound) {
+		return err
+	}
+	err = f.Mkdir(ctx, dstRemote)
+	if err != nil {
+		return err
+	}
+	dstPath := func(remote string) string {
+		if srcRemote == "" {
+			return path.Join(dstRemote, remote)
+		}
+		return path.Join(dstRemote, strings.TrimPrefix(remote, srcRemote+"/"))
+	}
+	var (
+		dirs    []string
+		mu      sync.Mutex // protects moved and unmoved
+		moved   []string
+		unmoved []string
+	)
+	// leave records the files in entries as not moved
+	leave := func(entries fs.DirEntries) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, entry := range entries {
+			if o, ok := entry.(fs.Object); ok {
+				unmoved = append(unmoved, o.Remote())
+			}
+		}
+	}
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Transfers)
+	err = walk.ListR(gCtx, srcFs, srcRemote, true, -1, walk.ListAll, func(entries fs.DirEntries) error {
+		for i, entry := range entries {
+			if err := gCtx.Err(); err != nil {
+				leave(entries[i:])
+				return err
+			}
+			switch x := entry.(type) {
+			case fs.Directory:
+				dirs = append(dirs, x.Remote())
+				err := f.Mkdir(gCtx, dstPath(x.Remote()))
+				if err != nil {
+					leave(entries[i:])
+					return err
+				}
+			case *Object:
+				g.Go(func() error {
+					dst := dstPath(x.Remote())
+					_, err := do(gCtx, x.Object, f.cipher.EncryptFileName(dst))
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						unmoved = append(unmoved, x.Remote())
+						return fmt.Errorf("failed to move %q: %w", x.Remote(), err)
+					}
+					moved = append(moved, dst)
+					return nil
+				})
+			}
+		}
+		return nil
+	})
+	waitErr := g.Wait()
+	if err == nil {
+		err = waitErr
+	}
+	if err != nil {
+		sort.Strings(moved)
+		sort.Strings(unmoved)
+		for _, remote := range unmoved {
+			fs.Errorf(remote, "Not moved to %q", dstRemote)
+		}
+		return &DirMoveError{
+			Moved:   moved,
+			Unmoved: unmoved,
+			Err:     err,
+		}
+	}
+	// Remove the source directories, deepest first
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], "/") > strings.Count(dirs[j], "/")
+	})
+	dirs = append(dirs, srcRemote)
+	for _, dir := range dirs {
+		err = srcFs.Rmdir(ctx, dir)
+		if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+			return fmt.Errorf("failed to remove source directory %q: %w", dir, err)
+		}
+	}
+	return nil
+}
+
 // PutUnchecked uploads the object
 //
 // This will create a duplicate if we upload a new file without
@@ -691,7 +932,7 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 	if err != nil {
 		return nil, err
 	}
-	o, err := do(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce))
+	o, err := do(ctx, wrappedIn, f.newObjectInfo(src, encrypter.header))
 	if err != nil {
 		return nil, err
 	}
@@ -744,11 +985,12 @@ func (f *Fs) DecryptFileName(encryptedFileName string) (string, error) {
 	return f.cipher.DecryptFileName(encryptedFileName)
 }
 
-// computeHashWithNonce takes the nonce and encrypts the contents of
-// src with it, and calculates the hash given by HashType on the fly
+// computeHashWithHeader takes the file header and encrypts the
+// contents of src with it, and calculates the hash given by HashType
+// on the fly
 //
 // Note that we break lots of encapsulation in this function.
-func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Object, hashType hash.Type) (hashStr string, err error) {
+func (f *Fs) computeHashWithHeader(ctx context.Context, header *fileHeader, src fs.Object, hashType hash.Type) (hashStr string, err error) {
 	// Open the src for input
 	in, err := src.Open(ctx)
 	if err != nil {
@@ -756,8 +998,8 @@ func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Objec
 	}
 	defer fs.CheckClose(in, &err)
 
-	// Now encrypt the src with the nonce
-	out, err := f.cipher.newEncrypter(in, &nonce)
+	// Now encrypt the src with the header
+	out, err := f.cipher.newEncrypter(in, header)
 	if err != nil {
 		return "", fmt.Errorf("failed to make encrypter: %w", err)
 	}
@@ -775,7 +1017,7 @@ func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Objec
 	return m.Sums()[hashType], nil
 }
 
-// ComputeHash takes the nonce from o, and encrypts the contents of
+// ComputeHash takes the header from o, and encrypts the contents of
 // src with it, and calculates the hash given by HashType on the fly
 //
 // Note that we break lots of encapsulation in this function.
@@ -795,17 +1037,19 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 		_ = in.Close()
 		return "", fmt.Errorf("failed to open object to read nonce: %w", err)
 	}
-	nonce := d.nonce
+	header := d.header
+	nonce := header.nonce
 	// fs.Debugf(o, "Read nonce % 2x", nonce)
 
-	// Check nonce isn't all zeros
+	// Check nonce isn't all zeros - the nonce always starts from
+	// zero in file format v2
 	isZero := true
 	for i := range nonce {
 		if nonce[i] != 0 {
 			isZero = false
 		}
 	}
-	if isZero {
+	if isZero && header.format == FileFormatV1 {
 		fs.Errorf(o, "empty nonce read")
 	}
 
@@ -815,7 +1059,7 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 		return "", fmt.Errorf("failed to close nonce read: %w", err)
 	}
 
-	return f.computeHashWithNonce(ctx, nonce, src, hashType)
+	return f.computeHashWithHeader(ctx, header, src, hashType)
 }
 
 // MergeDirs merges the contents of all the directories passed
@@ -911,6 +1155,35 @@ Usage Example:
 
     rclone backend decode crypt: encryptedfile1 [encryptedfile2...]
     rclone rc backend/command command=decode fs=crypt: encryptedfile1 [encryptedfile2...]
+`,
+	},
+	{
+		Name:  "rekey",
+		Short: "Rewrite files so they are keyed with the current key_password",
+		Long: `This makes sure every file under the path is in file_format v2 and
+keyed with the current key_password. It needs file_format to be set to
+v2.
+
+Files in format v2 keyed with previous_key_password or password only
+need their headers rewriting. This is done in place if the underlying
+remote supports it (e.g. local), otherwise the file is uploaded again
+but the data isn't re-encrypted. Files in format v1 are decrypted and
+encrypted again.
+
+Rewritten files are uploaded to a temporary name first, then moved
+over the original, so an interrupted rekey never loses data. Files
+already keyed with the current key are skipped, so run the command
+again to resume an interrupted rekey. Use --dry-run to see what would
+be done and --transfers to control how many files are done at once.
+
+Usage Example:
+
+    rclone backend rekey crypt:
+    rclone backend rekey crypt:path/to/dir
+    rclone rc backend/command command=rekey fs=crypt:
+
+It returns a count of the files unchanged, rewrapped in place,
+rewritten and re-encrypted.
 `,
 	},
 }
@@ -943,6 +1216,11 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			out = append(out, encryptedFileName)
 		}
 		return out, nil
+	case "rekey":
+		if len(arg) != 0 {
+			return nil, errors.New("rekey takes no arguments - put the path in the remote")
+		}
+		return f.rekey(ctx, "")
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -1107,15 +1385,15 @@ func (f *Fs) Shutdown(ctx context.Context) error {
 // This encrypts the remote name and adjusts the size
 type ObjectInfo struct {
 	fs.ObjectInfo
-	f     *Fs
-	nonce nonce
+	f      *Fs
+	header *fileHeader
 }
 
-func (f *Fs) newObjectInfo(src fs.ObjectInfo, nonce nonce) *ObjectInfo {
+func (f *Fs) newObjectInfo(src fs.ObjectInfo, header *fileHeader) *ObjectInfo {
 	return &ObjectInfo{
 		ObjectInfo: src,
 		f:          f,
-		nonce:      nonce,
+		header:     header,
 	}
 }
 
@@ -1160,7 +1438,7 @@ func (o *ObjectInfo) Hash(ctx context.Context, hash hash.Type) (string, error) {
 	if srcObj.Fs().Features().IsLocal {
 		// Read the data and encrypt it to calculate the hash
 		fs.Debugf(o, "Computing %v hash of encrypted source", hash)
-		return o.f.computeHashWithNonce(ctx, o.nonce, srcObj, hash)
+		return o.f.computeHashWithHeader(ctx, o.header, srcObj, hash)
 	}
 	return "", nil
 }
@@ -1281,6 +1559,7 @@ var (
 	_ fs.CleanUpper      = (*Fs)(nil)
 	_ fs.UnWrapper       = (*Fs)(nil)
 	_ fs.ListRer         = (*Fs)(nil)
+	_ fs.ListPer         = (*Fs)(nil)
 	_ fs.Abouter         = (*Fs)(nil)
 	_ fs.Wrapper         = (*Fs)(nil)
 	_ fs.MergeDirser     = (*Fs)(nil)
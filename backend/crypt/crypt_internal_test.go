@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/lib/random"
@@ -61,7 +63,7 @@ func testObjectInfo(t *testing.T, f *Fs, wrap bool) {
 	var outBuf bytes.Buffer
 	enc, err := f.cipher.newEncrypter(inBuf, nil)
 	require.NoError(t, err)
-	nonce := enc.nonce // read the nonce at the start
+	header := enc.header // read the header at the start
 	_, err = io.Copy(&outBuf, enc)
 	require.NoError(t, err)
 
@@ -71,9 +73,9 @@ func testObjectInfo(t *testing.T, f *Fs, wrap bool) {
 		oi = fs.NewOverrideRemote(oi, "new_remote")
 	}
 
-	// wrap the object in a crypt for upload using the nonce we
+	// wrap the object in a crypt for upload using the header we
 	// saved from the encrypter
-	src := f.newObjectInfo(oi, nonce)
+	src := f.newObjectInfo(oi, header)
 
 	// Test ObjectInfo methods
 	if !f.opt.NoDataEncryption {
@@ -125,3 +127,38 @@ func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("ObjectInfoWrap", func(t *testing.T) { testObjectInfo(t, f, true) })
 	t.Run("ComputeHash", func(t *testing.T) { testComputeHash(t, f) })
 }
+
+// Test an authenticated DirMove which stops before it is finished
+func TestDirMoveAuthenticatedIncomplete(t *testing.T) {
+	m := configmap.Simple{
+		"remote":                    t.TempDir(),
+		"password":                  obscure.MustObscure("potato"),
+		"filename_encryption":       "authenticated",
+		"directory_name_encryption": "true",
+		"filename_encoding":         "base32",
+		"suffix":                    ".bin",
+	}
+	fi, err := NewFs(context.Background(), "authenticated", "", m)
+	require.NoError(t, err)
+	f := fi.(*Fs)
+	for _, remote := range []string{"src/file1", "src/file2"} {
+		src := object.NewStaticObjectInfo(remote, time.Now(), 4, true, nil, nil)
+		_, err = f.Put(context.Background(), bytes.NewBufferString("data"), src)
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = f.DirMove(ctx, f, "src", "dst")
+	var moveErr *DirMoveError
+	require.ErrorAs(t, err, &moveErr)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, moveErr.Moved)
+	assert.Equal(t, []string{"src/file1", "src/file2"}, moveErr.Unmoved)
+
+	// The files not moved are still in the source
+	for _, remote := range moveErr.Unmoved {
+		_, err = f.NewObject(context.Background(), remote)
+		assert.NoError(t, err)
+	}
+}
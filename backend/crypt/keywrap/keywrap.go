@@ -0,0 +1,77 @@
+// Package keywrap implements the AES Key Wrap algorithm from RFC 3394
+//
+// This is a standard way of encrypting a key with a key encryption
+// key. It needs no nonce and the wrapped key is authenticated, so it
+// is ideal for storing small keys in file headers.
+package keywrap
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+// Errors Wrap and Unwrap can return
+var (
+	ErrorBadLength = errors.New("key wrap: key must be a multiple of 8 bytes and at least 16 bytes")
+	ErrorUnwrap    = errors.New("key wrap: failed to unwrap key - wrong key encryption key?")
+)
+
+// defaultIV is the initial value from RFC 3394 section 2.2.3.1
+var defaultIV = [8]byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6}
+
+// Wrap encrypts key with the key encryption key in block.
+//
+// block must be an AES cipher. The result is 8 bytes longer than
+// key.
+func Wrap(block cipher.Block, key []byte) ([]byte, error) {
+	if len(key)%8 != 0 || len(key) < 16 {
+		return nil, ErrorBadLength
+	}
+	n := len(key) / 8
+	out := make([]byte, len(key)+8)
+	copy(out, defaultIV[:])
+	copy(out[8:], key)
+	var b [16]byte
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b[:8], out[:8])
+			copy(b[8:], out[i*8:i*8+8])
+			block.Encrypt(b[:], b[:])
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(out[:8], binary.BigEndian.Uint64(b[:8])^t)
+			copy(out[i*8:], b[8:])
+		}
+	}
+	return out, nil
+}
+
+// Unwrap decrypts the wrapped key with the key encryption key in
+// block, checking its integrity.
+//
+// block must be an AES cipher. The result is 8 bytes shorter than
+// wrapped.
+func Unwrap(block cipher.Block, wrapped []byte) ([]byte, error) {
+	if len(wrapped)%8 != 0 || len(wrapped) < 24 {
+		return nil, ErrorBadLength
+	}
+	n := len(wrapped)/8 - 1
+	out := make([]byte, len(wrapped))
+	copy(out, wrapped)
+	var b [16]byte
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(out[:8])^t)
+			copy(b[8:], out[i*8:i*8+8])
+			block.Decrypt(b[:], b[:])
+			copy(out[:8], b[:8])
+			copy(out[i*8:], b[8:])
+		}
+	}
+	if subtle.ConstantTimeCompare(out[:8], defaultIV[:]) != 1 {
+		return nil, ErrorUnwrap
+	}
+	return out[8:], nil
+}
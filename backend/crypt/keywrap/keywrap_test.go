@@ -0,0 +1,76 @@
+package keywrap
+
+import (
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+// Test vectors from RFC 3394 section 4
+func TestWrapUnwrap(t *testing.T) {
+	for _, test := range []struct {
+		kek     string
+		key     string
+		wrapped string
+	}{
+		{
+			kek:     "000102030405060708090A0B0C0D0E0F",
+			key:     "00112233445566778899AABBCCDDEEFF",
+			wrapped: "1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5",
+		},
+		{
+			kek:     "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+			key:     "00112233445566778899AABBCCDDEEFF",
+			wrapped: "64E8C3F9CE0F5BA263E9777905818A2A93C8191E7D6E8AE7",
+		},
+		{
+			kek:     "000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F",
+			key:     "00112233445566778899AABBCCDDEEFF000102030405060708090A0B0C0D0E0F",
+			wrapped: "28C9F404C4B810F4CBCCB35CFB87F8263F5786E2D80ED326CBC7F0E71A99F43BFB988B9B7A02DD21",
+		},
+	} {
+		block, err := aes.NewCipher(unhex(t, test.kek))
+		require.NoError(t, err)
+		wrapped, err := Wrap(block, unhex(t, test.key))
+		require.NoError(t, err)
+		assert.Equal(t, unhex(t, test.wrapped), wrapped)
+		key, err := Unwrap(block, wrapped)
+		require.NoError(t, err)
+		assert.Equal(t, unhex(t, test.key), key)
+
+		// Corrupt the wrapped key
+		wrapped[3] ^= 1
+		_, err = Unwrap(block, wrapped)
+		assert.Equal(t, ErrorUnwrap, err)
+	}
+}
+
+func TestWrapErrors(t *testing.T) {
+	block, err := aes.NewCipher(make([]byte, 32))
+	require.NoError(t, err)
+	_, err = Wrap(block, make([]byte, 8))
+	assert.Equal(t, ErrorBadLength, err)
+	_, err = Wrap(block, make([]byte, 17))
+	assert.Equal(t, ErrorBadLength, err)
+	_, err = Unwrap(block, make([]byte, 16))
+	assert.Equal(t, ErrorBadLength, err)
+	_, err = Unwrap(block, make([]byte, 25))
+	assert.Equal(t, ErrorBadLength, err)
+
+	// Wrong key encryption key
+	wrapped, err := Wrap(block, make([]byte, 16))
+	require.NoError(t, err)
+	other, err := aes.NewCipher(make([]byte, 16))
+	require.NoError(t, err)
+	_, err = Unwrap(other, wrapped)
+	assert.Equal(t, ErrorUnwrap, err)
+}
@@ -0,0 +1,271 @@
+package crypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/readers"
+	"golang.org/x/sync/errgroup"
+)
+
+// rekeyTempSuffix is added to the encrypted name of files being
+// rewritten by rekey. It makes the name undecryptable so the
+// temporary file doesn't show up in listings.
+const rekeyTempSuffix = ".rclone-rekey"
+
+// rekeyStats counts what rekey did
+type rekeyStats struct {
+	mu          sync.Mutex
+	Unchanged   int64 `json:"unchanged"`   // already keyed with the current key
+	Rewrapped   int64 `json:"rewrapped"`   // header rewritten in place
+	Rewritten   int64 `json:"rewritten"`   // header rewritten by uploading the file again
+	Reencrypted int64 `json:"reencrypted"` // data decrypted and encrypted again
+}
+
+func (s *rekeyStats) add(p *int64) {
+	s.mu.Lock()
+	*p++
+	s.mu.Unlock()
+}
+
+// rekey makes sure every file under dir is in file format v2 keyed
+// with the current key_password.
+//
+// Files in format v2 with an old key only need their header
+// rewritten. This is done in place if the underlying object can
+// write ranges, otherwise the file is uploaded again without
+// re-encrypting it. Files in format v1 are re-encrypted.
+//
+// Files already keyed with the current key are skipped so an
+// interrupted rekey can be resumed by running it again.
+func (f *Fs) rekey(ctx context.Context, dir string) (*rekeyStats, error) {
+	if f.opt.NoDataEncryption {
+		return nil, errors.New("can't rekey with no_data_encryption set")
+	}
+	if f.cipher.fileFormat != FileFormatV2 {
+		return nil, errors.New("rekey needs file_format = v2")
+	}
+	ci := fs.GetConfig(ctx)
+	err := f.rekeyCleanUp(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	stats := new(rekeyStats)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(ci.Transfers)
+	err = walk.ListR(ctx, f, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		var err error
+		entries.ForObject(func(obj fs.Object) {
+			o, ok := obj.(*Object)
+			if !ok || err != nil {
+				return
+			}
+			err = gCtx.Err()
+			g.Go(func() error {
+				rekeyErr := f.rekeyObject(gCtx, o, stats)
+				if rekeyErr != nil {
+					fs.Errorf(o, "Failed to rekey: %v", rekeyErr)
+					accounting.Stats(gCtx).Error(rekeyErr)
+					return rekeyErr
+				}
+				return nil
+			})
+		})
+		return err
+	})
+	waitErr := g.Wait()
+	if err == nil {
+		err = waitErr
+	}
+	return stats, err
+}
+
+// readHeader reads and decodes the header of the underlying object
+func (f *Fs) readHeader(ctx context.Context, o *Object) (*fileHeader, error) {
+	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(fileHeaderSize) - 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object to read header: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	buf := make([]byte, fileHeaderSize)
+	n, err := readers.ReadFill(in, buf)
+	if n < fileHeaderSize {
+		if err == nil || err == io.EOF {
+			err = ErrorEncryptedFileTooShort
+		}
+		return nil, err
+	}
+	return f.cipher.readFileHeader(buf)
+}
+
+// rekeyObject rekeys a single object
+func (f *Fs) rekeyObject(ctx context.Context, o *Object, stats *rekeyStats) error {
+	header, err := f.readHeader(ctx, o)
+	if err != nil {
+		return err
+	}
+	if header.format == FileFormatV2 && header.kek == 0 {
+		fs.Debugf(o, "Already keyed with the current key")
+		stats.add(&stats.Unchanged)
+		return nil
+	}
+	if fs.GetConfig(ctx).DryRun {
+		fs.Logf(o, "Skipped rekey as --dry-run is set")
+		return nil
+	}
+	if header.format == FileFormatV2 {
+		err = f.cipher.wrapFileHeader(header)
+		if err != nil {
+			return err
+		}
+		if do, ok := o.Object.(fs.RangeWriter); ok {
+			err = do.WriteRange(ctx, header.raw[:], 0)
+			if err != nil {
+				return fmt.Errorf("failed to rewrite header: %w", err)
+			}
+			fs.Infof(o, "Rewrapped file key in place")
+			stats.add(&stats.Rewrapped)
+			return nil
+		}
+		// Upload the file again with the new header and the old data
+		err = f.rekeyReplace(ctx, o, header)
+		if err != nil {
+			return err
+		}
+		fs.Infof(o, "Rewrote file with new key")
+		stats.add(&stats.Rewritten)
+		return nil
+	}
+	// Format v1 - decrypt and encrypt the data again
+	err = f.rekeyReplace(ctx, o, nil)
+	if err != nil {
+		return err
+	}
+	fs.Infof(o, "Re-encrypted file with new key")
+	stats.add(&stats.Reencrypted)
+	return nil
+}
+
+// rekeyReplace uploads a new version of o to a temporary name then
+// moves it over o.
+//
+// If header is set the underlying data of o is copied with header
+// replacing the original header, otherwise the data of o is
+// decrypted and encrypted again in the current format.
+func (f *Fs) rekeyReplace(ctx context.Context, o *Object, header *fileHeader) (err error) {
+	src := o.Object
+	var in io.ReadCloser
+	if header != nil {
+		in, err = src.Open(ctx, &fs.SeekOption{Offset: int64(fileHeaderSize)})
+	} else {
+		in, err = o.Open(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+
+	tr := accounting.Stats(ctx).NewTransfer(o, f)
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+
+	var data io.Reader
+	if header != nil {
+		data = io.MultiReader(bytes.NewReader(header.raw[:]), in)
+	} else {
+		data, _, err = f.cipher.encryptData(in)
+		if err != nil {
+			return err
+		}
+	}
+	data = tr.Account(ctx, io.NopCloser(data))
+
+	tempRemote := src.Remote() + rekeyTempSuffix
+	info := object.NewStaticObjectInfo(tempRemote, src.ModTime(ctx), src.Size(), true, nil, src.Fs())
+	if do, ok := src.(fs.Metadataer); ok {
+		metadata, err := do.Metadata(ctx)
+		if err != nil {
+			fs.Debugf(o, "Failed to read metadata: %v", err)
+		} else {
+			info = info.WithMetadata(metadata)
+		}
+	}
+	tempObj, err := f.Fs.Put(ctx, data, info)
+	if err != nil {
+		return fmt.Errorf("failed to upload: %w", err)
+	}
+	if tempObj.Size() != src.Size() {
+		_ = tempObj.Remove(ctx)
+		return fmt.Errorf("size changed when rekeying from %d to %d", src.Size(), tempObj.Size())
+	}
+	err = f.rekeyMove(ctx, tempObj, src)
+	if err != nil {
+		return fmt.Errorf("failed to move into place: %w", err)
+	}
+	return nil
+}
+
+// rekeyMove replaces dst with src using a server-side Move or Copy
+// if possible, otherwise by uploading src over dst.
+func (f *Fs) rekeyMove(ctx context.Context, src, dst fs.Object) error {
+	if do := f.Fs.Features().Move; do != nil {
+		_, err := do(ctx, src, dst.Remote())
+		if !errors.Is(err, fs.ErrorCantMove) {
+			return err
+		}
+	}
+	if do := f.Fs.Features().Copy; do != nil {
+		_, err := do(ctx, src, dst.Remote())
+		if err == nil {
+			return src.Remove(ctx)
+		}
+		if !errors.Is(err, fs.ErrorCantCopy) {
+			return err
+		}
+	}
+	in, err := src.Open(ctx)
+	if err != nil {
+		return err
+	}
+	err = dst.Update(ctx, in, src)
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return src.Remove(ctx)
+}
+
+// rekeyCleanUp removes temporary files left by an interrupted rekey
+//
+// The original file is only replaced once the temporary file is
+// complete so these can always be deleted.
+func (f *Fs) rekeyCleanUp(ctx context.Context, dir string) error {
+	return walk.ListR(ctx, f.Fs, f.cipher.EncryptDirName(dir), true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		var err error
+		entries.ForObject(func(o fs.Object) {
+			if err != nil || !strings.HasSuffix(o.Remote(), rekeyTempSuffix) {
+				return
+			}
+			if fs.GetConfig(ctx).DryRun {
+				fs.Logf(o, "Skipped removing temporary file from interrupted rekey as --dry-run is set")
+				return
+			}
+			fs.Infof(o, "Removing temporary file from interrupted rekey")
+			err = o.Remove(ctx)
+		})
+		return err
+	})
+}
@@ -0,0 +1,147 @@
+package crypt
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRekeyFs makes a crypt Fs on top of dir with the given options
+func newRekeyFs(t *testing.T, dir, fileFormat, keyPassword, previousKeyPassword string) *Fs {
+	m := configmap.Simple{
+		"remote":                    dir,
+		"password":                  obscure.MustObscure("potato"),
+		"filename_encryption":       "standard",
+		"directory_name_encryption": "true",
+		"filename_encoding":         "base32",
+		"suffix":                    ".bin",
+		"file_format":               fileFormat,
+	}
+	if keyPassword != "" {
+		m["key_password"] = obscure.MustObscure(keyPassword)
+	}
+	if previousKeyPassword != "" {
+		m["previous_key_password"] = obscure.MustObscure(previousKeyPassword)
+	}
+	f, err := NewFs(context.Background(), "rekey", "", m)
+	require.NoError(t, err)
+	return f.(*Fs)
+}
+
+// readObject reads the decrypted contents of remote
+func readObject(t *testing.T, f *Fs, remote string) string {
+	ctx := context.Background()
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+// headerOf reads the header of remote as seen by f
+func headerOf(t *testing.T, f *Fs, remote string) *fileHeader {
+	ctx := context.Background()
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	header, err := f.readHeader(ctx, o.(*Object))
+	require.NoError(t, err)
+	return header
+}
+
+func TestRekey(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	files := map[string]string{
+		"v1.txt":          "format v1",
+		"password.txt":    "format v2 keyed with the password",
+		"dir/old-key.txt": "format v2 keyed with the old key_password",
+	}
+
+	uploadFile(t, newRekeyFs(t, dir, "v1", "", ""), "v1.txt", files["v1.txt"])
+	uploadFile(t, newRekeyFs(t, dir, "v2", "", ""), "password.txt", files["password.txt"])
+	uploadFile(t, newRekeyFs(t, dir, "v2", "old", ""), "dir/old-key.txt", files["dir/old-key.txt"])
+
+	// Can't rekey in format v1
+	_, err := newRekeyFs(t, dir, "v1", "", "").rekey(ctx, "")
+	assert.ErrorContains(t, err, "file_format = v2")
+
+	f := newRekeyFs(t, dir, "v2", "new", "old")
+	assert.Equal(t, FileFormatV1, headerOf(t, f, "v1.txt").format)
+	assert.Equal(t, 2, headerOf(t, f, "password.txt").kek)
+	assert.Equal(t, 1, headerOf(t, f, "dir/old-key.txt").kek)
+
+	// A dry run changes nothing
+	dryCtx, ci := fs.AddConfig(ctx)
+	ci.DryRun = true
+	stats, err := f.rekey(dryCtx, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Unchanged+stats.Rewrapped+stats.Rewritten+stats.Reencrypted)
+	assert.Equal(t, 1, headerOf(t, f, "dir/old-key.txt").kek)
+
+	// Leave a temporary file as if a rekey was interrupted
+	tempName := filepath.Join(dir, f.cipher.EncryptFileName("v1.txt")+rekeyTempSuffix)
+	require.NoError(t, os.WriteFile(tempName, []byte("partial"), 0666))
+
+	stats, err = f.rekey(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), stats.Unchanged)
+	assert.Equal(t, int64(2), stats.Rewrapped)
+	assert.Equal(t, int64(0), stats.Rewritten)
+	assert.Equal(t, int64(1), stats.Reencrypted)
+	assert.NoFileExists(t, tempName)
+
+	for remote, contents := range files {
+		header := headerOf(t, f, remote)
+		assert.Equal(t, FileFormatV2, header.format, remote)
+		assert.Equal(t, 0, header.kek, remote)
+		assert.Equal(t, contents, readObject(t, f, remote), remote)
+	}
+
+	// The old key is no longer needed
+	newOnly := newRekeyFs(t, dir, "v2", "new", "")
+	for remote, contents := range files {
+		assert.Equal(t, contents, readObject(t, newOnly, remote), remote)
+	}
+
+	// Running it again does nothing
+	stats, err = f.rekey(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Unchanged)
+	assert.Equal(t, int64(0), stats.Rewrapped+stats.Rewritten+stats.Reencrypted)
+}
+
+func TestRekeyReplace(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	const contents = "rewritten without re-encrypting"
+	uploadFile(t, newRekeyFs(t, dir, "v2", "old", ""), "file.txt", contents)
+
+	f := newRekeyFs(t, dir, "v2", "new", "old")
+	o, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	header, err := f.readHeader(ctx, o.(*Object))
+	require.NoError(t, err)
+	assert.Equal(t, 1, header.kek)
+	require.NoError(t, f.cipher.wrapFileHeader(header))
+
+	// Rewrite the header by uploading the file again as is done
+	// for backends which can't write ranges
+	require.NoError(t, f.rekeyReplace(ctx, o.(*Object), header))
+	assert.Equal(t, 0, headerOf(t, f, "file.txt").kek)
+	assert.Equal(t, contents, readObject(t, newRekeyFs(t, dir, "v2", "new", ""), "file.txt"))
+
+	entries, err := f.Fs.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
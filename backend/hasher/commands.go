@@ -36,6 +36,15 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			return nil, errors.New("please provide checksum type and path to sum file")
 		}
 		return nil, f.dbImport(ctx, arg[0], arg[1], sticky)
+	case "verify":
+		if len(arg) != 0 {
+			return nil, errors.New("verify takes no arguments")
+		}
+		vopt, err := f.parseVerifyOpt(opt)
+		if err != nil {
+			return nil, err
+		}
+		return f.verify(ctx, vopt)
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -70,6 +79,26 @@ Usage Example:
 Usage Example:
     rclone backend stickyimport hasher:subdir md5 remote:path/to/sum.md5
 `,
+}, {
+	Name:  "verify",
+	Short: "Re-read files to detect bitrot",
+	Long: `Read every file under the path and check its data against the
+cached checksums and any checksums stored by the underlying remote.
+
+Files whose data doesn't match are reported as bitrot and counted as
+errors. Their cached checksums are left alone. Files which match, or
+have nothing to check against, get fresh cached checksums and their
+verification time is recorded.
+
+Usage Example:
+    rclone backend verify hasher:path/to/dir
+    rclone backend verify hasher: -o rate=10M -o interval=30d
+    rclone rc backend/command command=verify fs=hasher: _async=true
+`,
+	Opts: map[string]string{
+		"rate":     "Maximum read rate in bytes per second, overrides verify_rate",
+		"interval": "Skip files verified more recently than this, overrides verify_interval",
+	},
 }}
 
 func (f *Fs) dbDump(ctx context.Context, full bool, root string) error {
@@ -50,6 +50,22 @@ func init() {
 			Advanced: true,
 			Default:  fs.SizeSuffix(0),
 			Help:     "Auto-update checksum for files smaller than this size (disabled by default).",
+		}, {
+			Name:     "verify_rate",
+			Advanced: true,
+			Default:  fs.SizeSuffix(0),
+			Help: `Maximum rate at which to read data when verifying (0 = unlimited).
+
+This is in bytes per second and limits the verify command so it
+doesn't use all the bandwidth.`,
+		}, {
+			Name:     "verify_interval",
+			Advanced: true,
+			Default:  fs.Duration(0),
+			Help: `Skip files verified more recently than this (0 = verify all).
+
+Use this to spread verification of a large remote over several runs
+of the verify command.`,
 		}},
 	})
 }
@@ -60,6 +76,9 @@ type Options struct {
 	Hashes   fs.CommaSepList `config:"hashes"`
 	AutoSize fs.SizeSuffix   `config:"auto_size"`
 	MaxAge   fs.Duration     `config:"max_age"`
+	// verification
+	VerifyRate     fs.SizeSuffix `config:"verify_rate"`
+	VerifyInterval fs.Duration   `config:"verify_interval"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -254,6 +273,17 @@ func (f *Fs) ListR(ctx context.Context, dir string, callback fs.ListRCallback) (
 	})
 }
 
+// ListP lists the objects and directories in dir a tranche at a time.
+func (f *Fs) ListP(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
+	return f.Fs.Features().ListP(ctx, dir, func(baseEntries fs.DirEntries) error {
+		hashEntries, err := f.wrapEntries(baseEntries)
+		if err != nil {
+			return err
+		}
+		return callback(hashEntries)
+	})
+}
+
 // Purge a directory
 func (f *Fs) Purge(ctx context.Context, dir string) error {
 	if do := f.Fs.Features().Purge; do != nil {
@@ -559,6 +589,7 @@ var (
 	_ fs.CleanUpper      = (*Fs)(nil)
 	_ fs.UnWrapper       = (*Fs)(nil)
 	_ fs.ListRer         = (*Fs)(nil)
+	_ fs.ListPer         = (*Fs)(nil)
 	_ fs.Abouter         = (*Fs)(nil)
 	_ fs.Wrapper         = (*Fs)(nil)
 	_ fs.MergeDirser     = (*Fs)(nil)
@@ -4,10 +4,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
 	"github.com/rclone/rclone/fstest/fstests"
@@ -78,3 +83,74 @@ func (f *Fs) InternalTest(t *testing.T) {
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
+
+func TestVerify(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("hasher is not supported on this OS")
+	}
+	ctx := context.Background()
+	dir := t.TempDir()
+	m := configmap.Simple{
+		"remote":          dir,
+		"hashes":          "md5",
+		"max_age":         "off",
+		"auto_size":       "0",
+		"verify_rate":     "0",
+		"verify_interval": "0",
+	}
+	fsys, err := NewFs(ctx, "TestHasherVerify", "", m)
+	require.NoError(t, err)
+	f := fsys.(*Fs)
+	defer func() {
+		_ = f.Shutdown(ctx)
+	}()
+	putFile(ctx, t, f, "a.txt", "hello")
+	putFile(ctx, t, f, "sub/b.txt", "world")
+
+	verify := func(opt map[string]string) *verifyStats {
+		out, err := f.Command(ctx, "verify", nil, opt)
+		require.NoError(t, err)
+		return out.(*verifyStats)
+	}
+
+	// The files are verified against the hashes cached by Put
+	stats := verify(map[string]string{"rate": "1M"})
+	assert.Equal(t, int64(2), stats.Checked)
+	assert.Equal(t, int64(10), stats.Bytes)
+	assert.Equal(t, int64(2), stats.Verified)
+	assert.Equal(t, int64(0), stats.Bitrot+stats.Errors)
+
+	// Change the data without changing the size or modtime
+	name := filepath.Join(dir, "a.txt")
+	fi, err := os.Stat(name)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(name, []byte("HELLO"), 0666))
+	require.NoError(t, os.Chtimes(name, fi.ModTime(), fi.ModTime()))
+
+	stats = verify(nil)
+	assert.Equal(t, int64(2), stats.Checked)
+	assert.Equal(t, int64(1), stats.Verified)
+	assert.Equal(t, int64(1), stats.Bitrot)
+	assert.Equal(t, []string{"a.txt"}, stats.Bad)
+
+	// The cached hash is kept as evidence
+	md5, err := f.getRawHash(ctx, hash.MD5, "a.txt", anyFingerprint, fs.ModTimeNotSupported)
+	require.NoError(t, err)
+	assert.Equal(t, "5d41402abc4b2a76b9719d911017c592", md5)
+
+	// Recently verified files are skipped
+	stats = verify(map[string]string{"interval": "1h"})
+	assert.Equal(t, int64(2), stats.Skipped)
+
+	// A legitimate change updates the hashes
+	require.NoError(t, os.Chtimes(name, time.Now(), time.Now()))
+	stats = verify(nil)
+	assert.Equal(t, int64(1), stats.Unhashed)
+	assert.Equal(t, int64(1), stats.Verified)
+	assert.Equal(t, int64(0), stats.Bitrot)
+
+	_, err = f.Command(ctx, "verify", nil, map[string]string{"potato": "1"})
+	assert.Error(t, err)
+	_, err = f.Command(ctx, "verify", nil, map[string]string{"rate": "fast"})
+	assert.Error(t, err)
+}
@@ -23,9 +23,10 @@ const (
 type hashMap map[hash.Type]string
 
 type hashRecord struct {
-	Fp      string // fingerprint
-	Hashes  operations.HashSums
-	Created time.Time
+	Fp       string // fingerprint
+	Hashes   operations.HashSums
+	Created  time.Time
+	Verified time.Time // when the data was last read and checked against Hashes
 }
 
 func (r *hashRecord) encode(key string) ([]byte, error) {
@@ -172,12 +173,32 @@ func (op *kvGet) Do(ctx context.Context, b kv.Bucket) error {
 	return nil
 }
 
+// kvGetRecord: get the whole record for a key without validating it
+type kvGetRecord struct {
+	key   string
+	rec   hashRecord
+	found bool
+}
+
+func (op *kvGetRecord) Do(ctx context.Context, b kv.Bucket) error {
+	data := b.Get([]byte(op.key))
+	if len(data) == 0 {
+		return nil
+	}
+	if err := op.rec.decode(op.key, data); err != nil {
+		return errors.New("invalid record")
+	}
+	op.found = true
+	return nil
+}
+
 // kvPut: set hashes for an object by key
 type kvPut struct {
-	key    string
-	fp     string
-	hashes operations.HashSums
-	age    time.Duration
+	key      string
+	fp       string
+	hashes   operations.HashSums
+	age      time.Duration
+	verified time.Time // set the verified time if not zero
 }
 
 func (op *kvPut) Do(ctx context.Context, b kv.Bucket) (err error) {
@@ -193,6 +214,10 @@ func (op *kvPut) Do(ctx context.Context, b kv.Bucket) (err error) {
 		r.Created = time.Now()
 		r.Hashes = operations.HashSums{}
 		r.Fp = op.fp
+		r.Verified = time.Time{}
+	}
+	if !op.verified.IsZero() {
+		r.Verified = op.verified
 	}
 
 	for hashType, hashVal := range op.hashes {
@@ -0,0 +1,264 @@
+package hasher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"golang.org/x/time/rate"
+)
+
+// errBitrot is returned when the data read doesn't match a known hash
+var errBitrot = errors.New("bitrot detected")
+
+// verifyStats is the result of the verify command
+type verifyStats struct {
+	Checked  int64    // number of files looked at
+	Verified int64    // files which matched their hashes
+	Unhashed int64    // files with no hashes to compare, now hashed
+	Skipped  int64    // files verified recently enough
+	Bitrot   int64    // files which didn't match their hashes
+	Errors   int64    // files which couldn't be read
+	Bytes    int64    // bytes read
+	Bad      []string // names of the files with bitrot
+	mu       sync.Mutex
+}
+
+// verifyOpt controls a verify run
+type verifyOpt struct {
+	rate     fs.SizeSuffix // bytes per second or 0 for unlimited
+	interval time.Duration // skip files verified more recently than this
+}
+
+// parse the options of the verify command
+func (f *Fs) parseVerifyOpt(opt map[string]string) (vopt verifyOpt, err error) {
+	vopt = verifyOpt{
+		rate:     f.opt.VerifyRate,
+		interval: time.Duration(f.opt.VerifyInterval),
+	}
+	for key, val := range opt {
+		switch key {
+		case "rate":
+			if err = vopt.rate.Set(val); err != nil {
+				return vopt, fmt.Errorf("bad rate: %w", err)
+			}
+		case "interval":
+			if vopt.interval, err = fs.ParseDuration(val); err != nil {
+				return vopt, fmt.Errorf("bad interval: %w", err)
+			}
+		default:
+			return vopt, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return vopt, nil
+}
+
+// verify re-reads all the objects in the Fs checking them against
+// their cached and remote-native hashes.
+func (f *Fs) verify(ctx context.Context, vopt verifyOpt) (*verifyStats, error) {
+	var limiter *rate.Limiter
+	if vopt.rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(vopt.rate), int(min(vopt.rate, 1024*1024)))
+	}
+	stats := &verifyStats{}
+	objs := make(chan *Object, fs.GetConfig(ctx).Checkers)
+	var wg sync.WaitGroup
+	for i := 0; i < fs.GetConfig(ctx).Checkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for o := range objs {
+				o.verify(ctx, vopt, limiter, stats)
+			}
+		}()
+	}
+	err := operations.ListFn(ctx, f, func(obj fs.Object) {
+		if o, ok := obj.(*Object); ok {
+			objs <- o
+		}
+	})
+	close(objs)
+	wg.Wait()
+	if err != nil {
+		return stats, err
+	}
+	return stats, ctx.Err()
+}
+
+// verify a single object updating the stats
+func (o *Object) verify(ctx context.Context, vopt verifyOpt, limiter *rate.Limiter, stats *verifyStats) {
+	f := o.f
+	count := func(counter *int64) {
+		stats.mu.Lock()
+		*counter++
+		stats.Checked++
+		stats.mu.Unlock()
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	fp := o.fingerprint(ctx)
+
+	// Find the cached hashes if they are still valid for the object
+	var (
+		rec    hashRecord
+		cached bool
+	)
+	if f.db != nil && fp != "" {
+		op := &kvGetRecord{key: path.Join(f.Fs.Root(), o.Remote())}
+		if err := f.db.Do(false, op); err != nil {
+			fs.Debugf(o, "verify: failed to read cached hashes: %v", err)
+		}
+		cached = op.found &&
+			(op.rec.Fp == anyFingerprint || op.rec.Fp == fp) &&
+			time.Since(op.rec.Created) <= time.Duration(f.opt.MaxAge)
+		rec = op.rec
+	}
+	if cached && vopt.interval > 0 && time.Since(rec.Verified) < vopt.interval {
+		fs.Debugf(o, "verify: skipping as verified %v ago", time.Since(rec.Verified).Round(time.Second))
+		count(&stats.Skipped)
+		return
+	}
+
+	// Collect the hashes to check the data against
+	want := hashMap{}
+	from := map[hash.Type]string{}
+	if cached {
+		for hashName, hashVal := range rec.Hashes {
+			var ht hash.Type
+			if hashVal == "" || ht.Set(hashName) != nil {
+				continue
+			}
+			want[ht] = hashVal
+			from[ht] = "cached"
+		}
+	}
+	for _, ht := range f.passHashes.Array() {
+		hashVal, err := o.Object.Hash(ctx, ht)
+		if err != nil || hashVal == "" {
+			continue
+		}
+		if cachedVal, ok := want[ht]; ok && cachedVal != hashVal {
+			fs.Errorf(o, "verify: cached %v %q differs from remote %q", ht, cachedVal, hashVal)
+		}
+		want[ht] = hashVal
+		from[ht] = "remote"
+	}
+	types := f.keepHashes
+	for ht := range want {
+		types.Add(ht)
+	}
+
+	// Read the data
+	tr := accounting.Stats(ctx).NewCheckingTransfer(o, "verifying")
+	sums, n, err := o.readHashes(ctx, types, limiter, tr)
+	stats.mu.Lock()
+	stats.Bytes += n
+	stats.mu.Unlock()
+	if err != nil {
+		fs.Errorf(o, "verify: failed to read: %v", err)
+		tr.Done(ctx, err)
+		count(&stats.Errors)
+		return
+	}
+
+	// Compare the hashes
+	bad := 0
+	for ht, wantVal := range want {
+		if gotVal := sums[ht]; gotVal != wantVal {
+			fs.Errorf(o, "verify: %s: %s %v is %q but data read has %q", errBitrot, from[ht], ht, wantVal, gotVal)
+			bad++
+		}
+	}
+	if bad > 0 {
+		tr.Done(ctx, fmt.Errorf("%w: %d hash(es) differ", errBitrot, bad))
+		stats.mu.Lock()
+		stats.Bad = append(stats.Bad, o.Remote())
+		stats.mu.Unlock()
+		count(&stats.Bitrot)
+		return
+	}
+	tr.Done(ctx, nil)
+
+	// Record the hashes and when they were verified
+	if f.db != nil && fp != "" {
+		hashes := operations.HashSums{}
+		for _, ht := range f.keepHashes.Array() {
+			hashes[ht.String()] = sums[ht]
+		}
+		err = f.db.Do(true, &kvPut{
+			key:      path.Join(f.Fs.Root(), o.Remote()),
+			fp:       fp,
+			hashes:   hashes,
+			age:      time.Duration(f.opt.MaxAge),
+			verified: time.Now(),
+		})
+		if err != nil {
+			fs.Errorf(o, "verify: failed to record hashes: %v", err)
+		}
+	}
+	if len(want) == 0 {
+		fs.Infof(o, "verify: no hashes to check against - hashed")
+		count(&stats.Unhashed)
+		return
+	}
+	fs.Debugf(o, "verify: OK")
+	count(&stats.Verified)
+}
+
+// readHashes reads the whole of the underlying object returning the
+// hashes of types and the number of bytes read.
+func (o *Object) readHashes(ctx context.Context, types hash.Set, limiter *rate.Limiter, tr *accounting.Transfer) (sums hashMap, n int64, err error) {
+	hasher, err := hash.NewMultiHasherTypes(types)
+	if err != nil {
+		return nil, 0, err
+	}
+	rc, err := o.Object.Open(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	acc := tr.Account(ctx, rc)
+	defer func() {
+		_ = acc.Close()
+	}()
+	var in io.Reader = acc
+	if limiter != nil {
+		in = &limitedReader{ctx: ctx, in: in, limiter: limiter}
+	}
+	n, err = io.Copy(hasher, in)
+	if err != nil {
+		return nil, n, err
+	}
+	if n != o.Object.Size() && o.Object.Size() >= 0 {
+		return nil, n, fmt.Errorf("read %d bytes but expected %d", n, o.Object.Size())
+	}
+	return hasher.Sums(), n, nil
+}
+
+// limitedReader limits the rate data can be read from in
+type limitedReader struct {
+	ctx     context.Context
+	in      io.Reader
+	limiter *rate.Limiter
+}
+
+func (r *limitedReader) Read(p []byte) (n int, err error) {
+	if burst := r.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err = r.in.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,408 @@
+//go:build linux
+
+package local
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"golang.org/x/sys/unix"
+)
+
+// notifier is the kernel interface used to watch directories
+type notifier interface {
+	// watch starts watching the directory at osPath, returning the
+	// key its events are reported with
+	watch(osPath string) (key string, err error)
+	// unwatch stops watching the directory with key
+	unwatch(key string)
+	// read passes the events to handle until the notifier is closed
+	read(handle func(event)) error
+	// close the notifier, stopping read
+	close() error
+	// String returns the name of the kernel interface
+	String() string
+}
+
+// eventOp describes what happened in an event
+type eventOp uint32
+
+// Event ops - the kernel can merge events so more than one may be set
+const (
+	opCreate   eventOp = 1 << iota // entry was created
+	opMovedIn                      // entry was moved in
+	opWrite                        // file was closed after writing
+	opChange                       // entry's attributes changed
+	opRemove                       // entry was deleted or moved out
+	opSelf                         // the directory itself was deleted or moved
+	opIsDir                        // entry is a directory
+	opOverflow                     // events were lost
+	opIgnored                      // the watch was removed
+)
+
+// event is a change reported by a notifier
+type event struct {
+	key  string  // key of the directory the event happened in
+	name string  // name of the entry or "" for the directory itself
+	op   eventOp // what happened
+}
+
+// watchedDir is a directory being watched
+type watchedDir struct {
+	remote string // remote path of the directory
+	osPath string // OS path of the directory
+}
+
+// watcher watches a directory tree for changes
+type watcher struct {
+	f      *Fs
+	notify func(string, fs.EntryType)
+	n      notifier
+	done   chan struct{} // closed when the reader has finished
+
+	mu          sync.Mutex
+	closed      bool                  // set when the watcher has been closed
+	dirs        map[string]watchedDir // notifier key to directory
+	keys        map[string]string     // remote path of directory to notifier key
+	unwatched   map[string]string     // remote path to OS path of directories which couldn't be watched
+	warnedLimit bool                  // set if we have warned about the watch limit
+}
+
+// ChangeNotify calls the passed function with a path that has had changes.
+//
+// On Linux the changes are found with fanotify if rclone has the
+// privileges to use it, or inotify otherwise, rather than polling.
+// The poll interval only sets how often directories which couldn't
+// be watched are rescanned.
+func (f *Fs) ChangeNotify(ctx context.Context, notifyFunc func(string, fs.EntryType), pollIntervalChan <-chan time.Duration) {
+	// Changes made while the poll interval is being sent are
+	// notified when the watcher starts. The change time is only
+	// updated every clock tick so it can be a little behind.
+	since := time.Now().Add(-time.Second)
+	go func() {
+		var w *watcher
+		var ticker *time.Ticker
+		var tickerC <-chan time.Time
+		stop := func() {
+			if ticker != nil {
+				ticker.Stop()
+				ticker, tickerC = nil, nil
+			}
+			if w != nil {
+				w.close()
+				w = nil
+			}
+		}
+		for {
+			select {
+			case pollInterval, ok := <-pollIntervalChan:
+				if !ok {
+					stop()
+					return
+				}
+				if pollInterval == 0 {
+					stop()
+					since = time.Time{}
+					continue
+				}
+				if ticker != nil {
+					ticker.Stop()
+				}
+				if w == nil {
+					if since.IsZero() {
+						// Restarting after being stopped
+						since = time.Now().Add(-time.Second)
+					}
+					var err error
+					w, err = f.newWatcher(notifyFunc, since)
+					if err != nil {
+						fs.Errorf(f, "Failed to start watching for changes: %v", err)
+						continue
+					}
+				}
+				ticker = time.NewTicker(pollInterval)
+				tickerC = ticker.C
+			case <-tickerC:
+				w.rescanUnwatched()
+			case <-ctx.Done():
+				stop()
+				return
+			}
+		}
+	}()
+}
+
+// newWatcher starts watching the tree at the root of f, notifying
+// anything changed at or after since
+func (f *Fs) newWatcher(notify func(string, fs.EntryType), since time.Time) (*watcher, error) {
+	n, err := f.newNotifier()
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{
+		f:         f,
+		notify:    notify,
+		n:         n,
+		done:      make(chan struct{}),
+		dirs:      make(map[string]watchedDir),
+		keys:      make(map[string]string),
+		unwatched: make(map[string]string),
+	}
+	go w.run(since)
+	return w, nil
+}
+
+// useFanotify can be cleared to always use inotify
+var useFanotify = true
+
+// newNotifier returns a fanotify notifier if it can watch the root of
+// f, otherwise an inotify one.
+//
+// fanotify watches whole filesystems so it has no limit on the number
+// of directories, but it needs CAP_SYS_ADMIN and Linux 5.9 or later.
+func (f *Fs) newNotifier() (notifier, error) {
+	if useFanotify {
+		n, err := newFanotify()
+		if err == nil {
+			_, err = n.watch(f.root)
+			if err == nil {
+				return n, nil
+			}
+			_ = n.close()
+		}
+		fs.Debugf(f, "Can't use fanotify to watch for changes - using inotify: %v", err)
+	}
+	return newInotify()
+}
+
+// run watches the tree then reads the events until the watcher is
+// closed.
+//
+// The tree is walked here so a large tree doesn't hold up the caller.
+// Changes made in a directory once it is watched are queued until the
+// walk is finished, and anything changed at or after since before then
+// is notified.
+func (w *watcher) run(since time.Time) {
+	defer close(w.done)
+	w.addTree("", w.f.root, changedSince(since))
+	if fi, err := os.Stat(w.f.root); err == nil && !readTime(cTime, fi).Before(since) {
+		w.notify("", fs.EntryDirectory)
+	}
+	w.mu.Lock()
+	fs.Debugf(w.f, "Watching %d directories for changes with %v", len(w.keys), w.n)
+	w.mu.Unlock()
+	err := w.n.read(w.handle)
+	if !errors.Is(err, os.ErrClosed) {
+		fs.Errorf(w.f, "Failed to read changes: %v", err)
+	}
+}
+
+// close stops the watcher and waits for it to finish
+func (w *watcher) close() {
+	w.mu.Lock()
+	w.closed = true
+	_ = w.n.close()
+	w.mu.Unlock()
+	<-w.done
+}
+
+// add a watch to the directory remote at osPath returning true if it
+// was added
+func (w *watcher) add(remote, osPath string) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		// Don't use the fd as it may have been reused
+		return false
+	}
+	key, err := w.n.watch(osPath)
+	if err == unix.ENOSPC {
+		// Out of watches - rescan the directory instead
+		w.unwatched[remote] = osPath
+		if !w.warnedLimit {
+			fs.Logf(w.f, "Too many directories to watch for changes - increase fs.inotify.max_user_watches - rescanning every poll interval instead")
+			w.warnedLimit = true
+		}
+		return false
+	} else if err != nil {
+		if remote == "" {
+			// Watch the root when it is created
+			w.unwatched[remote] = osPath
+		}
+		fs.Debugf(w.f, "Failed to watch %q for changes: %v", remote, err)
+		return false
+	}
+	w.dirs[key] = watchedDir{remote: remote, osPath: osPath}
+	w.keys[remote] = key
+	delete(w.unwatched, remote)
+	return true
+}
+
+// allChanged is passed to addTree for directories which have just
+// appeared as everything inside them is new
+func allChanged(os.DirEntry) bool {
+	return true
+}
+
+// changedSince returns a function for addTree which reports the
+// entries which changed at or after t
+func changedSince(t time.Time) func(os.DirEntry) bool {
+	return func(entry os.DirEntry) bool {
+		fi, err := entry.Info()
+		return err != nil || !readTime(cTime, fi).Before(t)
+	}
+}
+
+// addTree watches the directory remote at osPath and all the
+// directories inside it.
+//
+// If changed is set then everything found inside it which it reports
+// is notified, as it may have changed before the watch was added.
+func (w *watcher) addTree(remote, osPath string, changed func(os.DirEntry) bool) {
+	if !w.add(remote, osPath) {
+		return
+	}
+	entries, err := os.ReadDir(osPath)
+	if err != nil {
+		fs.Debugf(w.f, "Failed to read %q to watch for changes: %v", remote, err)
+		return
+	}
+	for _, entry := range entries {
+		newRemote := w.f.cleanRemote(remote, entry.Name())
+		if !entry.IsDir() {
+			if changed != nil && changed(entry) {
+				w.notifyObject(newRemote, filepath.Join(osPath, entry.Name()))
+			}
+			continue
+		}
+		if w.f.opt.OneFileSystem {
+			fi, err := entry.Info()
+			if err != nil || readDevice(fi, true) != w.f.dev {
+				continue
+			}
+		}
+		if changed != nil && changed(entry) {
+			w.notify(newRemote, fs.EntryDirectory)
+		}
+		w.addTree(newRemote, filepath.Join(osPath, entry.Name()), changed)
+	}
+}
+
+// notifyObject notifies the file remote at osPath as changed
+func (w *watcher) notifyObject(remote, osPath string) {
+	if w.f.opt.TranslateSymlinks {
+		if fi, err := os.Lstat(osPath); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			remote += fs.LinkSuffix
+		}
+	}
+	w.notify(remote, fs.EntryObject)
+}
+
+// removeTree stops watching the directory remote and all the
+// directories inside it
+func (w *watcher) removeTree(remote string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	for dir, key := range w.keys {
+		if dir == remote || strings.HasPrefix(dir, remote+"/") {
+			w.n.unwatch(key)
+			delete(w.keys, dir)
+			delete(w.dirs, key)
+		}
+	}
+	for dir := range w.unwatched {
+		if dir == remote || strings.HasPrefix(dir, remote+"/") {
+			delete(w.unwatched, dir)
+		}
+	}
+}
+
+// rescanUnwatched tries to watch the directories which couldn't be
+// watched and notifies the ones which exist as changed as we don't
+// know if they were
+func (w *watcher) rescanUnwatched() {
+	w.mu.Lock()
+	unwatched := make(map[string]string, len(w.unwatched))
+	for remote, osPath := range w.unwatched {
+		unwatched[remote] = osPath
+	}
+	w.mu.Unlock()
+	for remote, osPath := range unwatched {
+		if _, err := os.Stat(osPath); err != nil {
+			continue
+		}
+		w.addTree(remote, osPath, nil)
+		w.notify(remote, fs.EntryDirectory)
+	}
+}
+
+// rescan watches any directories which were missed and notifies the
+// whole tree as changed. This is used when events were lost.
+func (w *watcher) rescan() {
+	fs.Debugf(w.f, "Too many changes to track - rescanning")
+	w.addTree("", w.f.root, nil)
+	w.notify("", fs.EntryDirectory)
+}
+
+// handle a single event
+func (w *watcher) handle(ev event) {
+	if ev.op&opOverflow != 0 {
+		w.rescan()
+		return
+	}
+	w.mu.Lock()
+	dir, ok := w.dirs[ev.key]
+	if ok && ev.op&opIgnored != 0 {
+		// The watch was removed because the directory went
+		delete(w.dirs, ev.key)
+		if w.keys[dir.remote] == ev.key {
+			delete(w.keys, dir.remote)
+		}
+	}
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+	if ev.name == "" {
+		// Event on the directory itself - these are reported by
+		// the parent except for the root
+		if dir.remote == "" && ev.op&opSelf != 0 {
+			w.notify("", fs.EntryDirectory)
+		}
+		return
+	}
+	remote := w.f.cleanRemote(dir.remote, ev.name)
+	osPath := filepath.Join(dir.osPath, ev.name)
+	if ev.op&opIsDir != 0 {
+		w.notify(remote, fs.EntryDirectory)
+		if ev.op&opRemove != 0 {
+			w.removeTree(remote)
+		}
+		// Events can be merged so check what is there now
+		if ev.op&(opCreate|opMovedIn|opRemove) != 0 {
+			if fi, err := os.Lstat(osPath); err == nil && fi.IsDir() {
+				w.addTree(remote, osPath, allChanged)
+			}
+		}
+		return
+	}
+	if ev.op&^opIsDir == opCreate {
+		if fi, err := os.Lstat(osPath); err == nil && fi.Mode().IsRegular() {
+			// Wait for the write before notifying new files
+			return
+		}
+	}
+	w.notifyObject(remote, osPath)
+}
+
+// Check the interfaces are satisfied
+var _ fs.ChangeNotifier = &Fs{}
@@ -0,0 +1,208 @@
+//go:build linux
+
+package local
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+// changes collects the notifications from ChangeNotify
+type changes struct {
+	mu   sync.Mutex
+	seen map[string]fs.EntryType
+}
+
+func (c *changes) notify(remote string, entryType fs.EntryType) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen[remote] = entryType
+}
+
+// waitFor waits until remote has been notified with entryType
+func (c *changes) waitFor(t *testing.T, remote string, entryType fs.EntryType) {
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		got, ok := c.seen[remote]
+		return ok && got == entryType
+	}, 5*time.Second, 10*time.Millisecond, "waiting for %q", remote)
+}
+
+// withNotifier runs fn with inotify and with fanotify if it can be used
+func withNotifier(t *testing.T, fn func(t *testing.T)) {
+	t.Run("inotify", func(t *testing.T) {
+		useFanotify = false
+		defer func() {
+			useFanotify = true
+		}()
+		fn(t)
+	})
+	t.Run("fanotify", func(t *testing.T) {
+		n, err := newFanotify()
+		if err == nil {
+			_, err = n.watch(t.TempDir())
+			_ = n.close()
+		}
+		if err != nil {
+			t.Skipf("fanotify not available: %v", err)
+		}
+		fn(t)
+	})
+}
+
+func TestChangeNotify(t *testing.T) {
+	withNotifier(t, testChangeNotify)
+}
+
+func testChangeNotify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "existing", "deep"), 0777))
+	f, err := NewFs(ctx, "local", root, configmap.Simple{})
+	require.NoError(t, err)
+	require.NotNil(t, f.Features().ChangeNotify)
+
+	c := &changes{seen: map[string]fs.EntryType{}}
+	pollInterval := make(chan time.Duration)
+	f.Features().ChangeNotify(ctx, c.notify, pollInterval)
+	pollInterval <- time.Minute
+	defer close(pollInterval)
+
+	// Files are notified when written, even before the tree
+	// has been walked
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("hello"), 0666))
+	c.waitFor(t, "file.txt", fs.EntryObject)
+
+	// Directories which existed at the start are watched
+	require.NoError(t, os.WriteFile(filepath.Join(root, "existing", "deep", "a.txt"), []byte("a"), 0666))
+	c.waitFor(t, "existing/deep/a.txt", fs.EntryObject)
+
+	// New directories are watched
+	require.NoError(t, os.Mkdir(filepath.Join(root, "new"), 0777))
+	c.waitFor(t, "new", fs.EntryDirectory)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "new", "b.txt"), []byte("b"), 0666))
+	c.waitFor(t, "new/b.txt", fs.EntryObject)
+
+	// Renamed directories are watched at their new name
+	require.NoError(t, os.Rename(filepath.Join(root, "new"), filepath.Join(root, "renamed")))
+	c.waitFor(t, "renamed", fs.EntryDirectory)
+	require.NoError(t, os.WriteFile(filepath.Join(root, "renamed", "c.txt"), []byte("c"), 0666))
+	c.waitFor(t, "renamed/c.txt", fs.EntryObject)
+
+	// The contents of directories moved in are notified
+	outside := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(outside, "incoming", "sub"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(outside, "incoming", "sub", "d.txt"), []byte("d"), 0666))
+	require.NoError(t, os.Rename(filepath.Join(outside, "incoming"), filepath.Join(root, "incoming")))
+	c.waitFor(t, "incoming", fs.EntryDirectory)
+	c.waitFor(t, "incoming/sub", fs.EntryDirectory)
+	c.waitFor(t, "incoming/sub/d.txt", fs.EntryObject)
+
+	// Removals are notified
+	c.mu.Lock()
+	delete(c.seen, "file.txt")
+	c.mu.Unlock()
+	require.NoError(t, os.Remove(filepath.Join(root, "file.txt")))
+	c.waitFor(t, "file.txt", fs.EntryObject)
+	require.NoError(t, os.RemoveAll(filepath.Join(root, "existing")))
+	c.waitFor(t, "existing", fs.EntryDirectory)
+
+	// Stopping the watcher stops the notifications
+	pollInterval <- 0
+	c.mu.Lock()
+	c.seen = map[string]fs.EntryType{}
+	c.mu.Unlock()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "stopped.txt"), []byte("hello"), 0666))
+	time.Sleep(100 * time.Millisecond)
+	c.mu.Lock()
+	assert.Equal(t, map[string]fs.EntryType{}, c.seen)
+	c.mu.Unlock()
+}
+
+func TestChangeNotifyOverflow(t *testing.T) {
+	withNotifier(t, testChangeNotifyOverflow)
+}
+
+func testChangeNotifyOverflow(t *testing.T) {
+	root := t.TempDir()
+	f, err := NewFs(context.Background(), "local", root, configmap.Simple{})
+	require.NoError(t, err)
+	c := &changes{seen: map[string]fs.EntryType{}}
+	w, err := f.(*Fs).newWatcher(c.notify, time.Now())
+	require.NoError(t, err)
+	defer w.close()
+
+	// A directory made while events were lost is watched after the rescan
+	require.NoError(t, os.Mkdir(filepath.Join(root, "missed"), 0777))
+	w.handle(event{op: opOverflow})
+	c.waitFor(t, "", fs.EntryDirectory)
+	w.mu.Lock()
+	_, found := w.keys["missed"]
+	w.mu.Unlock()
+	assert.True(t, found)
+}
+
+func TestNewNotifier(t *testing.T) {
+	f, err := NewFs(context.Background(), "local", t.TempDir(), configmap.Simple{})
+	require.NoError(t, err)
+	n, err := f.(*Fs).newNotifier()
+	require.NoError(t, err)
+	defer func() {
+		_ = n.close()
+	}()
+	// fanotify is used if it is available
+	if _, err := newFanotify(); err == nil {
+		assert.Equal(t, "fanotify", n.String())
+	} else {
+		assert.Equal(t, "inotify", n.String())
+	}
+}
+
+func TestParseFanotifyInfo(t *testing.T) {
+	handle := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	fsid := []byte{9, 10, 11, 12, 13, 14, 15, 16}
+	record := func(recordType byte, name string) []byte {
+		b := []byte{recordType, 0, 0, 0}
+		b = append(b, fsid...)
+		b = binary.NativeEndian.AppendUint32(b, uint32(len(handle)))
+		b = binary.NativeEndian.AppendUint32(b, 1)
+		b = append(b, handle...)
+		b = append(b, name...)
+		b = append(b, 0, 0, 0)
+		binary.NativeEndian.PutUint16(b[2:], uint16(len(b)))
+		return b
+	}
+	wantKey := fanotifyKey(fsid, 1, handle)
+
+	key, name := parseFanotifyInfo(record(unix.FAN_EVENT_INFO_TYPE_DFID_NAME, "file.txt"))
+	assert.Equal(t, wantKey, key)
+	assert.Equal(t, "file.txt", name)
+
+	// Events on the directory itself have no name
+	key, name = parseFanotifyInfo(record(unix.FAN_EVENT_INFO_TYPE_DFID_NAME, "."))
+	assert.Equal(t, wantKey, key)
+	assert.Equal(t, "", name)
+
+	// Other records are skipped
+	info := append(record(unix.FAN_EVENT_INFO_TYPE_FID, ""), record(unix.FAN_EVENT_INFO_TYPE_DFID_NAME, "b")...)
+	key, name = parseFanotifyInfo(info)
+	assert.Equal(t, wantKey, key)
+	assert.Equal(t, "b", name)
+
+	// Truncated records are ignored
+	key, _ = parseFanotifyInfo(record(unix.FAN_EVENT_INFO_TYPE_DFID_NAME, "x")[:10])
+	assert.Equal(t, "", key)
+}
@@ -0,0 +1,200 @@
+//go:build linux
+
+package local
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// fanotifyMask is the set of fanotify events watched for on each
+// filesystem
+const fanotifyMask = unix.FAN_ATTRIB | unix.FAN_CLOSE_WRITE | unix.FAN_CREATE | unix.FAN_DELETE |
+	unix.FAN_MOVED_FROM | unix.FAN_MOVED_TO | unix.FAN_DELETE_SELF | unix.FAN_MOVE_SELF |
+	unix.FAN_ONDIR
+
+// fanotifyOps maps fanotify events to event ops
+var fanotifyOps = []struct {
+	mask uint64
+	op   eventOp
+}{
+	{unix.FAN_CREATE, opCreate},
+	{unix.FAN_MOVED_TO, opMovedIn},
+	{unix.FAN_CLOSE_WRITE, opWrite},
+	{unix.FAN_ATTRIB, opChange},
+	{unix.FAN_DELETE | unix.FAN_MOVED_FROM, opRemove},
+	{unix.FAN_DELETE_SELF | unix.FAN_MOVE_SELF, opSelf},
+	{unix.FAN_ONDIR, opIsDir},
+	{unix.FAN_Q_OVERFLOW, opOverflow},
+}
+
+// Offsets in a fanotify_event_info_fid record
+const (
+	fidFsidOffset   = 4  // __kernel_fsid_t fsid
+	fidHandleOffset = 12 // struct file_handle
+	fidHeaderSize   = fidHandleOffset + 8
+)
+
+// fanotifyMetadataSize is the size of the header of each event
+const fanotifyMetadataSize = int(unsafe.Sizeof(unix.FanotifyEventMetadata{}))
+
+// fanotify watches whole filesystems with fanotify.
+//
+// Events are reported with the file handle of the directory they
+// happened in and the name of the entry, so the directories are keyed
+// by their file handle, and events in directories which aren't being
+// watched are ignored.
+type fanotify struct {
+	fd   int
+	file *os.File // fd wrapped so reads can be interrupted by Close
+
+	mu     sync.Mutex
+	marked map[uint64]struct{} // devices with a filesystem mark
+}
+
+// newFanotify returns a new fanotify notifier
+//
+// This needs CAP_SYS_ADMIN and Linux 5.9 or later to report names.
+func newFanotify() (*fanotify, error) {
+	// The queue is read as fast as possible and must not drop
+	// events for other directories on the filesystem
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_NOTIF|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK|unix.FAN_UNLIMITED_QUEUE|unix.FAN_REPORT_DFID_NAME, unix.O_RDONLY|unix.O_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	return &fanotify{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "fanotify"),
+		marked: make(map[uint64]struct{}),
+	}, nil
+}
+
+// watch the directory at osPath, marking its filesystem if it isn't
+// already
+func (n *fanotify) watch(osPath string) (key string, err error) {
+	var st unix.Stat_t
+	if err := unix.Stat(osPath, &st); err != nil {
+		return "", err
+	}
+	n.mu.Lock()
+	dev := uint64(st.Dev) //nolint:unconvert // not uint64 on all platforms
+	_, found := n.marked[dev]
+	if !found {
+		err = unix.FanotifyMark(n.fd, unix.FAN_MARK_ADD|unix.FAN_MARK_FILESYSTEM, fanotifyMask, unix.AT_FDCWD, osPath)
+		if err == nil {
+			n.marked[dev] = struct{}{}
+		}
+	}
+	n.mu.Unlock()
+	if err != nil {
+		return "", fmt.Errorf("failed to mark filesystem: %w", err)
+	}
+	var stfs unix.Statfs_t
+	if err := unix.Statfs(osPath, &stfs); err != nil {
+		return "", err
+	}
+	handle, _, err := unix.NameToHandleAt(unix.AT_FDCWD, osPath, 0)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file handle: %w", err)
+	}
+	fsid := (*[8]byte)(unsafe.Pointer(&stfs.Fsid))
+	return fanotifyKey(fsid[:], uint32(handle.Type()), handle.Bytes()), nil
+}
+
+// fanotifyKey returns the key for the directory with the file handle
+// passed in
+func fanotifyKey(fsid []byte, handleType uint32, handle []byte) string {
+	key := make([]byte, 0, len(fsid)+4+len(handle))
+	key = append(key, fsid...)
+	key = binary.NativeEndian.AppendUint32(key, handleType)
+	key = append(key, handle...)
+	return string(key)
+}
+
+// unwatch does nothing as the whole filesystem is watched
+func (n *fanotify) unwatch(key string) {}
+
+// read the events from fanotify until it is closed
+func (n *fanotify) read(handle func(event)) error {
+	buf := make([]byte, 256*1024)
+	for {
+		nread, err := n.file.Read(buf)
+		if err != nil {
+			return err
+		}
+		for offset := 0; offset+fanotifyMetadataSize <= nread; {
+			meta := (*unix.FanotifyEventMetadata)(unsafe.Pointer(&buf[offset]))
+			end := offset + int(meta.Event_len)
+			if int(meta.Event_len) < fanotifyMetadataSize || end > nread {
+				break
+			}
+			if meta.Vers != unix.FANOTIFY_METADATA_VERSION {
+				return fmt.Errorf("unsupported fanotify version %d", meta.Vers)
+			}
+			if meta.Fd >= 0 {
+				_ = unix.Close(int(meta.Fd))
+			}
+			var ev event
+			for _, m := range fanotifyOps {
+				if meta.Mask&m.mask != 0 {
+					ev.op |= m.op
+				}
+			}
+			ev.key, ev.name = parseFanotifyInfo(buf[offset+int(meta.Metadata_len) : end])
+			if ev.key != "" || ev.op&opOverflow != 0 {
+				handle(ev)
+			}
+			offset = end
+		}
+	}
+}
+
+// parseFanotifyInfo returns the directory key and name from the info
+// records of an event
+func parseFanotifyInfo(info []byte) (key, name string) {
+	for len(info) >= 4 {
+		recordType := info[0]
+		recordLen := int(binary.NativeEndian.Uint16(info[2:4]))
+		if recordLen < 4 || recordLen > len(info) {
+			break
+		}
+		record := info[:recordLen]
+		info = info[recordLen:]
+		if recordType != unix.FAN_EVENT_INFO_TYPE_DFID_NAME || len(record) < fidHeaderSize {
+			continue
+		}
+		handleLen := int(binary.NativeEndian.Uint32(record[fidHandleOffset:]))
+		nameStart := fidHeaderSize + handleLen
+		if nameStart > len(record) {
+			continue
+		}
+		handleType := binary.NativeEndian.Uint32(record[fidHandleOffset+4:])
+		key = fanotifyKey(record[fidFsidOffset:fidHandleOffset], handleType, record[fidHeaderSize:nameStart])
+		name = string(record[nameStart:])
+		if i := strings.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		if name == "." {
+			// Event on the directory itself
+			name = ""
+		}
+		return key, name
+	}
+	return "", ""
+}
+
+// close the fanotify file descriptor
+func (n *fanotify) close() error {
+	return n.file.Close()
+}
+
+// String returns the name of the notifier
+func (n *fanotify) String() string {
+	return "fanotify"
+}
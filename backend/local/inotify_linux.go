@@ -0,0 +1,111 @@
+//go:build linux
+
+package local
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask is the set of inotify events watched for on each directory
+const inotifyMask = unix.IN_ATTRIB | unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF | unix.IN_MOVE_SELF |
+	unix.IN_ONLYDIR | unix.IN_DONT_FOLLOW
+
+// inotifyOps maps inotify events to event ops
+var inotifyOps = []struct {
+	mask uint32
+	op   eventOp
+}{
+	{unix.IN_CREATE, opCreate},
+	{unix.IN_MOVED_TO, opMovedIn},
+	{unix.IN_CLOSE_WRITE, opWrite},
+	{unix.IN_ATTRIB, opChange},
+	{unix.IN_DELETE | unix.IN_MOVED_FROM, opRemove},
+	{unix.IN_DELETE_SELF | unix.IN_MOVE_SELF, opSelf},
+	{unix.IN_ISDIR, opIsDir},
+	{unix.IN_Q_OVERFLOW, opOverflow},
+	{unix.IN_IGNORED, opIgnored},
+}
+
+// inotify watches each directory with its own inotify watch
+type inotify struct {
+	fd   int
+	file *os.File // fd wrapped so reads can be interrupted by Close
+}
+
+// newInotify returns a new inotify notifier
+func newInotify() (*inotify, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	return &inotify{
+		fd:   fd,
+		file: os.NewFile(uintptr(fd), "inotify"),
+	}, nil
+}
+
+// watch adds an inotify watch to the directory at osPath
+func (n *inotify) watch(osPath string) (key string, err error) {
+	wd, err := unix.InotifyAddWatch(n.fd, osPath, inotifyMask)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(wd), nil
+}
+
+// unwatch removes the inotify watch with key
+func (n *inotify) unwatch(key string) {
+	wd, err := strconv.Atoi(key)
+	if err != nil {
+		return
+	}
+	// This can fail if the directory has gone already
+	_, _ = unix.InotifyRmWatch(n.fd, uint32(wd))
+}
+
+// read the events from inotify until it is closed
+func (n *inotify) read(handle func(event)) error {
+	// Big enough for many events each with a maximum length name
+	var buf [unix.SizeofInotifyEvent * 4096]byte
+	for {
+		nread, err := n.file.Read(buf[:])
+		if err != nil {
+			return err
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= nread; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+			if nameEnd > nread {
+				break
+			}
+			ev := event{
+				key:  strconv.Itoa(int(raw.Wd)),
+				name: strings.TrimRight(string(buf[nameStart:nameEnd]), "\x00"),
+			}
+			for _, m := range inotifyOps {
+				if raw.Mask&m.mask != 0 {
+					ev.op |= m.op
+				}
+			}
+			handle(ev)
+			offset = nameEnd
+		}
+	}
+}
+
+// close the inotify file descriptor
+func (n *inotify) close() error {
+	return n.file.Close()
+}
+
+// String returns the name of the notifier
+func (n *inotify) String() string {
+	return "inotify"
+}
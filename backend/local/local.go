@@ -305,6 +305,19 @@ only useful for reading.
 					Help:  "The last status change time.",
 				}},
 			},
+			{
+				Name: "hashes",
+				Help: `Comma separated list of hashes to calculate together.
+
+Normally rclone reads a file once for each hash type it is asked
+for. If you set this then whenever a hash is needed all the hashes
+listed here are calculated in the same pass over the file and kept
+for later. This is useful when several hashes will be needed, for
+example when using a fast hash like xxh3 or blake3 alongside md5.
+`,
+				Default:  fs.CommaSepList{},
+				Advanced: true,
+			},
 			{
 				Name:     config.ConfigEncoding,
 				Help:     config.ConfigEncodingHelp,
@@ -333,6 +346,7 @@ type Options struct {
 	TimeType          timeType             `config:"time_type"`
 	Enc               encoder.MultiEncoder `config:"encoding"`
 	NoClone           bool                 `config:"no_clone"`
+	Hashes            fs.CommaSepList      `config:"hashes"`
 }
 
 // Fs represents a local filesystem rooted at root
@@ -347,6 +361,7 @@ type Fs struct {
 	warnedMu       sync.Mutex          // used for locking access to 'warned'.
 	warned         map[string]struct{} // whether we have warned about this string
 	xattrSupported atomic.Int32        // whether xattrs are supported
+	hashes         hash.Set            // hashes calculated together when one is needed
 
 	// do os.Lstat or os.Stat
 	lstat        func(name string) (os.FileInfo, error)
@@ -406,6 +421,13 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 	if xattrSupported {
 		f.xattrSupported.Store(1)
 	}
+	for _, hashName := range opt.Hashes {
+		var ht hash.Type
+		if err := ht.Set(hashName); err != nil {
+			return nil, fmt.Errorf("invalid token %q in hash string %q", hashName, opt.Hashes.String())
+		}
+		f.hashes.Add(ht)
+	}
 	f.root = cleanRootPath(root, f.opt.NoUNC, f.opt.Enc)
 	f.features = (&fs.Features{
 		CaseInsensitive:          f.caseInsensitive(),
@@ -588,12 +610,31 @@ func (f *Fs) newDirectory(dir string, fi os.FileInfo) *Directory {
 // This should return ErrDirNotFound if the directory isn't
 // found.
 func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	err = f.ListP(ctx, dir, func(newEntries fs.DirEntries) error {
+		entries = append(entries, newEntries...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ListP lists the objects and directories in dir calling callback
+// with each batch of entries read from the directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) ListP(ctx context.Context, dir string, callback fs.ListRCallback) (err error) {
 	filter, useFilter := filter.GetConfig(ctx), filter.GetUseFilter(ctx)
 
 	fsDirPath := f.localPath(dir)
 	_, err = os.Stat(fsDirPath)
 	if err != nil {
-		return nil, fs.ErrorDirNotFound
+		return fs.ErrorDirNotFound
 	}
 
 	fd, err := os.Open(fsDirPath)
@@ -605,7 +646,7 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 			_ = accounting.Stats(ctx).Error(fserrors.NoRetryError(err))
 			err = nil // ignore error but fail sync
 		}
-		return nil, err
+		return err
 	}
 	defer func() {
 		cerr := fd.Close()
@@ -616,6 +657,7 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 
 	for {
 		var fis []os.FileInfo
+		var entries fs.DirEntries
 		if useReadDir {
 			// Windows and Plan9 read the directory entries with the stat information in which
 			// shouldn't fail because of unreadable entries.
@@ -657,7 +699,7 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 			}
 		}
 		if err != nil {
-			return nil, fmt.Errorf("failed to read directory entry: %w", err)
+			return fmt.Errorf("failed to read directory entry: %w", err)
 		}
 
 		for _, fi := range fis {
@@ -680,7 +722,7 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 					continue
 				}
 				if err != nil {
-					return nil, err
+					return err
 				}
 				mode = fi.Mode()
 			}
@@ -703,15 +745,20 @@ func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err e
 				}
 				fso, err := f.newObjectWithInfo(newRemote, fi)
 				if err != nil {
-					return nil, err
+					return err
 				}
 				if fso.Storable() {
 					entries = append(entries, fso)
 				}
 			}
 		}
+		if len(entries) > 0 {
+			if err = callback(entries); err != nil {
+				return err
+			}
+		}
 	}
-	return entries, nil
+	return nil
 }
 
 func (f *Fs) cleanRemote(dir, filename string) (remote string) {
@@ -1134,8 +1181,11 @@ func (o *Object) Hash(ctx context.Context, r hash.Type) (string, error) {
 		if err != nil {
 			return "", fmt.Errorf("hash: failed to open: %w", err)
 		}
+		// Calculate any other hashes wanted in the same pass
+		set := o.fs.hashes
+		set.Add(r)
 		var hashes map[hash.Type]string
-		hashes, err = hash.StreamTypes(readers.NewContextReader(ctx, in), hash.NewHashSet(r))
+		hashes, err = hash.StreamTypes(readers.NewContextReader(ctx, in), set)
 		closeErr := in.Close()
 		if err != nil {
 			return "", fmt.Errorf("hash: failed to read: %w", err)
@@ -1145,10 +1195,12 @@ func (o *Object) Hash(ctx context.Context, r hash.Type) (string, error) {
 		}
 		hashValue = hashes[r]
 		o.fs.objectMetaMu.Lock()
-		if o.hashes == nil {
+		if o.hashes == nil || changed {
 			o.hashes = hashes
 		} else {
-			o.hashes[r] = hashValue
+			for ht, value := range hashes {
+				o.hashes[ht] = value
+			}
 		}
 		o.fs.objectMetaMu.Unlock()
 	}
@@ -1551,6 +1603,38 @@ func (o *Object) setMetadata(info os.FileInfo) {
 	}
 }
 
+// WriteRange overwrites the file's data at offset with p leaving its
+// size and modification time unchanged
+func (o *Object) WriteRange(ctx context.Context, p []byte, offset int64) (err error) {
+	if o.translatedLink {
+		return errors.New("can't write a range of a symlink")
+	}
+	if offset < 0 || offset+int64(len(p)) > o.Size() {
+		return fmt.Errorf("range %d+%d outside object of size %d", offset, len(p), o.Size())
+	}
+	modTime := o.ModTime(ctx)
+	out, err := file.OpenFile(o.path, os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	o.clearHashCache()
+	_, err = out.WriteAt(p, offset)
+	closeErr := out.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if !o.fs.opt.NoSetModTime {
+		err = o.setTimes(modTime, modTime)
+		if err != nil {
+			return err
+		}
+	}
+	return o.lstat()
+}
+
 // clearHashCache wipes any cached hashes for the object
 func (o *Object) clearHashCache() {
 	o.fs.objectMetaMu.Lock()
@@ -1696,6 +1780,7 @@ var (
 	_ fs.PutStreamer     = &Fs{}
 	_ fs.Mover           = &Fs{}
 	_ fs.DirMover        = &Fs{}
+	_ fs.ListPer         = &Fs{}
 	_ fs.Commander       = &Fs{}
 	_ fs.OpenWriterAter  = &Fs{}
 	_ fs.DirSetModTimer  = &Fs{}
@@ -1703,6 +1788,7 @@ var (
 	_ fs.Object          = &Object{}
 	_ fs.Metadataer      = &Object{}
 	_ fs.SetMetadataer   = &Object{}
+	_ fs.RangeWriter     = &Object{}
 	_ fs.Directory       = &Directory{}
 	_ fs.SetModTimer     = &Directory{}
 	_ fs.SetMetadataer   = &Directory{}
@@ -263,6 +263,69 @@ func TestHashOnDelete(t *testing.T) {
 	require.Error(t, err)
 }
 
+// Test writing a range of an object
+func TestWriteRange(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	const filePath = "file.txt"
+	when := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	r.WriteFile(filePath, "content", when)
+	f := r.Flocal.(*Fs)
+
+	o, err := f.NewObject(ctx, filePath)
+	require.NoError(t, err)
+	md5, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, "9a0364b9e99bb480dd25e1f0284c8555", md5)
+
+	do := o.(fs.RangeWriter)
+	require.NoError(t, do.WriteRange(ctx, []byte("CON"), 0))
+	assert.Error(t, do.WriteRange(ctx, []byte("TENTS"), 3))
+	assert.Error(t, do.WriteRange(ctx, []byte("C"), -1))
+
+	// Check the contents and hash changed but not the size or modtime
+	r.CheckLocalItems(t, fstest.NewItem(filePath, "CONtent", when))
+	assert.Equal(t, int64(7), o.Size())
+	fstest.AssertTimeEqualWithPrecision(t, filePath, when, o.ModTime(ctx), f.Precision())
+	md5, err = o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, "d9e3c8000fe79644c3d6a4343430cfb2", md5)
+}
+
+// Test the hashes listed in --local-hashes are calculated together
+func TestHashesTogether(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	const filePath = "file.txt"
+	r.WriteFile(filePath, "content", time.Now())
+
+	f, err := NewFs(ctx, "local", r.LocalName, configmap.Simple{
+		"hashes": "xxh3,blake3",
+	})
+	require.NoError(t, err)
+	o, err := f.NewObject(ctx, filePath)
+	require.NoError(t, err)
+
+	md5, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, "9a0364b9e99bb480dd25e1f0284c8555", md5)
+	assert.Equal(t, map[hash.Type]string{
+		hash.MD5:    "9a0364b9e99bb480dd25e1f0284c8555",
+		hash.XXH3:   "55f2b31a6acfaa64",
+		hash.BLAKE3: "3fba5250be9ac259c56e7250c526bc83bacb4be825f2799d3d59e5b4878dd74e",
+	}, o.(*Object).hashes)
+
+	xxh128, err := o.Hash(ctx, hash.XXH128)
+	require.NoError(t, err)
+	assert.Equal(t, "917e1274274fc195b27a2d2388d9568c", xxh128)
+	assert.Len(t, o.(*Object).hashes, 4)
+
+	_, err = NewFs(ctx, "local", r.LocalName, configmap.Simple{
+		"hashes": "potato",
+	})
+	assert.Error(t, err)
+}
+
 func TestMetadata(t *testing.T) {
 	ctx := context.Background()
 	r := fstest.NewRun(t)
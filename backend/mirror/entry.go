@@ -0,0 +1,456 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/backend/union"
+	"github.com/rclone/rclone/backend/union/upstream"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// errCorruptReplica is returned at the end of a read if the copy
+// read doesn't match the others.
+var errCorruptReplica = errors.New("copy read doesn't match the other copies - retry to read a different copy")
+
+// Object describes a mirror Object
+//
+// The embedded upstream Object is the first copy found and is used
+// for the object's attributes.
+type Object struct {
+	*upstream.Object
+	fs       *Fs                // what this object is part of
+	replicas []*upstream.Object // copy on each upstream or nil if missing
+	listed   []bool             // set if the upstream was read without error
+	mu       sync.Mutex         // protects bad
+	bad      map[int]struct{}   // copies found to be bad
+}
+
+// Directory describes a mirror Directory
+//
+// This is a wrapped directory which contains the directory on each
+// upstream.
+type Directory struct {
+	*upstream.Directory
+	fs   *Fs                   // what this directory is part of
+	dirs []*upstream.Directory // directory on each upstream or nil if missing
+}
+
+// newObject makes an Object from the copies on each upstream
+//
+// listed says which upstreams were read successfully so that the
+// copies known to be missing can be repaired.
+//
+// It returns nil if there are no copies.
+func (f *Fs) newObject(replicas []*upstream.Object, listed []bool) *Object {
+	for _, r := range replicas {
+		if r != nil {
+			return &Object{
+				Object:   r,
+				fs:       f,
+				replicas: replicas,
+				listed:   listed,
+			}
+		}
+	}
+	return nil
+}
+
+// newDirectory makes a Directory from the directories on each
+// upstream
+//
+// It returns nil if there are no directories.
+func (f *Fs) newDirectory(dirs []*upstream.Directory) *Directory {
+	for _, d := range dirs {
+		if d != nil {
+			return &Directory{
+				Directory: d,
+				fs:        f,
+				dirs:      dirs,
+			}
+		}
+	}
+	return nil
+}
+
+// Update o with the contents of newO
+func (o *Object) update(newO *Object) {
+	o.Object = newO.Object
+	o.replicas = newO.replicas
+	o.listed = newO.listed
+	o.mu.Lock()
+	o.bad = nil
+	o.mu.Unlock()
+}
+
+// primary returns the copy used for the object's attributes
+func (o *Object) primary() *upstream.Object {
+	return o.Object
+}
+
+// missingReplicas returns the upstreams known not to have a copy
+func (o *Object) missingReplicas() (missing []int) {
+	for i, r := range o.replicas {
+		if r == nil && o.listed[i] {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// markBad marks the copy on upstream i as bad so it is read last
+func (o *Object) markBad(i int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.bad == nil {
+		o.bad = make(map[int]struct{})
+	}
+	o.bad[i] = struct{}{}
+}
+
+// readOrder returns the upstreams to read the copies from in the
+// order to try them - the copies not known to be bad come first.
+func (o *Object) readOrder() (order []int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var bad []int
+	for i, r := range o.replicas {
+		if r == nil {
+			continue
+		}
+		if _, isBad := o.bad[i]; isBad {
+			bad = append(bad, i)
+		} else {
+			order = append(order, i)
+		}
+	}
+	return append(order, bad...)
+}
+
+// forEach calls fn on each copy of the object concurrently
+func (o *Object) forEach(fn func(r *upstream.Object) error) error {
+	errs := make(union.Errors, len(o.replicas))
+	multithread(len(o.replicas), func(i int) {
+		r := o.replicas[i]
+		if r == nil {
+			return
+		}
+		err := fn(r)
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", r.UpstreamFs().Name(), err)
+		}
+	})
+	return errs.Err()
+}
+
+// Fs returns the mirror Fs as the parent
+func (o *Object) Fs() fs.Info {
+	return o.fs
+}
+
+// Update in to the object with the modTime given of the given size
+//
+// When called from outside an Fs by rclone, src.Size() will always be >= 0.
+// But for unknown-sized objects (indicated by src.Size() == -1), Upload should either
+// return an error or update the object properly (rather than e.g. calling panic).
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	newO, err := o.fs.write(ctx, in, src, false, o.replicas, options...)
+	if err != nil {
+		return err
+	}
+	o.update(newO)
+	return nil
+}
+
+// Remove every copy of the object
+func (o *Object) Remove(ctx context.Context) error {
+	return o.forEach(func(r *upstream.Object) error {
+		return r.Remove(ctx)
+	})
+}
+
+// SetModTime sets the modification time of every copy of the object
+func (o *Object) SetModTime(ctx context.Context, t time.Time) error {
+	return o.forEach(func(r *upstream.Object) error {
+		return r.SetModTime(ctx, t)
+	})
+}
+
+// SetMetadata sets metadata on every copy of the object
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	return o.forEach(func(r *upstream.Object) error {
+		return r.SetMetadata(ctx, metadata)
+	})
+}
+
+// SetTier changes the storage tier of every copy of the object
+func (o *Object) SetTier(tier string) error {
+	return o.forEach(func(r *upstream.Object) error {
+		return r.SetTier(tier)
+	})
+}
+
+// Open opens the file for read.  Call Close() on the returned io.ReadCloser
+//
+// The copies are read in turn until one opens. If reading fails part
+// way through, the rest of the file is read from the next copy.
+//
+// If the whole file is read and verify_hash is set then its hash is
+// checked against the other copies when the end is reached.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	r := &reader{
+		ctx:     ctx,
+		o:       o,
+		order:   o.readOrder(),
+		limit:   -1,
+		options: options,
+	}
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			r.offset = x.Offset
+		case *fs.RangeOption:
+			r.offset, r.limit = x.Decode(o.Size())
+		default:
+			r.extraOptions = append(r.extraOptions, option)
+		}
+	}
+	if o.fs.hashType != hash.None && r.offset == 0 && r.limit < 0 {
+		var err error
+		r.hasher, err = hash.NewMultiHasherTypes(hash.NewHashSet(o.fs.hashType))
+		if err != nil {
+			return nil, err
+		}
+	}
+	if missing := o.missingReplicas(); len(missing) > 0 {
+		o.fs.repair(o.primary(), missing, "copy missing")
+	}
+	err := r.open()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// reader reads an object from its copies, failing over to the next
+// copy on error.
+type reader struct {
+	ctx          context.Context
+	o            *Object
+	order        []int             // upstreams to read from
+	next         int               // index in order of the next copy to try
+	current      int               // upstream of the copy being read
+	in           io.ReadCloser     // the copy being read
+	offset       int64             // offset of the next byte to read
+	limit        int64             // bytes left to read or -1 for all
+	options      []fs.OpenOption   // options for the first open
+	extraOptions []fs.OpenOption   // options without seek or range
+	hasher       *hash.MultiHasher // if set, hash the data to verify it
+}
+
+// open the next copy which can be opened
+func (r *reader) open() error {
+	var errs union.Errors
+	var failed []int
+	for r.next < len(r.order) {
+		i := r.order[r.next]
+		options := r.options
+		if r.next > 0 {
+			// Carry on from where the last copy failed
+			options = append([]fs.OpenOption{}, r.extraOptions...)
+			if r.limit >= 0 {
+				options = append(options, &fs.RangeOption{Start: r.offset, End: r.offset + r.limit - 1})
+			} else if r.offset > 0 {
+				options = append(options, &fs.SeekOption{Offset: r.offset})
+			}
+		}
+		r.next++
+		replica := r.o.replicas[i]
+		in, err := replica.Open(r.ctx, options...)
+		if err != nil {
+			fs.Errorf(r.o, "Failed to open copy on %s - trying next copy: %v", replica.UpstreamFs().Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", replica.UpstreamFs().Name(), err))
+			r.o.markBad(i)
+			failed = append(failed, i)
+			continue
+		}
+		r.in, r.current = in, i
+		r.o.fs.repair(replica, failed, "open failed")
+		return nil
+	}
+	if len(errs) == 0 {
+		return fs.ErrorObjectNotFound
+	}
+	return errs
+}
+
+// Read bytes from the object - see io.Reader
+func (r *reader) Read(p []byte) (n int, err error) {
+	for {
+		if r.limit == 0 {
+			return 0, io.EOF
+		}
+		if r.limit > 0 && int64(len(p)) > r.limit {
+			p = p[:r.limit]
+		}
+		n, err = r.in.Read(p)
+		r.offset += int64(n)
+		if r.limit > 0 {
+			r.limit -= int64(n)
+		}
+		if r.hasher != nil {
+			_, _ = r.hasher.Write(p[:n])
+		}
+		if err == nil {
+			return n, nil
+		}
+		if err == io.EOF {
+			if r.hasher != nil {
+				if verifyErr := r.verify(); verifyErr != nil {
+					return n, verifyErr
+				}
+			}
+			return n, io.EOF
+		}
+		replica := r.o.replicas[r.current]
+		fs.Errorf(r.o, "Failed to read copy on %s at offset %d - trying next copy: %v", replica.UpstreamFs().Name(), r.offset, err)
+		r.o.markBad(r.current)
+		_ = r.in.Close()
+		// The data now comes from more than one copy so can't be
+		// checked against any of them
+		r.hasher = nil
+		if openErr := r.open(); openErr != nil {
+			return n, err
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close the object
+func (r *reader) Close() error {
+	return r.in.Close()
+}
+
+// verify checks the hash of the data read against the copy it was
+// read from and the other copies.
+//
+// If the copy read is bad it is repaired and an error is returned so
+// the read can be retried from a good copy. If other copies are bad
+// they are repaired.
+func (r *reader) verify() error {
+	o, f, ctx := r.o, r.o.fs, r.ctx
+	sum, err := r.hasher.SumString(f.hashType, false)
+	if err != nil {
+		return err
+	}
+	read := o.replicas[r.current]
+	// The data read should match the hash of the copy it was read
+	// from if that can be read cheaply
+	readBad := false
+	if !read.UpstreamFs().Features().SlowHash {
+		stored, err := read.Hash(ctx, f.hashType)
+		if err == nil && stored != "" && stored != sum {
+			fs.Errorf(o, "Copy on %s has %v %s but read %s", read.UpstreamFs().Name(), f.hashType, stored, sum)
+			readBad = true
+		}
+	}
+	// Count the votes of the other copies
+	agree, agreeing, disagreeing := 1, []int(nil), []int(nil)
+	for i, replica := range o.replicas {
+		if i == r.current || replica == nil {
+			continue
+		}
+		other, err := replica.Hash(ctx, f.hashType)
+		if err != nil || other == "" {
+			fs.Debugf(o, "Can't read %v of copy on %s: %v", f.hashType, replica.UpstreamFs().Name(), err)
+			continue
+		}
+		if other == sum {
+			agree++
+			agreeing = append(agreeing, i)
+		} else {
+			disagreeing = append(disagreeing, i)
+		}
+	}
+	switch {
+	case !readBad && agree > len(disagreeing):
+		if len(disagreeing) > 0 {
+			fs.Errorf(o, "%d copies don't match the copy read from %s", len(disagreeing), read.UpstreamFs().Name())
+			f.repair(read, disagreeing, "hash mismatch")
+		}
+		return nil
+	case readBad || len(disagreeing) > agree:
+		o.markBad(r.current)
+		good := disagreeing
+		if readBad && len(agreeing) > 0 {
+			good = agreeing
+		}
+		if len(good) == 0 {
+			return fmt.Errorf("copy on %s is corrupt and there are no good copies: %w", read.UpstreamFs().Name(), errCorruptReplica)
+		}
+		fs.Errorf(o, "Copy read from %s doesn't match the other copies", read.UpstreamFs().Name())
+		f.repair(o.replicas[good[0]], []int{r.current}, "hash mismatch")
+		return fserrors.RetryError(errCorruptReplica)
+	default:
+		fs.Errorf(o, "Copies have different %v hashes and there is no majority - run the resync command to fix", f.hashType)
+		return nil
+	}
+}
+
+// ModTime returns the latest modification time of the directory
+func (d *Directory) ModTime(ctx context.Context) (t time.Time) {
+	for _, dir := range d.dirs {
+		if dir == nil {
+			continue
+		}
+		if modTime := dir.ModTime(ctx); modTime.After(t) {
+			t = modTime
+		}
+	}
+	return t
+}
+
+// forEach calls fn on each directory concurrently
+func (d *Directory) forEach(fn func(dir *upstream.Directory) error) error {
+	errs := make(union.Errors, len(d.dirs))
+	multithread(len(d.dirs), func(i int) {
+		dir := d.dirs[i]
+		if dir == nil {
+			return
+		}
+		err := fn(dir)
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", dir.UpstreamFs().Name(), err)
+		}
+	})
+	return errs.Err()
+}
+
+// SetMetadata sets metadata for the directory on every upstream
+func (d *Directory) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	return d.forEach(func(dir *upstream.Directory) error {
+		return dir.SetMetadata(ctx, metadata)
+	})
+}
+
+// SetModTime sets the modification time of the directory on every
+// upstream
+func (d *Directory) SetModTime(ctx context.Context, t time.Time) error {
+	return d.forEach(func(dir *upstream.Directory) error {
+		return dir.SetModTime(ctx, t)
+	})
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.FullObject    = (*Object)(nil)
+	_ fs.FullDirectory = (*Directory)(nil)
+)
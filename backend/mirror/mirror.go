@@ -0,0 +1,936 @@
+// Package mirror implements a backend which keeps a copy of every
+// file on each of several upstreams.
+package mirror
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/backend/union"
+	"github.com/rclone/rclone/backend/union/common"
+	"github.com/rclone/rclone/backend/union/upstream"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/atexit"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "mirror",
+		Description: "Mirror files onto several upstreams (RAID-1)",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		MetadataInfo: &fs.MetadataInfo{
+			Help: `Any metadata supported by the underlying remote is read and written.`,
+		},
+		Options: []fs.Option{{
+			Name:     "upstreams",
+			Help:     "List of space separated upstreams.\n\nEvery file is written to each of these.\n\nCan be 'remotea:test/dir remoteb:', '\"remotea:test/space dir\" remoteb:', etc.",
+			Required: true,
+		}, {
+			Name: "write_quorum",
+			Help: `Number of upstreams a write must succeed on.
+
+If a write succeeds on at least this many upstreams then it succeeds
+and the copies which failed are repaired in the background.
+
+Set to 0 to require the write to succeed on all the upstreams.`,
+			Default: 0,
+		}, {
+			Name: "verify_hash",
+			Help: `Verify the hash of files when they are read.
+
+When a whole file is read its hash is compared with the hashes of the
+other copies. If it doesn't match the majority the read returns an
+error, so it is retried from a different copy, and the bad copy is
+repaired in the background.
+
+Upstreams which need to read a file to find its hash, like local, will
+read every copy of the file to verify it.`,
+			Default:  true,
+			Advanced: true,
+		}, {
+			Name: "repair",
+			Help: `Repair missing and bad copies in the background when found.
+
+If this is false, problems are only logged and need fixing with the
+resync command.`,
+			Default:  true,
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Upstreams   fs.SpaceSepList `config:"upstreams"`
+	WriteQuorum int             `config:"write_quorum"`
+	VerifyHash  bool            `config:"verify_hash"`
+	Repair      bool            `config:"repair"`
+}
+
+// Fs represents a mirror of upstreams
+type Fs struct {
+	name      string         // name of this remote
+	root      string         // the path we are working on
+	opt       Options        // options for this Fs
+	features  *fs.Features   // optional features
+	upstreams []*upstream.Fs // the upstreams in config order
+	hashSet   hash.Set       // intersection of hash types
+	hashType  hash.Type      // hash used to verify copies or hash.None
+	quorum    int            // number of upstreams a write must succeed on
+	repairs   sync.WaitGroup // background repairs in progress
+	repairMu  sync.Mutex     // protects repairing
+	repairing map[string]struct{}
+	atexit    atexit.FnHandle // handle to wait for repairs on exit
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("mirror root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Hashes returns the hashes supported by all the upstreams
+func (f *Fs) Hashes() hash.Set {
+	return f.hashSet
+}
+
+// Precision is the greatest Precision of all upstreams
+func (f *Fs) Precision() time.Duration {
+	var greatestPrecision time.Duration
+	for _, u := range f.upstreams {
+		if u.Precision() > greatestPrecision {
+			greatestPrecision = u.Precision()
+		}
+	}
+	return greatestPrecision
+}
+
+// forEach calls fn for each upstream concurrently
+//
+// It succeeds if fn succeeds on at least quorum upstreams and returns
+// the errors from the others.
+func (f *Fs) forEach(quorum int, fn func(i int, u *upstream.Fs) error) (errs union.Errors, err error) {
+	errs = make(union.Errors, len(f.upstreams))
+	multithread(len(f.upstreams), func(i int) {
+		err := fn(i, f.upstreams[i])
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", f.upstreams[i].Name(), err)
+		}
+	})
+	errs = errs.FilterNil()
+	if len(f.upstreams)-len(errs) < quorum {
+		return errs, errs
+	}
+	return errs, nil
+}
+
+// all calls fn for each upstream concurrently returning an error if
+// any of them fail.
+func (f *Fs) all(fn func(i int, u *upstream.Fs) error) error {
+	_, err := f.forEach(len(f.upstreams), fn)
+	return err
+}
+
+// allOrNotFound is like all but if notFound is returned by all the
+// upstreams returns notFound. Otherwise notFound errors are ignored.
+func (f *Fs) allOrNotFound(notFound error, fn func(i int, u *upstream.Fs) error) error {
+	errs, _ := f.forEach(len(f.upstreams), fn)
+	if len(errs) == 0 {
+		return nil
+	}
+	notFoundCount := 0
+	errs = errs.Map(func(err error) error {
+		if errors.Is(err, notFound) {
+			notFoundCount++
+			return nil
+		}
+		return err
+	})
+	if len(errs) > 0 {
+		return errs
+	}
+	if notFoundCount == len(f.upstreams) {
+		return notFound
+	}
+	return nil
+}
+
+// Mkdir makes the directory on all the upstreams
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return f.all(func(i int, u *upstream.Fs) error {
+		return u.Mkdir(ctx, dir)
+	})
+}
+
+// MkdirMetadata makes the directory on all the upstreams with the
+// metadata given
+func (f *Fs) MkdirMetadata(ctx context.Context, dir string, metadata fs.Metadata) (fs.Directory, error) {
+	dirs := make([]*upstream.Directory, len(f.upstreams))
+	err := f.all(func(i int, u *upstream.Fs) error {
+		do := u.Features().MkdirMetadata
+		if do == nil {
+			// Just do Mkdir on upstreams which don't support MkdirMetadata
+			return u.Mkdir(ctx, dir)
+		}
+		newDir, err := do(ctx, dir, metadata)
+		if err != nil {
+			return err
+		}
+		dirs[i] = u.WrapDirectory(newDir)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	d := f.newDirectory(dirs)
+	if d == nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	return d, nil
+}
+
+// Rmdir removes the directory from all the upstreams
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return f.allOrNotFound(fs.ErrorDirNotFound, func(i int, u *upstream.Fs) error {
+		return u.Rmdir(ctx, dir)
+	})
+}
+
+// Purge all files in the directory
+//
+// Return an error if it doesn't exist
+func (f *Fs) Purge(ctx context.Context, dir string) error {
+	for _, u := range f.upstreams {
+		if u.Features().Purge == nil {
+			return fs.ErrorCantPurge
+		}
+	}
+	return f.allOrNotFound(fs.ErrorDirNotFound, func(i int, u *upstream.Fs) error {
+		return u.Features().Purge(ctx, dir)
+	})
+}
+
+// DirSetModTime sets the directory modtime for dir on all the
+// upstreams which support it
+func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) error {
+	return f.all(func(i int, u *upstream.Fs) error {
+		if do := u.Features().DirSetModTime; do != nil {
+			return do(ctx, dir, modTime)
+		}
+		return nil
+	})
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// If an upstream fails to list then the others are used.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	entriesList := make([]fs.DirEntries, len(f.upstreams))
+	errs := make([]error, len(f.upstreams))
+	multithread(len(f.upstreams), func(i int) {
+		entriesList[i], errs[i] = f.upstreams[i].List(ctx, dir)
+	})
+	found := false
+	listed := make([]bool, len(f.upstreams))
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			found = true
+			listed[i] = true
+		case errors.Is(err, fs.ErrorDirNotFound):
+			listed[i] = true
+		default:
+			fs.Errorf(f.upstreams[i], "Failed to list %q - using other upstreams: %v", dir, err)
+			if !found {
+				errs[i] = fmt.Errorf("%s: %w", f.upstreams[i].Name(), err)
+			}
+		}
+	}
+	if !found {
+		for _, err := range errs {
+			if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+				return nil, err
+			}
+		}
+		return nil, fs.ErrorDirNotFound
+	}
+	return f.mergeDirEntries(entriesList, listed), nil
+}
+
+// mergeDirEntries merges the listings of the upstreams in
+// entriesList into mirror entries.
+//
+// listed says which upstreams were listed successfully so that any
+// object not found on them is known to be missing.
+func (f *Fs) mergeDirEntries(entriesList []fs.DirEntries, listed []bool) (entries fs.DirEntries) {
+	n := len(f.upstreams)
+	type merged struct {
+		objs []*upstream.Object
+		dirs []*upstream.Directory
+	}
+	var order []string
+	byRemote := make(map[string]*merged)
+	for i, uEntries := range entriesList {
+		u := f.upstreams[i]
+		for _, entry := range uEntries {
+			remote := entry.Remote()
+			m := byRemote[remote]
+			if m == nil {
+				m = &merged{
+					objs: make([]*upstream.Object, n),
+					dirs: make([]*upstream.Directory, n),
+				}
+				byRemote[remote] = m
+				order = append(order, remote)
+			}
+			switch x := entry.(type) {
+			case fs.Object:
+				m.objs[i] = u.WrapObject(x)
+			case fs.Directory:
+				m.dirs[i] = u.WrapDirectory(x)
+			}
+		}
+	}
+	for _, remote := range order {
+		m := byRemote[remote]
+		if o := f.newObject(m.objs, listed); o != nil {
+			for i := range m.dirs {
+				if m.dirs[i] != nil {
+					fs.Errorf(o, "Is a directory on %s - run resync after fixing", f.upstreams[i].Name())
+					break
+				}
+			}
+			entries = append(entries, o)
+		} else if d := f.newDirectory(m.dirs); d != nil {
+			entries = append(entries, d)
+		}
+	}
+	return entries
+}
+
+// NewObject finds the Object at remote on the upstreams.
+//
+// If the object can't be found on some upstreams because of an error
+// the others are used. Only if none of the upstreams can be checked is
+// the error returned.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	objs := make([]*upstream.Object, len(f.upstreams))
+	listed := make([]bool, len(f.upstreams))
+	errs := make(union.Errors, len(f.upstreams))
+	multithread(len(f.upstreams), func(i int) {
+		u := f.upstreams[i]
+		o, err := u.NewObject(ctx, remote)
+		if err == fs.ErrorObjectNotFound || err == fs.ErrorIsDir {
+			listed[i] = true
+			return
+		} else if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", u.Name(), err)
+			return
+		}
+		listed[i] = true
+		objs[i] = u.WrapObject(o)
+	})
+	o := f.newObject(objs, listed)
+	if o == nil {
+		// Not found if any upstream could be checked
+		for i := range listed {
+			if listed[i] {
+				return nil, fs.ErrorObjectNotFound
+			}
+		}
+		return nil, errs.Err()
+	}
+	for _, err := range errs.FilterNil() {
+		fs.Errorf(o, "Failed to find copy - using other upstreams: %v", err)
+	}
+	return o, nil
+}
+
+// teeReader splits in into n readers
+//
+// When finished read the error from the channel
+func teeReader(n int, in io.Reader) ([]io.Reader, <-chan error) {
+	readers := make([]io.Reader, n)
+	pipeWriters := make([]*io.PipeWriter, n)
+	writers := make([]io.Writer, n)
+	errChan := make(chan error, 1)
+	for i := range writers {
+		r, w := io.Pipe()
+		bw := bufio.NewWriter(w)
+		readers[i], pipeWriters[i], writers[i] = r, w, bw
+	}
+	go func() {
+		mw := io.MultiWriter(writers...)
+		_, copyErr := io.Copy(mw, in)
+		errs := make(union.Errors, 2*n+1)
+		errs[2*n] = copyErr
+		for i, bw := range writers {
+			errs[2*i] = bw.(*bufio.Writer).Flush()
+		}
+		for i, pw := range pipeWriters {
+			errs[2*i+1] = pw.CloseWithError(copyErr)
+		}
+		errChan <- errs.Err()
+	}()
+	return readers, errChan
+}
+
+// write in to every upstream, updating the copies in replicas which
+// exist and creating the others.
+//
+// It succeeds if the write succeeds on at least f.quorum upstreams in
+// which case the failed copies are repaired in the background.
+func (f *Fs) write(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bool, replicas []*upstream.Object, options ...fs.OpenOption) (*Object, error) {
+	n := len(f.upstreams)
+	readers, errChan := teeReader(n, in)
+	newReplicas := make([]*upstream.Object, n)
+	errs := make(union.Errors, n)
+	multithread(n, func(i int) {
+		u := f.upstreams[i]
+		var err error
+		if replicas != nil && replicas[i] != nil {
+			err = replicas[i].Update(ctx, readers[i], src, options...)
+			if err == nil {
+				newReplicas[i] = replicas[i]
+			}
+		} else {
+			var o fs.Object
+			if stream {
+				o, err = u.PutStream(ctx, readers[i], src, options...)
+			} else {
+				o, err = u.Put(ctx, readers[i], src, options...)
+			}
+			if err == nil {
+				newReplicas[i] = u.WrapObject(o)
+			}
+		}
+		if err != nil {
+			errs[i] = fmt.Errorf("%s: %w", u.Name(), err)
+			// Drain the input so the other writes can continue
+			_, _ = io.Copy(io.Discard, readers[i])
+		}
+	})
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+	failed := errs.FilterNil()
+	if n-len(failed) < f.quorum {
+		return nil, fmt.Errorf("write succeeded on %d upstreams which is less than write_quorum %d: %w", n-len(failed), f.quorum, failed)
+	}
+	listed := make([]bool, n)
+	for i := range listed {
+		listed[i] = true
+	}
+	o := f.newObject(newReplicas, listed)
+	for _, err := range failed {
+		fs.Errorf(o, "Write failed but succeeded on enough other upstreams: %v", err)
+	}
+	if len(failed) > 0 {
+		f.repair(o.primary(), o.missingReplicas(), "write failed")
+	}
+	return o, nil
+}
+
+// put uploads a new object
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bool, options ...fs.OpenOption) (fs.Object, error) {
+	o, err := f.NewObject(ctx, src.Remote())
+	switch err {
+	case nil:
+		mo := o.(*Object)
+		newO, err := f.write(ctx, in, src, stream, mo.replicas, options...)
+		if err != nil {
+			return nil, err
+		}
+		return newO, nil
+	case fs.ErrorObjectNotFound:
+		newO, err := f.write(ctx, in, src, stream, nil, options...)
+		if err != nil {
+			return nil, err
+		}
+		return newO, nil
+	default:
+		return nil, err
+	}
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, false, options...)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+//
+// May create the object even if it returns an error - if so
+// will return the object and the error, otherwise will return
+// nil and the error
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, true, options...)
+}
+
+// Copy src to this remote using server-side copy operations.
+//
+// Each copy is copied on its own upstream.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantCopy
+func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || len(srcObj.replicas) != len(f.upstreams) {
+		fs.Debugf(src, "Can't copy - not same remote type")
+		return nil, fs.ErrorCantCopy
+	}
+	for _, u := range f.upstreams {
+		if u.Features().Copy == nil {
+			return nil, fs.ErrorCantCopy
+		}
+	}
+	return f.serverSide(ctx, srcObj, remote, func(u *upstream.Fs, o fs.Object) (fs.Object, error) {
+		return u.Features().Copy(ctx, o, remote)
+	})
+}
+
+// Move src to this remote using server-side move operations.
+//
+// Each copy is moved on its own upstream.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantMove
+func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || len(srcObj.replicas) != len(f.upstreams) {
+		fs.Debugf(src, "Can't move - not same remote type")
+		return nil, fs.ErrorCantMove
+	}
+	for _, u := range f.upstreams {
+		if !operations.CanServerSideMove(u) {
+			return nil, fs.ErrorCantMove
+		}
+	}
+	return f.serverSide(ctx, srcObj, remote, func(u *upstream.Fs, o fs.Object) (fs.Object, error) {
+		if do := u.Features().Move; do != nil {
+			return do(ctx, o, remote)
+		}
+		dstObj, err := u.Features().Copy(ctx, o, remote)
+		if err != nil {
+			return nil, err
+		}
+		return dstObj, o.Remove(ctx)
+	})
+}
+
+// serverSide runs fn on each copy of src to make the copies at remote
+func (f *Fs) serverSide(ctx context.Context, src *Object, remote string, fn func(u *upstream.Fs, o fs.Object) (fs.Object, error)) (fs.Object, error) {
+	newReplicas := make([]*upstream.Object, len(f.upstreams))
+	_, err := f.forEach(f.quorum, func(i int, u *upstream.Fs) error {
+		if src.replicas[i] == nil {
+			return fs.ErrorObjectNotFound
+		}
+		dstObj, err := fn(u, src.replicas[i].UnWrap())
+		if err != nil {
+			return err
+		}
+		if dstObj == nil {
+			return errors.New("destination object not found")
+		}
+		newReplicas[i] = u.WrapObject(dstObj)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	listed := make([]bool, len(f.upstreams))
+	for i := range listed {
+		listed[i] = true
+	}
+	o := f.newObject(newReplicas, listed)
+	if o == nil {
+		return nil, fs.ErrorObjectNotFound
+	}
+	if missing := o.missingReplicas(); len(missing) > 0 {
+		f.repair(o.primary(), missing, "copy missing")
+	}
+	return o, nil
+}
+
+// DirMove moves src, srcRemote to this remote at dstRemote
+// using server-side move operations.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantDirMove
+//
+// If destination exists then return fs.ErrorDirExists
+func (f *Fs) DirMove(ctx context.Context, src fs.Fs, srcRemote, dstRemote string) error {
+	srcFs, ok := src.(*Fs)
+	if !ok || len(srcFs.upstreams) != len(f.upstreams) {
+		fs.Debugf(src, "Can't move directory - not same remote type")
+		return fs.ErrorCantDirMove
+	}
+	for _, u := range f.upstreams {
+		if u.Features().DirMove == nil {
+			return fs.ErrorCantDirMove
+		}
+	}
+	errs, _ := f.forEach(0, func(i int, u *upstream.Fs) error {
+		return u.Features().DirMove(ctx, srcFs.upstreams[i].Fs, srcRemote, dstRemote)
+	})
+	if len(errs) == 0 {
+		return nil
+	}
+	notFound := 0
+	for _, err := range errs {
+		switch {
+		case errors.Is(err, fs.ErrorDirExists):
+			return fs.ErrorDirExists
+		case errors.Is(err, fs.ErrorDirNotFound):
+			notFound++
+		default:
+			return errs
+		}
+	}
+	if notFound == len(f.upstreams) {
+		return fs.ErrorDirNotFound
+	}
+	return nil
+}
+
+// ChangeNotify calls the passed function with a path
+// that has had changes. If the implementation
+// uses polling, it should adhere to the given interval.
+// At least one value will be written to the channel,
+// specifying the initial value and updated values might
+// follow. A 0 Duration should pause the polling.
+// The ChangeNotify implementation must empty the channel
+// regularly. When the channel gets closed, the implementation
+// should stop polling and release resources.
+func (f *Fs) ChangeNotify(ctx context.Context, fn func(string, fs.EntryType), ch <-chan time.Duration) {
+	var uChans []chan time.Duration
+	for _, u := range f.upstreams {
+		if do := u.Features().ChangeNotify; do != nil {
+			ch := make(chan time.Duration)
+			uChans = append(uChans, ch)
+			do(ctx, fn, ch)
+		}
+	}
+	go func() {
+		for i := range ch {
+			for _, c := range uChans {
+				c <- i
+			}
+		}
+		for _, c := range uChans {
+			close(c)
+		}
+	}()
+}
+
+// DirCacheFlush resets the directory cache - used in testing
+// as an optional interface
+func (f *Fs) DirCacheFlush() {
+	multithread(len(f.upstreams), func(i int) {
+		if do := f.upstreams[i].Features().DirCacheFlush; do != nil {
+			do()
+		}
+	})
+}
+
+// About gets quota information from the Fs
+//
+// As every file is stored on every upstream this returns the usage
+// of the most full upstream.
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	var usage *fs.Usage
+	for _, u := range f.upstreams {
+		usg, err := u.About(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if usage == nil || (usg.Free != nil && (usage.Free == nil || *usg.Free < *usage.Free)) {
+			usage = usg
+		}
+	}
+	return usage, nil
+}
+
+// CleanUp the trash in the Fs
+func (f *Fs) CleanUp(ctx context.Context) error {
+	return f.all(func(i int, u *upstream.Fs) error {
+		if do := u.Features().CleanUp; do != nil {
+			return do(ctx)
+		}
+		return nil
+	})
+}
+
+// Shutdown the backend, waiting for any repairs in progress then
+// closing any background tasks and any cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	atexit.Unregister(f.atexit)
+	f.repairs.Wait()
+	return f.all(func(i int, u *upstream.Fs) error {
+		if do := u.Features().Shutdown; do != nil {
+			return do(ctx)
+		}
+		return nil
+	})
+}
+
+// repair copies good over the copies on the upstreams in bad in the
+// background, unless the repair option is off.
+func (f *Fs) repair(good *upstream.Object, bad []int, why string) {
+	if len(bad) == 0 || good == nil {
+		return
+	}
+	names := make([]string, len(bad))
+	for j, i := range bad {
+		names[j] = f.upstreams[i].Name()
+	}
+	if !f.opt.Repair {
+		fs.Errorf(good, "Not repairing copies on %s (%s) as repair is off - run resync to fix", strings.Join(names, ", "), why)
+		return
+	}
+	remote := good.Remote()
+	f.repairMu.Lock()
+	if _, found := f.repairing[remote]; found {
+		f.repairMu.Unlock()
+		return
+	}
+	f.repairing[remote] = struct{}{}
+	f.repairMu.Unlock()
+	fs.Infof(good, "Repairing copies on %s (%s)", strings.Join(names, ", "), why)
+	f.repairs.Add(1)
+	go func() {
+		defer f.repairs.Done()
+		defer func() {
+			f.repairMu.Lock()
+			delete(f.repairing, remote)
+			f.repairMu.Unlock()
+		}()
+		ctx := context.Background()
+		for _, i := range bad {
+			err := f.repairCopy(ctx, good, i)
+			if err != nil {
+				fs.Errorf(good, "Failed to repair copy on %s: %v", f.upstreams[i].Name(), err)
+			}
+		}
+	}()
+}
+
+// repairCopy copies good to upstream i
+func (f *Fs) repairCopy(ctx context.Context, good *upstream.Object, i int) error {
+	u := f.upstreams[i]
+	remote := good.Remote()
+	dst, err := u.NewObject(ctx, remote)
+	if err == fs.ErrorObjectNotFound {
+		dst = nil
+	} else if err != nil {
+		return err
+	}
+	_, err = operations.Copy(ctx, u.Fs, dst, remote, good.UnWrap())
+	if err != nil {
+		return err
+	}
+	fs.Infof(good, "Repaired copy on %s", u.Name())
+	return nil
+}
+
+// NewFs constructs an Fs from the path.
+//
+// The returned Fs is the actual Fs, referenced by remote in the config
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	// Parse config into Options struct
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if len(opt.Upstreams) < 2 {
+		return nil, errors.New("mirror needs at least two upstreams - check the value of the upstreams setting")
+	}
+	for _, u := range opt.Upstreams {
+		if strings.HasPrefix(u, name+":") {
+			return nil, errors.New("can't point mirror remote at itself - check the value of the upstreams setting")
+		}
+		for _, suffix := range []string{":ro", ":nc", ":writeback"} {
+			if strings.HasSuffix(u, suffix) {
+				return nil, fmt.Errorf("mirror upstreams can't use %q - check the value of the upstreams setting", suffix)
+			}
+		}
+	}
+	n := len(opt.Upstreams)
+	quorum := opt.WriteQuorum
+	if quorum <= 0 {
+		quorum = n
+	} else if quorum > n {
+		return nil, fmt.Errorf("write_quorum %d is more than the number of upstreams %d", quorum, n)
+	}
+
+	root = strings.Trim(root, "/")
+	upstreamOpt := &common.Options{
+		Upstreams: opt.Upstreams,
+		CacheTime: 120,
+	}
+	newUpstreams := func(root string) ([]*upstream.Fs, error) {
+		upstreams := make([]*upstream.Fs, n)
+		errs := make([]error, n)
+		multithread(n, func(i int) {
+			upstreams[i], errs[i] = upstream.New(ctx, opt.Upstreams[i], root, upstreamOpt)
+		})
+		var fserr error
+		for _, err := range errs {
+			if err == fs.ErrorIsFile {
+				fserr = err
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return upstreams, fserr
+	}
+	upstreams, fserr := newUpstreams(root)
+	if fserr != nil && fserr != fs.ErrorIsFile {
+		return nil, fserr
+	}
+	// If the root is a file on any upstream then point all the
+	// upstreams at its parent so missing copies can be repaired
+	if fserr == fs.ErrorIsFile {
+		root = path.Dir(root)
+		if root == "." || root == "/" {
+			root = ""
+		}
+		upstreams, err = newUpstreams(root)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	f := &Fs{
+		name:      name,
+		root:      root,
+		opt:       *opt,
+		upstreams: upstreams,
+		quorum:    quorum,
+		repairing: make(map[string]struct{}),
+	}
+	features := (&fs.Features{
+		CaseInsensitive:          true,
+		DuplicateFiles:           false,
+		ReadMimeType:             true,
+		WriteMimeType:            true,
+		CanHaveEmptyDirectories:  true,
+		BucketBased:              true,
+		SetTier:                  true,
+		GetTier:                  true,
+		ReadMetadata:             true,
+		WriteMetadata:            true,
+		UserMetadata:             true,
+		ReadDirMetadata:          true,
+		WriteDirMetadata:         true,
+		WriteDirSetModTime:       true,
+		UserDirMetadata:          true,
+		DirModTimeUpdatesOnWrite: true,
+		PartialUploads:           true,
+	}).Fill(ctx, f)
+	canMove, slowHash := true, false
+	for _, u := range upstreams {
+		features = features.Mask(ctx, u) // Mask all upstream fs
+		if !operations.CanServerSideMove(u) {
+			canMove = false
+		}
+		slowHash = slowHash || u.Features().SlowHash
+	}
+	// We can move if all remotes support Move or Copy
+	if canMove {
+		features.Move = f.Move
+	}
+	// If any of upstreams are SlowHash, propagate it
+	features.SlowHash = slowHash
+	// show that we wrap other backends
+	features.Overlay = true
+	f.features = features
+	f.atexit = atexit.Register(f.repairs.Wait)
+
+	// Get common intersection of hashes
+	hashSet := upstreams[0].Hashes()
+	for _, u := range upstreams[1:] {
+		hashSet = hashSet.Overlap(u.Hashes())
+	}
+	f.hashSet = hashSet
+	f.hashType = hash.None
+	if opt.VerifyHash {
+		f.hashType = hashSet.GetOne()
+	}
+	fs.Debugf(f, "write quorum %d/%d, verify hash %v", quorum, n, f.hashType)
+	return f, fserr
+}
+
+func multithread(num int, fn func(int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < num; i++ {
+		wg.Add(1)
+		i := i
+		go func() {
+			defer wg.Done()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.Purger          = (*Fs)(nil)
+	_ fs.PutStreamer     = (*Fs)(nil)
+	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Mover           = (*Fs)(nil)
+	_ fs.DirMover        = (*Fs)(nil)
+	_ fs.DirSetModTimer  = (*Fs)(nil)
+	_ fs.MkdirMetadataer = (*Fs)(nil)
+	_ fs.DirCacheFlusher = (*Fs)(nil)
+	_ fs.ChangeNotifier  = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.Shutdowner      = (*Fs)(nil)
+	_ fs.CleanUpper      = (*Fs)(nil)
+	_ fs.Commander       = (*Fs)(nil)
+)
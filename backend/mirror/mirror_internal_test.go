@@ -0,0 +1,252 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFs makes a mirror of n local directories returning it and
+// the directories.
+func newTestFs(t *testing.T, n int, quorum string) (*Fs, []string) {
+	dirs := make([]string, n)
+	for i := range dirs {
+		dirs[i] = t.TempDir()
+	}
+	m := configmap.Simple{
+		"upstreams":    strings.Join(dirs, " "),
+		"write_quorum": quorum,
+		"verify_hash":  "true",
+		"repair":       "true",
+	}
+	f, err := NewFs(context.Background(), "TestMirrorInternal", "", m)
+	require.NoError(t, err)
+	return f.(*Fs), dirs
+}
+
+// put contents into the mirror at remote
+func put(t *testing.T, f *Fs, remote, contents string) fs.Object {
+	src := object.NewStaticObjectInfo(remote, time.Now(), int64(len(contents)), true, nil, nil)
+	o, err := f.Put(context.Background(), bytes.NewBufferString(contents), src)
+	require.NoError(t, err)
+	return o
+}
+
+// read the whole of remote from the mirror
+func read(t *testing.T, f *Fs, remote string) (string, error) {
+	ctx := context.Background()
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, in.Close())
+	return string(data), err
+}
+
+// readFile reads a copy directly from disk
+func readFile(t *testing.T, name string) string {
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestNewFsErrors(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, test := range []struct {
+		upstreams string
+		quorum    string
+		want      string
+	}{
+		{upstreams: dir, quorum: "0", want: "at least two upstreams"},
+		{upstreams: dir + " " + dir + ":ro", quorum: "0", want: `can't use ":ro"`},
+		{upstreams: dir + " TestMirror:", quorum: "0", want: "itself"},
+		{upstreams: dir + " " + dir, quorum: "3", want: "write_quorum 3 is more than"},
+	} {
+		m := configmap.Simple{
+			"upstreams":    test.upstreams,
+			"write_quorum": test.quorum,
+			"verify_hash":  "true",
+			"repair":       "true",
+		}
+		_, err := NewFs(ctx, "TestMirror", "", m)
+		require.Error(t, err, test.upstreams)
+		assert.Contains(t, err.Error(), test.want, test.upstreams)
+	}
+}
+
+func TestReadFailover(t *testing.T) {
+	f, dirs := newTestFs(t, 3, "0")
+	ctx := context.Background()
+	put(t, f, "file.txt", "hello world")
+
+	o, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+
+	// Delete the first copy so it fails to open
+	require.NoError(t, os.Remove(filepath.Join(dirs[0], "file.txt")))
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "hello world", string(data))
+
+	// Check it was repaired
+	f.repairs.Wait()
+	assert.Equal(t, "hello world", readFile(t, filepath.Join(dirs[0], "file.txt")))
+
+	// Check a range read fails over too
+	require.NoError(t, os.Remove(filepath.Join(dirs[0], "file.txt")))
+	in, err = o.Open(ctx, &fs.RangeOption{Start: 6, End: 8})
+	require.NoError(t, err)
+	data, err = io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "wor", string(data))
+	f.repairs.Wait()
+}
+
+func TestReadCorrupt(t *testing.T) {
+	f, dirs := newTestFs(t, 3, "0")
+	ctx := context.Background()
+	put(t, f, "file.txt", "hello world")
+
+	// Corrupt the first copy keeping the size the same
+	corrupt := filepath.Join(dirs[0], "file.txt")
+	require.NoError(t, os.WriteFile(corrupt, []byte("hello WORLD"), 0666))
+
+	o, err := f.NewObject(ctx, "file.txt")
+	require.NoError(t, err)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	_, err = io.ReadAll(in)
+	require.NoError(t, in.Close())
+	require.ErrorIs(t, err, errCorruptReplica)
+	assert.True(t, fserrors.IsRetryError(err))
+
+	// Retrying reads a good copy
+	in, err = o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "hello world", string(data))
+
+	// Check the bad copy was repaired
+	f.repairs.Wait()
+	assert.Equal(t, "hello world", readFile(t, corrupt))
+
+	// Corrupt a copy which isn't read - it is repaired when the
+	// file is read
+	corrupt = filepath.Join(dirs[2], "file.txt")
+	require.NoError(t, os.WriteFile(corrupt, []byte("HELLO world"), 0666))
+	data2, err := read(t, f, "file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", data2)
+	f.repairs.Wait()
+	assert.Equal(t, "hello world", readFile(t, corrupt))
+}
+
+func TestWriteQuorum(t *testing.T) {
+	ctx := context.Background()
+	// Make an upstream which can't be written to as its parent is
+	// a file
+	parent := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(parent, []byte("x"), 0666))
+	bad := filepath.Join(parent, "dir")
+	dirs := []string{t.TempDir(), t.TempDir(), bad}
+	newFs := func(quorum string) *Fs {
+		m := configmap.Simple{
+			"upstreams":    strings.Join(dirs, " "),
+			"write_quorum": quorum,
+			"verify_hash":  "true",
+			"repair":       "true",
+		}
+		f, err := NewFs(ctx, "TestMirrorQuorum", "", m)
+		require.NoError(t, err)
+		return f.(*Fs)
+	}
+
+	// All upstreams must succeed by default
+	f := newFs("0")
+	src := object.NewStaticObjectInfo("file.txt", time.Now(), 5, true, nil, nil)
+	_, err := f.Put(ctx, bytes.NewBufferString("hello"), src)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "less than write_quorum 3")
+	f.repairs.Wait()
+
+	// Two out of three is enough with write_quorum 2
+	f = newFs("2")
+	o := put(t, f, "file.txt", "hello")
+	assert.Equal(t, int64(5), o.Size())
+	f.repairs.Wait()
+	data, err := read(t, f, "file.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "hello", data)
+	f.repairs.Wait()
+}
+
+func TestResync(t *testing.T) {
+	f, dirs := newTestFs(t, 3, "0")
+	f.opt.Repair = false
+	ctx := context.Background()
+	put(t, f, "a/one.txt", "one")
+	put(t, f, "a/two.txt", "two")
+	put(t, f, "three.txt", "three")
+
+	// Make the copies diverge
+	require.NoError(t, os.Remove(filepath.Join(dirs[1], "a", "one.txt")))
+	require.NoError(t, os.WriteFile(filepath.Join(dirs[2], "a", "two.txt"), []byte("TWO"), 0666))
+	require.NoError(t, os.Mkdir(filepath.Join(dirs[0], "empty"), 0777))
+
+	// Dry run changes nothing
+	dryCtx, ci := fs.AddConfig(ctx)
+	ci.DryRun = true
+	out, err := f.Command(dryCtx, "resync", nil, nil)
+	require.NoError(t, err)
+	stats := out.(*resyncStats)
+	assert.Equal(t, int64(3), stats.Checked)
+	assert.Equal(t, int64(1), stats.Missing)
+	assert.Equal(t, int64(1), stats.Differed)
+	assert.Equal(t, int64(0), stats.Repaired)
+	assert.NoFileExists(t, filepath.Join(dirs[1], "a", "one.txt"))
+
+	out, err = f.Command(ctx, "resync", nil, nil)
+	require.NoError(t, err)
+	stats = out.(*resyncStats)
+	assert.Equal(t, int64(3), stats.Checked)
+	assert.Equal(t, int64(1), stats.Missing)
+	assert.Equal(t, int64(1), stats.Differed)
+	assert.Equal(t, int64(2), stats.Repaired)
+	assert.Equal(t, int64(0), stats.Errors)
+	assert.Equal(t, "one", readFile(t, filepath.Join(dirs[1], "a", "one.txt")))
+	assert.Equal(t, "two", readFile(t, filepath.Join(dirs[2], "a", "two.txt")))
+	for _, dir := range dirs {
+		assert.DirExists(t, filepath.Join(dir, "empty"))
+	}
+
+	// Running again finds nothing to do
+	out, err = f.Command(ctx, "resync", nil, nil)
+	require.NoError(t, err)
+	stats = out.(*resyncStats)
+	assert.Equal(t, int64(3), stats.Checked)
+	assert.Equal(t, int64(0), stats.Missing+stats.Differed+stats.Repaired+stats.Errors)
+
+	_, err = f.Command(ctx, "resync", []string{"potato"}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,208 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rclone/rclone/backend/union/upstream"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+var commandHelp = []fs.CommandHelp{
+	{
+		Name:  "resync",
+		Short: "Make the copies on every upstream the same",
+		Long: `This checks every file and directory under the path on all the
+upstreams and fixes any differences.
+
+Missing directories are created. For each file the size and hash of
+the copies are compared and the version held by most upstreams is
+copied over any copies which are missing or different. If there is no
+majority the newest version is used.
+
+Use --dry-run to see what would be done and --transfers to control how
+many files are repaired at once.
+
+Usage Example:
+
+    rclone backend resync mirror:
+    rclone backend resync mirror:path/to/dir
+    rclone rc backend/command command=resync fs=mirror:
+
+It returns a count of the files checked, missing, different and
+repaired and the number of errors.
+`,
+	},
+}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out interface{}, err error) {
+	switch name {
+	case "resync":
+		if len(arg) != 0 {
+			return nil, errors.New("resync takes no arguments - put the path in the remote")
+		}
+		return f.resync(ctx, "")
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// resyncStats counts what resync did
+type resyncStats struct {
+	mu       sync.Mutex
+	Checked  int64 `json:"checked"`  // files checked
+	Missing  int64 `json:"missing"`  // copies missing
+	Differed int64 `json:"differed"` // copies different from the majority
+	Repaired int64 `json:"repaired"` // copies repaired
+	Errors   int64 `json:"errors"`   // copies which couldn't be repaired
+}
+
+func (s *resyncStats) add(p *int64) {
+	s.mu.Lock()
+	*p++
+	s.mu.Unlock()
+}
+
+// resync makes the copies of everything under dir the same on every
+// upstream.
+func (f *Fs) resync(ctx context.Context, dir string) (*resyncStats, error) {
+	ci := fs.GetConfig(ctx)
+	stats := new(resyncStats)
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(ci.Transfers)
+	err := walk.ListR(ctx, f, dir, true, -1, walk.ListAll, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			if err := gCtx.Err(); err != nil {
+				return err
+			}
+			switch x := entry.(type) {
+			case *Directory:
+				f.resyncDir(ctx, x, stats)
+			case *Object:
+				g.Go(func() error {
+					f.resyncObject(gCtx, x, stats)
+					return nil
+				})
+			}
+		}
+		return nil
+	})
+	waitErr := g.Wait()
+	if err == nil {
+		err = waitErr
+	}
+	if err == nil && stats.Errors > 0 {
+		err = fmt.Errorf("failed to repair %d copies", stats.Errors)
+	}
+	return stats, err
+}
+
+// resyncDir creates the directory d on the upstreams it is missing from
+func (f *Fs) resyncDir(ctx context.Context, d *Directory, stats *resyncStats) {
+	for i, dir := range d.dirs {
+		if dir != nil {
+			continue
+		}
+		u := f.upstreams[i]
+		if fs.GetConfig(ctx).DryRun {
+			fs.Logf(d, "Skipped creating directory on %s as --dry-run is set", u.Name())
+			continue
+		}
+		fs.Infof(d, "Creating missing directory on %s", u.Name())
+		err := u.Mkdir(ctx, d.Remote())
+		if err != nil {
+			fs.Errorf(d, "Failed to create directory on %s: %v", u.Name(), err)
+			accounting.Stats(ctx).Error(err)
+			stats.add(&stats.Errors)
+		}
+	}
+}
+
+// resyncObject copies the majority version of o over any copies which
+// are missing or different.
+func (f *Fs) resyncObject(ctx context.Context, o *Object, stats *resyncStats) {
+	stats.add(&stats.Checked)
+	ht := f.hashSet.GetOne()
+	type version struct {
+		key      string
+		replicas []int
+		newest   *upstream.Object
+	}
+	keys := make([]string, len(o.replicas))
+	versions := make(map[string]*version)
+	for i, r := range o.replicas {
+		if r == nil {
+			continue
+		}
+		key := fmt.Sprintf("%d", r.Size())
+		if ht != hash.None {
+			sum, err := r.Hash(ctx, ht)
+			if err != nil {
+				fs.Errorf(o, "Failed to read %v of copy on %s: %v", ht, r.UpstreamFs().Name(), err)
+				stats.add(&stats.Errors)
+				return
+			}
+			key += "/" + sum
+		}
+		keys[i] = key
+		v := versions[key]
+		if v == nil {
+			v = &version{key: key}
+			versions[key] = v
+		}
+		v.replicas = append(v.replicas, i)
+		if v.newest == nil || r.ModTime(ctx).After(v.newest.ModTime(ctx)) {
+			v.newest = r
+		}
+	}
+	var best *version
+	for _, v := range versions {
+		if best == nil || len(v.replicas) > len(best.replicas) ||
+			(len(v.replicas) == len(best.replicas) && v.newest.ModTime(ctx).After(best.newest.ModTime(ctx))) {
+			best = v
+		}
+	}
+	for i, r := range o.replicas {
+		switch {
+		case r == nil && !o.listed[i]:
+			fs.Errorf(o, "Couldn't check copy on %s as it couldn't be read", f.upstreams[i].Name())
+			stats.add(&stats.Errors)
+			continue
+		case r == nil:
+			fs.Infof(o, "Copy missing on %s", f.upstreams[i].Name())
+			stats.add(&stats.Missing)
+		case keys[i] != best.key:
+			fs.Infof(o, "Copy on %s is different from the copy on %s", f.upstreams[i].Name(), best.newest.UpstreamFs().Name())
+			stats.add(&stats.Differed)
+		default:
+			continue
+		}
+		if fs.GetConfig(ctx).DryRun {
+			fs.Logf(o, "Skipped repairing copy on %s as --dry-run is set", f.upstreams[i].Name())
+			continue
+		}
+		err := f.repairCopy(ctx, best.newest, i)
+		if err != nil {
+			fs.Errorf(o, "Failed to repair copy on %s: %v", f.upstreams[i].Name(), err)
+			accounting.Stats(ctx).Error(err)
+			stats.add(&stats.Errors)
+			continue
+		}
+		stats.add(&stats.Repaired)
+	}
+}
@@ -4351,8 +4351,10 @@ func (f *Fs) itemToDirEntry(ctx context.Context, remote string, object *types.Ob
 	return o, nil
 }
 
-// listDir lists files and directories to out
-func (f *Fs) listDir(ctx context.Context, bucket, directory, prefix string, addBucket bool) (entries fs.DirEntries, err error) {
+// listDir lists files and directories calling callback with each
+// tranche of entries
+func (f *Fs) listDir(ctx context.Context, bucket, directory, prefix string, addBucket bool, callback fs.ListRCallback) (err error) {
+	list := walk.NewListRHelper(callback)
 	// List the objects and directories
 	err = f.list(ctx, listOpt{
 		bucket:       bucket,
@@ -4367,17 +4369,14 @@ func (f *Fs) listDir(ctx context.Context, bucket, directory, prefix string, addB
 		if err != nil {
 			return err
 		}
-		if entry != nil {
-			entries = append(entries, entry)
-		}
-		return nil
+		return list.Add(entry)
 	})
 	if err != nil {
-		return nil, err
+		return err
 	}
 	// bucket must be present if listing succeeded
 	f.cache.MarkOK(bucket)
-	return entries, nil
+	return list.Flush()
 }
 
 // listBuckets lists the buckets to out
@@ -4410,14 +4409,37 @@ func (f *Fs) listBuckets(ctx context.Context) (entries fs.DirEntries, err error)
 // This should return ErrDirNotFound if the directory isn't
 // found.
 func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	err = f.ListP(ctx, dir, func(newEntries fs.DirEntries) error {
+		entries = append(entries, newEntries...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ListP lists the objects and directories in dir calling callback
+// with each tranche of entries as the listing is read.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) ListP(ctx context.Context, dir string, callback fs.ListRCallback) error {
 	bucket, directory := f.split(dir)
 	if bucket == "" {
 		if directory != "" {
-			return nil, fs.ErrorListBucketRequired
+			return fs.ErrorListBucketRequired
+		}
+		entries, err := f.listBuckets(ctx)
+		if err != nil {
+			return err
 		}
-		return f.listBuckets(ctx)
+		return callback(entries)
 	}
-	return f.listDir(ctx, bucket, directory, f.rootDirectory, f.rootBucket == "")
+	return f.listDir(ctx, bucket, directory, f.rootDirectory, f.rootBucket == "", callback)
 }
 
 // ListR lists the objects and directories of the Fs starting
@@ -6714,6 +6736,7 @@ var (
 	_ fs.Copier          = &Fs{}
 	_ fs.PutStreamer     = &Fs{}
 	_ fs.ListRer         = &Fs{}
+	_ fs.ListPer         = &Fs{}
 	_ fs.Commander       = &Fs{}
 	_ fs.CleanUpper      = &Fs{}
 	_ fs.OpenChunkWriter = &Fs{}
@@ -61,6 +61,7 @@ docs = [
     "mailru.md",
     "mega.md",
     "memory.md",
+    "mirror.md",
     "netstorage.md",
     "azureblob.md",
     "azurefiles.md",
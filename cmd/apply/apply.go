@@ -0,0 +1,75 @@
+// Package apply provides the apply command.
+package apply
+
+import (
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/sync"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "apply plan.json [source:path dest:path]",
+	Short: `Do the actions in a plan file made by sync --plan-file.`,
+	Long: `Do the actions in a plan file made by ` + "`rclone sync --plan-file`" + `.
+
+This does exactly the actions recorded in the plan, from and to the
+remotes the plan was made for, and nothing else.
+
+    rclone sync --plan-file plan.json /path/to/src remote:dst
+    # review plan.json
+    rclone apply plan.json
+
+The source and destination are read from the config file using the
+remotes recorded in the plan. The plan doesn't record connection
+string parameters as they may contain credentials, so if the plan was
+made with them pass the source and destination again after the plan.
+
+    rclone sync --plan-file plan.json /path/to/src ":s3,access_key_id=XXX:bucket"
+    rclone apply plan.json /path/to/src ":s3,access_key_id=XXX:bucket"
+
+A warning is logged if these aren't the remotes the plan was made for.
+
+Before each action the files involved are checked against the
+fingerprints (size, modification time and hash) recorded in the plan.
+If a file has changed, or a file which didn't exist now does, then
+that action is refused and logged as an error. The other actions are
+still done and rclone exits with an error at the end.
+
+Use ` + "`--dry-run`" + ` to check what would be done without doing it.
+
+Apply doesn't retry as actions already done would be refused. Make a
+new plan and review it instead.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.70",
+		"groups":            "Sync,Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 3, command, args)
+		if len(args) == 2 {
+			fs.Fatalf(nil, "Pass both the source and the destination or neither")
+		}
+		plan, err := sync.LoadPlan(args[0])
+		if err != nil {
+			fs.Fatal(nil, err.Error())
+		}
+		var fsrc, fdst fs.Fs
+		if len(args) == 3 {
+			fsrc, fdst = cmd.NewFsSrcDst(args[1:])
+			if fs.ConfigString(fsrc) != plan.SrcFs || fs.ConfigString(fdst) != plan.DstFs {
+				fs.Logf(nil, "Plan was made for %q -> %q but applying it to %q -> %q", plan.SrcFs, plan.DstFs, fs.ConfigString(fsrc), fs.ConfigString(fdst))
+			}
+		} else {
+			fsrc = cmd.NewFsDir([]string{plan.SrcFs})
+			fdst = cmd.NewFsDir([]string{plan.DstFs})
+		}
+		cmd.Run(false, true, command, func() error {
+			return sync.Apply(command.Context(), fdst, fsrc, plan)
+		})
+	},
+}
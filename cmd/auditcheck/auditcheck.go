@@ -0,0 +1,55 @@
+// Package auditcheck provides the auditcheck command.
+package auditcheck
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "auditcheck /path/to/audit.log",
+	Short: `Check the hash chain of an audit log is intact.`,
+	Long: `Checks an audit log written with ` + "`--audit-log`" + ` hasn't been tampered with.
+
+Each record in the audit log contains the SHA-256 hash of the record
+before it. This command reads the log and checks that the chain of
+hashes and the record sequence numbers are unbroken, so any record
+changed, inserted or removed will be found.
+
+It exits with a non-zero exit code and reports the first bad record if
+the check fails.
+
+Note that this can't detect records removed from the end of the log,
+so keep a copy of the latest record, or of its ` + "`seq`" + ` and hash,
+somewhere safe if that matters.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.70",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		cmd.Run(false, false, command, func() (err error) {
+			in, err := os.Open(args[0])
+			if err != nil {
+				return err
+			}
+			defer fs.CheckClose(in, &err)
+			n, err := audit.Check(in)
+			if err != nil {
+				return fserrors.FatalError(fmt.Errorf("audit log %q failed check after %d good records: %w", args[0], n, err))
+			}
+			fs.Logf(nil, "Audit log %q is intact: %d records", args[0], n)
+			return nil
+		})
+	},
+}
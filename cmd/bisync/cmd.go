@@ -117,6 +117,12 @@ func (x *CheckSyncMode) Type() string {
 // Opt keeps command line options
 var Opt Options
 
+// Command line options for --watch
+var (
+	watch    = false
+	watchOpt = DefaultWatchOptions
+)
+
 func init() {
 	Opt.MaxLock = 0
 	cmd.Root.AddCommand(commandDefinition)
@@ -150,6 +156,9 @@ func init() {
 	flags.FVarP(cmdFlags, &Opt.ConflictResolve, "conflict-resolve", "", "Automatically resolve conflicts by preferring the version that is: "+ConflictResolveList+" (default: none)", "")
 	flags.FVarP(cmdFlags, &Opt.ConflictLoser, "conflict-loser", "", "Action to take on the loser of a sync conflict (when there is a winner) or on both files (when there is no winner): "+ConflictLoserList+" (default: num)", "")
 	flags.StringVarP(cmdFlags, &Opt.ConflictSuffixFlag, "conflict-suffix", "", Opt.ConflictSuffixFlag, "Suffix to use when renaming a --conflict-loser. Can be either one string or two comma-separated strings to assign different suffixes to Path1/Path2. (default: 'conflict')", "")
+	flags.BoolVarP(cmdFlags, &watch, "watch", "", watch, "Keep running and bisync again whenever either path changes", "")
+	flags.DurationVarP(cmdFlags, &watchOpt.Debounce, "watch-debounce", "", watchOpt.Debounce, "With --watch run once there have been no changes for this long", "")
+	flags.DurationVarP(cmdFlags, &watchOpt.PollInterval, "watch-interval", "", watchOpt.PollInterval, "With --watch run this often if changes can't be notified", "")
 	_ = cmdFlags.MarkHidden("debugname")
 	_ = cmdFlags.MarkHidden("localtime")
 }
@@ -192,7 +201,12 @@ var commandDefinition = &cobra.Command{
 
 		fs.Logf(nil, "bisync is IN BETA. Don't use in production!")
 		cmd.Run(false, true, command, func() error {
-			err := Bisync(ctx, fs1, fs2, &opt)
+			var err error
+			if watch {
+				err = Watch(ctx, fs1, fs2, &opt, watchOpt)
+			} else {
+				err = Bisync(ctx, fs1, fs2, &opt)
+			}
 			if err == ErrBisyncAborted {
 				return fserrors.FatalError(err)
 			}
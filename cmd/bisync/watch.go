@@ -0,0 +1,146 @@
+package bisync
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+)
+
+// WatchOptions configures Watch
+type WatchOptions struct {
+	Debounce     time.Duration // run once there have been no changes for this long
+	PollInterval time.Duration // passed to ChangeNotify and how often to run without it
+}
+
+// DefaultWatchOptions are the defaults for WatchOptions
+var DefaultWatchOptions = WatchOptions{
+	Debounce:     5 * time.Second,
+	PollInterval: time.Minute,
+}
+
+// Watch runs Bisync on fs1 and fs2 then keeps running it whenever
+// either path changes until ctx is cancelled.
+//
+// Changes are found with ChangeNotify where the backends support it.
+// Bisync is run once there have been no changes for opt.Debounce. If
+// either path can't notify changes then Bisync is run every
+// opt.PollInterval instead.
+//
+// Only the first run can be a resync. Watching stops if a run is
+// aborted as later runs would need a resync too.
+func Watch(ctx context.Context, fs1, fs2 fs.Fs, optArg *Options, opt WatchOptions) error {
+	if opt.PollInterval <= 0 {
+		return errors.New("watch interval must be greater than 0")
+	}
+	runOpt := *optArg
+
+	// Start watching before the first run so no changes are missed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	kick := make(chan struct{}, 1)
+	notify := func(remote string, entryType fs.EntryType) {
+		select {
+		case kick <- struct{}{}:
+		default:
+		}
+	}
+	notify1 := startNotify(ctx, fs1, notify, opt.PollInterval)
+	notify2 := startNotify(ctx, fs2, notify, opt.PollInterval)
+	if !notify1 || !notify2 {
+		fs.Infof(nil, "Changes aren't notified on both paths - running bisync every %v", opt.PollInterval)
+	}
+	ticker := time.NewTicker(opt.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// Errors from previous runs mustn't abort this one
+		accounting.Stats(ctx).ResetErrors()
+		err := Bisync(ctx, fs1, fs2, &runOpt)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, ErrBisyncAborted) {
+			return err
+		}
+		if err != nil {
+			fs.Errorf(nil, "Bisync failed - will run again on the next change: %v", err)
+		}
+		runOpt.Resync = false
+		runOpt.ResyncMode = PreferNone
+
+		// Changes made by the run itself cause one more run which
+		// finds nothing to do
+		if !waitForChange(ctx, kick, ticker.C, opt, notify1 && notify2) {
+			return nil
+		}
+	}
+}
+
+// startNotify starts ChangeNotify on f if it is supported, returning
+// whether it was. It stops when ctx is cancelled.
+func startNotify(ctx context.Context, f fs.Fs, notify func(string, fs.EntryType), pollInterval time.Duration) bool {
+	doChangeNotify := f.Features().ChangeNotify
+	if doChangeNotify == nil {
+		return false
+	}
+	pollIntervalChan := make(chan time.Duration, 1)
+	pollIntervalChan <- pollInterval
+	doChangeNotify(ctx, notify, pollIntervalChan)
+	go func() {
+		<-ctx.Done()
+		close(pollIntervalChan)
+	}()
+	return true
+}
+
+// waitForChange waits until bisync should run again, returning false
+// if ctx was cancelled.
+//
+// If notified is set then it waits for a change followed by
+// opt.Debounce without one, or for at most opt.PollInterval after the
+// first change. Otherwise it waits for the next tick.
+func waitForChange(ctx context.Context, kick <-chan struct{}, tick <-chan time.Time, opt WatchOptions, notified bool) bool {
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-tick:
+			if !notified {
+				return true
+			}
+		case <-kick:
+			return debounce(ctx, kick, opt)
+		}
+	}
+}
+
+// debounce waits until no changes have been notified for the debounce
+// time, or for at most the poll interval, returning false if ctx was
+// cancelled.
+func debounce(ctx context.Context, kick <-chan struct{}, opt WatchOptions) bool {
+	timer := time.NewTimer(opt.Debounce)
+	defer timer.Stop()
+	deadline := time.NewTimer(max(opt.Debounce, opt.PollInterval))
+	defer deadline.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-kick:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(opt.Debounce)
+		case <-timer.C:
+			return true
+		case <-deadline.C:
+			return true
+		}
+	}
+}
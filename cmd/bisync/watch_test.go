@@ -0,0 +1,69 @@
+package bisync_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/cmd/bisync"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path1, path2 := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(path1, "start.txt"), []byte("start"), 0666))
+	fs1, err := fs.NewFs(ctx, path1)
+	require.NoError(t, err)
+	fs2, err := fs.NewFs(ctx, path2)
+	require.NoError(t, err)
+
+	opt := &bisync.Options{
+		Resync:    true,
+		Workdir:   t.TempDir(),
+		MaxDelete: bisync.DefaultMaxDelete,
+		CheckSync: bisync.CheckSyncTrue,
+	}
+	wopt := bisync.WatchOptions{
+		Debounce:     10 * time.Millisecond,
+		PollInterval: 100 * time.Millisecond,
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- bisync.Watch(ctx, fs1, fs2, opt, wopt)
+	}()
+	exists := func(name string) func() bool {
+		return func() bool {
+			_, err := os.Stat(name)
+			return err == nil
+		}
+	}
+
+	// The first run is a resync
+	assert.Eventually(t, exists(filepath.Join(path2, "start.txt")), 10*time.Second, 10*time.Millisecond)
+
+	// Later changes on either side are synced
+	require.NoError(t, os.WriteFile(filepath.Join(path1, "one.txt"), []byte("one"), 0666))
+	assert.Eventually(t, exists(filepath.Join(path2, "one.txt")), 10*time.Second, 10*time.Millisecond)
+	require.NoError(t, os.WriteFile(filepath.Join(path2, "two.txt"), []byte("two"), 0666))
+	assert.Eventually(t, exists(filepath.Join(path1, "two.txt")), 10*time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Watch didn't stop")
+	}
+}
+
+func TestWatchBadInterval(t *testing.T) {
+	err := bisync.Watch(context.Background(), nil, nil, &bisync.Options{}, bisync.WatchOptions{})
+	assert.ErrorContains(t, err, "watch interval")
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/config/configfile"
 	"github.com/rclone/rclone/fs/config/configflags"
@@ -37,6 +38,7 @@ import (
 	"github.com/rclone/rclone/lib/buildinfo"
 	"github.com/rclone/rclone/lib/exitcode"
 	"github.com/rclone/rclone/lib/terminal"
+	"github.com/rclone/rclone/lib/tracing"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
@@ -250,6 +252,14 @@ func RunWithSustainOS(Retry bool, showStats bool, cmd *cobra.Command, f func() e
 		stopStats = StartStats()
 	}
 	SigInfoHandler()
+	// Spans of servers aren't made the root as they would collect
+	// the spans of everything served until they exit
+	startSpan := tracing.StartRoot
+	if isServer(cmd) {
+		startSpan = tracing.Start
+	}
+	ctx, span := startSpan(ctx, cmd.CommandPath())
+	cmd.SetContext(ctx)
 	for try := 1; try <= ci.Retries; try++ {
 		cmdErr = f()
 		cmdErr = fs.CountError(ctx, cmdErr)
@@ -290,6 +300,7 @@ func RunWithSustainOS(Retry bool, showStats bool, cmd *cobra.Command, f func() e
 			time.Sleep(ci.RetriesInterval)
 		}
 	}
+	tracing.End(span, cmdErr)
 	stopStats()
 	if showStats && (accounting.GlobalStats().Errored() || *statsInterval > 0) {
 		accounting.GlobalStats().Log()
@@ -343,6 +354,27 @@ func Run(Retry bool, showStats bool, cmd *cobra.Command, f func() error) {
 	RunWithSustainOS(Retry, showStats, cmd, f, false)
 }
 
+// serverCommands are the top level commands which keep running to
+// serve or mount remotes
+var serverCommands = map[string]bool{
+	"rcd":      true,
+	"serve":    true,
+	"mount":    true,
+	"cmount":   true,
+	"mount2":   true,
+	"nfsmount": true,
+}
+
+// isServer returns true if cmd keeps running to serve or mount remotes
+func isServer(cmd *cobra.Command) bool {
+	for ; cmd.HasParent(); cmd = cmd.Parent() {
+		if !cmd.Parent().HasParent() {
+			return serverCommands[cmd.Name()]
+		}
+	}
+	return false
+}
+
 // CheckArgs checks there are enough arguments and prints a message if not
 func CheckArgs(MinArgs, MaxArgs int, cmd *cobra.Command, args []string) {
 	if len(args) < MinArgs {
@@ -408,6 +440,38 @@ func initConfig() {
 	// Start accounting
 	accounting.Start(ctx)
 
+	// Start tracing if configured
+	shutdownTracing, err := tracing.Init(ctx, tracing.Options{
+		Endpoint:    ci.TraceOTLPEndpoint,
+		File:        ci.TraceFile,
+		SampleRatio: ci.TraceSampleRatio,
+		Version:     fs.Version,
+	})
+	if err != nil {
+		fs.Fatalf(nil, "Failed to start tracing: %v", err)
+	}
+	if tracing.Enabled() {
+		atexit.Register(func() {
+			if err := shutdownTracing(context.Background()); err != nil {
+				fs.Errorf(nil, "Failed to flush traces: %v", err)
+			}
+		})
+	}
+
+	// Start the audit log if configured
+	if command, _, err := Root.Find(os.Args[1:]); err == nil {
+		audit.SetCommand(command.CommandPath())
+	}
+	stopAudit, err := audit.Start(ctx)
+	if err != nil {
+		fs.Fatalf(nil, "Failed to start audit log: %v", err)
+	}
+	atexit.Register(func() {
+		if err := stopAudit(); err != nil {
+			fs.Errorf(nil, "Failed to close audit log: %v", err)
+		}
+	})
+
 	// Configure console
 	if ci.NoConsole {
 		// Hide the console window
@@ -489,6 +553,10 @@ func initConfig() {
 func resolveExitCode(err error, sustainIfNilError bool) {
 	ctx := context.Background()
 	ci := fs.GetConfig(ctx)
+	if err == nil && sustainIfNilError {
+		// Carrying on so leave the exit handlers registered
+		return
+	}
 	atexit.Run()
 	if err == nil && !sustainIfNilError {
 		if ci.ErrorOnNoTransfer {
@@ -2,7 +2,6 @@
 package copy
 
 import (
-	"context"
 	"strings"
 
 	"github.com/rclone/rclone/cmd"
@@ -100,9 +99,9 @@ for more info.
 		fsrc, srcFileName, fdst := cmd.NewFsSrcFileDst(args)
 		cmd.Run(true, true, command, func() error {
 			if srcFileName == "" {
-				return sync.CopyDir(context.Background(), fdst, fsrc, createEmptySrcDirs)
+				return sync.CopyDir(command.Context(), fdst, fsrc, createEmptySrcDirs)
 			}
-			return operations.CopyFile(context.Background(), fdst, fsrc, srcFileName, srcFileName)
+			return operations.CopyFile(command.Context(), fdst, fsrc, srcFileName, srcFileName)
 		})
 	},
 }
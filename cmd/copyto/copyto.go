@@ -2,8 +2,6 @@
 package copyto
 
 import (
-	"context"
-
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fs/sync"
@@ -54,9 +52,9 @@ the destination.
 		fsrc, srcFileName, fdst, dstFileName := cmd.NewFsSrcDstFiles(args)
 		cmd.Run(true, true, command, func() error {
 			if srcFileName == "" {
-				return sync.CopyDir(context.Background(), fdst, fsrc, false)
+				return sync.CopyDir(command.Context(), fdst, fsrc, false)
 			}
-			return operations.CopyFile(context.Background(), fdst, fsrc, dstFileName, srcFileName)
+			return operations.CopyFile(command.Context(), fdst, fsrc, dstFileName, srcFileName)
 		})
 	},
 }
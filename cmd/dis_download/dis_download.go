@@ -10,6 +10,7 @@ import (
 
 func init() {
 	cmd.Root.AddCommand(commandDefinition)
+	dis_operations.AddFlags(commandDefinition.Flags())
 }
 
 var commandDefinition = &cobra.Command{
@@ -8,6 +8,7 @@ import (
 
 func init() {
 	cmd.Root.AddCommand(commandDefinition)
+	dis_operations.AddFlags(commandDefinition.Flags())
 }
 
 var commandDefinition = &cobra.Command{
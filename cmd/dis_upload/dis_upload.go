@@ -15,6 +15,7 @@ func init() {
 	cmd.Root.AddCommand(commandDefinition)
 	loadBalancer.Value = dis_operations.RoundRobin // Default value
 	commandDefinition.Flags().VarP(&loadBalancer, "loadbalancer", "b", "Load balancing strategy (RoundRobin, ResourceBased, DownloadOptima, UploadOptima, )")
+	dis_operations.AddFlags(commandDefinition.Flags())
 }
 
 var commandDefinition = &cobra.Command{
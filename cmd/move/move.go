@@ -2,7 +2,6 @@
 package move
 
 import (
-	"context"
 	"strings"
 
 	"github.com/rclone/rclone/cmd"
@@ -76,9 +75,9 @@ for more info.
 		fsrc, srcFileName, fdst := cmd.NewFsSrcFileDst(args)
 		cmd.Run(true, true, command, func() error {
 			if srcFileName == "" {
-				return sync.MoveDir(context.Background(), fdst, fsrc, deleteEmptySrcDirs, createEmptySrcDirs)
+				return sync.MoveDir(command.Context(), fdst, fsrc, deleteEmptySrcDirs, createEmptySrcDirs)
 			}
-			return operations.MoveFile(context.Background(), fdst, fsrc, srcFileName, srcFileName)
+			return operations.MoveFile(command.Context(), fdst, fsrc, srcFileName, srcFileName)
 		})
 	},
 }
@@ -2,8 +2,6 @@
 package moveto
 
 import (
-	"context"
-
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fs/sync"
@@ -58,9 +56,9 @@ successful transfer.
 
 		cmd.Run(true, true, command, func() error {
 			if srcFileName == "" {
-				return sync.MoveDir(context.Background(), fdst, fsrc, false, false)
+				return sync.MoveDir(command.Context(), fdst, fsrc, false, false)
 			}
-			return operations.MoveFile(context.Background(), fdst, fsrc, dstFileName, srcFileName)
+			return operations.MoveFile(command.Context(), fdst, fsrc, dstFileName, srcFileName)
 		})
 	},
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/rclone/rclone/fs/rc"
 	"github.com/rclone/rclone/fs/rc/rcflags"
 	"github.com/rclone/rclone/fs/rc/rcserver"
+	"github.com/rclone/rclone/fs/rc/schedule"
 	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/systemd"
 	"github.com/spf13/cobra"
@@ -29,6 +30,10 @@ If you pass in a path to a directory, rclone will serve that directory
 for GET requests on the URL passed in.  It will also open the URL in
 the browser when rclone is run.
 
+The rc commands can be run periodically with the schedule/add rc
+command. The schedules are kept in the file given by
+` + "`--rc-schedule-file`" + ` so they survive restarts.
+
 See the [rc documentation](/rc/) for more info on the rc flags.
 
 ` + libhttp.Help(rcflags.FlagPrefix) + libhttp.TemplateHelp(rcflags.FlagPrefix) + libhttp.AuthHelp(rcflags.FlagPrefix),
@@ -56,6 +61,13 @@ See the [rc documentation](/rc/) for more info on the rc flags.
 			fs.Fatal(nil, "rc server not configured")
 		}
 
+		// Start running the schedules
+		sched, err := schedule.Start(context.Background(), rc.Opt.ScheduleFile)
+		if err != nil {
+			fs.Fatalf(nil, "Failed to start scheduler: %v", err)
+		}
+		defer sched.Stop()
+
 		// Notify stopping on exit
 		defer systemd.Notify()()
 
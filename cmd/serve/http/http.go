@@ -19,6 +19,7 @@ import (
 	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/config/flags"
 	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/http/serve"
 	"github.com/rclone/rclone/lib/systemd"
@@ -30,9 +31,10 @@ import (
 
 // Options required for http server
 type Options struct {
-	Auth     libhttp.AuthConfig
-	HTTP     libhttp.Config
-	Template libhttp.TemplateConfig
+	Auth       libhttp.AuthConfig
+	HTTP       libhttp.Config
+	Template   libhttp.TemplateConfig
+	AllowWrite bool
 }
 
 // DefaultOpt is the default values used for Options
@@ -54,6 +56,7 @@ func init() {
 	libhttp.AddAuthFlagsPrefix(flagSet, flagPrefix, &Opt.Auth)
 	libhttp.AddHTTPFlagsPrefix(flagSet, flagPrefix, &Opt.HTTP)
 	libhttp.AddTemplateFlagsPrefix(flagSet, flagPrefix, &Opt.Template)
+	flags.BoolVarP(flagSet, &Opt.AllowWrite, "allow-write", "", false, "Allow uploading files, creating directories and deleting", "")
 	vfsflags.AddFlags(flagSet)
 	proxyflags.AddFlags(flagSet)
 }
@@ -74,6 +77,27 @@ The server will log errors.  Use ` + "`-v`" + ` to see access logs.
 ` + "`--bwlimit`" + ` will be respected for file transfers.  Use ` + "`--stats`" + ` to
 control the stats printing.
 
+### Uploads
+
+By default the server is read only. Use ` + "`--allow-write`" + ` to let
+clients upload files, create directories and delete files and empty
+directories. The directory listing then shows an upload form, a form to
+create a directory and a delete button for each entry, so files can be
+dropped into the remote from a browser.
+
+The following requests are accepted when ` + "`--allow-write`" + ` is set:
+
+- ` + "`PUT /path/to/file`" + ` uploads the request body to the file.
+- ` + "`POST /path/to/dir/`" + ` with a ` + "`multipart/form-data`" + ` body uploads
+  each ` + "`file`" + ` part into the directory, creates the directory named in a
+  ` + "`mkdir`" + ` field and deletes the entry named in a ` + "`delete`" + ` field.
+- ` + "`DELETE /path`" + ` deletes a file or an empty directory.
+
+Browsers sending a POST from another site are rejected. Make sure you
+use the authentication flags below when writes are allowed as otherwise
+anyone who can reach the server can modify the remote. The VFS
+` + "`--read-only`" + ` flag still applies.
+
 ` + libhttp.Help(flagPrefix) + libhttp.TemplateHelp(flagPrefix) + libhttp.AuthHelp(flagPrefix) + vfs.Help() + proxy.Help,
 	Annotations: map[string]string{
 		"versionIntroduced": "v1.39",
@@ -167,6 +191,11 @@ func run(ctx context.Context, f fs.Fs, opt Options) (s *HTTP, err error) {
 	)
 	router.Get("/*", s.handler)
 	router.Head("/*", s.handler)
+	if s.opt.AllowWrite {
+		router.Put("/*", s.putHandler)
+		router.Post("/*", s.postHandler)
+		router.Delete("/*", s.deleteHandler)
+	}
 
 	s.server.Serve()
 
@@ -226,6 +255,7 @@ func (s *HTTP) serveDir(w http.ResponseWriter, r *http.Request, dirRemote string
 	sortParm := r.URL.Query().Get("sort")
 	orderParm := r.URL.Query().Get("order")
 	directory.ProcessQueryParams(sortParm, orderParm)
+	directory.Writable = s.opt.AllowWrite && !VFS.Opt.ReadOnly
 
 	// Set the Last-Modified header to the timestamp
 	w.Header().Set("Last-Modified", dir.ModTime().UTC().Format(http.TimeFormat))
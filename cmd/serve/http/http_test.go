@@ -1,9 +1,11 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"flag"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -32,12 +34,16 @@ const (
 )
 
 func start(ctx context.Context, t *testing.T, f fs.Fs) (s *HTTP, testURL string) {
-	opts := Options{
-		HTTP: libhttp.DefaultCfg(),
+	return startOpts(ctx, t, f, Options{
 		Template: libhttp.TemplateConfig{
 			Path: testTemplate,
 		},
-	}
+	})
+}
+
+// startOpts starts the server with opts adding the test address and auth
+func startOpts(ctx context.Context, t *testing.T, f fs.Fs, opts Options) (s *HTTP, testURL string) {
+	opts.HTTP = libhttp.DefaultCfg()
 	opts.HTTP.ListenAddr = []string{testBindAddress}
 	if proxyflags.Opt.AuthProxy == "" {
 		opts.Auth.BasicUser = testUser
@@ -267,3 +273,138 @@ func TestGET(t *testing.T) {
 func TestAuthProxy(t *testing.T) {
 	testGET(t, true)
 }
+
+func TestAllowWrite(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "old.txt"), []byte("old"), 0666))
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+
+	s, testURL := startOpts(ctx, t, f, Options{AllowWrite: true})
+	defer func() {
+		assert.NoError(t, s.server.Shutdown())
+	}()
+
+	do := func(method, URL string, body io.Reader, header http.Header) (int, string) {
+		req, err := http.NewRequest(method, testURL+URL, body)
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.SetBasicAuth(testUser, testPass)
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		require.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		out, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(out)
+	}
+	form := func(fields ...string) (io.Reader, http.Header) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for i := 0; i < len(fields); i += 2 {
+			if fields[i] == "file" {
+				w, err := mw.CreateFormFile("file", fields[i+1])
+				require.NoError(t, err)
+				_, err = w.Write([]byte("contents of " + fields[i+1]))
+				require.NoError(t, err)
+			} else {
+				require.NoError(t, mw.WriteField(fields[i], fields[i+1]))
+			}
+		}
+		require.NoError(t, mw.Close())
+		return &buf, http.Header{"Content-Type": {mw.FormDataContentType()}}
+	}
+	checkFile := func(name, want string) {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err, name)
+		assert.Equal(t, want, string(got), name)
+	}
+
+	// The listing shows the upload controls
+	status, body := do("GET", "", nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `name="file"`)
+	assert.Contains(t, body, `name="delete" value="old.txt"`)
+
+	// PUT a file
+	status, _ = do("PUT", "put.txt", strings.NewReader("put contents"), nil)
+	assert.Equal(t, http.StatusCreated, status)
+	checkFile("put.txt", "put contents")
+
+	// PUT replaces a file
+	status, _ = do("PUT", "put.txt", strings.NewReader("new"), nil)
+	assert.Equal(t, http.StatusCreated, status)
+	checkFile("put.txt", "new")
+
+	// Can't PUT to a directory
+	status, _ = do("PUT", "", strings.NewReader("x"), nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	// mkdir then upload two files into it from a browser
+	body1, header := form("mkdir", "sub")
+	status, _ = do("POST", "", body1, header)
+	assert.Equal(t, http.StatusNoContent, status)
+	body1, header = form("file", "a.txt", "file", "b.txt", "submit", "Upload")
+	header.Set("Accept", "text/html")
+	status, _ = do("POST", "sub/", body1, header)
+	assert.Equal(t, http.StatusSeeOther, status)
+	checkFile("sub/a.txt", "contents of a.txt")
+	checkFile("sub/b.txt", "contents of b.txt")
+
+	// Invalid names are refused
+	body1, header = form("mkdir", "..")
+	status, _ = do("POST", "", body1, header)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// POST to a file is not allowed
+	body1, header = form("mkdir", "x")
+	status, _ = do("POST", "old.txt", body1, header)
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+
+	// Cross origin requests are refused
+	body1, header = form("delete", "old.txt")
+	header.Set("Origin", "http://example.com")
+	status, _ = do("POST", "", body1, header)
+	assert.Equal(t, http.StatusForbidden, status)
+	checkFile("old.txt", "old")
+
+	// Delete a file with the form and with DELETE
+	body1, header = form("delete", "old.txt")
+	status, _ = do("POST", "", body1, header)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.NoFileExists(t, filepath.Join(dir, "old.txt"))
+	status, _ = do("DELETE", "put.txt", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.NoFileExists(t, filepath.Join(dir, "put.txt"))
+
+	// Deleting a missing file or a non empty directory fails
+	status, _ = do("DELETE", "put.txt", nil, nil)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = do("DELETE", "sub", nil, nil)
+	assert.Equal(t, http.StatusConflict, status)
+
+	// Delete an empty directory with the form in the listing
+	require.NoError(t, os.Remove(filepath.Join(dir, "sub", "a.txt")))
+	require.NoError(t, os.Remove(filepath.Join(dir, "sub", "b.txt")))
+	status, body = do("GET", "", nil, nil)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `name="delete" value="sub/"`)
+	body1, header = form("delete", "sub/")
+	status, _ = do("POST", "", body1, header)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.NoDirExists(t, filepath.Join(dir, "sub"))
+
+	// Names aren't trimmed
+	body1, header = form("mkdir", " spaced ")
+	status, _ = do("POST", "", body1, header)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.DirExists(t, filepath.Join(dir, " spaced "))
+	body1, header = form("delete", " spaced /")
+	status, _ = do("POST", "", body1, header)
+	assert.Equal(t, http.StatusNoContent, status)
+	assert.NoDirExists(t, filepath.Join(dir, " spaced "))
+}
@@ -0,0 +1,236 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/lib/http/serve"
+	"github.com/rclone/rclone/vfs"
+)
+
+// maxFieldSize is the largest form value read from an upload form
+const maxFieldSize = 4096
+
+// writeError writes an error for a failed write request with a status
+// matching the VFS error
+func writeError(w http.ResponseWriter, r *http.Request, remote, text string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, vfs.ENOENT):
+		status = http.StatusNotFound
+	case errors.Is(err, vfs.EEXIST), errors.Is(err, vfs.ENOTEMPTY):
+		status = http.StatusConflict
+	case errors.Is(err, vfs.EROFS), errors.Is(err, vfs.EPERM):
+		status = http.StatusForbidden
+	case errors.Is(err, vfs.EINVAL):
+		status = http.StatusBadRequest
+	default:
+		serve.Error(r.Context(), remote, w, text, err)
+		return
+	}
+	fs.Infof(remote, "%s: %s: %v", r.RemoteAddr, text, err)
+	http.Error(w, fmt.Sprintf("%s: %v", text, err), status)
+}
+
+// sameOrigin returns false if a browser sent the request from a page
+// on another site
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
+}
+
+// validLeaf returns true if leaf can be used as a name in a directory
+func validLeaf(leaf string) bool {
+	return leaf != "" && leaf != "." && leaf != ".." && !strings.ContainsAny(leaf, "/\\")
+}
+
+// getWriteVFS returns the VFS for a write request, writing an error
+// and returning nil if the request can't be served
+func (s *HTTP) getWriteVFS(w http.ResponseWriter, r *http.Request) *vfs.VFS {
+	if !sameOrigin(r) {
+		http.Error(w, "Cross origin request refused", http.StatusForbidden)
+		return nil
+	}
+	VFS, err := s.getVFS(r.Context())
+	if err != nil {
+		http.Error(w, "Root directory not found", http.StatusNotFound)
+		fs.Errorf(nil, "Failed to serve write request: %v", err)
+		return nil
+	}
+	return VFS
+}
+
+// upload copies in to the file at remote, replacing it if it exists
+func upload(r *http.Request, VFS *vfs.VFS, remote string, size int64, in io.Reader) (err error) {
+	ctx := r.Context()
+	tr := accounting.Stats(ctx).NewTransferRemoteSize(remote, size, nil, nil)
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+
+	fs.Infof(remote, "%s: Uploading file", r.RemoteAddr)
+	fd, err := VFS.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fd, tr.Account(ctx, io.NopCloser(in)))
+	closeErr := fd.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Don't leave a partial file behind
+		if removeErr := VFS.Remove(remote); removeErr != nil && !errors.Is(removeErr, vfs.ENOENT) {
+			fs.Errorf(remote, "Failed to remove partial upload: %v", removeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// putHandler uploads the request body to the file at the path
+func (s *HTTP) putHandler(w http.ResponseWriter, r *http.Request) {
+	remote := strings.Trim(r.URL.Path, "/")
+	if remote == "" || strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "Can't PUT to a directory", http.StatusMethodNotAllowed)
+		return
+	}
+	VFS := s.getWriteVFS(w, r)
+	if VFS == nil {
+		return
+	}
+	err := upload(r, VFS, remote, r.ContentLength, r.Body)
+	if err != nil {
+		writeError(w, r, remote, "Failed to upload file", err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// deleteHandler deletes the file or empty directory at the path
+func (s *HTTP) deleteHandler(w http.ResponseWriter, r *http.Request) {
+	remote := strings.Trim(r.URL.Path, "/")
+	if remote == "" {
+		http.Error(w, "Can't delete the root directory", http.StatusForbidden)
+		return
+	}
+	VFS := s.getWriteVFS(w, r)
+	if VFS == nil {
+		return
+	}
+	fs.Infof(remote, "%s: Deleting", r.RemoteAddr)
+	if err := VFS.Remove(remote); err != nil {
+		writeError(w, r, remote, "Failed to delete", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// postHandler processes an upload form posted to a directory.
+//
+// Each part of the multipart/form-data body is processed in order:
+// file parts are uploaded into the directory, a "mkdir" field creates
+// the named directory and a "delete" field deletes the named entry.
+func (s *HTTP) postHandler(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "Can only POST to a directory", http.StatusMethodNotAllowed)
+		return
+	}
+	dirRemote := strings.Trim(r.URL.Path, "/")
+	VFS := s.getWriteVFS(w, r)
+	if VFS == nil {
+		return
+	}
+	node, err := VFS.Stat(dirRemote)
+	if err != nil {
+		writeError(w, r, dirRemote, "Failed to find directory", err)
+		return
+	}
+	if !node.IsDir() {
+		http.Error(w, "Not a directory", http.StatusNotFound)
+		return
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Expecting multipart/form-data: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			http.Error(w, "Failed to read form: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		remote, text, err := s.processPart(r, VFS, dirRemote, part)
+		_ = part.Close()
+		if err != nil {
+			writeError(w, r, remote, text, err)
+			return
+		}
+	}
+
+	// Send browsers back to the listing, other clients just get the status
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// processPart carries out the action of one part of an upload form
+// returning the remote it applied to and a description if it failed
+func (s *HTTP) processPart(r *http.Request, VFS *vfs.VFS, dirRemote string, part *multipart.Part) (remote, text string, err error) {
+	if part.FileName() != "" {
+		leaf := part.FileName()
+		remote = path.Join(dirRemote, leaf)
+		if !validLeaf(leaf) {
+			return remote, "Invalid file name", vfs.EINVAL
+		}
+		return remote, "Failed to upload file", upload(r, VFS, remote, -1, part)
+	}
+
+	value, err := io.ReadAll(io.LimitReader(part, maxFieldSize))
+	if err != nil {
+		return dirRemote, "Failed to read form", err
+	}
+	leaf := string(value)
+	if part.FormName() == "delete" {
+		// directories are listed with a trailing "/"
+		leaf = strings.TrimSuffix(leaf, "/")
+	}
+	remote = path.Join(dirRemote, leaf)
+	switch part.FormName() {
+	case "mkdir":
+		if !validLeaf(leaf) {
+			return remote, "Invalid directory name", vfs.EINVAL
+		}
+		fs.Infof(remote, "%s: Creating directory", r.RemoteAddr)
+		return remote, "Failed to create directory", VFS.Mkdir(remote, 0777)
+	case "delete":
+		if !validLeaf(leaf) {
+			return remote, "Invalid name", vfs.EINVAL
+		}
+		fs.Infof(remote, "%s: Deleting", r.RemoteAddr)
+		return remote, "Failed to delete", VFS.Remove(remote)
+	}
+	// ignore unknown fields such as the submit button
+	return remote, "", nil
+}
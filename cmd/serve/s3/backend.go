@@ -27,14 +27,26 @@ type s3Backend struct {
 	opt  *Options
 	s    *Server
 	meta *sync.Map
+
+	mu       sync.Mutex
+	configs  map[string]bucketConfig // versioning config by bucket
+	keyLocks map[string]*keyLock     // locks for changing versions by path
 }
 
+// check interfaces
+var (
+	_ gofakes3.Backend          = (*s3Backend)(nil)
+	_ gofakes3.VersionedBackend = (*s3Backend)(nil)
+)
+
 // newBackend creates a new SimpleBucketBackend.
-func newBackend(s *Server, opt *Options) gofakes3.Backend {
+func newBackend(s *Server, opt *Options) *s3Backend {
 	return &s3Backend{
-		opt:  opt,
-		s:    s,
-		meta: new(sync.Map),
+		opt:      opt,
+		s:        s,
+		meta:     new(sync.Map),
+		configs:  map[string]bucketConfig{},
+		keyLocks: map[string]*keyLock{},
 	}
 }
 
@@ -118,7 +130,29 @@ func (b *s3Backend) HeadObject(ctx context.Context, bucketName, objectName strin
 		return nil, gofakes3.BucketNotFound(bucketName)
 	}
 
+	if isReserved(objectName) {
+		return nil, gofakes3.KeyNotFound(objectName)
+	}
+
 	fp := path.Join(bucketName, objectName)
+	versions, marker, err := b.latestVersion(_vfs, bucketName, objectName)
+	if err != nil || marker != nil {
+		return marker, err
+	}
+	if versions == nil {
+		return b.headFile(_vfs, fp, objectName, b.liveMeta(fp, nil))
+	}
+	obj, err := b.headFile(_vfs, fp, objectName, b.versionMeta(bucketName, objectName, versions, 0))
+	if err != nil {
+		return nil, err
+	}
+	obj.VersionID = gofakes3.VersionID(versions[0].ID)
+	return obj, nil
+}
+
+// headFile returns the info of the object objectName stored in fp with
+// the extra metadata meta
+func (b *s3Backend) headFile(_vfs *vfs.VFS, fp, objectName string, extraMeta map[string]string) (*gofakes3.Object, error) {
 	node, err := _vfs.Stat(fp)
 	if err != nil {
 		return nil, gofakes3.KeyNotFound(objectName)
@@ -142,11 +176,8 @@ func (b *s3Backend) HeadObject(ctx context.Context, bucketName, objectName strin
 		"Content-Type":  fs.MimeType(context.Background(), fobj),
 	}
 
-	if val, ok := b.meta.Load(fp); ok {
-		metaMap := val.(map[string]string)
-		for k, v := range metaMap {
-			meta[k] = v
-		}
+	for k, v := range extraMeta {
+		meta[k] = v
 	}
 
 	return &gofakes3.Object{
@@ -169,7 +200,29 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 		return nil, gofakes3.BucketNotFound(bucketName)
 	}
 
+	if isReserved(objectName) {
+		return nil, gofakes3.KeyNotFound(objectName)
+	}
+
 	fp := path.Join(bucketName, objectName)
+	versions, marker, err := b.latestVersion(_vfs, bucketName, objectName)
+	if err != nil || marker != nil {
+		return marker, err
+	}
+	if versions == nil {
+		return b.getFile(_vfs, fp, objectName, b.liveMeta(fp, nil), rangeRequest)
+	}
+	obj, err = b.getFile(_vfs, fp, objectName, b.versionMeta(bucketName, objectName, versions, 0), rangeRequest)
+	if err != nil {
+		return nil, err
+	}
+	obj.VersionID = gofakes3.VersionID(versions[0].ID)
+	return obj, nil
+}
+
+// getFile opens the object objectName stored in fp with the extra
+// metadata meta
+func (b *s3Backend) getFile(_vfs *vfs.VFS, fp, objectName string, extraMeta map[string]string, rangeRequest *gofakes3.ObjectRangeRequest) (obj *gofakes3.Object, err error) {
 	node, err := _vfs.Stat(fp)
 	if err != nil {
 		return nil, gofakes3.KeyNotFound(objectName)
@@ -219,11 +272,8 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 		"Content-Type":  fs.MimeType(context.Background(), fobj),
 	}
 
-	if val, ok := b.meta.Load(fp); ok {
-		metaMap := val.(map[string]string)
-		for k, v := range metaMap {
-			meta[k] = v
-		}
+	for k, v := range extraMeta {
+		meta[k] = v
 	}
 
 	return &gofakes3.Object{
@@ -305,7 +355,26 @@ func (b *s3Backend) PutObject(
 	if err != nil {
 		return result, gofakes3.BucketNotFound(bucketName)
 	}
+	if isReserved(objectName) {
+		return result, gofakes3.ErrorInvalidArgument("key", objectName, "Keys in "+versionsDir+" are reserved for versioning")
+	}
 
+	c, err := b.getConfig(_vfs, bucketName)
+	if err != nil {
+		return result, err
+	}
+	lock, err := objectLockFromMeta(c, meta, time.Now())
+	if err != nil {
+		return result, err
+	}
+	if c.versioned() {
+		return b.putVersion(_vfs, c, bucketName, objectName, meta, lock, input)
+	}
+	return result, b.putObject(_vfs, bucketName, objectName, meta, input)
+}
+
+// putObject writes the object to the filesystem.
+func (b *s3Backend) putObject(_vfs *vfs.VFS, bucketName, objectName string, meta map[string]string, input io.Reader) (err error) {
 	fp := path.Join(bucketName, objectName)
 	objectDir := path.Dir(fp)
 	// _, err = db.fs.Stat(objectDir)
@@ -316,31 +385,31 @@ func (b *s3Backend) PutObject(
 
 	if objectDir != "." {
 		if err := mkdirRecursive(objectDir, _vfs); err != nil {
-			return result, err
+			return err
 		}
 	}
 
 	f, err := _vfs.Create(fp)
 	if err != nil {
-		return result, err
+		return err
 	}
 
 	if _, err := io.Copy(f, input); err != nil {
 		// remove file when i/o error occurred (FsPutErr)
 		_ = f.Close()
 		_ = _vfs.Remove(fp)
-		return result, err
+		return err
 	}
 
 	if err := f.Close(); err != nil {
 		// remove file when close error occurred (FsPutErr)
 		_ = _vfs.Remove(fp)
-		return result, err
+		return err
 	}
 
 	_, err = _vfs.Stat(fp)
 	if err != nil {
-		return result, err
+		return err
 	}
 
 	b.meta.Store(fp, meta)
@@ -349,24 +418,24 @@ func (b *s3Backend) PutObject(
 		ti, err := swift.FloatStringToTime(val)
 		if err == nil {
 			b.storeModtime(fp, meta, val)
-			return result, _vfs.Chtimes(fp, ti, ti)
+			return _vfs.Chtimes(fp, ti, ti)
 		}
 		// ignore error since the file is successfully created
 
 		if val, ok := meta["mtime"]; ok {
 			b.storeModtime(fp, meta, val)
-			return result, _vfs.Chtimes(fp, ti, ti)
+			return _vfs.Chtimes(fp, ti, ti)
 		}
 		// ignore error since the file is successfully created
 	}
 
-	return result, nil
+	return nil
 }
 
 // DeleteMulti deletes multiple objects in a single request.
 func (b *s3Backend) DeleteMulti(ctx context.Context, bucketName string, objects ...string) (result gofakes3.MultiDeleteResult, rerr error) {
 	for _, object := range objects {
-		if err := b.deleteObject(ctx, bucketName, object); err != nil {
+		if _, err := b.DeleteObject(ctx, bucketName, object); err != nil {
 			fs.Errorf("serve s3", "delete object failed: %v", err)
 			result.Error = append(result.Error, gofakes3.ErrorResult{
 				Code:    gofakes3.ErrInternal,
@@ -384,8 +453,27 @@ func (b *s3Backend) DeleteMulti(ctx context.Context, bucketName string, objects
 }
 
 // DeleteObject deletes the object with the given name.
+//
+// If the bucket is versioned this adds a delete marker instead.
 func (b *s3Backend) DeleteObject(ctx context.Context, bucketName, objectName string) (result gofakes3.ObjectDeleteResult, rerr error) {
-	return result, b.deleteObject(ctx, bucketName, objectName)
+	_vfs, err := b.s.getVFS(ctx)
+	if err != nil {
+		return result, err
+	}
+	c, err := b.getConfig(_vfs, bucketName)
+	if err != nil {
+		return result, err
+	}
+	if !c.versioned() {
+		return result, b.deleteObject(ctx, bucketName, objectName)
+	}
+	if _, err := _vfs.Stat(bucketName); err != nil {
+		return result, gofakes3.BucketNotFound(bucketName)
+	}
+	if isReserved(objectName) {
+		return result, nil
+	}
+	return b.deleteVersioned(_vfs, c, bucketName, objectName)
 }
 
 // deleteObject deletes the object from the filesystem.
@@ -443,6 +531,19 @@ func (b *s3Backend) DeleteBucket(ctx context.Context, name string) error {
 		return gofakes3.BucketNotFound(name)
 	}
 
+	entries, err := getDirEntries(name, _vfs)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() != versionsDir {
+			return gofakes3.ErrBucketNotEmpty
+		}
+	}
+	if err := b.removeConfig(_vfs, name); err != nil {
+		return err
+	}
+
 	if err := _vfs.Remove(name); err != nil {
 		return gofakes3.ErrBucketNotEmpty
 	}
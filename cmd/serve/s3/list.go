@@ -26,6 +26,10 @@ func (b *s3Backend) entryListR(_vfs *vfs.VFS, bucket, fdPath, name string, addPr
 			continue
 		}
 
+		if fdPath == "" && object == versionsDir {
+			continue
+		}
+
 		if entry.IsDir() {
 			if addPrefix {
 				response.AddPrefix(gofakes3.URLEncode(objectPath))
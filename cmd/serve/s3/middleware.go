@@ -0,0 +1,430 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/gofakes3/signature"
+	"github.com/rclone/rclone/fs"
+)
+
+// s3Xmlns is the namespace of the XML documents in the S3 API
+const s3Xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+// errPassThrough is returned by a versionsHandler to pass the
+// request on to gofakes3
+var errPassThrough = errors.New("pass request to gofakes3")
+
+// versionsHandler serves a request to bucket and key
+type versionsHandler func(w http.ResponseWriter, r *http.Request, bucket, key string) error
+
+// versionsMiddleware serves the versioning and object lock requests
+// which gofakes3 doesn't route itself, passing everything else on to
+// next.
+func versionsMiddleware(next http.Handler, b *s3Backend) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bucket, key := b.bucketAndKey(r)
+		handler := b.versionsRoute(r, bucket, key)
+		if handler == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(b.opt.authPair) > 0 {
+			if result := signature.V4SignVerify(r); result != signature.ErrNone {
+				fs.Infof("serve s3", "Access Denied: %s => %s", r.RemoteAddr, r.URL)
+				resp := signature.GetAPIError(result)
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(resp.HTTPStatusCode)
+				_, _ = w.Write(signature.EncodeAPIErrorToResponse(resp))
+				return
+			}
+		}
+		err := handler(w, r, bucket, key)
+		if err == errPassThrough {
+			next.ServeHTTP(w, r)
+		} else if err != nil {
+			writeError(w, r, err)
+		}
+	})
+}
+
+// bucketAndKey returns the bucket and key the request is for
+func (b *s3Backend) bucketAndKey(r *http.Request) (bucket, key string) {
+	p := strings.Trim(r.URL.Path, "/")
+	if !b.opt.pathBucketMode {
+		return strings.SplitN(r.Host, ".", 2)[0], p
+	}
+	parts := strings.SplitN(p, "/", 2)
+	if len(parts) == 2 {
+		key = parts[1]
+	}
+	return parts[0], key
+}
+
+// versionsRoute returns the handler for the request or nil if it
+// should be served by gofakes3
+func (b *s3Backend) versionsRoute(r *http.Request, bucket, key string) versionsHandler {
+	query := r.URL.Query()
+	has := func(name string) bool {
+		_, ok := query[name]
+		return ok
+	}
+	switch {
+	case bucket == "":
+	case key == "":
+		switch {
+		case has("object-lock"):
+			return b.serveObjectLockConfig
+		case r.Method == http.MethodPut && len(query) == 0 && strings.EqualFold(r.Header.Get("X-Amz-Bucket-Object-Lock-Enabled"), "true"):
+			return b.serveCreateLockedBucket
+		case r.Method == http.MethodPost && has("delete"):
+			return b.serveDeleteVersions
+		}
+	case has("retention"):
+		return b.serveRetention
+	case has("legal-hold"):
+		return b.serveLegalHold
+	case query.Get("versionId") != "" && !has("uploadId"):
+		// gofakes3 serves HEAD of any version as the current
+		// version and treats the null version as the current one.
+		switch {
+		case r.Method == http.MethodHead:
+			return b.serveHeadVersion
+		case r.Method == http.MethodDelete:
+			return b.serveDeleteVersion
+		case r.Method == http.MethodGet && query.Get("versionId") == nullVersionID:
+			return b.serveGetVersion
+		}
+	}
+	return nil
+}
+
+// errorStatus returns the HTTP status for code
+func errorStatus(code gofakes3.ErrorCode) int {
+	switch code {
+	case errCodeAccessDenied:
+		return http.StatusForbidden
+	case errCodeInvalidBucketState:
+		return http.StatusConflict
+	case errCodeNoSuchObjectLockConfiguration, errCodeObjectLockConfigurationNotFound:
+		return http.StatusNotFound
+	case gofakes3.ErrMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	}
+	return code.Status()
+}
+
+// writeError writes err as an S3 error response
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	resp := gofakes3.ErrorResponse{Code: gofakes3.ErrInternal}
+	var s3Err gofakes3.Error
+	if errors.As(err, &s3Err) {
+		resp.Code = s3Err.ErrorCode()
+	}
+	var msgErr *gofakes3.ErrorResponse
+	if errors.As(err, &msgErr) {
+		resp.Message = msgErr.Message
+	}
+	if resp.Code == gofakes3.ErrInternal {
+		fs.Errorf("serve s3", "%s %s failed: %v", r.Method, r.URL.Path, err)
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(errorStatus(resp.Code))
+	if r.Method != http.MethodHead {
+		_, _ = w.Write([]byte(xml.Header))
+		_ = xml.NewEncoder(w).Encode(resp)
+	}
+}
+
+// writeXML writes v as the XML response
+func writeXML(w http.ResponseWriter, v interface{}) error {
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write([]byte(xml.Header))
+	return xml.NewEncoder(w).Encode(v)
+}
+
+// readXML decodes the XML request body into v
+func readXML(r *http.Request, v interface{}) error {
+	defer func() {
+		_ = r.Body.Close()
+	}()
+	if err := xml.NewDecoder(r.Body).Decode(v); err != nil {
+		return gofakes3.ErrorMessage(gofakes3.ErrMalformedXML, err.Error())
+	}
+	return nil
+}
+
+// bypassGovernance returns true if the request asks to override
+// governance mode retention
+func bypassGovernance(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("X-Amz-Bypass-Governance-Retention"), "true")
+}
+
+// parseRange parses the Range header of a GET request
+func parseRange(s string) (*gofakes3.ObjectRangeRequest, error) {
+	if s == "" {
+		return nil, nil
+	}
+	spec, ok := strings.CutPrefix(s, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return nil, gofakes3.ErrInvalidRange
+	}
+	start, end, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, gofakes3.ErrInvalidRange
+	}
+	var (
+		rng = &gofakes3.ObjectRangeRequest{End: gofakes3.RangeNoEnd}
+		err error
+	)
+	if start == "" {
+		rng.FromEnd = true
+		rng.End, err = strconv.ParseInt(end, 10, 64)
+	} else {
+		rng.Start, err = strconv.ParseInt(start, 10, 64)
+		if err == nil && end != "" {
+			rng.End, err = strconv.ParseInt(end, 10, 64)
+		}
+	}
+	if err != nil || rng.Start < 0 || (rng.End != gofakes3.RangeNoEnd && rng.End < rng.Start && !rng.FromEnd) {
+		return nil, gofakes3.ErrInvalidRange
+	}
+	return rng, nil
+}
+
+// writeObject writes the headers and, for GET, the contents of obj
+func writeObject(w http.ResponseWriter, r *http.Request, obj *gofakes3.Object) (err error) {
+	defer gofakes3.CheckClose(obj.Contents, &err)
+	h := w.Header()
+	for k, v := range obj.Metadata {
+		h.Set(k, v)
+	}
+	h.Set("x-amz-version-id", string(obj.VersionID))
+	etag := `"` + hex.EncodeToString(obj.Hash) + `"`
+	h.Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	h.Set("Accept-Ranges", "bytes")
+	status := http.StatusOK
+	if obj.Range != nil {
+		h.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", obj.Range.Start, obj.Range.Start+obj.Range.Length-1, obj.Size))
+		h.Set("Content-Length", strconv.FormatInt(obj.Range.Length, 10))
+		status = http.StatusPartialContent
+	} else {
+		h.Set("Content-Length", strconv.FormatInt(obj.Size, 10))
+	}
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return nil
+	}
+	_, err = io.Copy(w, obj.Contents)
+	return err
+}
+
+// serveHeadVersion serves HEAD of a specific version of an object
+func (b *s3Backend) serveHeadVersion(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	obj, err := b.HeadObjectVersion(bucket, key, gofakes3.VersionID(r.URL.Query().Get("versionId")))
+	if err != nil {
+		return err
+	}
+	return writeObject(w, r, obj)
+}
+
+// serveGetVersion serves GET of a specific version of an object
+func (b *s3Backend) serveGetVersion(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	rng, err := parseRange(r.Header.Get("Range"))
+	if err != nil {
+		return err
+	}
+	obj, err := b.GetObjectVersion(bucket, key, gofakes3.VersionID(r.URL.Query().Get("versionId")), rng)
+	if err != nil {
+		return err
+	}
+	return writeObject(w, r, obj)
+}
+
+// serveDeleteVersion permanently deletes a specific version of an object
+func (b *s3Backend) serveDeleteVersion(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	id := r.URL.Query().Get("versionId")
+	result, err := b.deleteVersion(bucket, key, id, bypassGovernance(r))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("x-amz-delete-marker", strconv.FormatBool(result.IsDeleteMarker))
+	if result.VersionID != "" {
+		w.Header().Set("x-amz-version-id", string(result.VersionID))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// serveDeleteVersions serves a multi object delete which names
+// versions. gofakes3 ignores the versions so serves the rest.
+func (b *s3Backend) serveDeleteVersions(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	body, err := io.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var in gofakes3.DeleteRequest
+	if xml.Unmarshal(body, &in) != nil {
+		return errPassThrough
+	}
+	hasVersions := false
+	for _, o := range in.Objects {
+		if o.VersionID != "" {
+			hasVersions = true
+		}
+	}
+	if !hasVersions {
+		return errPassThrough
+	}
+	var out gofakes3.MultiDeleteResult
+	for _, o := range in.Objects {
+		if o.VersionID != "" {
+			_, err = b.deleteVersion(bucket, o.Key, o.VersionID, bypassGovernance(r))
+		} else {
+			_, err = b.DeleteObject(r.Context(), bucket, o.Key)
+		}
+		if err != nil {
+			result := gofakes3.ErrorResultFromError(err)
+			result.Key = o.Key
+			out.Error = append(out.Error, result)
+		} else if !in.Quiet {
+			out.Deleted = append(out.Deleted, o)
+		}
+	}
+	return writeXML(w, out)
+}
+
+// serveCreateLockedBucket creates a bucket with object lock enabled
+func (b *s3Backend) serveCreateLockedBucket(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	if err := gofakes3.ValidateBucketName(bucket); err != nil {
+		return err
+	}
+	if err := b.CreateBucket(r.Context(), bucket); err != nil {
+		return err
+	}
+	_vfs, err := b.versionVFS()
+	if err != nil {
+		return err
+	}
+	err = b.setConfig(_vfs, bucket, bucketConfig{
+		Versioning: gofakes3.VersioningEnabled,
+		ObjectLock: true,
+	})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", "/"+bucket)
+	return nil
+}
+
+// serveObjectLockConfig serves ?object-lock on a bucket
+func (b *s3Backend) serveObjectLockConfig(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	switch r.Method {
+	case http.MethodGet:
+		config, err := b.getObjectLockConfig(bucket)
+		if err != nil {
+			return err
+		}
+		config.Xmlns = s3Xmlns
+		return writeXML(w, config)
+	case http.MethodPut:
+		var config objectLockConfiguration
+		if err := readXML(r, &config); err != nil {
+			return err
+		}
+		return b.setObjectLockConfig(bucket, config)
+	}
+	return gofakes3.ErrMethodNotAllowed
+}
+
+// serveRetention serves ?retention on an object
+func (b *s3Backend) serveRetention(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	id := r.URL.Query().Get("versionId")
+	switch r.Method {
+	case http.MethodGet:
+		out := retention{Xmlns: s3Xmlns}
+		err := b.withVersion(bucket, key, id, false, func(v *version) error {
+			if v.Mode == "" {
+				return gofakes3.ErrorMessage(errCodeNoSuchObjectLockConfiguration, "The specified object does not have a ObjectLock configuration")
+			}
+			out.Mode = v.Mode
+			out.RetainUntilDate = v.RetainUntil.UTC().Format(time.RFC3339)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return writeXML(w, out)
+	case http.MethodPut:
+		var in retention
+		if err := readXML(r, &in); err != nil {
+			return err
+		}
+		now := time.Now()
+		var until time.Time
+		if in.Mode != "" || in.RetainUntilDate != "" {
+			if !validMode(in.Mode) {
+				return gofakes3.ErrMalformedXML
+			}
+			var err error
+			until, err = time.Parse(time.RFC3339, in.RetainUntilDate)
+			if err != nil {
+				return gofakes3.ErrMalformedXML
+			}
+			if !until.After(now) {
+				return gofakes3.ErrorInvalidArgument("RetainUntilDate", in.RetainUntilDate, "The retain until date must be in the future!")
+			}
+		}
+		return b.withVersion(bucket, key, id, true, func(v *version) error {
+			return v.setRetention(now, in.Mode, until, bypassGovernance(r))
+		})
+	}
+	return gofakes3.ErrMethodNotAllowed
+}
+
+// serveLegalHold serves ?legal-hold on an object
+func (b *s3Backend) serveLegalHold(w http.ResponseWriter, r *http.Request, bucket, key string) error {
+	id := r.URL.Query().Get("versionId")
+	switch r.Method {
+	case http.MethodGet:
+		out := legalHold{Xmlns: s3Xmlns, Status: "OFF"}
+		err := b.withVersion(bucket, key, id, false, func(v *version) error {
+			if v.LegalHold {
+				out.Status = "ON"
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return writeXML(w, out)
+	case http.MethodPut:
+		var in legalHold
+		if err := readXML(r, &in); err != nil {
+			return err
+		}
+		if in.Status != "ON" && in.Status != "OFF" {
+			return gofakes3.ErrMalformedXML
+		}
+		return b.withVersion(bucket, key, id, true, func(v *version) error {
+			v.LegalHold = in.Status == "ON"
+			return nil
+		})
+	}
+	return gofakes3.ErrMethodNotAllowed
+}
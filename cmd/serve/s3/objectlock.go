@@ -0,0 +1,271 @@
+package s3
+
+import (
+	"encoding/xml"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/rclone/gofakes3"
+)
+
+// Object lock retention modes
+const (
+	lockModeGovernance = "GOVERNANCE"
+	lockModeCompliance = "COMPLIANCE"
+)
+
+// Error codes gofakes3 doesn't know about. These are given the right
+// HTTP status by writeError.
+const (
+	errCodeAccessDenied                    gofakes3.ErrorCode = "AccessDenied"
+	errCodeInvalidBucketState              gofakes3.ErrorCode = "InvalidBucketState"
+	errCodeNoSuchObjectLockConfiguration   gofakes3.ErrorCode = "NoSuchObjectLockConfiguration"
+	errCodeObjectLockConfigurationNotFound gofakes3.ErrorCode = "ObjectLockConfigurationNotFoundError"
+)
+
+// errNoObjectLock is returned when an object lock operation is used on
+// a bucket without object lock enabled
+var errNoObjectLock = gofakes3.ErrorMessage(gofakes3.ErrInvalidArgument, "Bucket is missing Object Lock Configuration")
+
+// objectLock is the retention and legal hold of an object version
+type objectLock struct {
+	Mode        string    `json:"mode,omitempty"` // lockModeGovernance or lockModeCompliance
+	RetainUntil time.Time `json:"retainUntil,omitempty"`
+	LegalHold   bool      `json:"legalHold,omitempty"`
+}
+
+// validMode returns true if mode is a retention mode
+func validMode(mode string) bool {
+	return mode == lockModeGovernance || mode == lockModeCompliance
+}
+
+// retained returns true if the retention period is in force at now
+func (l *objectLock) retained(now time.Time) bool {
+	return l.Mode != "" && now.Before(l.RetainUntil)
+}
+
+// checkDelete returns an error if the version can't be deleted at
+// now. Governance mode retention is ignored if bypass is set.
+func (l *objectLock) checkDelete(now time.Time, bypass bool) error {
+	if l.LegalHold || (l.retained(now) && !(bypass && l.Mode == lockModeGovernance)) {
+		return gofakes3.ErrorMessage(errCodeAccessDenied, "Access Denied because object protected by object lock.")
+	}
+	return nil
+}
+
+// setRetention changes the retention of the version. Retention in
+// force can only be reduced in governance mode with bypass set.
+func (l *objectLock) setRetention(now time.Time, mode string, until time.Time, bypass bool) error {
+	if l.retained(now) {
+		stricter := mode == l.Mode || (l.Mode == lockModeGovernance && mode == lockModeCompliance)
+		if !stricter || until.Before(l.RetainUntil) {
+			if l.Mode == lockModeCompliance || !bypass {
+				return gofakes3.ErrorMessage(errCodeAccessDenied, "Access Denied because object protected by object lock.")
+			}
+		}
+	}
+	l.Mode = mode
+	l.RetainUntil = until
+	return nil
+}
+
+// headers returns meta with the object lock headers of l added
+func (l *objectLock) headers(meta map[string]string) map[string]string {
+	if l.Mode == "" && !l.LegalHold {
+		return meta
+	}
+	out := make(map[string]string, len(meta)+3)
+	for k, v := range meta {
+		out[k] = v
+	}
+	if l.Mode != "" {
+		out["X-Amz-Object-Lock-Mode"] = l.Mode
+		out["X-Amz-Object-Lock-Retain-Until-Date"] = l.RetainUntil.UTC().Format(time.RFC3339)
+	}
+	if l.LegalHold {
+		out["X-Amz-Object-Lock-Legal-Hold"] = "ON"
+	}
+	return out
+}
+
+// objectLockFromMeta removes the object lock headers from the metadata
+// of an upload returning the lock they describe, or the default lock
+// of the bucket if there are none.
+func objectLockFromMeta(c bucketConfig, meta map[string]string, now time.Time) (l objectLock, err error) {
+	mode, hasMode := meta["X-Amz-Object-Lock-Mode"]
+	until, hasUntil := meta["X-Amz-Object-Lock-Retain-Until-Date"]
+	hold, hasHold := meta["X-Amz-Object-Lock-Legal-Hold"]
+	delete(meta, "X-Amz-Object-Lock-Mode")
+	delete(meta, "X-Amz-Object-Lock-Retain-Until-Date")
+	delete(meta, "X-Amz-Object-Lock-Legal-Hold")
+	if !hasMode && !hasUntil && !hasHold {
+		if c.ObjectLock && c.DefaultMode != "" {
+			l.Mode = c.DefaultMode
+			l.RetainUntil = now.AddDate(c.DefaultYears, 0, c.DefaultDays)
+		}
+		return l, nil
+	}
+	if !c.ObjectLock {
+		return l, errNoObjectLock
+	}
+	if hasMode || hasUntil {
+		if !hasMode || !hasUntil {
+			return l, gofakes3.ErrorMessage(gofakes3.ErrInvalidArgument, "x-amz-object-lock-retain-until-date and x-amz-object-lock-mode must both be supplied")
+		}
+		l.Mode = strings.ToUpper(mode)
+		if !validMode(l.Mode) {
+			return l, gofakes3.ErrorInvalidArgument("x-amz-object-lock-mode", mode, "Unknown wormMode directive.")
+		}
+		l.RetainUntil, err = time.Parse(time.RFC3339, until)
+		if err != nil || !l.RetainUntil.After(now) {
+			return l, gofakes3.ErrorInvalidArgument("x-amz-object-lock-retain-until-date", until, "The retain until date must be in the future!")
+		}
+	}
+	switch strings.ToUpper(hold) {
+	case "ON":
+		l.LegalHold = true
+	case "OFF", "":
+	default:
+		return l, gofakes3.ErrorInvalidArgument("x-amz-object-lock-legal-hold", hold, "Legal Hold must be either of 'ON' or 'OFF'")
+	}
+	return l, nil
+}
+
+// objectLockConfiguration is the XML for the object lock config of a bucket
+type objectLockConfiguration struct {
+	XMLName           xml.Name        `xml:"ObjectLockConfiguration"`
+	Xmlns             string          `xml:"xmlns,attr,omitempty"`
+	ObjectLockEnabled string          `xml:"ObjectLockEnabled,omitempty"`
+	Rule              *objectLockRule `xml:"Rule,omitempty"`
+}
+
+// objectLockRule is the XML for the default retention of a bucket
+type objectLockRule struct {
+	DefaultRetention struct {
+		Mode  string `xml:"Mode"`
+		Days  int    `xml:"Days,omitempty"`
+		Years int    `xml:"Years,omitempty"`
+	} `xml:"DefaultRetention"`
+}
+
+// retention is the XML for the retention of an object version
+type retention struct {
+	XMLName         xml.Name `xml:"Retention"`
+	Xmlns           string   `xml:"xmlns,attr,omitempty"`
+	Mode            string   `xml:"Mode,omitempty"`
+	RetainUntilDate string   `xml:"RetainUntilDate,omitempty"`
+}
+
+// legalHold is the XML for the legal hold of an object version
+type legalHold struct {
+	XMLName xml.Name `xml:"LegalHold"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:"Status"`
+}
+
+// getObjectLockConfig returns the object lock config of bucket
+func (b *s3Backend) getObjectLockConfig(bucket string) (out objectLockConfiguration, err error) {
+	_vfs, err := b.versionVFS()
+	if err != nil {
+		return out, err
+	}
+	if _, err := _vfs.Stat(bucket); err != nil {
+		return out, gofakes3.BucketNotFound(bucket)
+	}
+	c, err := b.getConfig(_vfs, bucket)
+	if err != nil {
+		return out, err
+	}
+	if !c.ObjectLock {
+		return out, gofakes3.ErrorMessage(errCodeObjectLockConfigurationNotFound, "Object Lock configuration does not exist for this bucket")
+	}
+	out.ObjectLockEnabled = "Enabled"
+	if c.DefaultMode != "" {
+		out.Rule = &objectLockRule{}
+		out.Rule.DefaultRetention.Mode = c.DefaultMode
+		out.Rule.DefaultRetention.Days = c.DefaultDays
+		out.Rule.DefaultRetention.Years = c.DefaultYears
+	}
+	return out, nil
+}
+
+// setObjectLockConfig enables object lock on bucket and sets its
+// default retention. Versioning must be enabled first.
+func (b *s3Backend) setObjectLockConfig(bucket string, in objectLockConfiguration) error {
+	_vfs, err := b.versionVFS()
+	if err != nil {
+		return err
+	}
+	if _, err := _vfs.Stat(bucket); err != nil {
+		return gofakes3.BucketNotFound(bucket)
+	}
+	if in.ObjectLockEnabled != "Enabled" {
+		return gofakes3.ErrMalformedXML
+	}
+	c, err := b.getConfig(_vfs, bucket)
+	if err != nil {
+		return err
+	}
+	if !c.ObjectLock && c.Versioning != gofakes3.VersioningEnabled {
+		return gofakes3.ErrorMessage(errCodeInvalidBucketState, "Versioning must be 'Enabled' on the bucket to apply a Object Lock configuration")
+	}
+	c.ObjectLock = true
+	c.DefaultMode, c.DefaultDays, c.DefaultYears = "", 0, 0
+	if in.Rule != nil {
+		r := in.Rule.DefaultRetention
+		if !validMode(r.Mode) || r.Days < 0 || r.Years < 0 || (r.Days == 0) == (r.Years == 0) {
+			return gofakes3.ErrMalformedXML
+		}
+		c.DefaultMode, c.DefaultDays, c.DefaultYears = r.Mode, r.Days, r.Years
+	}
+	return b.setConfig(_vfs, bucket, c)
+}
+
+// withVersion calls fn on version id of key, or the current version if
+// id is empty, in a bucket with object lock enabled. If write is set
+// the changes fn makes are stored.
+func (b *s3Backend) withVersion(bucket, key, id string, write bool, fn func(v *version) error) error {
+	_vfs, err := b.versionVFS()
+	if err != nil {
+		return err
+	}
+	if _, err := _vfs.Stat(bucket); err != nil {
+		return gofakes3.BucketNotFound(bucket)
+	}
+	c, err := b.getConfig(_vfs, bucket)
+	if err != nil {
+		return err
+	}
+	if !c.ObjectLock {
+		return errNoObjectLock
+	}
+	if isReserved(key) {
+		return gofakes3.KeyNotFound(key)
+	}
+	unlock := b.lockKey(path.Join(bucket, key))
+	defer unlock()
+	versions, err := b.readVersions(_vfs, bucket, key)
+	if err != nil {
+		return err
+	}
+	i := 0
+	if id != "" {
+		i = findVersion(versions, id)
+		if i < 0 {
+			return gofakes3.ErrNoSuchVersion
+		}
+	} else if len(versions) == 0 {
+		return gofakes3.KeyNotFound(key)
+	}
+	if versions[i].DeleteMarker {
+		return gofakes3.ErrMethodNotAllowed
+	}
+	if err := fn(versions[i]); err != nil {
+		return err
+	}
+	if !write {
+		return nil
+	}
+	return b.writeVersions(_vfs, bucket, key, versions)
+}
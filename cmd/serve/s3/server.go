@@ -67,18 +67,26 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options) (s *Server, err error
 	}
 
 	var newLogger logger
-	w.faker = gofakes3.New(
-		newBackend(w, opt),
+	backend := newBackend(w, opt)
+	fakeOpts := []gofakes3.Option{
 		gofakes3.WithHostBucket(!opt.pathBucketMode),
 		gofakes3.WithLogger(newLogger),
 		gofakes3.WithRequestID(rand.Uint64()),
-		gofakes3.WithoutVersioning(),
 		gofakes3.WithV4Auth(authlistResolver(opt.authPair)),
 		gofakes3.WithIntegrityCheck(true), // Check Content-MD5 if supplied
-	)
+	}
+	if proxyflags.Opt.AuthProxy != "" {
+		// the versioning calls from gofakes3 have no context to find
+		// the VFS of the user with
+		fakeOpts = append(fakeOpts, gofakes3.WithoutVersioning())
+	}
+	w.faker = gofakes3.New(backend, fakeOpts...)
 
 	w.handler = http.NewServeMux()
 	w.handler = w.faker.Server()
+	// serve the versioning requests gofakes3 doesn't route so they
+	// aren't mistaken for other requests, even if versioning is off
+	w.handler = versionsMiddleware(w.handler, backend)
 
 	if proxyflags.Opt.AuthProxy != "" {
 		w.proxy = proxy.New(ctx, &proxyflags.Opt)
@@ -0,0 +1,815 @@
+package s3
+
+// Versioning emulation
+//
+// The configuration of a bucket and the old versions of its objects
+// are kept in the hidden directory versionsDir at the top of the
+// bucket:
+//
+//	bucket/.rclone-versions/bucket.json              - versioning and object lock config
+//	bucket/.rclone-versions/path/to/key.versions/    - versions of bucket/path/to/key
+//	bucket/.rclone-versions/path/to/key.versions/index.json - list of versions, newest first
+//	bucket/.rclone-versions/path/to/key.versions/<id>       - data of an old version
+//
+// The data of the current version of an object is always the file
+// bucket/path/to/key so the bucket still looks normal to anything
+// reading the remote directly. A file without an index is the "null"
+// version made before versioning was enabled.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/vfs"
+)
+
+const (
+	versionsDir      = ".rclone-versions" // hidden directory at the top of each bucket
+	bucketConfigName = "bucket.json"      // name of the bucket config in versionsDir
+	versionsSuffix   = ".versions"        // suffix of the directory holding the versions of a key
+	indexName        = "index.json"       // name of the list of versions of a key
+	nullVersionID    = "null"             // ID of versions made while versioning isn't enabled
+)
+
+// bucketConfig is the versioning and object lock configuration of a bucket
+type bucketConfig struct {
+	Versioning   gofakes3.VersioningStatus `json:"versioning,omitempty"`
+	ObjectLock   bool                      `json:"objectLock,omitempty"`
+	DefaultMode  string                    `json:"defaultMode,omitempty"` // retention mode applied to new versions
+	DefaultDays  int                       `json:"defaultDays,omitempty"`
+	DefaultYears int                       `json:"defaultYears,omitempty"`
+}
+
+// versioned returns true if versioning has ever been enabled on the bucket
+func (c *bucketConfig) versioned() bool {
+	return c.Versioning != ""
+}
+
+// version describes a single version of an object
+type version struct {
+	ID           string            `json:"id"`
+	DeleteMarker bool              `json:"deleteMarker,omitempty"`
+	Size         int64             `json:"size"`
+	LastModified time.Time         `json:"lastModified"`
+	ETag         string            `json:"etag,omitempty"` // hex hash as used for the ETag
+	Meta         map[string]string `json:"meta,omitempty"`
+	objectLock
+}
+
+// findVersion returns the index of the version with id or -1 if not found
+func findVersion(versions []*version, id string) int {
+	for i, v := range versions {
+		if v.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// newVersionID makes a new version ID which sorts in creation order
+func newVersionID() string {
+	return fmt.Sprintf("%016x%s", time.Now().UnixNano(), random.String(8))
+}
+
+// isReserved returns true if key refers to the hidden versions directory
+func isReserved(key string) bool {
+	return key == versionsDir || strings.HasPrefix(key, versionsDir+"/")
+}
+
+// versionsPath returns the directory holding the versions of key
+func versionsPath(bucket, key string) string {
+	return path.Join(bucket, versionsDir, key+versionsSuffix)
+}
+
+// versionDataPath returns where the data of versions[i] is stored
+func versionDataPath(bucket, key string, versions []*version, i int) string {
+	if i == 0 {
+		return path.Join(bucket, key)
+	}
+	return path.Join(versionsPath(bucket, key), versions[i].ID)
+}
+
+// keyLock is a reference counted mutex for a single key
+type keyLock struct {
+	mu sync.Mutex
+	n  int
+}
+
+// lockKey serialises changes to the versions of fp returning a
+// function to unlock it
+func (b *s3Backend) lockKey(fp string) (unlock func()) {
+	b.mu.Lock()
+	l := b.keyLocks[fp]
+	if l == nil {
+		l = &keyLock{}
+		b.keyLocks[fp] = l
+	}
+	l.n++
+	b.mu.Unlock()
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		b.mu.Lock()
+		l.n--
+		if l.n == 0 {
+			delete(b.keyLocks, fp)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// versionVFS returns the VFS for the versioning calls from gofakes3.
+//
+// These aren't passed a context so can't be used with --auth-proxy.
+func (b *s3Backend) versionVFS() (*vfs.VFS, error) {
+	if b.s._vfs == nil {
+		return nil, gofakes3.ErrNotImplemented
+	}
+	return b.s._vfs, nil
+}
+
+// getConfig returns the versioning and object lock config of bucket
+func (b *s3Backend) getConfig(_vfs *vfs.VFS, bucket string) (c bucketConfig, err error) {
+	if b.s.proxy != nil {
+		// each user of the proxy has their own VFS so no versioning
+		return c, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c, ok := b.configs[bucket]; ok {
+		return c, nil
+	}
+	data, err := _vfs.ReadFile(path.Join(bucket, versionsDir, bucketConfigName))
+	if errors.Is(err, vfs.ENOENT) {
+		err = nil
+	} else if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return c, fmt.Errorf("failed to read config of bucket %q: %w", bucket, err)
+	}
+	b.configs[bucket] = c
+	return c, nil
+}
+
+// setConfig stores the versioning and object lock config of bucket
+func (b *s3Backend) setConfig(_vfs *vfs.VFS, bucket string, c bucketConfig) error {
+	if b.s.proxy != nil {
+		return gofakes3.ErrNotImplemented
+	}
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dir := path.Join(bucket, versionsDir)
+	if err := _vfs.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	if err := _vfs.WriteFile(path.Join(dir, bucketConfigName), data, 0666); err != nil {
+		return fmt.Errorf("failed to write config of bucket %q: %w", bucket, err)
+	}
+	b.configs[bucket] = c
+	return nil
+}
+
+// removeConfig removes the config of an empty bucket so it can be
+// deleted. It returns gofakes3.ErrBucketNotEmpty if any versions remain.
+func (b *s3Backend) removeConfig(_vfs *vfs.VFS, bucket string) error {
+	dir := path.Join(bucket, versionsDir)
+	entries, err := getDirEntries(dir, _vfs)
+	if err == gofakes3.ErrNoSuchKey {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Name() != bucketConfigName {
+			return gofakes3.ErrBucketNotEmpty
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := _vfs.Remove(path.Join(dir, bucketConfigName)); err != nil && !errors.Is(err, vfs.ENOENT) {
+		return err
+	}
+	delete(b.configs, bucket)
+	return _vfs.Remove(dir)
+}
+
+// VersioningConfiguration returns the versioning status of bucket
+func (b *s3Backend) VersioningConfiguration(bucket string) (config gofakes3.VersioningConfiguration, err error) {
+	if b.s.proxy != nil {
+		return config, nil
+	}
+	_vfs, err := b.versionVFS()
+	if err != nil {
+		return config, err
+	}
+	if _, err := _vfs.Stat(bucket); err != nil {
+		return config, gofakes3.BucketNotFound(bucket)
+	}
+	c, err := b.getConfig(_vfs, bucket)
+	if err != nil {
+		return config, err
+	}
+	config.Status = c.Versioning
+	return config, nil
+}
+
+// SetVersioningConfiguration enables or suspends versioning on bucket
+func (b *s3Backend) SetVersioningConfiguration(bucket string, v gofakes3.VersioningConfiguration) error {
+	_vfs, err := b.versionVFS()
+	if err != nil {
+		return err
+	}
+	if _, err := _vfs.Stat(bucket); err != nil {
+		return gofakes3.BucketNotFound(bucket)
+	}
+	if v.MFADelete == gofakes3.MFADeleteEnabled {
+		return gofakes3.ErrNotImplemented
+	}
+	c, err := b.getConfig(_vfs, bucket)
+	if err != nil {
+		return err
+	}
+	switch {
+	case v.Status == "" || v.Status == c.Versioning:
+		return nil
+	case c.ObjectLock:
+		return gofakes3.ErrorMessage(gofakes3.ErrIllegalVersioningConfiguration, "An Object Lock configuration is present on this bucket, so the versioning state cannot be changed.")
+	}
+	c.Versioning = v.Status
+	return b.setConfig(_vfs, bucket, c)
+}
+
+// liveMeta returns the metadata of the current version stored in fp
+func (b *s3Backend) liveMeta(fp string, v *version) map[string]string {
+	if val, ok := b.meta.Load(fp); ok {
+		return val.(map[string]string)
+	}
+	if v != nil {
+		return v.Meta
+	}
+	return nil
+}
+
+// readVersions returns the versions of key, newest first.
+//
+// The list is reconciled with the file holding the current version in
+// case it was changed without versioning.
+func (b *s3Backend) readVersions(_vfs *vfs.VFS, bucket, key string) (versions []*version, err error) {
+	data, err := _vfs.ReadFile(path.Join(versionsPath(bucket, key), indexName))
+	if err == nil {
+		err = json.Unmarshal(data, &versions)
+	} else if errors.Is(err, vfs.ENOENT) {
+		err = nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read versions of %q: %w", key, err)
+	}
+	fp := path.Join(bucket, key)
+	node, err := _vfs.Stat(fp)
+	live := err == nil && node.IsFile()
+	current := len(versions) > 0 && !versions[0].DeleteMarker
+	switch {
+	case live && !current:
+		// written while versioning wasn't enabled
+		v := &version{
+			ID:           nullVersionID,
+			Size:         node.Size(),
+			LastModified: node.ModTime(),
+			ETag:         getFileHash(node),
+			Meta:         b.liveMeta(fp, nil),
+		}
+		versions = append([]*version{v}, versions...)
+	case !live && current:
+		// removed from outside serve s3
+		versions = versions[1:]
+	}
+	return versions, nil
+}
+
+// latestVersion returns the versions of key if bucket has versioning
+// configured. If the latest version is a delete marker it returns the
+// Object which should be returned for it in marker.
+func (b *s3Backend) latestVersion(_vfs *vfs.VFS, bucket, key string) (versions []*version, marker *gofakes3.Object, err error) {
+	c, err := b.getConfig(_vfs, bucket)
+	if err != nil || !c.versioned() {
+		return nil, nil, err
+	}
+	versions, err = b.readVersions(_vfs, bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(versions) == 0 {
+		return nil, nil, gofakes3.KeyNotFound(key)
+	}
+	if v := versions[0]; v.DeleteMarker {
+		marker = &gofakes3.Object{
+			Name:           key,
+			VersionID:      gofakes3.VersionID(v.ID),
+			IsDeleteMarker: true,
+			Contents:       noOpReadCloser{},
+		}
+	}
+	return versions, marker, nil
+}
+
+// writeVersions stores the versions of key, removing the index if
+// there are none.
+func (b *s3Backend) writeVersions(_vfs *vfs.VFS, bucket, key string, versions []*version) error {
+	dir := versionsPath(bucket, key)
+	indexPath := path.Join(dir, indexName)
+	if len(versions) == 0 {
+		if err := _vfs.Remove(indexPath); err != nil && !errors.Is(err, vfs.ENOENT) {
+			return err
+		}
+		// remove empty directories up to versionsDir
+		top := path.Join(bucket, versionsDir)
+		for ; dir != top && strings.HasPrefix(dir, top+"/"); dir = path.Dir(dir) {
+			if _vfs.Remove(dir) != nil {
+				break
+			}
+		}
+		return nil
+	}
+	data, err := json.MarshalIndent(versions, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := _vfs.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	if err := _vfs.WriteFile(indexPath, data, 0666); err != nil {
+		return fmt.Errorf("failed to write versions of %q: %w", key, err)
+	}
+	return nil
+}
+
+// archive moves the data of the current version v of key out of the
+// way into the versions directory.
+func (b *s3Backend) archive(_vfs *vfs.VFS, bucket, key string, v *version) error {
+	fp := path.Join(bucket, key)
+	dir := versionsPath(bucket, key)
+	if err := _vfs.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	v.Meta = b.liveMeta(fp, v)
+	if err := _vfs.Rename(fp, path.Join(dir, v.ID)); err != nil {
+		return fmt.Errorf("failed to archive version %q of %q: %w", v.ID, key, err)
+	}
+	b.meta.Delete(fp)
+	return nil
+}
+
+// promote makes the old version v of key the current version again
+func (b *s3Backend) promote(_vfs *vfs.VFS, bucket, key string, v *version) error {
+	fp := path.Join(bucket, key)
+	if objectDir := path.Dir(fp); objectDir != "." {
+		if err := mkdirRecursive(objectDir, _vfs); err != nil {
+			return err
+		}
+	}
+	if err := _vfs.Rename(path.Join(versionsPath(bucket, key), v.ID), fp); err != nil {
+		return fmt.Errorf("failed to restore version %q of %q: %w", v.ID, key, err)
+	}
+	if v.Meta != nil {
+		b.meta.Store(fp, v.Meta)
+	}
+	return nil
+}
+
+// removeData removes the data of versions[i] of key if it has any
+func (b *s3Backend) removeData(_vfs *vfs.VFS, bucket, key string, versions []*version, i int) error {
+	if versions[i].DeleteMarker {
+		return nil
+	}
+	fp := versionDataPath(bucket, key, versions, i)
+	if err := _vfs.Remove(fp); err != nil && !errors.Is(err, vfs.ENOENT) {
+		return err
+	}
+	if i == 0 {
+		b.meta.Delete(fp)
+	}
+	return nil
+}
+
+// putVersion uploads a new version of key to a versioned bucket
+func (b *s3Backend) putVersion(_vfs *vfs.VFS, c bucketConfig, bucket, key string, meta map[string]string, lock objectLock, input io.Reader) (result gofakes3.PutObjectResult, err error) {
+	fp := path.Join(bucket, key)
+	unlock := b.lockKey(fp)
+	defer unlock()
+	versions, err := b.readVersions(_vfs, bucket, key)
+	if err != nil {
+		return result, err
+	}
+	now := time.Now()
+
+	id := nullVersionID
+	if c.Versioning == gofakes3.VersioningEnabled {
+		id = newVersionID()
+	}
+
+	// A new null version replaces the old one
+	replaced := findVersion(versions, id)
+	if replaced >= 0 {
+		if err := versions[replaced].checkDelete(now, false); err != nil {
+			return result, err
+		}
+	}
+
+	var archived *version
+	if len(versions) > 0 && !versions[0].DeleteMarker && replaced != 0 {
+		archived = versions[0]
+		if err := b.archive(_vfs, bucket, key, archived); err != nil {
+			return result, err
+		}
+	}
+
+	if err := b.putObject(_vfs, bucket, key, meta, input); err != nil {
+		if archived != nil {
+			if restoreErr := b.promote(_vfs, bucket, key, archived); restoreErr != nil {
+				fs.Errorf(fp, "Failed to restore previous version after failed upload: %v", restoreErr)
+			}
+		}
+		return result, err
+	}
+	node, err := _vfs.Stat(fp)
+	if err != nil {
+		return result, err
+	}
+
+	if replaced > 0 {
+		if err := b.removeData(_vfs, bucket, key, versions, replaced); err != nil {
+			return result, err
+		}
+	}
+	if replaced >= 0 {
+		versions = append(versions[:replaced], versions[replaced+1:]...)
+	}
+	v := &version{
+		ID:           id,
+		Size:         node.Size(),
+		LastModified: now,
+		ETag:         getFileHash(node),
+		Meta:         meta,
+		objectLock:   lock,
+	}
+	versions = append([]*version{v}, versions...)
+	if err := b.writeVersions(_vfs, bucket, key, versions); err != nil {
+		return result, err
+	}
+	result.VersionID = gofakes3.VersionID(id)
+	return result, nil
+}
+
+// deleteVersioned adds a delete marker to key in a versioned bucket
+func (b *s3Backend) deleteVersioned(_vfs *vfs.VFS, c bucketConfig, bucket, key string) (result gofakes3.ObjectDeleteResult, err error) {
+	fp := path.Join(bucket, key)
+	unlock := b.lockKey(fp)
+	defer unlock()
+	versions, err := b.readVersions(_vfs, bucket, key)
+	if err != nil {
+		return result, err
+	}
+	now := time.Now()
+
+	id := nullVersionID
+	if c.Versioning == gofakes3.VersioningEnabled {
+		id = newVersionID()
+	}
+
+	// The delete marker replaces any null version
+	i := findVersion(versions, id)
+	if i >= 0 {
+		if err := versions[i].checkDelete(now, false); err != nil {
+			return result, err
+		}
+		if err := b.removeData(_vfs, bucket, key, versions, i); err != nil {
+			return result, err
+		}
+		versions = append(versions[:i], versions[i+1:]...)
+	}
+	if i != 0 && len(versions) > 0 && !versions[0].DeleteMarker {
+		if err := b.archive(_vfs, bucket, key, versions[0]); err != nil {
+			return result, err
+		}
+	}
+	versions = append([]*version{{
+		ID:           id,
+		DeleteMarker: true,
+		LastModified: now,
+	}}, versions...)
+	if err := b.writeVersions(_vfs, bucket, key, versions); err != nil {
+		return result, err
+	}
+	if !b.opt.noCleanup {
+		rmdirRecursive(fp, _vfs)
+	}
+	result.IsDeleteMarker = true
+	result.VersionID = gofakes3.VersionID(id)
+	return result, nil
+}
+
+// deleteVersion permanently removes version id of key. Governance
+// mode retention is ignored if bypass is set.
+func (b *s3Backend) deleteVersion(bucket, key, id string, bypass bool) (result gofakes3.ObjectDeleteResult, err error) {
+	_vfs, err := b.versionVFS()
+	if err != nil {
+		return result, err
+	}
+	if _, err := _vfs.Stat(bucket); err != nil {
+		return result, gofakes3.BucketNotFound(bucket)
+	}
+	if isReserved(key) {
+		return result, nil
+	}
+	fp := path.Join(bucket, key)
+	unlock := b.lockKey(fp)
+	defer unlock()
+	versions, err := b.readVersions(_vfs, bucket, key)
+	if err != nil {
+		return result, err
+	}
+	i := findVersion(versions, id)
+	if i < 0 {
+		return result, nil
+	}
+	v := versions[i]
+	if err := v.checkDelete(time.Now(), bypass); err != nil {
+		return result, err
+	}
+	if err := b.removeData(_vfs, bucket, key, versions, i); err != nil {
+		return result, err
+	}
+	versions = append(versions[:i], versions[i+1:]...)
+	if i == 0 && len(versions) > 0 && !versions[0].DeleteMarker {
+		if err := b.promote(_vfs, bucket, key, versions[0]); err != nil {
+			return result, err
+		}
+	}
+	if err := b.writeVersions(_vfs, bucket, key, versions); err != nil {
+		return result, err
+	}
+	if i == 0 && !b.opt.noCleanup {
+		rmdirRecursive(fp, _vfs)
+	}
+	result.IsDeleteMarker = v.DeleteMarker
+	result.VersionID = gofakes3.VersionID(id)
+	return result, nil
+}
+
+// DeleteObjectVersion permanently deletes a specific object version.
+func (b *s3Backend) DeleteObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (result gofakes3.ObjectDeleteResult, err error) {
+	return b.deleteVersion(bucketName, objectName, string(versionID), false)
+}
+
+// findObjectVersion returns the versions of key and the index of id in them
+func (b *s3Backend) findObjectVersion(bucket, key, id string) (_vfs *vfs.VFS, versions []*version, i int, err error) {
+	_vfs, err = b.versionVFS()
+	if err != nil {
+		return nil, nil, -1, err
+	}
+	if _, err := _vfs.Stat(bucket); err != nil {
+		return nil, nil, -1, gofakes3.BucketNotFound(bucket)
+	}
+	if isReserved(key) {
+		return nil, nil, -1, gofakes3.KeyNotFound(key)
+	}
+	versions, err = b.readVersions(_vfs, bucket, key)
+	if err != nil {
+		return nil, nil, -1, err
+	}
+	i = findVersion(versions, id)
+	if i < 0 {
+		return nil, nil, -1, gofakes3.ErrNoSuchVersion
+	}
+	if versions[i].DeleteMarker {
+		return nil, nil, -1, gofakes3.ErrMethodNotAllowed
+	}
+	return _vfs, versions, i, nil
+}
+
+// versionMeta returns the metadata to return for versions[i] of key
+func (b *s3Backend) versionMeta(bucket, key string, versions []*version, i int) map[string]string {
+	v := versions[i]
+	if i == 0 {
+		return v.headers(b.liveMeta(path.Join(bucket, key), v))
+	}
+	return v.headers(v.Meta)
+}
+
+// GetObjectVersion fetches a specific version of an object.
+func (b *s3Backend) GetObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
+	_vfs, versions, i, err := b.findObjectVersion(bucketName, objectName, string(versionID))
+	if err != nil {
+		return nil, err
+	}
+	fp := versionDataPath(bucketName, objectName, versions, i)
+	obj, err := b.getFile(_vfs, fp, objectName, b.versionMeta(bucketName, objectName, versions, i), rangeRequest)
+	if err != nil {
+		return nil, err
+	}
+	obj.VersionID = versionID
+	return obj, nil
+}
+
+// HeadObjectVersion fetches the info of a specific version of an object.
+func (b *s3Backend) HeadObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (*gofakes3.Object, error) {
+	_vfs, versions, i, err := b.findObjectVersion(bucketName, objectName, string(versionID))
+	if err != nil {
+		return nil, err
+	}
+	fp := versionDataPath(bucketName, objectName, versions, i)
+	obj, err := b.headFile(_vfs, fp, objectName, b.versionMeta(bucketName, objectName, versions, i))
+	if err != nil {
+		return nil, err
+	}
+	obj.VersionID = versionID
+	return obj, nil
+}
+
+// walkFiles calls fn with the path relative to root of every file
+// below dir, skipping the versions directory at the top of root
+func walkFiles(_vfs *vfs.VFS, root, dir string, fn func(rel string, node vfs.Node)) error {
+	entries, err := getDirEntries(path.Join(root, dir), _vfs)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		rel := path.Join(dir, entry.Name())
+		if entry.IsDir() {
+			if rel == versionsDir {
+				continue
+			}
+			if err := walkFiles(_vfs, root, rel, fn); err != nil {
+				return err
+			}
+		} else {
+			fn(rel, entry)
+		}
+	}
+	return nil
+}
+
+// listKeys returns the sorted keys in bucket which have a current or
+// an old version.
+func (b *s3Backend) listKeys(_vfs *vfs.VFS, bucket string) (keys []string, err error) {
+	seen := map[string]struct{}{}
+	add := func(key string) {
+		if _, found := seen[key]; !found {
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+	err = walkFiles(_vfs, bucket, "", func(rel string, node vfs.Node) {
+		add(rel)
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = walkFiles(_vfs, path.Join(bucket, versionsDir), "", func(rel string, node vfs.Node) {
+		dir, leaf := path.Split(rel)
+		if leaf == indexName && strings.HasSuffix(dir, versionsSuffix+"/") {
+			add(strings.TrimSuffix(dir, versionsSuffix+"/"))
+		}
+	})
+	if err != nil && err != gofakes3.ErrNoSuchKey {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// ListBucketVersions lists all the versions of the objects in bucket.
+//
+// This reads the whole bucket so may be slow on large buckets. Keys
+// are URL encoded in the same way as ListBucket.
+func (b *s3Backend) ListBucketVersions(bucketName string, prefix *gofakes3.Prefix, page *gofakes3.ListBucketVersionsPage) (*gofakes3.ListBucketVersionsResult, error) {
+	_vfs, err := b.versionVFS()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := _vfs.Stat(bucketName); err != nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	var p gofakes3.Prefix
+	if prefix != nil {
+		p = *prefix
+	}
+	// same workaround as ListBucket
+	if strings.TrimSpace(p.Prefix) == "" {
+		p.HasPrefix = false
+	}
+	if p.Delimiter == "" {
+		p.HasDelimiter = false
+	}
+	if page == nil {
+		page = &gofakes3.ListBucketVersionsPage{}
+	}
+	maxKeys := page.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+	keys, err := b.listKeys(_vfs, bucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := gofakes3.NewListBucketVersionsResult(bucketName, &p, page)
+	var (
+		n         int64
+		match     gofakes3.PrefixMatch
+		lastKey   string
+		lastID    string
+		lastDir   string
+		truncated bool
+	)
+	full := func(key, id string) bool {
+		if n >= maxKeys {
+			truncated = true
+			return true
+		}
+		n++
+		lastKey, lastID = key, id
+		return false
+	}
+	for _, key := range keys {
+		if page.HasKeyMarker && key < page.KeyMarker {
+			continue
+		}
+		if !p.Match(key, &match) {
+			continue
+		}
+		if match.CommonPrefix {
+			if page.HasKeyMarker && match.MatchedPart <= page.KeyMarker {
+				continue
+			}
+			if match.MatchedPart == lastDir {
+				continue
+			}
+			if full(match.MatchedPart, "") {
+				break
+			}
+			lastDir = match.MatchedPart
+			result.AddPrefix(gofakes3.URLEncode(match.MatchedPart))
+			continue
+		}
+		versions, err := b.readVersions(_vfs, bucketName, key)
+		if err != nil {
+			return nil, err
+		}
+		skip := page.HasKeyMarker && key == page.KeyMarker
+		for i, v := range versions {
+			if skip {
+				// skip up to and including the version marker
+				if page.HasVersionIDMarker && string(page.VersionIDMarker) == v.ID {
+					skip = false
+				}
+				continue
+			}
+			if full(key, v.ID) {
+				break
+			}
+			lastModified := gofakes3.NewContentTime(v.LastModified)
+			if v.DeleteMarker {
+				result.Versions = append(result.Versions, &gofakes3.DeleteMarker{
+					Key:          gofakes3.URLEncode(key),
+					VersionID:    gofakes3.VersionID(v.ID),
+					IsLatest:     i == 0,
+					LastModified: lastModified,
+				})
+			} else {
+				result.Versions = append(result.Versions, &gofakes3.Version{
+					Key:          gofakes3.URLEncode(key),
+					VersionID:    gofakes3.VersionID(v.ID),
+					IsLatest:     i == 0,
+					LastModified: lastModified,
+					Size:         v.Size,
+					ETag:         v.ETag,
+				})
+			}
+		}
+		if truncated {
+			break
+		}
+	}
+	if truncated {
+		result.IsTruncated = true
+		result.NextKeyMarker = gofakes3.URLEncode(lastKey)
+		result.NextVersionIDMarker = gofakes3.VersionID(lastID)
+	}
+	return result, nil
+}
@@ -0,0 +1,260 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/rclone/rclone/cmd/serve/proxy/proxyflags"
+	"github.com/rclone/rclone/fs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newVersionsClient serves a local directory and returns a minio
+// client for it and the directory
+func newVersionsClient(t *testing.T) (*minio.Client, string) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	endpoint, keyid, keysec, s := serveS3(f)
+	t.Cleanup(func() {
+		assert.NoError(t, s.server.Shutdown())
+	})
+	testURL, err := url.Parse(endpoint)
+	require.NoError(t, err)
+	client, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+	return client, dir
+}
+
+// put uploads contents to key returning the version ID
+func put(t *testing.T, client *minio.Client, bucket, key, contents string, opts minio.PutObjectOptions) string {
+	info, err := client.PutObject(context.Background(), bucket, key, strings.NewReader(contents), int64(len(contents)), opts)
+	require.NoError(t, err)
+	return info.VersionID
+}
+
+// get reads key returning its contents
+func get(t *testing.T, client *minio.Client, bucket, key, versionID string) (string, error) {
+	obj, err := client.GetObject(context.Background(), bucket, key, minio.GetObjectOptions{VersionID: versionID})
+	require.NoError(t, err)
+	defer func() {
+		_ = obj.Close()
+	}()
+	data, err := io.ReadAll(obj)
+	return string(data), err
+}
+
+// listVersions returns the versions of the objects in bucket
+func listVersions(t *testing.T, client *minio.Client, bucket string) (versions []minio.ObjectInfo) {
+	for info := range client.ListObjects(context.Background(), bucket, minio.ListObjectsOptions{WithVersions: true, Recursive: true}) {
+		require.NoError(t, info.Err)
+		versions = append(versions, info)
+	}
+	return versions
+}
+
+func TestVersioning(t *testing.T) {
+	ctx := context.Background()
+	client, dir := newVersionsClient(t)
+	const bucket = "versioned"
+	require.NoError(t, client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}))
+
+	// An object written before versioning is the null version
+	put(t, client, bucket, "dir/file.txt", "null version", minio.PutObjectOptions{})
+	require.NoError(t, client.EnableVersioning(ctx, bucket))
+	config, err := client.GetBucketVersioning(ctx, bucket)
+	require.NoError(t, err)
+	assert.Equal(t, "Enabled", config.Status)
+
+	v1 := put(t, client, bucket, "dir/file.txt", "version 1", minio.PutObjectOptions{})
+	v2 := put(t, client, bucket, "dir/file.txt", "version 2", minio.PutObjectOptions{})
+	require.NotEmpty(t, v1)
+	require.NotEqual(t, v1, v2)
+
+	// The latest version is the file in the remote
+	data, err := os.ReadFile(filepath.Join(dir, bucket, "dir", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "version 2", string(data))
+
+	// Old versions can be read
+	for id, want := range map[string]string{"": "version 2", v2: "version 2", v1: "version 1", "null": "null version"} {
+		got, err := get(t, client, bucket, "dir/file.txt", id)
+		require.NoError(t, err, id)
+		assert.Equal(t, want, got, id)
+	}
+	info, err := client.StatObject(ctx, bucket, "dir/file.txt", minio.StatObjectOptions{VersionID: v1})
+	require.NoError(t, err)
+	assert.Equal(t, v1, info.VersionID)
+	assert.Equal(t, int64(len("version 1")), info.Size)
+
+	// Deleting adds a delete marker
+	require.NoError(t, client.RemoveObject(ctx, bucket, "dir/file.txt", minio.RemoveObjectOptions{}))
+	_, err = client.StatObject(ctx, bucket, "dir/file.txt", minio.StatObjectOptions{})
+	assert.Equal(t, "NoSuchKey", minio.ToErrorResponse(err).Code)
+	_, err = os.Stat(filepath.Join(dir, bucket, "dir", "file.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	versions := listVersions(t, client, bucket)
+	require.Len(t, versions, 4)
+	assert.True(t, versions[0].IsDeleteMarker)
+	assert.True(t, versions[0].IsLatest)
+	assert.Equal(t, v2, versions[1].VersionID)
+	assert.Equal(t, v1, versions[2].VersionID)
+	assert.Equal(t, "null", versions[3].VersionID)
+	for _, v := range versions {
+		assert.Equal(t, "dir/file.txt", v.Key)
+	}
+
+	// Listing can be paged
+	var paged []string
+	for info := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{WithVersions: true, Recursive: true, MaxKeys: 1}) {
+		require.NoError(t, info.Err)
+		paged = append(paged, info.VersionID)
+	}
+	assert.Equal(t, []string{versions[0].VersionID, v2, v1, "null"}, paged)
+
+	// The hidden directory isn't listed
+	for object := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+		assert.Fail(t, "unexpected object", object.Key)
+	}
+
+	// Removing the delete marker restores the object
+	require.NoError(t, client.RemoveObject(ctx, bucket, "dir/file.txt", minio.RemoveObjectOptions{VersionID: versions[0].VersionID}))
+	got, err := get(t, client, bucket, "dir/file.txt", "")
+	require.NoError(t, err)
+	assert.Equal(t, "version 2", got)
+
+	// Removing the latest version promotes the previous one
+	require.NoError(t, client.RemoveObject(ctx, bucket, "dir/file.txt", minio.RemoveObjectOptions{VersionID: v2}))
+	got, err = get(t, client, bucket, "dir/file.txt", "")
+	require.NoError(t, err)
+	assert.Equal(t, "version 1", got)
+
+	// Removing every version leaves an empty bucket which can be deleted
+	require.NoError(t, client.RemoveObject(ctx, bucket, "dir/file.txt", minio.RemoveObjectOptions{VersionID: "null"}))
+	require.NoError(t, client.RemoveObject(ctx, bucket, "dir/file.txt", minio.RemoveObjectOptions{VersionID: v1}))
+	assert.Len(t, listVersions(t, client, bucket), 0)
+	require.NoError(t, client.RemoveBucket(ctx, bucket))
+}
+
+func TestObjectLock(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newVersionsClient(t)
+	const bucket = "locked"
+	require.NoError(t, client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{ObjectLocking: true}))
+	enabled, _, _, _, err := client.GetObjectLockConfig(ctx, bucket)
+	require.NoError(t, err)
+	assert.Equal(t, "Enabled", enabled)
+
+	// Retention set on upload
+	until := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	v1 := put(t, client, bucket, "file.txt", "governed", minio.PutObjectOptions{
+		Mode:            minio.Governance,
+		RetainUntilDate: until,
+	})
+	mode, gotUntil, err := client.GetObjectRetention(ctx, bucket, "file.txt", v1)
+	require.NoError(t, err)
+	assert.Equal(t, minio.Governance, *mode)
+	assert.True(t, until.Equal(*gotUntil), "%v != %v", until, *gotUntil)
+
+	// Locked versions can't be deleted without bypassing governance
+	err = client.RemoveObject(ctx, bucket, "file.txt", minio.RemoveObjectOptions{VersionID: v1})
+	assert.Equal(t, "AccessDenied", minio.ToErrorResponse(err).Code)
+
+	// Retention can be extended but not shortened
+	longer := until.Add(time.Hour)
+	compliance := minio.Compliance
+	require.NoError(t, client.PutObjectRetention(ctx, bucket, "file.txt", minio.PutObjectRetentionOptions{
+		Mode:            &compliance,
+		RetainUntilDate: &longer,
+		VersionID:       v1,
+	}))
+	shorter := until.Add(-time.Minute)
+	err = client.PutObjectRetention(ctx, bucket, "file.txt", minio.PutObjectRetentionOptions{
+		Mode:             &compliance,
+		RetainUntilDate:  &shorter,
+		VersionID:        v1,
+		GovernanceBypass: true,
+	})
+	assert.Equal(t, "AccessDenied", minio.ToErrorResponse(err).Code)
+	err = client.RemoveObject(ctx, bucket, "file.txt", minio.RemoveObjectOptions{VersionID: v1, GovernanceBypass: true})
+	assert.Equal(t, "AccessDenied", minio.ToErrorResponse(err).Code)
+
+	// Legal holds block deletion until released
+	v2 := put(t, client, bucket, "file.txt", "held", minio.PutObjectOptions{})
+	on, off := minio.LegalHoldEnabled, minio.LegalHoldDisabled
+	require.NoError(t, client.PutObjectLegalHold(ctx, bucket, "file.txt", minio.PutObjectLegalHoldOptions{VersionID: v2, Status: &on}))
+	status, err := client.GetObjectLegalHold(ctx, bucket, "file.txt", minio.GetObjectLegalHoldOptions{VersionID: v2})
+	require.NoError(t, err)
+	assert.Equal(t, on, *status)
+	err = client.RemoveObject(ctx, bucket, "file.txt", minio.RemoveObjectOptions{VersionID: v2, GovernanceBypass: true})
+	assert.Equal(t, "AccessDenied", minio.ToErrorResponse(err).Code)
+	require.NoError(t, client.PutObjectLegalHold(ctx, bucket, "file.txt", minio.PutObjectLegalHoldOptions{VersionID: v2, Status: &off}))
+	require.NoError(t, client.RemoveObject(ctx, bucket, "file.txt", minio.RemoveObjectOptions{VersionID: v2}))
+
+	// Delete markers can always be added
+	require.NoError(t, client.RemoveObject(ctx, bucket, "file.txt", minio.RemoveObjectOptions{}))
+	got, err := get(t, client, bucket, "file.txt", v1)
+	require.NoError(t, err)
+	assert.Equal(t, "governed", got)
+
+	// Versioning can't be suspended
+	assert.Error(t, client.SuspendVersioning(ctx, bucket))
+}
+
+func TestVersioningAuthProxy(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	prog, err := filepath.Abs("../servetest/proxy_code.go")
+	require.NoError(t, err)
+	proxyflags.Opt.AuthProxy = "go run " + prog + " " + dir
+	defer func() {
+		proxyflags.Opt.AuthProxy = ""
+	}()
+	endpoint, keyid, keysec, s := serveS3(nil)
+	defer func() {
+		assert.NoError(t, s.server.Shutdown())
+	}()
+	testURL, err := url.Parse(endpoint)
+	require.NoError(t, err)
+	client, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+
+	const bucket = "bucket"
+	require.NoError(t, client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}))
+	put(t, client, bucket, "file.txt", "contents", minio.PutObjectOptions{})
+
+	// Versioning isn't available
+	err = client.EnableVersioning(ctx, bucket)
+	assert.Equal(t, "NotImplemented", minio.ToErrorResponse(err).Code)
+	_, _, _, _, err = client.GetObjectLockConfig(ctx, bucket)
+	assert.Equal(t, "NotImplemented", minio.ToErrorResponse(err).Code)
+
+	// Object lock requests aren't mistaken for uploads
+	until := time.Now().Add(time.Hour)
+	governance := minio.Governance
+	err = client.PutObjectRetention(ctx, bucket, "file.txt", minio.PutObjectRetentionOptions{
+		Mode:            &governance,
+		RetainUntilDate: &until,
+	})
+	assert.Equal(t, "NotImplemented", minio.ToErrorResponse(err).Code)
+	got, err := get(t, client, bucket, "file.txt", "")
+	require.NoError(t, err)
+	assert.Equal(t, "contents", got)
+}
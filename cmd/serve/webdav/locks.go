@@ -0,0 +1,238 @@
+package webdav
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs/vfslock"
+	"golang.org/x/net/webdav"
+)
+
+// lockSystem is a webdav.LockSystem which keeps the locks in a
+// vfslock.Locks so they persist across restarts and are shared with
+// other rclone processes and with VFSes using --vfs-respect-locks.
+//
+// The webdav handler takes a temporary lock for the duration of each
+// request made without an If header. These are only kept in memory as
+// they never outlive the request.
+type lockSystem struct {
+	locks *vfslock.Locks
+
+	mu   sync.Mutex
+	temp map[string]vfslock.Lock // temporary locks by token
+	held map[string]struct{}     // tokens of locks held by Confirm
+	n    uint64                  // number of temporary locks made
+}
+
+// check interface
+var _ webdav.LockSystem = (*lockSystem)(nil)
+
+// newLockSystem makes a lockSystem using locks
+func newLockSystem(locks *vfslock.Locks) *lockSystem {
+	return &lockSystem{
+		locks: locks,
+		temp:  map[string]vfslock.Lock{},
+		held:  map[string]struct{}{},
+	}
+}
+
+// isTemporary returns true if details describe the lock the webdav
+// handler takes while serving a request
+func isTemporary(details webdav.LockDetails) bool {
+	return details.Duration < 0 && details.ZeroDepth && details.OwnerXML == ""
+}
+
+// lockName converts a webdav path into a name for the lock store
+func lockName(name string) string {
+	return strings.Trim(name, "/")
+}
+
+// lockErr translates errors from the lock store into webdav errors
+func lockErr(err error) error {
+	switch {
+	case errors.Is(err, vfslock.ErrLocked):
+		return webdav.ErrLocked
+	case errors.Is(err, vfslock.ErrNoSuchLock):
+		return webdav.ErrNoSuchLock
+	}
+	return err
+}
+
+// details converts l into webdav.LockDetails
+func details(l vfslock.Lock) webdav.LockDetails {
+	return webdav.LockDetails{
+		Root:      "/" + l.Root,
+		Duration:  l.Duration,
+		OwnerXML:  l.OwnerXML,
+		ZeroDepth: l.ZeroDepth,
+	}
+}
+
+// get returns the lock with token if it covers name and isn't held.
+//
+// Call with ls.mu held.
+func (ls *lockSystem) get(now time.Time, name, token string) bool {
+	if _, held := ls.held[token]; held {
+		return false
+	}
+	l, ok := ls.temp[token]
+	if !ok {
+		var err error
+		l, ok, err = ls.locks.Get(now, token)
+		if err != nil {
+			fs.Errorf(name, "Failed to read lock %s: %v", token, err)
+			return false
+		}
+	}
+	return ok && l.Covers(name)
+}
+
+// lookup returns the token of a lock from conditions covering name.
+//
+// Call with ls.mu held.
+func (ls *lockSystem) lookup(now time.Time, name string, conditions []webdav.Condition) (string, bool) {
+	for _, c := range conditions {
+		if c.Token != "" && ls.get(now, name, c.Token) {
+			return c.Token, true
+		}
+	}
+	return "", false
+}
+
+// Confirm confirms that the caller can claim all of the locks
+// specified by the given conditions, and that holding the union of
+// all of those locks gives exclusive access to all of the named
+// resources.
+func (ls *lockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (release func(), err error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	var tokens []string
+	for _, name := range []string{name0, name1} {
+		if name == "" {
+			continue
+		}
+		token, ok := ls.lookup(now, lockName(name), conditions)
+		if !ok {
+			return nil, webdav.ErrConfirmationFailed
+		}
+		if len(tokens) == 0 || tokens[0] != token {
+			tokens = append(tokens, token)
+		}
+	}
+	for _, token := range tokens {
+		ls.held[token] = struct{}{}
+	}
+	return func() {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		for _, token := range tokens {
+			delete(ls.held, token)
+		}
+	}, nil
+}
+
+// Create creates a lock with the given depth, duration, owner and
+// root (name).
+func (ls *lockSystem) Create(now time.Time, details webdav.LockDetails) (token string, err error) {
+	l := vfslock.Lock{
+		Root:      lockName(details.Root),
+		ZeroDepth: details.ZeroDepth,
+		OwnerXML:  details.OwnerXML,
+		Duration:  details.Duration,
+	}
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for _, t := range ls.temp {
+		if t.Conflicts(l.Root, l.ZeroDepth) {
+			return "", webdav.ErrLocked
+		}
+	}
+	if isTemporary(details) {
+		if err := ls.locks.Check(now, l.Root, false); err != nil {
+			return "", lockErr(err)
+		}
+		ls.n++
+		l.Token = fmt.Sprintf("rclone-temporary:%d", ls.n)
+		ls.temp[l.Token] = l
+		return l.Token, nil
+	}
+	l, err = ls.locks.Create(now, l)
+	if err != nil {
+		return "", lockErr(err)
+	}
+	return l.Token, nil
+}
+
+// Refresh refreshes the lock with the given token.
+func (ls *lockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if _, held := ls.held[token]; held {
+		return webdav.LockDetails{}, webdav.ErrLocked
+	}
+	if _, ok := ls.temp[token]; ok {
+		return webdav.LockDetails{}, webdav.ErrLocked
+	}
+	l, err := ls.locks.Refresh(now, token, duration)
+	if err != nil {
+		return webdav.LockDetails{}, lockErr(err)
+	}
+	return details(l), nil
+}
+
+// Unlock unlocks the lock with the given token.
+func (ls *lockSystem) Unlock(now time.Time, token string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if _, held := ls.held[token]; held {
+		return webdav.ErrLocked
+	}
+	if _, ok := ls.temp[token]; ok {
+		delete(ls.temp, token)
+		return nil
+	}
+	return lockErr(ls.locks.Unlock(now, token))
+}
+
+// xmlEscape escapes s for use as XML character data
+func xmlEscape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// lockDiscovery returns the contents of the DAV:lockdiscovery
+// property of name, or nil if it isn't locked.
+func (ls *lockSystem) lockDiscovery(now time.Time, name string) ([]byte, error) {
+	locks, err := ls.locks.Find(now, lockName(name))
+	if err != nil || len(locks) == 0 {
+		return nil, err
+	}
+	var b strings.Builder
+	for _, l := range locks {
+		depth := "infinity"
+		if l.ZeroDepth {
+			depth = "0"
+		}
+		timeout := "Infinite"
+		if !l.Expiry.IsZero() {
+			timeout = fmt.Sprintf("Second-%d", int64(l.Expiry.Sub(now)/time.Second))
+		}
+		fmt.Fprintf(&b, "<D:activelock>"+
+			"<D:locktype><D:write/></D:locktype>"+
+			"<D:lockscope><D:exclusive/></D:lockscope>"+
+			"<D:depth>%s</D:depth>"+
+			"<D:owner>%s</D:owner>"+
+			"<D:timeout>%s</D:timeout>"+
+			"<D:locktoken><D:href>%s</D:href></D:locktoken>"+
+			"<D:lockroot><D:href>%s</D:href></D:lockroot>"+
+			"</D:activelock>",
+			depth, l.OwnerXML, timeout, xmlEscape(l.Token), xmlEscape("/"+l.Root))
+	}
+	return []byte(b.String()), nil
+}
@@ -0,0 +1,116 @@
+//go:build !windows && !darwin
+
+package webdav
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const lockBody = `<?xml version="1.0" encoding="utf-8" ?>
+<D:lockinfo xmlns:D="DAV:">
+  <D:lockscope><D:exclusive/></D:lockscope>
+  <D:locktype><D:write/></D:locktype>
+  <D:owner><D:href>tester</D:href></D:owner>
+</D:lockinfo>`
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8" ?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:lockdiscovery/></D:prop></D:propfind>`
+
+// startLockServer starts a webdav server on f with persistent locks
+func startLockServer(t *testing.T, f fs.Fs) (testURL string, stop func()) {
+	opt := DefaultOpt
+	opt.HTTP.ListenAddr = []string{testBindAddress}
+	opt.LockSystem = "persistent"
+	w, err := newWebDAV(context.Background(), f, &opt)
+	require.NoError(t, err)
+	require.NoError(t, w.serve())
+	return w.Server.URLs()[0], func() {
+		assert.NoError(t, w.Shutdown())
+		w.Wait()
+	}
+}
+
+// do makes a request returning the status and body
+func do(t *testing.T, method, url, body string, headers ...string) (*http.Response, string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp, string(data)
+}
+
+func TestWebDavPersistentLocks(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("persistent locks not supported on this OS")
+	}
+	ctx := context.Background()
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	defer func() {
+		_ = config.SetCacheDir(oldCacheDir)
+	}()
+	f, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+
+	testURL, stop := startLockServer(t, f)
+	fileURL := testURL + "file.txt"
+
+	// Lock a new file
+	resp, body := do(t, "LOCK", fileURL, lockBody, "Timeout", "Second-600", "Depth", "0")
+	require.Equal(t, http.StatusCreated, resp.StatusCode, body)
+	token := resp.Header.Get("Lock-Token")
+	require.True(t, strings.HasPrefix(token, "<opaquelocktoken:"), token)
+	ifHeader := "(" + token + ")"
+
+	// Writes without the token are refused
+	resp, body = do(t, "PUT", fileURL, "hello", "If", "")
+	assert.Equal(t, http.StatusLocked, resp.StatusCode, body)
+
+	// Writes with the token succeed
+	resp, body = do(t, "PUT", fileURL, "hello", "If", ifHeader)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, body)
+
+	// The lock is discoverable
+	resp, body = do(t, "PROPFIND", fileURL, propfindBody, "Depth", "0")
+	assert.Equal(t, http.StatusMultiStatus, resp.StatusCode, body)
+	assert.Contains(t, body, "<D:lockdiscovery><D:activelock>")
+	assert.Contains(t, body, token[1:len(token)-1])
+	assert.Contains(t, body, "<D:owner><D:href>tester</D:href></D:owner>")
+	assert.Contains(t, body, "<D:lockroot><D:href>/file.txt</D:href></D:lockroot>")
+
+	// The lock survives a restart
+	stop()
+	testURL, stop = startLockServer(t, f)
+	defer stop()
+	fileURL = testURL + "file.txt"
+	resp, body = do(t, "PUT", fileURL, "goodbye", "If", "")
+	assert.Equal(t, http.StatusLocked, resp.StatusCode, body)
+	resp, body = do(t, "LOCK", fileURL, "", "If", ifHeader, "Timeout", "Second-600")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, body)
+
+	// Once unlocked anyone can write
+	resp, body = do(t, "UNLOCK", fileURL, "", "Lock-Token", token)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode, body)
+	resp, body = do(t, "PUT", fileURL, "goodbye", "If", "")
+	assert.Equal(t, http.StatusCreated, resp.StatusCode, body)
+	resp, body = do(t, "PROPFIND", fileURL, propfindBody, "Depth", "0")
+	assert.Equal(t, http.StatusMultiStatus, resp.StatusCode, body)
+	assert.NotContains(t, body, "activelock")
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/rclone/rclone/vfs"
 	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/rclone/rclone/vfs/vfsflags"
+	"github.com/rclone/rclone/vfs/vfslock"
 	"github.com/spf13/cobra"
 	"golang.org/x/net/webdav"
 )
@@ -40,6 +41,7 @@ type Options struct {
 	HashName      string
 	HashType      hash.Type
 	DisableGETDir bool
+	LockSystem    string
 }
 
 // DefaultOpt is the default values used for Options
@@ -49,6 +51,7 @@ var DefaultOpt = Options{
 	Template:      libhttp.DefaultTemplateCfg(),
 	HashType:      hash.None,
 	DisableGETDir: false,
+	LockSystem:    "memory",
 }
 
 // Opt is options set by command line flags
@@ -67,6 +70,7 @@ func init() {
 	proxyflags.AddFlags(flagSet)
 	flags.StringVarP(flagSet, &Opt.HashName, "etag-hash", "", "", "Which hash to use for the ETag, or auto or blank for off", "")
 	flags.BoolVarP(flagSet, &Opt.DisableGETDir, "disable-dir-list", "", false, "Disable HTML directory list on GET request for a directory", "")
+	flags.StringVarP(flagSet, &Opt.LockSystem, "lock-system", "", Opt.LockSystem, "Where to keep WebDAV locks: memory or persistent", "")
 }
 
 // Command definition for cobra
@@ -89,6 +93,33 @@ supported hash on the backend or you can use a named hash such as
 "MD5" or "SHA-1". Use the [hashsum](/commands/rclone_hashsum/) command
 to see the full list.
 
+#### --lock-system
+
+This controls where the locks taken by WebDAV clients with the LOCK
+method are kept. Office and LibreOffice use these to stop two people
+editing the same document at once.
+
+With the default of "memory" the locks are only known to this server
+and are forgotten when it stops.
+
+With "persistent" the locks are kept in a database in the cache
+directory (set with --cache-dir). They survive restarts and are
+shared with every other rclone serving the same remote with the same
+cache directory, so several WebDAV servers behind a load balancer
+can share them if the cache directory is on a shared path which
+supports file locking. Expired
+locks are removed and the active locks on a file or directory are
+returned in its DAV:lockdiscovery property.
+
+Other servers can be made to respect these locks with
+--vfs-respect-locks. For example, to stop files locked via WebDAV
+being overwritten via SFTP, run
+
+    rclone serve webdav --lock-system persistent remote:
+    rclone serve sftp --vfs-respect-locks remote:
+
+This can't be used with --auth-proxy.
+
 ### Access WebDAV on Windows
 
 WebDAV shared folder can be mapped as a drive on Windows, however the default settings prevent it.
@@ -188,6 +219,7 @@ type WebDAV struct {
 	f             fs.Fs
 	_vfs          *vfs.VFS // don't use directly, use getVFS
 	webdavhandler *webdav.Handler
+	locks         *lockSystem // persistent locks - nil if not in use
 	proxy         *proxy.Proxy
 	ctx           context.Context // for global config
 }
@@ -207,7 +239,29 @@ func newWebDAV(ctx context.Context, f fs.Fs, opt *Options) (w *WebDAV, err error
 		// override auth
 		w.opt.Auth.CustomAuthFn = w.auth
 	} else {
-		w._vfs = vfs.New(f, &vfscommon.Opt)
+		// The locks are taken by this server so it mustn't refuse
+		// to write to the files it has locked
+		vfsOpt := vfscommon.Opt
+		vfsOpt.RespectLocks = false
+		w._vfs = vfs.New(f, &vfsOpt)
+	}
+
+	var lockSystem webdav.LockSystem
+	switch w.opt.LockSystem {
+	case "", "memory":
+		lockSystem = webdav.NewMemLS()
+	case "persistent":
+		if w.proxy != nil {
+			return nil, errors.New("--lock-system persistent can't be used with --auth-proxy")
+		}
+		locks, err := vfslock.New(ctx, f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open lock database: %w", err)
+		}
+		w.locks = newLockSystem(locks)
+		lockSystem = w.locks
+	default:
+		return nil, fmt.Errorf("unknown --lock-system %q - use memory or persistent", w.opt.LockSystem)
 	}
 
 	w.Server, err = libhttp.NewServer(ctx,
@@ -225,7 +279,7 @@ func newWebDAV(ctx context.Context, f fs.Fs, opt *Options) (w *WebDAV, err error
 	webdavHandler := &webdav.Handler{
 		Prefix:     w.opt.HTTP.BaseURL,
 		FileSystem: w,
-		LockSystem: webdav.NewMemLS(),
+		LockSystem: lockSystem,
 		Logger:     w.logRequest, // FIXME
 	}
 	w.webdavhandler = webdavHandler
@@ -541,6 +595,19 @@ func (h Handle) DeadProps() (map[xml.Name]webdav.Property, error) {
 	property.InnerXML = strconv.AppendInt(nil, h.Handle.Node().ModTime().Unix(), 10)
 	properties[xmlName] = property
 
+	if h.w.locks != nil {
+		activeLocks, err := h.w.locks.lockDiscovery(time.Now(), h.Handle.Node().Path())
+		if err != nil {
+			fs.Errorf(h.Handle.Node(), "failed to read locks: %v", err)
+		} else if activeLocks != nil {
+			xmlName.Space = "DAV:"
+			xmlName.Local = "lockdiscovery"
+			property.XMLName = xmlName
+			property.InnerXML = activeLocks
+			properties[xmlName] = property
+		}
+	}
+
 	return properties, nil
 }
 
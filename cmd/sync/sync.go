@@ -21,6 +21,9 @@ var (
 	createEmptySrcDirs = false
 	opt                = operations.LoggerOpt{}
 	loggerFlagsOpt     = operationsflags.AddLoggerFlagsOptions{}
+	watch              = false
+	watchOpt           = sync.DefaultWatchOptions
+	planFile           = ""
 )
 
 func init() {
@@ -28,6 +31,10 @@ func init() {
 	cmdFlags := commandDefinition.Flags()
 	flags.BoolVarP(cmdFlags, &createEmptySrcDirs, "create-empty-src-dirs", "", createEmptySrcDirs, "Create empty source dirs on destination after sync", "")
 	operationsflags.AddLoggerFlags(cmdFlags, &opt, &loggerFlagsOpt)
+	flags.StringVarP(cmdFlags, &planFile, "plan-file", "", planFile, "Write the actions the sync would take to this file instead of doing them", "")
+	flags.BoolVarP(cmdFlags, &watch, "watch", "", watch, "Keep running and sync changes as they happen", "")
+	flags.DurationVarP(cmdFlags, &watchOpt.Debounce, "watch-debounce", "", watchOpt.Debounce, "With --watch sync once there have been no changes for this long", "")
+	flags.DurationVarP(cmdFlags, &watchOpt.PollInterval, "watch-interval", "", watchOpt.PollInterval, "With --watch sync everything this often if changes can't be notified", "")
 	// TODO: add same flags to move and copy
 }
 
@@ -127,6 +134,20 @@ func GetSyncLoggerOpt(ctx context.Context, fdst fs.Fs, command *cobra.Command) (
 	return opt, close, nil
 }
 
+// writePlan writes the actions the sync would take to planFile
+func writePlan(ctx context.Context, fdst, fsrc fs.Fs) error {
+	plan, err := sync.MakePlan(ctx, fdst, fsrc, createEmptySrcDirs)
+	if err != nil {
+		return err
+	}
+	err = plan.Save(planFile)
+	if err != nil {
+		return err
+	}
+	fs.Logf(nil, "Wrote %d actions to plan file %q", len(plan.Actions), planFile)
+	return nil
+}
+
 func anyNotBlank(s ...string) bool {
 	for _, x := range s {
 		if x != "" {
@@ -179,6 +200,50 @@ for more info.
 
 **Note**: Use the ` + "`-P`" + `/` + "`--progress`" + ` flag to view real-time transfer statistics
 
+## Plan files
+
+With the ` + "`--plan-file`" + ` flag rclone doesn't change anything. Instead
+it works out what the sync would do, like ` + "`--dry-run`" + `, and writes
+each action to the file given as JSON so it can be reviewed.
+
+    rclone sync --plan-file plan.json /path/to/src remote:dst
+
+The actions are ` + "`mkdir`" + `, ` + "`rename`" + ` (a server-side rename on the
+destination from ` + "`--track-renames`" + `), ` + "`copy`" + `, ` + "`update`" + `, ` + "`delete`" + `
+and ` + "`rmdir`" + `. Each records the fingerprint (size, modification time
+and hash) of the files involved and copies which can be done
+server-side are marked with ` + "`serverSide`" + `.
+
+Use the [apply](/commands/rclone_apply/) command to do exactly those
+actions later. Directory modification times and metadata aren't part
+of the plan. The ` + "`--backup-dir`" + `, ` + "`--compare-dest`" + ` and
+` + "`--copy-dest`" + ` and ` + "`--watch`" + ` flags can't be used with
+` + "`--plan-file`" + `.
+
+## Watching for changes
+
+With the ` + "`--watch`" + ` flag rclone does the sync then keeps running
+and syncs the changes made to the source as they happen. This can be
+used to keep a working directory continuously mirrored to a remote.
+
+The changes are found using change notifications from the backends
+which support them (for example the local backend on Linux, Google
+Drive or Dropbox). Notifications from the destination are used too,
+so changes made there are put back. Only the changed files and
+directories are checked and transferred rather than the whole tree.
+
+Changes are synced once there have been none for ` + "`--watch-debounce`" + `
+(default 5s) so that a burst of changes is synced together. If the
+source can't notify its changes then everything is synced every
+` + "`--watch-interval`" + ` (default 1m) instead. This is also passed as the
+poll interval to the backends which poll for changes. If a sync fails
+everything is synced again after ` + "`--watch-interval`" + `.
+
+Use ` + "`rclone rc sync/watch/list`" + ` with the ` + "`--rc`" + ` flag to see the
+state of the watch.
+
+    rclone sync --watch --rc /home/user/work remote:work
+
 **Note**: Use the ` + "`rclone dedupe`" + ` command to deal with "Duplicate object/directory found in source/destination - ignoring" errors.
 See [this forum post](https://forum.rclone.org/t/sync-not-clearing-duplicates/14372) for more info.
 
@@ -225,9 +290,12 @@ is most useful as a predictor of what SHOULD happen to each file
 	},
 	Run: func(command *cobra.Command, args []string) {
 		cmd.CheckArgs(2, 2, command, args)
+		if planFile != "" && watch {
+			fs.Fatalf(nil, "Can't use --plan-file with --watch")
+		}
 		fsrc, srcFileName, fdst := cmd.NewFsSrcFileDst(args)
 		cmd.Run(true, true, command, func() error {
-			ctx := context.Background()
+			ctx := command.Context()
 			opt, close, err := GetSyncLoggerOpt(ctx, fdst, command)
 			if err != nil {
 				return err
@@ -240,6 +308,13 @@ is most useful as a predictor of what SHOULD happen to each file
 			}
 
 			if srcFileName == "" {
+				if planFile != "" {
+					return writePlan(ctx, fdst, fsrc)
+				}
+				if watch {
+					watchOpt.CreateEmptySrcDirs = createEmptySrcDirs
+					return sync.Watch(ctx, fdst, fsrc, watchOpt)
+				}
 				return sync.Sync(ctx, fdst, fsrc, createEmptySrcDirs)
 			}
 			return operations.CopyFile(ctx, fdst, fsrc, srcFileName, srcFileName)
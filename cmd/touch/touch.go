@@ -10,6 +10,7 @@ import (
 
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/config/flags"
 	"github.com/rclone/rclone/fs/fspath"
 	"github.com/rclone/rclone/fs/object"
@@ -126,8 +127,12 @@ func timeOfTouch() (time.Time, error) {
 func createEmptyObject(ctx context.Context, remote string, modTime time.Time, f fs.Fs) error {
 	var buffer []byte
 	src := object.NewStaticObjectInfo(remote, modTime, int64(len(buffer)), true, nil, f)
-	_, err := f.Put(ctx, bytes.NewBuffer(buffer), src)
-	return err
+	o, err := f.Put(ctx, bytes.NewBuffer(buffer), src)
+	if err != nil {
+		return err
+	}
+	audit.Object(ctx, audit.OpCreate, o, nil)
+	return nil
 }
 
 // Touch create new file or change file modification time.
@@ -185,6 +190,7 @@ func Touch(ctx context.Context, f fs.Fs, remote string) error {
 		if err != nil {
 			return fmt.Errorf("failed to touch: %w", err)
 		}
+		audit.Object(ctx, audit.OpSetMetadata, file, nil)
 	}
 	return nil
 }
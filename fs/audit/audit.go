@@ -0,0 +1,339 @@
+// Package audit records the changes rclone makes to remotes in a
+// tamper-evident log.
+//
+// Each object-level mutation is written as a line of JSON. Each
+// record contains the SHA-256 of the line before it, so any change
+// to, insertion into or deletion from the middle of the log can be
+// detected with Check.
+//
+// Several rclone processes can append to the same log. Each append is
+// made holding an exclusive lock on the log's ".lock" file, after
+// reading the end of the chain again in case another process has
+// appended to it.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/rc/jobs"
+)
+
+// OptionsInfo describes the Options in use
+var OptionsInfo = fs.Options{{
+	Name:    "audit_log",
+	Default: "",
+	Help:    "Record every change made to remotes in this file as JSON",
+	Groups:  "Logging",
+}, {
+	Name:    "audit_log_sync",
+	Default: false,
+	Help:    "Sync the audit log to disk after every record",
+	Groups:  "Logging",
+}}
+
+// Options contains options for the audit log
+type Options struct {
+	File string `config:"audit_log"`      // file to append the records to
+	Sync bool   `config:"audit_log_sync"` // fsync after every record
+}
+
+func init() {
+	fs.RegisterGlobalOptions(fs.OptionsInfo{Name: "audit", Opt: &Opt, Options: OptionsInfo})
+}
+
+// Opt is the options for the audit log
+var Opt Options
+
+// Op is the kind of change recorded
+type Op string
+
+// The changes which are recorded
+const (
+	OpCreate      Op = "create"       // a new object was uploaded
+	OpOverwrite   Op = "overwrite"    // an existing object was replaced
+	OpDelete      Op = "delete"       // an object was deleted
+	OpMove        Op = "move"         // an object or directory was moved or renamed
+	OpSetMetadata Op = "set-metadata" // the modification time or metadata of an object was changed
+	OpPurge       Op = "purge"        // a directory and everything in it was deleted
+)
+
+// Record is a single line of the audit log
+type Record struct {
+	Seq       int64             `json:"seq"`                 // sequence number starting from 1
+	Time      time.Time         `json:"time"`                // when the change was made
+	Op        Op                `json:"op"`                  // what the change was
+	Remote    string            `json:"remote"`              // the remote changed
+	Path      string            `json:"path"`                // path of the object or directory in the remote
+	Dir       bool              `json:"dir,omitempty"`       // set if Path is a directory
+	Size      int64             `json:"size"`                // size of the object or -1 if unknown
+	Hashes    map[string]string `json:"hashes,omitempty"`    // hashes of the object if known
+	SrcRemote string            `json:"srcRemote,omitempty"` // where the object was copied or moved from
+	SrcPath   string            `json:"srcPath,omitempty"`   // path in SrcRemote
+	Command   string            `json:"command,omitempty"`   // the rclone command making the change
+	JobID     int64             `json:"jobid,omitempty"`     // the rc job making the change
+	Prev      string            `json:"prev"`                // hex SHA-256 of the previous line
+}
+
+// the open audit log
+type auditLog struct {
+	mu   sync.Mutex
+	out  *os.File
+	lock *flock.Flock // held by a process while it appends to out
+	sync bool
+	seq  int64  // sequence number of the last record
+	prev string // hash of the last record
+}
+
+var (
+	current atomic.Pointer[auditLog] // the open log or nil
+	command string                   // set by SetCommand
+)
+
+// Enabled returns true if changes are being recorded
+func Enabled() bool {
+	return current.Load() != nil
+}
+
+// SetCommand sets the name of the command recorded as making the
+// changes
+func SetCommand(name string) {
+	command = name
+}
+
+// Start recording changes if configured. The records are appended to
+// any existing log continuing its hash chain.
+//
+// It returns a function to close the log.
+func Start(ctx context.Context) (stop func() error, err error) {
+	stop = func() error { return nil }
+	if Opt.File == "" {
+		return stop, nil
+	}
+	l, err := open(Opt.File)
+	if err != nil {
+		return stop, err
+	}
+	l.sync = Opt.Sync
+	current.Store(l)
+	fs.Debugf(nil, "Audit log %q opened at record %d", Opt.File, l.seq)
+	stop = func() error {
+		current.CompareAndSwap(l, nil)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		err := l.out.Sync()
+		return errors.Join(err, l.out.Close())
+	}
+	return stop, nil
+}
+
+// open the audit log at path reading the end of the chain from it
+func open(path string) (*auditLog, error) {
+	out, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	l := &auditLog{
+		out:  out,
+		lock: flock.New(path + ".lock"),
+	}
+	err = l.lockEnd()
+	if err != nil {
+		_ = out.Close()
+		return nil, err
+	}
+	_ = l.lock.Unlock()
+	return l, nil
+}
+
+// lockEnd takes the lock on the log then reads the end of the chain
+// from it, as another process may have appended to it.
+//
+// If it returns no error the lock must be unlocked.
+func (l *auditLog) lockEnd() error {
+	err := l.lock.Lock()
+	if err != nil {
+		return fmt.Errorf("failed to lock audit log: %w", err)
+	}
+	last, err := lastLine(l.out)
+	if err == nil && last != nil {
+		var rec Record
+		err = json.Unmarshal(last, &rec)
+		if err == nil {
+			l.seq = rec.Seq
+			l.prev = lineHash(last)
+		}
+	}
+	if err != nil {
+		_ = l.lock.Unlock()
+		return fmt.Errorf("failed to read the end of audit log %q: %w", l.out.Name(), err)
+	}
+	return nil
+}
+
+// lastLine returns the last line of in without its newline or nil if
+// in is empty
+func lastLine(in *os.File) ([]byte, error) {
+	size, err := in.Seek(0, io.SeekEnd)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+	var buf []byte
+	for chunk := int64(4096); ; chunk *= 2 {
+		if chunk > size {
+			chunk = size
+		}
+		buf = make([]byte, chunk)
+		if _, err = in.ReadAt(buf, size-chunk); err != nil {
+			return nil, err
+		}
+		if buf[len(buf)-1] != '\n' {
+			return nil, errors.New("last record is incomplete")
+		}
+		buf = buf[:len(buf)-1]
+		if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+			return buf[i+1:], nil
+		}
+		if chunk == size {
+			return buf, nil
+		}
+	}
+}
+
+// lineHash returns the hash of a line for the chain
+func lineHash(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// write rec to the log filling in the chain
+func (l *auditLog) write(ctx context.Context, rec *Record) {
+	rec.Time = time.Now()
+	rec.Command = command
+	if jobID, ok := jobs.GetJobID(ctx); ok {
+		rec.JobID = jobID
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err := l.lockEnd()
+	if err != nil {
+		fs.Errorf(nil, "Failed to write audit log: %v", err)
+		_ = fs.CountError(ctx, err)
+		return
+	}
+	defer func() {
+		_ = l.lock.Unlock()
+	}()
+	rec.Seq = l.seq + 1
+	rec.Prev = l.prev
+	line, err := json.Marshal(rec)
+	if err == nil {
+		_, err = l.out.Write(append(line, '\n'))
+	}
+	if err == nil && l.sync {
+		err = l.out.Sync()
+	}
+	if err != nil {
+		fs.Errorf(nil, "Failed to write audit log: %v", err)
+		_ = fs.CountError(ctx, err)
+		return
+	}
+	l.seq = rec.Seq
+	l.prev = lineHash(line)
+}
+
+// Object records op on the object o. src is the object it was copied
+// or moved from or nil.
+func Object(ctx context.Context, op Op, o fs.Object, src fs.ObjectInfo) {
+	l := current.Load()
+	if l == nil {
+		return
+	}
+	rec := &Record{
+		Op:     op,
+		Remote: fs.ConfigString(o.Fs()),
+		Path:   o.Remote(),
+		Size:   o.Size(),
+	}
+	// Reading the hash of a deleted object on a remote where that
+	// needs another transaction will likely fail
+	if ht := o.Fs().Hashes().GetOne(); ht != hash.None && !(op == OpDelete && o.Fs().Features().SlowHash) {
+		sum, err := o.Hash(ctx, ht)
+		if err != nil {
+			fs.Debugf(o, "Audit log: failed to read hash: %v", err)
+		} else if sum != "" {
+			rec.Hashes = map[string]string{ht.String(): sum}
+		}
+	}
+	if src != nil {
+		if srcFs := src.Fs(); srcFs != nil {
+			rec.SrcRemote = fs.ConfigString(srcFs)
+		}
+		rec.SrcPath = src.Remote()
+	}
+	l.write(ctx, rec)
+}
+
+// Dir records op on the directory dir of f. srcFs and srcDir are
+// where it was moved from if set.
+func Dir(ctx context.Context, op Op, f fs.Info, dir string, srcFs fs.Info, srcDir string) {
+	l := current.Load()
+	if l == nil {
+		return
+	}
+	rec := &Record{
+		Op:     op,
+		Remote: fs.ConfigString(f),
+		Path:   dir,
+		Dir:    true,
+		Size:   -1,
+	}
+	if srcFs != nil {
+		rec.SrcRemote = fs.ConfigString(srcFs)
+		rec.SrcPath = srcDir
+	}
+	l.write(ctx, rec)
+}
+
+// Check reads an audit log from in checking the hash chain is intact.
+//
+// It returns the number of records read and an error describing the
+// first problem found, if any.
+func Check(in io.Reader) (n int64, err error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	prev := ""
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return n, fmt.Errorf("line %d: bad record: %w", n+1, err)
+		}
+		if rec.Seq != n+1 {
+			return n, fmt.Errorf("line %d: sequence number is %d but expected %d", n+1, rec.Seq, n+1)
+		}
+		if rec.Prev != prev {
+			return n, fmt.Errorf("line %d: hash chain broken: previous line hash is %q but record has %q", n+1, prev, rec.Prev)
+		}
+		prev = lineHash(line)
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return n, fmt.Errorf("line %d: %w", n+1, err)
+	}
+	return n, nil
+}
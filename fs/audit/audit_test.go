@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// read the records from the audit log at path
+func readRecords(t *testing.T, path string) (recs []Record) {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var rec Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		recs = append(recs, rec)
+	}
+	require.NoError(t, scanner.Err())
+	return recs
+}
+
+// check the audit log at path returning the number of records
+func checkLog(t *testing.T, path string) (int64, error) {
+	in, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, in.Close())
+	}()
+	return Check(in)
+}
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	oldOpt := Opt
+	defer func() {
+		Opt = oldOpt
+		SetCommand("")
+	}()
+
+	// Nothing recorded unless configured
+	Opt = Options{}
+	stop, err := Start(ctx)
+	require.NoError(t, err)
+	assert.False(t, Enabled())
+	require.NoError(t, stop())
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	Opt = Options{File: path, Sync: true}
+	SetCommand("rclone test")
+	stop, err = Start(ctx)
+	require.NoError(t, err)
+	assert.True(t, Enabled())
+
+	f, err := mockfs.NewFs(ctx, "mock", "root", nil)
+	require.NoError(t, err)
+	src := mockobject.New("src.txt").WithContent([]byte("hello"), mockobject.SeekModeNone)
+	dst := mockobject.New("dir/dst.txt").WithContent([]byte("hello"), mockobject.SeekModeNone)
+	dst.SetFs(f)
+	Object(ctx, OpCreate, dst, src)
+	Dir(ctx, OpMove, f, "new", f, "old")
+	// a long record to check the end of the log is found
+	Dir(ctx, OpPurge, f, strings.Repeat("x", 10000), nil, "")
+	require.NoError(t, stop())
+	assert.False(t, Enabled())
+
+	// Reopening continues the chain
+	stop, err = Start(ctx)
+	require.NoError(t, err)
+	Object(ctx, OpDelete, dst, nil)
+	require.NoError(t, stop())
+
+	recs := readRecords(t, path)
+	require.Len(t, recs, 4)
+	assert.Equal(t, int64(1), recs[0].Seq)
+	assert.Equal(t, OpCreate, recs[0].Op)
+	assert.Equal(t, "mock:root", recs[0].Remote)
+	assert.Equal(t, "dir/dst.txt", recs[0].Path)
+	assert.Equal(t, int64(5), recs[0].Size)
+	assert.Equal(t, "src.txt", recs[0].SrcPath)
+	assert.Equal(t, "rclone test", recs[0].Command)
+	assert.Equal(t, "", recs[0].Prev)
+	assert.Equal(t, OpMove, recs[1].Op)
+	assert.True(t, recs[1].Dir)
+	assert.Equal(t, "new", recs[1].Path)
+	assert.Equal(t, "old", recs[1].SrcPath)
+	assert.Equal(t, int64(-1), recs[1].Size)
+	assert.NotEqual(t, "", recs[1].Prev)
+	assert.Equal(t, OpPurge, recs[2].Op)
+	assert.Equal(t, int64(4), recs[3].Seq)
+	assert.Equal(t, OpDelete, recs[3].Op)
+
+	n, err := checkLog(t, path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), n)
+
+	// Tampering with a record is detected
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	tampered := bytes.Replace(data, []byte(`"path":"dir/dst.txt"`), []byte(`"path":"dir/DST.txt"`), 1)
+	require.NoError(t, os.WriteFile(path, tampered, 0600))
+	n, err = checkLog(t, path)
+	assert.ErrorContains(t, err, "line 2: hash chain broken")
+	assert.Equal(t, int64(1), n)
+
+	// As is removing one
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	require.NoError(t, os.WriteFile(path, append(lines[0], lines[2]...), 0600))
+	_, err = checkLog(t, path)
+	assert.ErrorContains(t, err, "line 2: sequence number is 3")
+
+	// Logs opened by several processes keep one chain
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	l1, err := open(path)
+	require.NoError(t, err)
+	l2, err := open(path)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		l1.write(ctx, &Record{Op: OpCreate, Path: "one"})
+		l2.write(ctx, &Record{Op: OpCreate, Path: "two"})
+	}
+	require.NoError(t, l1.out.Close())
+	require.NoError(t, l2.out.Close())
+	n, err = checkLog(t, path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), n)
+
+	// An incomplete record at the end stops the log opening
+	require.NoError(t, os.WriteFile(path, data[:len(data)-1], 0600))
+	_, err = Start(ctx)
+	assert.ErrorContains(t, err, "last record is incomplete")
+	assert.False(t, Enabled())
+}
@@ -0,0 +1,13 @@
+// Package auditflags implements command line flags to set up the audit log
+package auditflags
+
+import (
+	"github.com/rclone/rclone/fs/audit"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/spf13/pflag"
+)
+
+// AddFlags adds the audit log flags to the flagSet
+func AddFlags(flagSet *pflag.FlagSet) {
+	flags.AddFlagsFromOptions(flagSet, "", audit.OptionsInfo)
+}
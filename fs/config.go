@@ -277,6 +277,11 @@ var ConfigOptionsInfo = Options{{
 	Default: false,
 	Help:    "Use recursive list if available; uses more memory but fewer transactions",
 	Groups:  "Listing",
+}, {
+	Name:    "list_cutoff",
+	Default: 1_000_000,
+	Help:    "To save memory, sort directory listings on disk above this threshold",
+	Groups:  "Listing",
 }, {
 	Name:    "tpslimit",
 	Default: 0.0,
@@ -534,6 +539,21 @@ var ConfigOptionsInfo = Options{{
 	Default: ".partial",
 	Help:    "Add partial-suffix to temporary file name when --inplace is not used",
 	Groups:  "Copy",
+}, {
+	Name:    "trace_otlp_endpoint",
+	Default: "",
+	Help:    "Send OpenTelemetry traces to this OTLP/HTTP endpoint, e.g. http://localhost:4318",
+	Groups:  "Debugging",
+}, {
+	Name:    "trace_file",
+	Default: "",
+	Help:    "Write OpenTelemetry traces to this file as JSON",
+	Groups:  "Debugging",
+}, {
+	Name:    "trace_sample_ratio",
+	Default: 1.0,
+	Help:    "Fraction of traces to record when tracing is enabled",
+	Groups:  "Debugging",
 }}
 
 // ConfigInfo is filesystem config options
@@ -585,6 +605,7 @@ type ConfigInfo struct {
 	Suffix                     string            `config:"suffix"`
 	SuffixKeepExtension        bool              `config:"suffix_keep_extension"`
 	UseListR                   bool              `config:"fast_list"`
+	ListCutoff                 int               `config:"list_cutoff"`
 	BufferSize                 SizeSuffix        `config:"buffer_size"`
 	BwLimit                    BwTimetable       `config:"bwlimit"`
 	BwLimitFile                BwTimetable       `config:"bwlimit_file"`
@@ -642,6 +663,9 @@ type ConfigInfo struct {
 	Inplace                    bool              `config:"inplace"`      // Download directly to destination file instead of atomic download to temp/rename
 	PartialSuffix              string            `config:"partial_suffix"`
 	MetadataMapper             SpaceSepList      `config:"metadata_mapper"`
+	TraceOTLPEndpoint          string            `config:"trace_otlp_endpoint"`
+	TraceFile                  string            `config:"trace_file"`
+	TraceSampleRatio           float64           `config:"trace_sample_ratio"`
 }
 
 func init() {
@@ -117,6 +117,7 @@ var (
 var (
 	configPath string
 	cacheDir   string
+	tempDir    string
 	data       Storage
 	dataLoaded bool
 )
@@ -753,6 +754,15 @@ func SetCacheDir(path string) (err error) {
 	return
 }
 
+// GetTempDir returns the directory to use for temporary files as set
+// with --temp-dir, or os.TempDir() if it hasn't been set.
+func GetTempDir() string {
+	if tempDir != "" {
+		return tempDir
+	}
+	return os.TempDir()
+}
+
 // SetTempDir sets new default directory to use for temporary files.
 //
 // Assuming golang's os.TempDir is used to get the directory:
@@ -765,7 +775,6 @@ func SetCacheDir(path string) (err error) {
 // aliases for the same path, and programs may refer to to either of them).
 // This should make all libraries and forked processes use the same.
 func SetTempDir(path string) (err error) {
-	var tempDir string
 	if tempDir, err = filepath.Abs(path); err != nil {
 		return err
 	}
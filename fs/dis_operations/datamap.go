@@ -103,7 +103,7 @@ func GetDistributedInfo(fileName string, remote Remote, checksum string) (Distri
 }
 
 // making file info about original file
-func MakeDataMap(originalFilePath string, distributedFiles []DistributedFile, disFileSize int64, paddingAmount int64, shard int, parity int) error {
+func MakeDataMap(originalFilePath string, distributedFiles []DistributedFile, disFileSize int64, paddingAmount int64, shard int, parity int, codec string) error {
 	if originalFilePath == "" {
 		return errors.New("originalFilePath cannot be empty")
 	}
@@ -132,6 +132,7 @@ func MakeDataMap(originalFilePath string, distributedFiles []DistributedFile, di
 		DisFileSize:          disFileSize,
 		Shard:                shard,
 		Parity:               parity,
+		Codec:                codec,
 		Flag:                 true,
 		State:                "upload",
 		Checksum:             checksum,
@@ -41,6 +41,12 @@ func Dis_Download(args []string, reSignal bool) (err error) {
 		return err
 	}
 
+	release, err := reedsolomon.UseStaging()
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	var distributedFileInfos []DistributedFile
 
 	if reSignal {
@@ -87,7 +93,14 @@ func Dis_Download(args []string, reSignal bool) (err error) {
 		checksums[each.DistributedFile] = each.Checksum
 	}
 
-	err = reedsolomon.DoDecode(originalFileName, absolutePath, fileInfo.Padding, checksums, fileInfo.Shard, fileInfo.Parity, tryGetPassword())
+	_, err = reedsolomon.DecodeFile(context.Background(), originalFileName, absolutePath, reedsolomon.DecodeOptions{
+		Codec:        reedsolomon.Codec(fileInfo.Codec),
+		DataShards:   fileInfo.Shard,
+		ParityShards: fileInfo.Parity,
+		Padding:      fileInfo.Padding,
+		Checksums:    checksums,
+		Password:     tryGetPassword(),
+	})
 	if err != nil {
 		result := ShowDescription_RemoveFile(originalFileName, err)
 		if result {
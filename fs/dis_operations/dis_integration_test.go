@@ -0,0 +1,171 @@
+package dis_operations
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/dis_operations/distest"
+	"github.com/rclone/rclone/reedsolomon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// upload a file of size bytes to a fresh harness with n remotes
+func uploadTestFile(t *testing.T, n int, size int64) (h *distest.Harness, name, src string) {
+	h = distest.New(t, n)
+	name = "file.bin"
+	src = h.WriteFile(name, size)
+	require.NoError(t, Dis_Upload([]string{src}, false, RoundRobin))
+
+	fileInfo, err := GetFileInfoStruct(name)
+	require.NoError(t, err)
+	require.Len(t, fileInfo.DistributedFileInfos, fileInfo.Shard+fileInfo.Parity)
+	return h, name, src
+}
+
+// download the file and check it matches the source
+func checkDownload(t *testing.T, h *distest.Harness, name, src string) {
+	require.NoError(t, Dis_Download([]string{name, h.DstDir}, false))
+	h.RequireSameFile(src, filepath.Join(h.DstDir, name))
+}
+
+func TestIntegrationUploadDownload(t *testing.T) {
+	h, name, src := uploadTestFile(t, 4, 100*1024)
+
+	total := 0
+	for _, remote := range h.Remotes {
+		shards := h.Shards(remote)
+		assert.NotEmpty(t, shards, "remote %s has no shards", remote)
+		total += len(shards)
+	}
+	fileInfo, err := GetFileInfoStruct(name)
+	require.NoError(t, err)
+	assert.Equal(t, fileInfo.Shard+fileInfo.Parity, total)
+
+	checkDownload(t, h, name, src)
+}
+
+func TestIntegrationDownloadDroppedRemote(t *testing.T) {
+	h, name, src := uploadTestFile(t, 4, 100*1024)
+
+	h.Drop(h.Remotes[1])
+	checkDownload(t, h, name, src)
+}
+
+func TestIntegrationDownloadDroppedShards(t *testing.T) {
+	h, name, src := uploadTestFile(t, 4, 100*1024)
+
+	fileInfo, err := GetFileInfoStruct(name)
+	require.NoError(t, err)
+
+	// Drop as many shards as there are parity shards, spread over the remotes
+	dropped := 0
+	for _, remote := range h.Remotes {
+		shards := h.Shards(remote)
+		n := len(shards)
+		if n > fileInfo.Parity-dropped {
+			n = fileInfo.Parity - dropped
+		}
+		if n > 0 {
+			h.Drop(remote, shards[:n]...)
+			dropped += n
+		}
+	}
+	require.Equal(t, fileInfo.Parity, dropped)
+
+	checkDownload(t, h, name, src)
+}
+
+func TestIntegrationDownloadCorruptShards(t *testing.T) {
+	h, name, src := uploadTestFile(t, 4, 100*1024)
+
+	shards := h.Shards(h.Remotes[2])
+	require.NotEmpty(t, shards)
+	h.Corrupt(h.Remotes[2], shards[0])
+
+	checkDownload(t, h, name, src)
+}
+
+func TestIntegrationSlowRemote(t *testing.T) {
+	h := distest.New(t, 3)
+	h.Slow(h.Remotes[0], 50*time.Millisecond)
+
+	name := "slow.bin"
+	src := h.WriteFile(name, 10*1024)
+	require.NoError(t, Dis_Upload([]string{src}, false, RoundRobin))
+
+	checkDownload(t, h, name, src)
+}
+
+func TestIntegrationRemove(t *testing.T) {
+	h, name, _ := uploadTestFile(t, 3, 10*1024)
+
+	require.NoError(t, Dis_rm([]string{name}, false))
+	for _, remote := range h.Remotes {
+		assert.Empty(t, h.Shards(remote), "remote %s still has shards", remote)
+	}
+	exists, err := DoesFileStructExist(name)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestIntegrationStaging(t *testing.T) {
+	h, name, src := uploadTestFile(t, 3, 10*1024)
+	checkDownload(t, h, name, src)
+
+	// Nothing is left next to the source or in the work directory
+	entries, err := os.ReadDir(h.SrcDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, name, entries[0].Name())
+	entries, err = os.ReadDir(filepath.Join(h.Staging, "work"))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// Files are left alone while another command is using the
+	// staging directory unless they are old
+	release, err := reedsolomon.UseStaging()
+	require.NoError(t, err)
+	inUse := filepath.Join(h.Staging, "work", "in-use.fcef")
+	require.NoError(t, os.WriteFile(inUse, []byte("in use"), 0600))
+	old := filepath.Join(h.Staging, "shard", "old")
+	require.NoError(t, os.WriteFile(old, []byte("old"), 0600))
+	oldTime := time.Now().Add(-2 * reedsolomon.StaleAge)
+	require.NoError(t, os.Chtimes(old, oldTime, oldTime))
+	require.NoError(t, CleanStaging())
+	assert.FileExists(t, inUse)
+	assert.NoFileExists(t, old)
+	release()
+
+	// Stale shards and temporary files are removed by CleanStaging
+	stale := filepath.Join(h.Staging, "shard", "stale")
+	require.NoError(t, os.WriteFile(stale, []byte("stale"), 0600))
+	staleDir := filepath.Join(h.Staging, "shard", "file.bin.fcef.123")
+	require.NoError(t, os.Mkdir(staleDir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(staleDir, "file.bin.fcef.0"), []byte("stale"), 0600))
+	partial := filepath.Join(h.Staging, "work", "file.bin.fcef")
+	require.NoError(t, os.WriteFile(partial, []byte("partial"), 0600))
+	require.NoError(t, CleanStaging())
+	assert.NoFileExists(t, stale)
+	assert.NoDirExists(t, staleDir)
+	assert.NoFileExists(t, partial)
+	assert.NoFileExists(t, inUse)
+}
+
+func TestIntegrationLeopard(t *testing.T) {
+	oldCodec := Opt.Codec
+	Opt.Codec = string(reedsolomon.CodecLeopard)
+	defer func() {
+		Opt.Codec = oldCodec
+	}()
+
+	h, name, src := uploadTestFile(t, 4, 100*1024)
+	fileInfo, err := GetFileInfoStruct(name)
+	require.NoError(t, err)
+	assert.Equal(t, string(reedsolomon.CodecLeopard), fileInfo.Codec)
+
+	h.Drop(h.Remotes[3])
+	checkDownload(t, h, name, src)
+}
@@ -45,7 +45,7 @@ func LoadBalancer_RoundRobin() (Remote, error) {
 		return Remote{}, err
 	}
 
-	remotes := config.GetRemotes()
+	remotes := GetDistributionRemotes()
 	if len(remotes) == 0 {
 		return Remote{}, fmt.Errorf("no available remotes")
 	}
@@ -86,7 +86,7 @@ func LoadBalancer_ResourceBased() (Remote, error) {
 		return bestRemote_save, nil
 	}
 
-	remotes := config.GetRemotes()
+	remotes := GetDistributionRemotes()
 	var errs []error
 	var wg sync.WaitGroup
 	var mu sync.Mutex // To protect shared variables
@@ -302,8 +302,16 @@ func getRemoteOfHighestThroughput(selector func(RemoteInfo) float64) (Remote, er
 	var maxValue float64
 	firstIteration := true
 
+	states, err := readRemoteStates()
+	if err != nil {
+		return Remote{}, err
+	}
+
 	// Find the remote with the highest average throughput
 	for key, value := range existingLBInfo.RemoteInfos {
+		if states[strings.Split(key, "|")[0]].Disabled {
+			continue
+		}
 		currentVal := selector(value)
 		if currentVal == 0 {
 			continue
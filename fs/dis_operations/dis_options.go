@@ -0,0 +1,60 @@
+package dis_operations
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/reedsolomon"
+	"github.com/spf13/pflag"
+)
+
+// OptionsInfo describes the Options in use
+var OptionsInfo = fs.Options{{
+	Name:    "dis_temp_dir",
+	Default: "",
+	Help:    "Directory shards and temporary files are staged in (default rclone-dis in --temp-dir)",
+	Groups:  "Config",
+}, {
+	Name:    "dis_codec",
+	Default: string(reedsolomon.CodecStream),
+	Help:    "Erasure code new uploads are split with",
+	Examples: []fs.OptionExample{{
+		Value: string(reedsolomon.CodecStream),
+		Help:  "Classic Reed-Solomon, up to 256 shards",
+	}, {
+		Value: string(reedsolomon.CodecLeopard),
+		Help:  "Leopard GF(2^16), up to 65536 small shards for wide stripes",
+	}},
+	Groups: "Config",
+}}
+
+// Options contains the options for the distributed commands
+type Options struct {
+	TempDir string `config:"dis_temp_dir"`
+	Codec   string `config:"dis_codec"`
+}
+
+// Opt is the current set of options
+var Opt Options
+
+func init() {
+	fs.RegisterGlobalOptions(fs.OptionsInfo{Name: "dis", Opt: &Opt, Options: OptionsInfo, Reload: reload})
+}
+
+// AddFlags adds the flags shared by the distributed commands
+func AddFlags(flagSet *pflag.FlagSet) {
+	flags.AddFlagsFromOptions(flagSet, "", OptionsInfo)
+}
+
+// reload applies the options once they are read
+func reload(ctx context.Context) error {
+	switch reedsolomon.Codec(Opt.Codec) {
+	case "", reedsolomon.CodecStream, reedsolomon.CodecLeopard:
+	default:
+		return fmt.Errorf("unknown --dis-codec %q", Opt.Codec)
+	}
+	reedsolomon.SetStagingDir(Opt.TempDir)
+	return nil
+}
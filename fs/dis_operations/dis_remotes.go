@@ -0,0 +1,118 @@
+package dis_operations
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/rclone/rclone/fs/config"
+)
+
+var remotes_file_name = "remotes.json"
+
+var remotesFileMutex sync.Mutex
+
+// RemoteState holds the distribution settings of a single remote
+type RemoteState struct {
+	Disabled bool `json:"disabled"`
+}
+
+// getting path of json file holding the remote states
+func getRemotesJsonFilePath() string {
+	path := GetRcloneDirPath()
+	return filepath.Join(path, "data", remotes_file_name)
+}
+
+// reading remote states, a missing file means every remote is enabled
+func readRemoteStates() (map[string]RemoteState, error) {
+	file, err := os.Open(getRemotesJsonFilePath())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return make(map[string]RemoteState), nil
+		}
+		return nil, fmt.Errorf("failed to open remotes file: %v", err)
+	}
+	defer file.Close()
+
+	var states map[string]RemoteState
+	err = json.NewDecoder(file).Decode(&states)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to decode remotes file: %v", err)
+	}
+	if states == nil {
+		states = make(map[string]RemoteState)
+	}
+	return states, nil
+}
+
+func writeRemoteStates(states map[string]RemoteState) error {
+	filePath := getRemotesJsonFilePath()
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal remotes file: %v", err)
+	}
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write remotes file: %v", err)
+	}
+	return nil
+}
+
+// IsRemoteEnabled reports whether shards may be distributed to the remote
+func IsRemoteEnabled(name string) bool {
+	states, err := readRemoteStates()
+	if err != nil {
+		fmt.Printf("failed to read remote states: %v\n", err)
+		return true
+	}
+	return !states[name].Disabled
+}
+
+// SetRemoteEnabled enables or disables the remote for distribution.
+//
+// Disabled remotes keep the shards already stored on them, they are
+// only skipped when new shards are allocated.
+func SetRemoteEnabled(name string, enabled bool) error {
+	remotesFileMutex.Lock()
+	defer remotesFileMutex.Unlock()
+
+	states, err := readRemoteStates()
+	if err != nil {
+		return err
+	}
+	if enabled {
+		delete(states, name)
+	} else {
+		states[name] = RemoteState{Disabled: true}
+	}
+	return writeRemoteStates(states)
+}
+
+// GetDistributionRemotes returns the configured remotes which are
+// enabled for distribution
+func GetDistributionRemotes() []config.Remote {
+	states, err := readRemoteStates()
+	if err != nil {
+		fmt.Printf("failed to read remote states: %v\n", err)
+		return config.GetRemotes()
+	}
+
+	var remotes []config.Remote
+	for _, remote := range config.GetRemotes() {
+		if !states[remote.Name].Disabled {
+			remotes = append(remotes, remote)
+		}
+	}
+	return remotes
+}
+
+func GetRemotesFileName() string {
+	return remotes_file_name
+}
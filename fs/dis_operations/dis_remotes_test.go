@@ -0,0 +1,44 @@
+package dis_operations
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/configfile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetRemoteEnabled(t *testing.T) {
+	oldConfigPath := config.GetConfigPath()
+	defer func() {
+		_ = config.SetConfigPath(oldConfigPath)
+		configfile.Install()
+	}()
+
+	configPath := filepath.Join(t.TempDir(), "rclone.conf")
+	require.NoError(t, os.WriteFile(configPath, []byte("[one]\ntype = local\n\n[two]\ntype = memory\n"), 0600))
+	require.NoError(t, config.SetConfigPath(configPath))
+	configfile.Install()
+
+	names := func() (names []string) {
+		for _, remote := range GetDistributionRemotes() {
+			names = append(names, remote.Name)
+		}
+		return names
+	}
+
+	assert.True(t, IsRemoteEnabled("one"))
+	assert.Equal(t, []string{"one", "two"}, names())
+
+	require.NoError(t, SetRemoteEnabled("one", false))
+	assert.False(t, IsRemoteEnabled("one"))
+	assert.True(t, IsRemoteEnabled("two"))
+	assert.Equal(t, []string{"two"}, names())
+
+	require.NoError(t, SetRemoteEnabled("one", true))
+	assert.True(t, IsRemoteEnabled("one"))
+	assert.Equal(t, []string{"one", "two"}, names())
+}
@@ -3,12 +3,14 @@ package dis_operations
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/rclone/rclone/cmd"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var PERM_DEL_FLAG = "--drive-use-trash=false"
@@ -78,6 +80,16 @@ func remoteCallDeleteFile(args []string) (err error) {
 	return nil
 }
 
+// deleteFileArgs returns the deletefile arguments for remotePath,
+// skipping the permanent delete flag when the drive backend isn't built in
+func deleteFileArgs(remotePath string) []string {
+	flagName := strings.SplitN(strings.TrimPrefix(PERM_DEL_FLAG, "--"), "=", 2)[0]
+	if pflag.CommandLine.Lookup(flagName) == nil {
+		return []string{remotePath}
+	}
+	return []string{PERM_DEL_FLAG, remotePath}
+}
+
 func startRmFileGoroutine(originalFileName string, distributedFileArray []DistributedFile) (err error) {
 	var wg sync.WaitGroup
 	errCh := make(chan error, len(distributedFileArray))
@@ -104,7 +116,7 @@ func startRmFileGoroutine(originalFileName string, distributedFileArray []Distri
 
 			remotePath := fmt.Sprintf("%s:%s/%s", info.Remote.Name, remoteDirectory, hashedFileName)
 
-			if err := remoteCallDeleteFile([]string{PERM_DEL_FLAG, remotePath}); err != nil {
+			if err := remoteCallDeleteFile(deleteFileArgs(remotePath)); err != nil {
 				errCh <- fmt.Errorf("failed to delete %s on remote %s: %w", info.DistributedFile, info.Remote.Name, err)
 			}
 
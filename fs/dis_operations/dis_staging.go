@@ -0,0 +1,75 @@
+package dis_operations
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rclone/rclone/reedsolomon"
+)
+
+// CleanStaging tidies the staging directory before a command runs.
+//
+// It removes the temporary files of interrupted encodes and decodes
+// and every shard which doesn't belong to an unfinished operation
+// recorded in the datamap, as those are still needed to resume or
+// dump it.
+//
+// If another command (or the GUI) is using the staging directory only
+// files older than reedsolomon.StaleAge are removed so the files it is
+// working on are left alone.
+func CleanStaging() error {
+	unlock, inUse, err := reedsolomon.LockStaging()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := reedsolomon.CleanWorkDir(inUse); err != nil {
+		return err
+	}
+
+	filesMap, err := readJsonFile()
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[string]bool)
+	for _, fileInfo := range filesMap {
+		if !fileInfo.Flag {
+			continue
+		}
+		for _, dFile := range fileInfo.DistributedFileInfos {
+			hashedFileName, err := CalculateHash(dFile.DistributedFile)
+			if err != nil {
+				return err
+			}
+			keep[dFile.DistributedFile] = true
+			keep[hashedFileName] = true
+		}
+	}
+
+	dir, err := GetShardPath()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read shard directory: %w", err)
+	}
+	for _, entry := range entries {
+		if keep[entry.Name()] {
+			continue
+		}
+		fi, err := entry.Info()
+		if err != nil || !reedsolomon.IsStale(fi, inUse) {
+			continue
+		}
+		// directories are left by interrupted encodes
+		filePath := filepath.Join(dir, entry.Name())
+		if err := os.RemoveAll(filePath); err != nil {
+			return fmt.Errorf("failed to remove stale shard %s: %w", filePath, err)
+		}
+		fmt.Printf("Removed stale shard %s\n", entry.Name())
+	}
+	return nil
+}
@@ -8,6 +8,10 @@ import (
 
 // if return true, do original cmd
 func CheckState(action string, args []string, loadbalancer LoadBalancerType) (bool, error) {
+	if err := CleanStaging(); err != nil {
+		return false, err
+	}
+
 	flag, state, origin_name := CheckFlagAndState()
 	if !flag {
 		return false, nil
@@ -46,6 +46,12 @@ func Dis_Upload(args []string, reSignal bool, loadBalancer LoadBalancerType) err
 		return err
 	}
 
+	release, err := reedsolomon.UseStaging()
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	originalFileName := filepath.Base(args[0])
 	var distributedFileArray []DistributedFile
 	hashedNamesMap := make(map[string]string)
@@ -138,10 +144,20 @@ func createHashNames(distributedFileArray []DistributedFile) (hashNameMap map[st
 }
 
 func prepareUpload(absolutePath string) (hashNameMap map[string]string, distributedFileInfos []DistributedFile, err error) {
-	dis_names, checksums, shardSize, padding, shard, parity := reedsolomon.DoEncode(absolutePath, tryGetPassword())
-	fmt.Println("Shard:", shard)
-	fmt.Println("Parity:", parity)
-	remotes := config.GetRemotes()
+	encoded, err := reedsolomon.EncodeFile(context.Background(), absolutePath, reedsolomon.EncodeOptions{
+		Codec:    reedsolomon.Codec(Opt.Codec),
+		Password: tryGetPassword(),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode %s: %w", absolutePath, err)
+	}
+	if err := moveShards(encoded.Paths); err != nil {
+		return nil, nil, err
+	}
+	fmt.Println("Codec:", encoded.Codec)
+	fmt.Println("Shard:", encoded.DataShards)
+	fmt.Println("Parity:", encoded.ParityShards)
+	remotes := GetDistributionRemotes()
 
 	err = MakeDistributionDir(remotes)
 	if err != nil {
@@ -149,11 +165,11 @@ func prepareUpload(absolutePath string) (hashNameMap map[string]string, distribu
 	}
 
 	// get Distributed info
-	for idx, source := range dis_names {
+	for idx, source := range encoded.Paths {
 		dis_fileName := filepath.Base(source)
 
 		// Get the distributed info (Remote is filled at distribution-time)
-		distributionFile, err := GetDistributedInfo(dis_fileName, Remote{}, checksums[idx])
+		distributionFile, err := GetDistributedInfo(dis_fileName, Remote{}, encoded.Checksums[idx])
 		if err != nil {
 			return nil, nil, err
 		}
@@ -167,7 +183,7 @@ func prepareUpload(absolutePath string) (hashNameMap map[string]string, distribu
 		return nil, nil, fmt.Errorf("errors occurred during hashing: %v", errs)
 	}
 
-	err = MakeDataMap(absolutePath, distributedFileInfos, shardSize, padding, shard, parity)
+	err = MakeDataMap(absolutePath, distributedFileInfos, encoded.ShardSize, encoded.Padding, encoded.DataShards, encoded.ParityShards, string(encoded.Codec))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -175,6 +191,27 @@ func prepareUpload(absolutePath string) (hashNameMap map[string]string, distribu
 	return hashNameMap, distributedFileInfos, nil
 }
 
+// moveShards moves the shards written by EncodeFile into the shard
+// directory so they can be found to resume the upload, and removes the
+// directory they were written to
+func moveShards(paths []string) error {
+	dir, err := GetShardPath()
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if err := os.Rename(path, filepath.Join(dir, filepath.Base(path))); err != nil {
+			return fmt.Errorf("failed to move shard: %w", err)
+		}
+	}
+	if len(paths) > 0 {
+		if err := os.Remove(filepath.Dir(paths[0])); err != nil {
+			return fmt.Errorf("failed to remove encode directory: %w", err)
+		}
+	}
+	return nil
+}
+
 func uploadFile(source, dest string, mu *sync.Mutex, totalThroughput *float64, fileCount *int, errs *[]error, originalFileName string, shardInfo DistributedFile, hashedFileNameMap map[string]string) error {
 	// Get file info
 	fileInfo, err := os.Stat(source)
@@ -242,7 +279,10 @@ func startUploadFileGoroutine_Worker(originalFileName string, hashedFileNameMap
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 	var errs []error
-	dir := GetShardPath()
+	dir, err := GetShardPath()
+	if err != nil {
+		return err
+	}
 	var totalThroughput float64
 	var fileCount int
 
@@ -308,7 +348,10 @@ func startUploadFileGoroutine(originalFileName string, hashedFileNameMap map[str
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 	var errs []error
-	dir := GetShardPath()
+	dir, err := GetShardPath()
+	if err != nil {
+		return err
+	}
 
 	var totalThroughput float64 // Accumulates total throughput
 	var fileCount int           // Counts number of uploaded files
@@ -0,0 +1,153 @@
+// Package distest provides an integration test harness for
+// dis_operations.
+//
+// It builds a temporary rclone config whose remotes are local
+// directories wrapped by a fault injecting backend, so the whole
+// upload, download and remove flow can run in go test and particular
+// remotes or shards can be dropped, corrupted or slowed down.
+package distest
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local" // stand-in remotes are local directories
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/config/configfile"
+	"github.com/rclone/rclone/reedsolomon"
+	"github.com/stretchr/testify/require"
+)
+
+// Harness is a temporary dis_operations environment
+type Harness struct {
+	t       *testing.T
+	Dir     string   // config directory holding datamap and the config file
+	Staging string   // directory shards and temporary files are staged in
+	SrcDir  string   // directory test files are created in
+	DstDir  string   // directory files are downloaded to
+	Remotes []string // config names of the stand-in remotes
+}
+
+// New makes a Harness with n stand-in remotes.
+//
+// The global config path and staging directory are pointed at
+// temporary directories for the duration of the test and restored
+// afterwards.
+func New(t *testing.T, n int) *Harness {
+	Register()
+
+	dir := t.TempDir()
+	h := &Harness{
+		t:       t,
+		Dir:     filepath.Join(dir, "config"),
+		Staging: filepath.Join(dir, "staging"),
+		SrcDir:  filepath.Join(dir, "src"),
+		DstDir:  filepath.Join(dir, "dst"),
+	}
+
+	var conf strings.Builder
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("dis%d", i)
+		h.Remotes = append(h.Remotes, name)
+		_, _ = fmt.Fprintf(&conf, "[%s]\ntype = distest\nremote = %s\n\n", name, h.RemoteDir(name))
+		require.NoError(t, os.MkdirAll(h.RemoteDir(name), 0755))
+	}
+	for _, d := range []string{h.Dir, h.SrcDir, h.DstDir} {
+		require.NoError(t, os.MkdirAll(d, 0755))
+	}
+
+	configPath := filepath.Join(h.Dir, "rclone.conf")
+	require.NoError(t, os.WriteFile(configPath, []byte(conf.String()), 0600))
+
+	oldConfigPath := config.GetConfigPath()
+	require.NoError(t, config.SetConfigPath(configPath))
+	configfile.Install()
+	cache.Clear()
+	oldStaging := reedsolomon.GetStagingDir()
+	reedsolomon.SetStagingDir(h.Staging)
+
+	t.Cleanup(func() {
+		ClearFaults()
+		cache.Clear()
+		reedsolomon.SetStagingDir(oldStaging)
+		_ = config.SetConfigPath(oldConfigPath)
+		configfile.Install()
+	})
+	return h
+}
+
+// RemoteDir returns the local directory backing the remote
+func (h *Harness) RemoteDir(name string) string {
+	return filepath.Join(filepath.Dir(h.Dir), "remotes", name)
+}
+
+// WriteFile creates a file of random data of size bytes in SrcDir and
+// returns its path
+func (h *Harness) WriteFile(name string, size int64) string {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	require.NoError(h.t, err)
+	filePath := filepath.Join(h.SrcDir, name)
+	require.NoError(h.t, os.WriteFile(filePath, data, 0644))
+	return filePath
+}
+
+// Shards returns the leaf names of the objects stored on the remote
+func (h *Harness) Shards(name string) (shards []string) {
+	err := filepath.WalkDir(h.RemoteDir(name), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			shards = append(shards, d.Name())
+		}
+		return nil
+	})
+	require.NoError(h.t, err)
+	sort.Strings(shards)
+	return shards
+}
+
+// Drop makes the shards on the remote disappear, or all of its objects
+// if no shards are given
+func (h *Harness) Drop(name string, shards ...string) {
+	SetFault(name, Fault{Drop: true, Shards: shards})
+	cache.Clear()
+}
+
+// Corrupt makes the shards on the remote, or all of its objects if no
+// shards are given, return inverted data when read
+func (h *Harness) Corrupt(name string, shards ...string) {
+	SetFault(name, Fault{Corrupt: true, Shards: shards})
+	cache.Clear()
+}
+
+// Slow delays every transfer to or from the remote
+func (h *Harness) Slow(name string, delay time.Duration) {
+	SetFault(name, Fault{Delay: delay})
+	cache.Clear()
+}
+
+// Heal removes the fault injected into the remote
+func (h *Harness) Heal(name string) {
+	ClearFault(name)
+	cache.Clear()
+}
+
+// RequireSameFile checks the files at the two paths have the same
+// contents
+func (h *Harness) RequireSameFile(want, got string) {
+	wantData, err := os.ReadFile(want)
+	require.NoError(h.t, err)
+	gotData, err := os.ReadFile(got)
+	require.NoError(h.t, err)
+	require.True(h.t, string(wantData) == string(gotData), "contents of %q and %q differ", want, got)
+}
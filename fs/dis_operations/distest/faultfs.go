@@ -0,0 +1,281 @@
+package distest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Fault describes what goes wrong with the objects of a remote
+type Fault struct {
+	Drop    bool          // objects are not listed and can't be found
+	Corrupt bool          // object data is inverted when read
+	Delay   time.Duration // every Open, Put and Update sleeps this long
+	Shards  []string      // if set, only objects with these leaf names are affected
+}
+
+// affects returns true if the fault applies to the object at remote
+func (fault *Fault) affects(remote string) bool {
+	if len(fault.Shards) == 0 {
+		return true
+	}
+	leaf := path.Base(remote)
+	for _, shard := range fault.Shards {
+		if shard == leaf {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	faultsMu sync.Mutex
+	faults   = map[string]Fault{}
+)
+
+// SetFault sets the fault injected into the remote with the config
+// name given
+func SetFault(name string, fault Fault) {
+	faultsMu.Lock()
+	defer faultsMu.Unlock()
+	faults[name] = fault
+}
+
+// ClearFault removes any fault injected into the remote
+func ClearFault(name string) {
+	faultsMu.Lock()
+	defer faultsMu.Unlock()
+	delete(faults, name)
+}
+
+// ClearFaults removes the faults from all remotes
+func ClearFaults() {
+	faultsMu.Lock()
+	defer faultsMu.Unlock()
+	faults = map[string]Fault{}
+}
+
+func getFault(name string) Fault {
+	faultsMu.Lock()
+	defer faultsMu.Unlock()
+	return faults[name]
+}
+
+var registerOnce sync.Once
+
+// Register the fault injecting backend with Fs
+func Register() {
+	registerOnce.Do(func() {
+		fs.Register(&fs.RegInfo{
+			Name:        "distest",
+			Description: "Fault injecting stand-in remote for dis_operations tests",
+			NewFs:       NewFs,
+			Options: []fs.Option{{
+				Name:     "remote",
+				Help:     "Remote or path to wrap.",
+				Required: true,
+			}},
+		})
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote string `config:"remote"`
+}
+
+// Fs wraps an upstream Fs injecting the faults set for its name
+type Fs struct {
+	fs.Fs
+	name     string
+	root     string
+	features *fs.Features
+}
+
+// Object wraps an upstream Object injecting the faults of its Fs
+type Object struct {
+	fs.Object
+	f *Fs
+}
+
+// NewFs constructs an Fs from the path
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	upstream, err := cache.Get(ctx, fspath.JoinRootPath(opt.Remote, root))
+	if err != nil && err != fs.ErrorIsFile {
+		return nil, err
+	}
+	f := &Fs{
+		Fs:   upstream,
+		name: name,
+		root: root,
+	}
+	f.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+	}).Fill(ctx, f).Mask(ctx, upstream).WrapsFs(f, upstream)
+
+	// A dropped file is reported as a missing directory
+	if err == fs.ErrorIsFile {
+		fault := getFault(name)
+		if fault.Drop && fault.affects(root) {
+			return f, nil
+		}
+		f.root = path.Dir(root)
+	}
+	return f, err
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String returns a description of the FS
+func (f *Fs) String() string {
+	return fmt.Sprintf("distest %s:%s", f.name, f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Hashes returns no hashes so corrupted reads aren't caught by the
+// transfer but by the shard checksums
+func (f *Fs) Hashes() hash.Set {
+	return hash.Set(hash.None)
+}
+
+// About gets quota information from the upstream
+func (f *Fs) About(ctx context.Context) (*fs.Usage, error) {
+	do := f.Fs.Features().About
+	if do == nil {
+		return nil, fs.ErrorNotImplemented
+	}
+	return do(ctx)
+}
+
+// List the objects and directories in dir into entries
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	upstreamEntries, err := f.Fs.List(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	fault := getFault(f.name)
+	for _, entry := range upstreamEntries {
+		o, ok := entry.(fs.Object)
+		if !ok {
+			entries = append(entries, entry)
+			continue
+		}
+		if fault.Drop && fault.affects(o.Remote()) {
+			continue
+		}
+		entries = append(entries, &Object{Object: o, f: f})
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	fault := getFault(f.name)
+	if fault.Drop && fault.affects(remote) {
+		return nil, fs.ErrorObjectNotFound
+	}
+	o, err := f.Fs.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{Object: o, f: f}, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	fault := getFault(f.name)
+	if fault.affects(src.Remote()) {
+		time.Sleep(fault.Delay)
+	}
+	o, err := f.Fs.Put(ctx, in, src, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{Object: o, f: f}, nil
+}
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Hash is not supported, see Fs.Hashes
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	return "", hash.ErrUnsupported
+}
+
+// Open an object for read
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	fault := getFault(o.f.name)
+	if !fault.affects(o.Remote()) {
+		return o.Object.Open(ctx, options...)
+	}
+	time.Sleep(fault.Delay)
+	in, err := o.Object.Open(ctx, options...)
+	if err != nil || !fault.Corrupt {
+		return in, err
+	}
+	return corruptReader{ReadCloser: in}, nil
+}
+
+// Update the object with the contents of the io.Reader
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	fault := getFault(o.f.name)
+	if fault.affects(o.Remote()) {
+		time.Sleep(fault.Delay)
+	}
+	return o.Object.Update(ctx, in, src, options...)
+}
+
+// UnWrap returns the upstream Object
+func (o *Object) UnWrap() fs.Object {
+	return o.Object
+}
+
+// corruptReader inverts every byte read
+type corruptReader struct {
+	io.ReadCloser
+}
+
+func (r corruptReader) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	for i := range p[:n] {
+		p[i] = ^p[i]
+	}
+	return n, err
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs              = (*Fs)(nil)
+	_ fs.Abouter         = (*Fs)(nil)
+	_ fs.Object          = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+)
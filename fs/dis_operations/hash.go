@@ -6,15 +6,21 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/reedsolomon"
 )
 
 func ConvertFileNameForUP(name string) (string, error) {
 	hashFileName, err := CalculateHash(name)
 	if err != nil {
-		fmt.Errorf("failed to calculate hash: %v", err)
+		return "", fmt.Errorf("failed to calculate hash: %v", err)
 	}
 
-	dir := GetShardPath()
+	dir, err := GetShardPath()
+	if err != nil {
+		return "", err
+	}
 	hashedFilePath := filepath.Join(dir, hashFileName)
 	originalFilePath := filepath.Join(dir, name)
 
@@ -28,11 +34,14 @@ func ConvertFileNameForUP(name string) (string, error) {
 }
 
 func ConvertFileNameForDo(hashedName string, originalName string) error {
-	dir := GetShardPath()
+	dir, err := GetShardPath()
+	if err != nil {
+		return err
+	}
 	hashedFilePath := filepath.Join(dir, hashedName)
 	originalFilePath := filepath.Join(dir, originalName)
 
-	_, err := os.Stat(hashedFilePath)
+	_, err = os.Stat(hashedFilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			fmt.Println("no file")
@@ -60,7 +69,12 @@ func CalculateHash(name string) (string, error) {
 
 }
 
-func GetShardPath() string {
-	path := GetRcloneDirPath()
-	return filepath.Join(path, "shard")
+// GetShardPath returns the directory shards are staged in
+func GetShardPath() (string, error) {
+	dir, err := reedsolomon.GetShardDir()
+	if err != nil {
+		fs.Errorf(nil, "Error getting shard directory: %v", err)
+		return "", err
+	}
+	return dir, nil
 }
@@ -0,0 +1,690 @@
+// Boolean filter expressions for --filter-expr
+
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// exprResult is the result of evaluating an expression.
+//
+// Expressions are evaluated with three valued logic so that they can
+// be evaluated when only some of the properties of an object are
+// known, e.g. when deciding whether to descend into a directory.
+type exprResult int
+
+const (
+	exprFalse exprResult = iota
+	exprUnknown
+	exprTrue
+)
+
+func exprBool(b bool) exprResult {
+	if b {
+		return exprTrue
+	}
+	return exprFalse
+}
+
+func (r exprResult) not() exprResult {
+	return exprTrue - r
+}
+
+func (r exprResult) and(s exprResult) exprResult {
+	return min(r, s)
+}
+
+func (r exprResult) or(s exprResult) exprResult {
+	return max(r, s)
+}
+
+// exprItem is the thing an expression is evaluated against
+type exprItem struct {
+	ctx      context.Context
+	remote   string
+	dir      bool // remote is a directory - evaluate for all its descendants
+	pathOnly bool // only the path of the remote is known
+	size     int64
+	modTime  time.Time
+	metadata fs.Metadata
+	o        fs.Object // may be nil
+	now      time.Time
+}
+
+// exprNode is a node in the parsed expression
+type exprNode interface {
+	eval(item *exprItem) exprResult
+	String() string
+}
+
+// filterExpr is a compiled --filter-expr
+type filterExpr struct {
+	root         exprNode
+	needModTime  bool
+	needMetadata bool
+	now          time.Time
+}
+
+// The fields which can be used in an expression
+type exprField int
+
+const (
+	fieldName exprField = iota
+	fieldPath
+	fieldMime
+	fieldMeta
+	fieldHash
+	fieldSize
+	fieldAge
+	fieldModTime
+)
+
+// exprFieldNames maps names in expressions to fields
+var exprFieldNames = map[string]exprField{
+	"name":    fieldName,
+	"path":    fieldPath,
+	"mime":    fieldMime,
+	"size":    fieldSize,
+	"age":     fieldAge,
+	"modtime": fieldModTime,
+}
+
+// exprRef is a reference to a field in an expression
+type exprRef struct {
+	field    exprField
+	key      string    // metadata key for fieldMeta
+	hashType hash.Type // for fieldHash
+	text     string    // as written in the expression
+}
+
+// exprAnd is "left and right"
+type exprAnd struct {
+	left, right exprNode
+}
+
+func (e *exprAnd) eval(item *exprItem) exprResult {
+	r := e.left.eval(item)
+	if r == exprFalse {
+		return r
+	}
+	return r.and(e.right.eval(item))
+}
+
+func (e *exprAnd) String() string {
+	return "(" + e.left.String() + " and " + e.right.String() + ")"
+}
+
+// exprOr is "left or right"
+type exprOr struct {
+	left, right exprNode
+}
+
+func (e *exprOr) eval(item *exprItem) exprResult {
+	r := e.left.eval(item)
+	if r == exprTrue {
+		return r
+	}
+	return r.or(e.right.eval(item))
+}
+
+func (e *exprOr) String() string {
+	return "(" + e.left.String() + " or " + e.right.String() + ")"
+}
+
+// exprNot is "not x"
+type exprNot struct {
+	x exprNode
+}
+
+func (e *exprNot) eval(item *exprItem) exprResult {
+	return e.x.eval(item).not()
+}
+
+func (e *exprNot) String() string {
+	return "not " + e.x.String()
+}
+
+// exprMatch matches a string field against a glob
+type exprMatch struct {
+	ref    exprRef
+	glob   string
+	negate bool
+	re     *regexp.Regexp
+	// for path matches only
+	allRe   *regexp.Regexp   // if this matches a directory then all its descendants match
+	dirsRes []*regexp.Regexp // if none of these match a directory then none of its descendants match
+}
+
+func (e *exprMatch) eval(item *exprItem) (r exprResult) {
+	r = e.match(item)
+	if e.negate {
+		r = r.not()
+	}
+	return r
+}
+
+func (e *exprMatch) match(item *exprItem) exprResult {
+	var value string
+	switch e.ref.field {
+	case fieldPath:
+		if item.dir {
+			return e.matchDir(item.remote)
+		}
+		value = item.remote
+	case fieldName:
+		if item.dir {
+			return exprUnknown
+		}
+		value = path.Base(item.remote)
+	case fieldMime:
+		if item.dir || item.pathOnly {
+			return exprUnknown
+		}
+		if item.o != nil {
+			value = fs.MimeType(item.ctx, item.o)
+		} else {
+			value = fs.MimeTypeFromName(item.remote)
+		}
+	case fieldMeta:
+		if item.dir || item.pathOnly {
+			return exprUnknown
+		}
+		value = item.metadata[e.ref.key]
+	case fieldHash:
+		if item.dir || item.pathOnly || item.o == nil {
+			return exprUnknown
+		}
+		var err error
+		value, err = item.o.Hash(item.ctx, e.ref.hashType)
+		if errors.Is(err, hash.ErrUnsupported) {
+			value = ""
+		} else if err != nil {
+			fs.Errorf(item.o, "Failed to read hash for filter expression: %v", err)
+			return exprUnknown
+		}
+	}
+	return exprBool(e.re.MatchString(value))
+}
+
+// matchDir works out whether the path glob matches all, none or
+// some of the paths inside dir.
+func (e *exprMatch) matchDir(dir string) exprResult {
+	if dir == "" {
+		return exprUnknown
+	}
+	if e.allRe != nil {
+		for d := dir; ; {
+			if e.allRe.MatchString(d) {
+				return exprTrue
+			}
+			i := strings.LastIndex(d, "/")
+			if i < 0 {
+				break
+			}
+			d = d[:i]
+		}
+	}
+	for _, re := range e.dirsRes {
+		if re.MatchString(dir + "/") {
+			return exprUnknown
+		}
+	}
+	return exprFalse
+}
+
+func (e *exprMatch) String() string {
+	op := "="
+	if e.negate {
+		op = "!="
+	}
+	return fmt.Sprintf("%s %s %q", e.ref.text, op, e.glob)
+}
+
+// exprCompare compares size, age or modtime against a value
+type exprCompare struct {
+	ref   exprRef
+	op    string
+	value string        // as written in the expression
+	size  int64         // for fieldSize
+	age   time.Duration // for fieldAge
+	t     time.Time     // for fieldModTime
+}
+
+func (e *exprCompare) eval(item *exprItem) exprResult {
+	if item.dir || item.pathOnly {
+		return exprUnknown
+	}
+	var c int
+	switch e.ref.field {
+	case fieldSize:
+		if item.size < 0 {
+			return exprUnknown
+		}
+		c = compareInt64(item.size, e.size)
+	case fieldAge:
+		c = compareInt64(int64(item.now.Sub(item.modTime)), int64(e.age))
+	case fieldModTime:
+		c = item.modTime.Compare(e.t)
+	}
+	switch e.op {
+	case "=":
+		return exprBool(c == 0)
+	case "!=":
+		return exprBool(c != 0)
+	case "<":
+		return exprBool(c < 0)
+	case "<=":
+		return exprBool(c <= 0)
+	case ">":
+		return exprBool(c > 0)
+	case ">=":
+		return exprBool(c >= 0)
+	}
+	return exprUnknown
+}
+
+func (e *exprCompare) String() string {
+	return fmt.Sprintf("%s %s %s", e.ref.text, e.op, e.value)
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// exprHas is "has meta.KEY" or "has hash.TYPE"
+type exprHas struct {
+	ref exprRef
+}
+
+func (e *exprHas) eval(item *exprItem) exprResult {
+	if item.dir || item.pathOnly {
+		return exprUnknown
+	}
+	if e.ref.field == fieldMeta {
+		_, found := item.metadata[e.ref.key]
+		return exprBool(found)
+	}
+	if item.o == nil {
+		return exprUnknown
+	}
+	if !item.o.Fs().Hashes().Contains(e.ref.hashType) {
+		return exprFalse
+	}
+	value, err := item.o.Hash(item.ctx, e.ref.hashType)
+	if errors.Is(err, hash.ErrUnsupported) {
+		return exprFalse
+	} else if err != nil {
+		fs.Errorf(item.o, "Failed to read hash for filter expression: %v", err)
+		return exprUnknown
+	}
+	return exprBool(value != "")
+}
+
+func (e *exprHas) String() string {
+	return "has " + e.ref.text
+}
+
+// exprToken is a token in the expression
+type exprToken struct {
+	text   string
+	quoted bool // was a quoted string
+	eof    bool
+	pos    int
+}
+
+// isWord returns true if the token is an unquoted word equal to
+// one of words, ignoring case
+func (t exprToken) isWord(words ...string) bool {
+	if t.quoted || t.eof {
+		return false
+	}
+	for _, word := range words {
+		if strings.EqualFold(t.text, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t exprToken) String() string {
+	switch {
+	case t.eof:
+		return "end of expression"
+	case t.quoted:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// Characters which end an unquoted word
+const exprDelimiters = " \t\r\n()=!<>&|\"'"
+
+// Operators, longest first
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "=", "<", ">", "!"}
+
+// tokenizeExpr splits the expression into tokens
+func tokenizeExpr(s string) (tokens []exprToken, err error) {
+	i := 0
+outer:
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, exprToken{text: s[i : i+1], pos: i})
+			i++
+		case c == '"' || c == '\'':
+			var value strings.Builder
+			for j := i + 1; j < len(s); j++ {
+				switch {
+				case s[j] == c:
+					tokens = append(tokens, exprToken{text: value.String(), quoted: true, pos: i})
+					i = j + 1
+					continue outer
+				case s[j] == '\\' && c == '"' && j+1 < len(s):
+					j++
+					_ = value.WriteByte(s[j])
+				default:
+					_ = value.WriteByte(s[j])
+				}
+			}
+			return nil, fmt.Errorf("unterminated string starting at offset %d", i)
+		case strings.IndexByte(exprDelimiters, c) >= 0:
+			for _, op := range exprOperators {
+				if strings.HasPrefix(s[i:], op) {
+					tokens = append(tokens, exprToken{text: op, pos: i})
+					i += len(op)
+					continue outer
+				}
+			}
+			return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+		default:
+			j := i
+			for j < len(s) && strings.IndexByte(exprDelimiters, s[j]) < 0 {
+				j++
+			}
+			tokens = append(tokens, exprToken{text: s[i:j], pos: i})
+			i = j
+		}
+	}
+	tokens = append(tokens, exprToken{eof: true, pos: len(s)})
+	return tokens, nil
+}
+
+// exprParser is a recursive descent parser for filter expressions
+//
+//	expr    = and { ("or" | "||") and }
+//	and     = not { ("and" | "&&") not }
+//	not     = ("not" | "!") not | primary
+//	primary = "(" expr ")" | "has" field | field op value
+type exprParser struct {
+	tokens     []exprToken
+	i          int
+	ignoreCase bool
+	f          *filterExpr
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.i]
+}
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.i]
+	if !tok.eof {
+		p.i++
+	}
+	return tok
+}
+
+func (p *exprParser) errorf(tok exprToken, format string, a ...any) error {
+	return fmt.Errorf("%s at offset %d", fmt.Sprintf(format, a...), tok.pos)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isWord("or", "||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isWord("and", "&&") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.peek().isWord("not", "!") {
+		p.next()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNot{x: x}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	if tok.isWord("(") {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if tok = p.next(); !tok.isWord(")") {
+			return nil, p.errorf(tok, "expecting \")\" but got %v", tok)
+		}
+		return x, nil
+	}
+	if tok.isWord("has") {
+		tok = p.next()
+		ref, err := p.parseRef(tok)
+		if err != nil {
+			return nil, err
+		}
+		if ref.field != fieldMeta && ref.field != fieldHash {
+			return nil, p.errorf(tok, "\"has\" can only be used with meta.KEY or hash.TYPE not %v", tok)
+		}
+		if ref.field == fieldMeta {
+			p.f.needMetadata = true
+		}
+		return &exprHas{ref: ref}, nil
+	}
+	ref, err := p.parseRef(tok)
+	if err != nil {
+		return nil, err
+	}
+	opTok := p.next()
+	op := opTok.text
+	switch {
+	case opTok.quoted || opTok.eof:
+		return nil, p.errorf(opTok, "expecting comparison operator after %q but got %v", ref.text, opTok)
+	case op == "==":
+		op = "="
+	case op == "=" || op == "!=" || op == "<" || op == "<=" || op == ">" || op == ">=":
+	default:
+		return nil, p.errorf(opTok, "expecting comparison operator after %q but got %v", ref.text, opTok)
+	}
+	valueTok := p.next()
+	if valueTok.eof || (!valueTok.quoted && strings.IndexByte(exprDelimiters, valueTok.text[0]) >= 0) {
+		return nil, p.errorf(valueTok, "expecting value after %q but got %v", ref.text+" "+op, valueTok)
+	}
+	switch ref.field {
+	case fieldSize, fieldAge, fieldModTime:
+		return p.parseCompare(ref, op, valueTok)
+	}
+	if op != "=" && op != "!=" {
+		return nil, p.errorf(opTok, "%q can only be compared with = or !=", ref.text)
+	}
+	return p.parseMatch(ref, op == "!=", valueTok.text)
+}
+
+// parseRef parses a field reference
+func (p *exprParser) parseRef(tok exprToken) (ref exprRef, err error) {
+	if tok.quoted || tok.eof || strings.IndexByte(exprDelimiters, tok.text[0]) >= 0 {
+		return ref, p.errorf(tok, "expecting field name but got %v", tok)
+	}
+	ref.text = tok.text
+	lower := strings.ToLower(tok.text)
+	if key, ok := strings.CutPrefix(lower, "meta."); ok {
+		if key == "" {
+			return ref, p.errorf(tok, "missing metadata key in %q", tok.text)
+		}
+		ref.field = fieldMeta
+		ref.key = key
+		return ref, nil
+	}
+	if name, ok := strings.CutPrefix(lower, "hash."); ok {
+		ref.field = fieldHash
+		if err := ref.hashType.Set(name); err != nil {
+			return ref, p.errorf(tok, "bad hash type in %q: %v", tok.text, err)
+		}
+		return ref, nil
+	}
+	field, ok := exprFieldNames[lower]
+	if !ok {
+		return ref, p.errorf(tok, "unknown field %q", tok.text)
+	}
+	ref.field = field
+	return ref, nil
+}
+
+// parseCompare makes a comparison of size, age or modtime
+func (p *exprParser) parseCompare(ref exprRef, op string, tok exprToken) (exprNode, error) {
+	e := &exprCompare{ref: ref, op: op, value: tok.text}
+	var err error
+	switch ref.field {
+	case fieldSize:
+		// Unlike --min-size a plain number is in bytes here
+		if e.size, err = strconv.ParseInt(tok.text, 10, 64); err != nil {
+			var size fs.SizeSuffix
+			err = size.Set(tok.text)
+			e.size = int64(size)
+		}
+	case fieldAge:
+		p.f.needModTime = true
+		var d fs.Duration
+		err = d.Set(tok.text)
+		e.age = time.Duration(d)
+	case fieldModTime:
+		p.f.needModTime = true
+		e.t, err = fs.ParseTime(tok.text)
+	}
+	if err != nil {
+		return nil, p.errorf(tok, "bad value for %q: %v", ref.text, err)
+	}
+	return e, nil
+}
+
+// parseMatch makes a glob match
+func (p *exprParser) parseMatch(ref exprRef, negate bool, glob string) (exprNode, error) {
+	e := &exprMatch{ref: ref, glob: glob, negate: negate}
+	var err error
+	switch ref.field {
+	case fieldPath:
+		e.re, err = GlobPathToRegexp(glob, p.ignoreCase)
+		if err != nil {
+			break
+		}
+		if prefix, ok := strings.CutSuffix(glob, "/**"); ok || glob == "**" {
+			if prefix == "" || prefix == "/" || glob == "**" {
+				prefix = "/**"
+			}
+			e.allRe, err = GlobPathToRegexp(prefix, p.ignoreCase)
+			if err != nil {
+				break
+			}
+		}
+		for _, dirGlob := range globToDirGlobs(glob) {
+			var dirRe *regexp.Regexp
+			dirRe, err = GlobPathToRegexp(dirGlob, p.ignoreCase)
+			if err != nil {
+				break
+			}
+			e.dirsRes = append(e.dirsRes, dirRe)
+		}
+	case fieldMeta:
+		p.f.needMetadata = true
+		e.re, err = GlobStringToRegexp(glob, true, p.ignoreCase)
+	default:
+		e.re, err = GlobStringToRegexp(glob, true, p.ignoreCase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad glob %q for %q: %w", glob, ref.text, err)
+	}
+	return e, nil
+}
+
+// newFilterExpr compiles the expression passed in
+func newFilterExpr(expr string, ignoreCase bool) (f *filterExpr, err error) {
+	f = &filterExpr{
+		now: time.Now(),
+	}
+	tokens, err := tokenizeExpr(expr)
+	if err != nil {
+		return nil, fmt.Errorf("bad filter expression %q: %w", expr, err)
+	}
+	p := &exprParser{
+		tokens:     tokens,
+		ignoreCase: ignoreCase,
+		f:          f,
+	}
+	f.root, err = p.parseOr()
+	if err == nil {
+		if tok := p.next(); !tok.eof {
+			err = p.errorf(tok, "unexpected %v", tok)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad filter expression %q: %w", expr, err)
+	}
+	return f, nil
+}
+
+// eval evaluates the expression against item
+func (f *filterExpr) eval(item *exprItem) exprResult {
+	item.now = f.now
+	return f.root.eval(item)
+}
+
+// String returns the expression in canonical form
+func (f *filterExpr) String() string {
+	return f.root.String()
+}
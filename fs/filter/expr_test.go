@@ -0,0 +1,205 @@
+package filter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExprParse(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+		err  string
+	}{
+		{in: `name = "*.iso"`, want: `name = "*.iso"`},
+		{in: `name == *.iso`, want: `name = "*.iso"`},
+		{in: `path != 'tmp/**'`, want: `path != "tmp/**"`},
+		{in: `size > 1G or name = "*.iso"`, want: `(size > 1G or name = "*.iso")`},
+		{in: `a=1`, err: `unknown field "a" at offset 0`},
+		{in: `size>1G&&!(age<1w||has meta.owner)`, want: `(size > 1G and not (age < 1w or has meta.owner))`},
+		{in: `NAME = a AND NOT size < 10 OR mime = "image/*"`, want: `((NAME = "a" and not size < 10) or mime = "image/*")`},
+		{in: `has hash.md5 and hash.sha1 != ""`, want: `(has hash.md5 and hash.sha1 != "")`},
+		{in: `modtime >= 2024-01-02`, want: `modtime >= 2024-01-02`},
+		{in: `meta.owner = "x\"y"`, want: `meta.owner = "x\"y"`},
+		{in: ``, err: `expecting field name but got end of expression at offset 0`},
+		{in: `name = `, err: `expecting value after "name =" but got end of expression at offset 7`},
+		{in: `(name = a`, err: `expecting ")" but got end of expression at offset 9`},
+		{in: `name = a)`, err: `unexpected ")" at offset 8`},
+		{in: `name < a`, err: `"name" can only be compared with = or !=`},
+		{in: `name a`, err: `expecting comparison operator after "name" but got "a" at offset 5`},
+		{in: `size > potato`, err: `bad value for "size"`},
+		{in: `age > potato`, err: `bad value for "age"`},
+		{in: `has size`, err: `"has" can only be used with meta.KEY or hash.TYPE`},
+		{in: `has hash.potato`, err: `bad hash type in "hash.potato"`},
+		{in: `has meta.`, err: `missing metadata key in "meta."`},
+		{in: `name = "*.iso`, err: `unterminated string starting at offset 7`},
+		{in: `name = a & name = b`, err: `unexpected '&' at offset 9`},
+		{in: `name = "[a"`, err: `bad glob "[a" for "name"`},
+	} {
+		f, err := newFilterExpr(test.in, false)
+		if test.err != "" {
+			require.Error(t, err, test.in)
+			assert.Contains(t, err.Error(), test.err, test.in)
+			continue
+		}
+		require.NoError(t, err, test.in)
+		assert.Equal(t, test.want, f.String(), test.in)
+	}
+}
+
+func TestExprResult(t *testing.T) {
+	results := []exprResult{exprFalse, exprUnknown, exprTrue}
+	for _, a := range results {
+		for _, b := range results {
+			assert.Equal(t, a.and(b).not(), a.not().or(b.not()), "%v %v", a, b)
+		}
+	}
+	assert.Equal(t, exprTrue, exprFalse.not())
+	assert.Equal(t, exprUnknown, exprUnknown.not())
+	assert.Equal(t, exprUnknown, exprTrue.and(exprUnknown))
+	assert.Equal(t, exprFalse, exprFalse.and(exprUnknown))
+	assert.Equal(t, exprTrue, exprTrue.or(exprUnknown))
+	assert.Equal(t, exprUnknown, exprFalse.or(exprUnknown))
+}
+
+func newExprFilter(t *testing.T, expr string) *Filter {
+	opt := Opt
+	opt.FilterExpr = expr
+	f, err := NewFilter(&opt)
+	require.NoError(t, err)
+	assert.False(t, f.InActive())
+	return f
+}
+
+func TestExprInclude(t *testing.T) {
+	f := newExprFilter(t, `(size > 1G or name = "*.iso") and not path = "tmp/**" and age < 1w`)
+	now := time.Now()
+	old := now.Add(-30 * 24 * time.Hour)
+	for _, test := range []struct {
+		remote  string
+		size    int64
+		modTime time.Time
+		want    bool
+	}{
+		{"small.txt", 10, now, false},
+		{"big.bin", 2 << 30, now, true},
+		{"big.bin", 2 << 30, old, false},
+		{"dir/disk.iso", 10, now, true},
+		{"dir/disk.iso", 10, old, false},
+		{"tmp/disk.iso", 10, now, false},
+		{"a/tmp/big.bin", 2 << 30, now, false},
+		{"tmpfile.iso", 10, now, true},
+	} {
+		assert.Equal(t, test.want, f.Include(test.remote, test.size, test.modTime, nil), test.remote)
+	}
+}
+
+func TestExprIncludeMetadata(t *testing.T) {
+	f := newExprFilter(t, `meta.owner = "b*" or (has meta.keep and meta.keep != "no")`)
+	for _, test := range []struct {
+		metadata fs.Metadata
+		want     bool
+	}{
+		{nil, false},
+		{fs.Metadata{"owner": "bob"}, true},
+		{fs.Metadata{"owner": "alice"}, false},
+		{fs.Metadata{"owner": "alice", "keep": ""}, true},
+		{fs.Metadata{"keep": "no"}, false},
+	} {
+		assert.Equal(t, test.want, f.Include("file", 0, time.Now(), test.metadata), test.metadata)
+	}
+	assert.True(t, f.expr.needMetadata)
+	assert.False(t, f.expr.needModTime)
+}
+
+func TestExprIncludeRemote(t *testing.T) {
+	f := newExprFilter(t, `name = "*.jpg" and size > 1M`)
+	assert.True(t, f.IncludeRemote("a.jpg"))
+	assert.False(t, f.IncludeRemote("a.png"))
+
+	f = newExprFilter(t, `name = "*.jpg" or size > 1M`)
+	assert.True(t, f.IncludeRemote("a.jpg"))
+	assert.True(t, f.IncludeRemote("a.png"))
+}
+
+func TestExprIncludeDirectory(t *testing.T) {
+	ctx := context.Background()
+	for _, test := range []struct {
+		expr string
+		dirs map[string]bool
+	}{
+		{
+			expr: `not path = "tmp/**"`,
+			dirs: map[string]bool{"tmp": false, "tmp/sub": false, "a/tmp": false, "a": true, "tmpfile": true},
+		},
+		{
+			expr: `not path = "/tmp/**"`,
+			dirs: map[string]bool{"tmp": false, "tmp/sub": false, "a/tmp": true, "a": true},
+		},
+		{
+			expr: `path = "photos/*.jpg"`,
+			dirs: map[string]bool{"photos": true, "a/photos": true, "a": false, "photos/sub": false},
+		},
+		{
+			expr: `path = "/photos/**" and size > 1M`,
+			dirs: map[string]bool{"photos": true, "photos/sub": true, "a": false, "a/photos": false},
+		},
+		{
+			expr: `path = "/photos/**" or size > 1M`,
+			dirs: map[string]bool{"photos": true, "a": true},
+		},
+		{
+			expr: `name = "*.jpg"`,
+			dirs: map[string]bool{"a": true, "a/b": true},
+		},
+		{
+			expr: `not (name = "*.jpg" or path = "a/**")`,
+			dirs: map[string]bool{"a": false, "a/b": false, "b": true},
+		},
+	} {
+		f := newExprFilter(t, test.expr)
+		include := f.IncludeDirectory(ctx, nil)
+		for dir, want := range test.dirs {
+			got, err := include(dir)
+			require.NoError(t, err)
+			assert.Equal(t, want, got, "%s: %s", test.expr, dir)
+		}
+	}
+}
+
+func TestExprIncludeObject(t *testing.T) {
+	ctx := context.Background()
+	mfs, err := mockfs.NewFs(ctx, "mock", "root", nil)
+	require.NoError(t, err)
+	mfs.(*mockfs.Fs).SetHashes(hash.NewHashSet(hash.MD5))
+	newObject := func(remote string, content string) fs.Object {
+		o := mockobject.New(remote).WithContent([]byte(content), mockobject.SeekModeNone)
+		o.SetFs(mfs)
+		return o
+	}
+
+	f := newExprFilter(t, `mime = "image/*" and has hash.md5 and not has hash.sha1`)
+	assert.True(t, f.IncludeObject(ctx, newObject("a.jpg", "hello")))
+	assert.False(t, f.IncludeObject(ctx, newObject("a.txt", "hello")))
+
+	// md5 of "hello"
+	f = newExprFilter(t, `hash.md5 = "5d41402abc4b2a76b9719d911017c592"`)
+	assert.True(t, f.IncludeObject(ctx, newObject("a.txt", "hello")))
+	assert.False(t, f.IncludeObject(ctx, newObject("a.txt", "potato")))
+
+	// Without the object the hash is unknown so the file is included
+	assert.True(t, f.Include("a.txt", 5, time.Now(), nil))
+}
+
+func TestExprDumpFilters(t *testing.T) {
+	f := newExprFilter(t, `size > 1G`)
+	assert.Contains(t, f.DumpFilters(), "--- Filter expression ---\nsize > 1G")
+}
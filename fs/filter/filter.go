@@ -29,6 +29,11 @@ var OptionsInfo = fs.Options{{
 	Default: []string{},
 	Help:    "Exclude directories if filename is present",
 	Groups:  "Filter",
+}, {
+	Name:    "ignore_file_name",
+	Default: []string{},
+	Help:    "Read gitignore style rules from files with this name in each directory, e.g. .rcloneignore",
+	Groups:  "Filter",
 }, {
 	Name:    "files_from",
 	Default: []string{},
@@ -95,6 +100,11 @@ var OptionsInfo = fs.Options{{
 	Default: []string{},
 	Help:    "Read file include patterns from file (use - to read from stdin)",
 	Groups:  "Filter",
+}, {
+	Name:    "filter_expr",
+	Default: "",
+	Help:    "Only transfer files matching this boolean filter expression",
+	Groups:  "Filter",
 }, {
 	Name:    "metadata_filter",
 	Default: []string{},
@@ -132,6 +142,7 @@ type Options struct {
 	DeleteExcluded bool          `config:"delete_excluded"`
 	RulesOpt                     // embedded so we don't change the JSON API
 	ExcludeFile    []string      `config:"exclude_if_present"`
+	IgnoreFile     []string      `config:"ignore_file_name"`
 	FilesFrom      []string      `config:"files_from"`
 	FilesFromRaw   []string      `config:"files_from_raw"`
 	MetaRules      RulesOpt      `config:"metadata"`
@@ -140,6 +151,7 @@ type Options struct {
 	MinSize        fs.SizeSuffix `config:"min_size"`
 	MaxSize        fs.SizeSuffix `config:"max_size"`
 	IgnoreCase     bool          `config:"ignore_case"`
+	FilterExpr     string        `config:"filter_expr"`
 }
 
 func init() {
@@ -167,12 +179,16 @@ type Filter struct {
 	metaRules   rules
 	files       FilesMap // files if filesFrom
 	dirs        FilesMap // dirs from filesFrom
+	ignores     *ignoreCache
+	expr        *filterExpr // compiled FilterExpr if set
 }
 
 // NewFilter parses the command line options and creates a Filter
 // object.  If opt is nil, then DefaultOpt will be used
 func NewFilter(opt *Options) (f *Filter, err error) {
-	f = &Filter{}
+	f = &Filter{
+		ignores: newIgnoreCache(),
+	}
 
 	// Make a copy of the options
 	if opt != nil {
@@ -204,6 +220,13 @@ func NewFilter(opt *Options) (f *Filter, err error) {
 		return nil, err
 	}
 
+	if f.Opt.FilterExpr != "" {
+		f.expr, err = newFilterExpr(f.Opt.FilterExpr, f.Opt.IgnoreCase)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	inActive := f.InActive()
 
 	for _, rule := range f.Opt.FilesFrom {
@@ -366,7 +389,9 @@ func (f *Filter) InActive() bool {
 		f.fileRules.len() == 0 &&
 		f.dirRules.len() == 0 &&
 		f.metaRules.len() == 0 &&
-		len(f.Opt.ExcludeFile) == 0)
+		len(f.Opt.ExcludeFile) == 0 &&
+		len(f.Opt.IgnoreFile) == 0 &&
+		f.expr == nil)
 }
 
 // IncludeRemote returns whether this remote passes the filter rules.
@@ -376,7 +401,15 @@ func (f *Filter) IncludeRemote(remote string) bool {
 		_, include := f.files[remote]
 		return include
 	}
-	return f.fileRules.include(remote)
+	if !f.fileRules.include(remote) {
+		return false
+	}
+	// Only exclude if the expression is false whatever the
+	// rest of the object is
+	if f.expr != nil && f.expr.eval(&exprItem{remote: remote, pathOnly: true}) == exprFalse {
+		return false
+	}
+	return true
 }
 
 // ListContainsExcludeFile checks if exclude file is present in the list.
@@ -418,8 +451,14 @@ func (f *Filter) IncludeDirectory(ctx context.Context, fs fs.Fs) func(string) (b
 			_, include := f.dirs[remote]
 			return include, nil
 		}
-		remote += "/"
-		return f.dirRules.include(remote), nil
+		if !f.dirRules.include(remote + "/") {
+			return false, nil
+		}
+		// Prune the directory only if nothing in it can match
+		if f.expr != nil && f.expr.eval(&exprItem{ctx: ctx, remote: remote, dir: true}) == exprFalse {
+			return false, nil
+		}
+		return true, nil
 	}
 }
 
@@ -444,6 +483,12 @@ func (f *Filter) DirContainsExcludeFile(ctx context.Context, fremote fs.Fs, remo
 // Include returns whether this object should be included into the
 // sync or not and logs the reason for exclusion if not included
 func (f *Filter) Include(remote string, size int64, modTime time.Time, metadata fs.Metadata) bool {
+	return f.include(context.Background(), remote, size, modTime, metadata, nil)
+}
+
+// include is Include with the object if known. The object is used by
+// --filter-expr to read the MIME type and hashes.
+func (f *Filter) include(ctx context.Context, remote string, size int64, modTime time.Time, metadata fs.Metadata, o fs.Object) bool {
 	// filesFrom takes precedence
 	if f.files != nil {
 		_, include := f.files[remote]
@@ -483,6 +528,20 @@ func (f *Filter) Include(remote string, size int64, modTime time.Time, metadata
 			return false
 		}
 	}
+	if f.expr != nil {
+		item := exprItem{
+			ctx:      ctx,
+			remote:   remote,
+			size:     size,
+			modTime:  modTime,
+			metadata: metadata,
+			o:        o,
+		}
+		if f.expr.eval(&item) == exprFalse {
+			fs.Debugf(remote, "Excluded (Filter Expression)")
+			return false
+		}
+	}
 	include := f.IncludeRemote(remote)
 	if !include {
 		fs.Debugf(remote, "Excluded (Path Filter)")
@@ -496,13 +555,13 @@ func (f *Filter) Include(remote string, size int64, modTime time.Time, metadata
 func (f *Filter) IncludeObject(ctx context.Context, o fs.Object) bool {
 	var modTime time.Time
 
-	if !f.ModTimeFrom.IsZero() || !f.ModTimeTo.IsZero() {
+	if !f.ModTimeFrom.IsZero() || !f.ModTimeTo.IsZero() || (f.expr != nil && f.expr.needModTime) {
 		modTime = o.ModTime(ctx)
 	} else {
 		modTime = time.Unix(0, 0)
 	}
 	var metadata fs.Metadata
-	if f.metaRules.len() > 0 {
+	if f.metaRules.len() > 0 || (f.expr != nil && f.expr.needMetadata) {
 		var err error
 		metadata, err = fs.GetMetadata(ctx, o)
 		if err != nil {
@@ -511,7 +570,7 @@ func (f *Filter) IncludeObject(ctx context.Context, o fs.Object) bool {
 		}
 
 	}
-	return f.Include(o.Remote(), o.Size(), modTime, metadata)
+	return f.include(ctx, o.Remote(), o.Size(), modTime, metadata, o)
 }
 
 // DumpFilters dumps the filters in textual form, 1 per line
@@ -537,6 +596,10 @@ func (f *Filter) DumpFilters() string {
 			rules = append(rules, metaRule.String())
 		}
 	}
+	if f.expr != nil {
+		rules = append(rules, "--- Filter expression ---")
+		rules = append(rules, f.expr.String())
+	}
 	return strings.Join(rules, "\n")
 }
 
@@ -0,0 +1,441 @@
+// Per directory ignore files in gitignore syntax
+
+package filter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Ignore files bigger than this are refused
+const maxIgnoreFileSize = 1024 * 1024
+
+// ignoreRule is a single rule from an ignore file
+type ignoreRule struct {
+	text    string         // the rule as written
+	re      *regexp.Regexp // matches paths relative to the directory of the ignore file
+	negate  bool           // set if the rule re-includes what it matches
+	dirOnly bool           // set if the rule only matches directories
+}
+
+// match returns true if the rule matches rel
+func (r *ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return r.re.MatchString(rel)
+}
+
+// ignoreFile is a parsed ignore file
+type ignoreFile struct {
+	remote string // path of the ignore file
+	dir    string // directory the rules are relative to
+	rules  []ignoreRule
+}
+
+// ignoreDir is the ignore files found in a directory
+type ignoreDir struct {
+	ready       chan struct{} // closed when the directory has been read
+	fingerprint string        // fingerprint of the ignore files read
+	files       []*ignoreFile // ignore files in the directory, if any
+	err         error         // error reading the ignore files
+}
+
+// ignoreCache caches the ignore files of each directory
+type ignoreCache struct {
+	mu   sync.Mutex
+	dirs map[string]*ignoreDir // keyed by Fs and directory
+}
+
+func newIgnoreCache() *ignoreCache {
+	return &ignoreCache{
+		dirs: make(map[string]*ignoreDir),
+	}
+}
+
+// IgnoreMatcher holds the rules from the ignore files which apply to a
+// directory, outermost first.
+//
+// A nil IgnoreMatcher ignores nothing.
+type IgnoreMatcher []*ignoreFile
+
+// Ignored returns whether remote, which must be in the directory the
+// IgnoreMatcher was made for, is ignored. isDir should be set if remote
+// is a directory.
+//
+// As with git, the last rule which matches wins, and the rules of
+// deeper ignore files are read after those of their parents.
+func (m IgnoreMatcher) Ignored(remote string, isDir bool) bool {
+	ignored := false
+	for _, file := range m {
+		rel := remote
+		if file.dir != "" {
+			var found bool
+			rel, found = strings.CutPrefix(remote, file.dir+"/")
+			if !found {
+				continue
+			}
+		}
+		for i := range file.rules {
+			rule := &file.rules[i]
+			if rule.match(rel, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// Filter removes the ignored entries, filtering in place
+func (m IgnoreMatcher) Filter(entries fs.DirEntries) fs.DirEntries {
+	if len(m) == 0 {
+		return entries
+	}
+	newEntries := entries[:0]
+	for _, entry := range entries {
+		_, isDir := entry.(fs.Directory)
+		if m.Ignored(entry.Remote(), isDir) {
+			fs.Debugf(entry, "Excluded (Ignore File)")
+			continue
+		}
+		newEntries = append(newEntries, entry)
+	}
+	return newEntries
+}
+
+// UsesIgnoreFiles returns true if ignore files are in use
+func (f *Filter) UsesIgnoreFiles() bool {
+	return len(f.Opt.IgnoreFile) > 0
+}
+
+// IgnoreMatcher returns the IgnoreMatcher for the directory dir on
+// fremote reading the ignore files in it and its parents as needed.
+//
+// If entries is not nil it should be the complete listing of dir,
+// which saves looking for the ignore files in it.
+//
+// If the context was set with SetIgnoreFs then the ignore files are
+// read from that Fs instead.
+func (f *Filter) IgnoreMatcher(ctx context.Context, fremote fs.Fs, dir string, entries fs.DirEntries) (m IgnoreMatcher, err error) {
+	if !f.UsesIgnoreFiles() {
+		return nil, nil
+	}
+	if ignoreFs := getIgnoreFs(ctx); ignoreFs != nil && ignoreFs != fremote {
+		fremote, entries = ignoreFs, nil
+	}
+	dir = strings.Trim(dir, "/")
+	// Read the parents first, outermost first
+	var dirs []string
+	for d := dir; ; d = parentDir(d) {
+		dirs = append(dirs, d)
+		if d == "" {
+			break
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		var dirEntries fs.DirEntries
+		if i == 0 {
+			dirEntries = entries
+		}
+		files, err := f.ignoreFiles(ctx, fremote, dirs[i], dirEntries)
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, files...)
+	}
+	return m, nil
+}
+
+// parentDir returns the parent directory of dir with "" for the root
+func parentDir(dir string) string {
+	parent := path.Dir(dir)
+	if parent == "." || parent == "/" {
+		return ""
+	}
+	return parent
+}
+
+// ignoreFiles returns the ignore files in dir on fremote, reading them
+// if they aren't cached or have changed.
+//
+// entries is the listing of dir if known or nil.
+func (f *Filter) ignoreFiles(ctx context.Context, fremote fs.Fs, dir string, entries fs.DirEntries) ([]*ignoreFile, error) {
+	var objects []fs.Object
+	fingerprint := ""
+	if entries != nil {
+		objects = f.findIgnoreFiles(entries)
+		fingerprint = ignoreFingerprint(ctx, objects)
+	}
+	key := fs.ConfigString(fremote) + "\x00" + dir
+	c := f.ignores
+	c.mu.Lock()
+	d, found := c.dirs[key]
+	if found && (entries == nil || d.fingerprint == fingerprint) {
+		c.mu.Unlock()
+		<-d.ready
+		return d.files, d.err
+	}
+	d = &ignoreDir{ready: make(chan struct{})}
+	c.dirs[key] = d
+	c.mu.Unlock()
+
+	if entries == nil {
+		for _, name := range f.Opt.IgnoreFile {
+			o, err := fremote.NewObject(ctx, path.Join(dir, name))
+			if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorIsDir) {
+				continue
+			} else if err != nil {
+				d.err = fmt.Errorf("failed to find ignore file: %w", err)
+				break
+			}
+			objects = append(objects, o)
+		}
+		fingerprint = ignoreFingerprint(ctx, objects)
+	}
+	d.fingerprint = fingerprint
+	for _, o := range objects {
+		if d.err != nil {
+			break
+		}
+		var file *ignoreFile
+		file, d.err = readIgnoreFile(ctx, o, dir, f.Opt.IgnoreCase)
+		d.files = append(d.files, file)
+	}
+	if d.err != nil {
+		d.files = nil
+		// Don't cache errors so the next listing tries again
+		c.mu.Lock()
+		if c.dirs[key] == d {
+			delete(c.dirs, key)
+		}
+		c.mu.Unlock()
+	}
+	close(d.ready)
+	return d.files, d.err
+}
+
+// findIgnoreFiles returns the ignore files in entries in the order of
+// --ignore-file-name
+func (f *Filter) findIgnoreFiles(entries fs.DirEntries) (objects []fs.Object) {
+	for _, name := range f.Opt.IgnoreFile {
+		for _, entry := range entries {
+			if o, ok := entry.(fs.Object); ok && path.Base(o.Remote()) == name {
+				objects = append(objects, o)
+				break
+			}
+		}
+	}
+	return objects
+}
+
+// ignoreFingerprint returns a fingerprint of the ignore files so
+// changes to them can be noticed
+func ignoreFingerprint(ctx context.Context, objects []fs.Object) string {
+	var out strings.Builder
+	for _, o := range objects {
+		out.WriteString(o.Remote())
+		out.WriteRune(',')
+		out.WriteString(fs.Fingerprint(ctx, o, true))
+		out.WriteRune('\n')
+	}
+	return out.String()
+}
+
+// readIgnoreFile reads and parses the ignore file o in dir
+func readIgnoreFile(ctx context.Context, o fs.Object, dir string, ignoreCase bool) (file *ignoreFile, err error) {
+	if o.Size() > maxIgnoreFileSize {
+		return nil, fmt.Errorf("ignore file %q is bigger than %d bytes", o.Remote(), maxIgnoreFileSize)
+	}
+	in, err := o.Open(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ignore file %q: %w", o.Remote(), err)
+	}
+	defer fs.CheckClose(in, &err)
+	file, err = parseIgnoreFile(io.LimitReader(in, maxIgnoreFileSize), dir, ignoreCase)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ignore file %q: %w", o.Remote(), err)
+	}
+	file.remote = o.Remote()
+	fs.Debugf(o, "Read %d rules from ignore file", len(file.rules))
+	return file, nil
+}
+
+// parseIgnoreFile parses the ignore file in for the directory dir
+func parseIgnoreFile(in io.Reader, dir string, ignoreCase bool) (*ignoreFile, error) {
+	file := &ignoreFile{dir: dir}
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		rule, ok, err := parseIgnoreRule(scanner.Text(), ignoreCase)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			file.rules = append(file.rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// parseIgnoreRule parses a line of an ignore file in gitignore syntax
+// returning false if the line has no rule in
+func parseIgnoreRule(line string, ignoreCase bool) (rule ignoreRule, ok bool, err error) {
+	line = strings.TrimSuffix(line, "\r")
+	rule.text = line
+	// Trailing spaces are ignored unless escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return rule, false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false, nil
+	}
+	// A pattern with a / in is relative to the directory of the
+	// ignore file, otherwise it matches at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	var re strings.Builder
+	if ignoreCase {
+		re.WriteString("(?i)")
+	}
+	re.WriteString("^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	if err = ignoreGlobToRegexp(&re, line); err != nil {
+		return rule, false, fmt.Errorf("bad ignore rule %q: %w", rule.text, err)
+	}
+	re.WriteString("$")
+	rule.re, err = regexp.Compile(re.String())
+	if err != nil {
+		return rule, false, fmt.Errorf("bad ignore rule %q: %w", rule.text, err)
+	}
+	return rule, true, nil
+}
+
+// ignoreGlobToRegexp converts a gitignore style glob into a regexp
+// written to re
+func ignoreGlobToRegexp(re *strings.Builder, glob string) error {
+	segments := strings.Split(glob, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if segment == "**" {
+			if last {
+				// "a/**" matches everything inside a
+				re.WriteString(".*")
+			} else {
+				// "**/b" and "a/**/b" match zero or more directories
+				re.WriteString("(?:.*/)?")
+			}
+			continue
+		}
+		if err := ignoreSegmentToRegexp(re, segment); err != nil {
+			return err
+		}
+		if !last {
+			re.WriteString("/")
+		}
+	}
+	return nil
+}
+
+// ignoreSegmentToRegexp converts a path segment of a glob, which
+// can't match /, into a regexp written to re
+func ignoreSegmentToRegexp(re *strings.Builder, segment string) error {
+	runes := []rune(segment)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch c {
+		case '\\':
+			i++
+			if i >= len(runes) {
+				return errors.New("trailing \\")
+			}
+			re.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '*':
+			// Consecutive stars which aren't a whole segment
+			// are the same as a single one
+			for i+1 < len(runes) && runes[i+1] == '*' {
+				i++
+			}
+			re.WriteString("[^/]*")
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			end := i + 1
+			if end < len(runes) && (runes[end] == '!' || runes[end] == '^') {
+				end++
+			}
+			if end < len(runes) && runes[end] == ']' {
+				end++
+			}
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end >= len(runes) {
+				return errors.New("unterminated [")
+			}
+			class := runes[i+1 : end]
+			re.WriteString("[")
+			if len(class) > 0 && (class[0] == '!' || class[0] == '^') {
+				re.WriteString("^/")
+				class = class[1:]
+			}
+			for _, r := range class {
+				if r == '\\' || r == '[' || r == ']' {
+					re.WriteRune('\\')
+				}
+				re.WriteRune(r)
+			}
+			re.WriteString("]")
+			i = end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return nil
+}
+
+// Context key for the Fs to read ignore files from
+type ignoreFsContextKeyType struct{}
+
+var ignoreFsContextKey = ignoreFsContextKeyType{}
+
+// SetIgnoreFs returns a context which makes IgnoreMatcher read the
+// ignore files from f rather than the Fs being listed.
+//
+// This is used when syncing so the destination is listed with the
+// ignore files of the source.
+func SetIgnoreFs(ctx context.Context, f fs.Fs) context.Context {
+	return context.WithValue(ctx, ignoreFsContextKey, f)
+}
+
+// getIgnoreFs returns the Fs set with SetIgnoreFs or nil
+func getIgnoreFs(ctx context.Context) fs.Fs {
+	if ctx == nil {
+		return nil
+	}
+	f, _ := ctx.Value(ignoreFsContextKey).(fs.Fs)
+	return f
+}
@@ -0,0 +1,137 @@
+package filter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockdir"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIgnoreRule(t *testing.T) {
+	for _, test := range []struct {
+		rule    string
+		ok      bool
+		re      string
+		negate  bool
+		dirOnly bool
+	}{
+		{rule: "", ok: false},
+		{rule: "# comment", ok: false},
+		{rule: "   ", ok: false},
+		{rule: "/", ok: false},
+		{rule: "*.log", ok: true, re: `^(?:.*/)?[^/]*\.log$`},
+		{rule: "*.log  ", ok: true, re: `^(?:.*/)?[^/]*\.log$`},
+		{rule: `a\ `, ok: true, re: `^(?:.*/)?a $`},
+		{rule: `\#hash`, ok: true, re: `^(?:.*/)?#hash$`},
+		{rule: `\!bang`, ok: true, re: `^(?:.*/)?!bang$`},
+		{rule: "!keep.log", ok: true, re: `^(?:.*/)?keep\.log$`, negate: true},
+		{rule: "build/", ok: true, re: `^(?:.*/)?build$`, dirOnly: true},
+		{rule: "/build", ok: true, re: `^build$`},
+		{rule: "doc/*.txt", ok: true, re: `^doc/[^/]*\.txt$`},
+		{rule: "**/foo", ok: true, re: `^(?:.*/)?foo$`},
+		{rule: "a/**/b", ok: true, re: `^a/(?:.*/)?b$`},
+		{rule: "a/**", ok: true, re: `^a/.*$`},
+		{rule: "a**b", ok: true, re: `^(?:.*/)?a[^/]*b$`},
+		{rule: "file?.[ch]", ok: true, re: `^(?:.*/)?file[^/]\.[ch]$`},
+		{rule: "[!a-c]x", ok: true, re: `^(?:.*/)?[^/a-c]x$`},
+	} {
+		rule, ok, err := parseIgnoreRule(test.rule, false)
+		require.NoError(t, err, test.rule)
+		assert.Equal(t, test.ok, ok, test.rule)
+		if !ok {
+			continue
+		}
+		assert.Equal(t, test.re, rule.re.String(), test.rule)
+		assert.Equal(t, test.negate, rule.negate, test.rule)
+		assert.Equal(t, test.dirOnly, rule.dirOnly, test.rule)
+	}
+
+	for _, bad := range []string{"[abc", `abc\`} {
+		_, _, err := parseIgnoreRule(bad, false)
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	parse := func(dir, rules string) *ignoreFile {
+		file, err := parseIgnoreFile(strings.NewReader(rules), dir, false)
+		require.NoError(t, err)
+		return file
+	}
+	m := IgnoreMatcher{
+		parse("", "*.log\nbuild/\n/top\n"),
+		parse("sub", "!keep.log\ndoc/*.txt\n"),
+	}
+	for _, test := range []struct {
+		remote  string
+		isDir   bool
+		ignored bool
+	}{
+		{"file.txt", false, false},
+		{"file.log", false, true},
+		{"sub/file.log", false, true},
+		{"sub/keep.log", false, false},
+		{"build", true, true},
+		{"build", false, false},
+		{"sub/build", true, true},
+		{"top", false, true},
+		{"sub/top", false, false},
+		{"sub/doc/a.txt", false, true},
+		{"sub/doc/deeper/a.txt", false, false},
+		{"doc/a.txt", false, false},
+	} {
+		assert.Equal(t, test.ignored, m.Ignored(test.remote, test.isDir), test.remote)
+	}
+	var none IgnoreMatcher
+	assert.False(t, none.Ignored("file.log", false))
+}
+
+func TestFilterIgnoreMatcher(t *testing.T) {
+	ctx := context.Background()
+	opt := Opt
+	opt.IgnoreFile = []string{".rcloneignore"}
+	f, err := NewFilter(&opt)
+	require.NoError(t, err)
+	assert.False(t, f.InActive())
+	assert.True(t, f.UsesIgnoreFiles())
+
+	mf, err := mockfs.NewFs(ctx, "mock", "/", nil)
+	require.NoError(t, err)
+	ignore := mockobject.New(".rcloneignore").WithContent([]byte("*.log\n!keep.log\n"), mockobject.SeekModeNone)
+	mf.(*mockfs.Fs).AddObject(ignore)
+
+	entries := fs.DirEntries{
+		ignore,
+		mockobject.Object("a.log"),
+		mockobject.Object("keep.log"),
+		mockobject.Object("file.txt"),
+		mockdir.New("dir.log"),
+	}
+
+	// Reading the ignore file from the listing
+	m, err := f.IgnoreMatcher(ctx, mf, "", entries)
+	require.NoError(t, err)
+	var remotes []string
+	for _, entry := range m.Filter(entries) {
+		remotes = append(remotes, entry.Remote())
+	}
+	assert.Equal(t, []string{".rcloneignore", "keep.log", "file.txt"}, remotes)
+
+	// Reading the ignore files of a subdirectory finds the parent's
+	m, err = f.IgnoreMatcher(ctx, mf, "dir", nil)
+	require.NoError(t, err)
+	assert.True(t, m.Ignored("dir/b.log", false))
+
+	// Without ignore files nothing is read
+	noIgnore, err := NewFilter(nil)
+	require.NoError(t, err)
+	m, err = noIgnore.IgnoreMatcher(ctx, mf, "", entries)
+	require.NoError(t, err)
+	assert.Nil(t, m)
+}
@@ -15,6 +15,8 @@ import (
 	"strings"
 
 	"github.com/jzelinskie/whirlpool"
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
 )
 
 // Type indicates a standard hashing algorithm
@@ -87,6 +89,15 @@ var (
 
 	// SHA256 indicates SHA-256 support
 	SHA256 Type
+
+	// BLAKE3 indicates BLAKE3 support
+	BLAKE3 Type
+
+	// XXH3 indicates XXH3 64 bit support
+	XXH3 Type
+
+	// XXH128 indicates XXH3 128 bit support
+	XXH128 Type
 )
 
 func init() {
@@ -95,6 +106,23 @@ func init() {
 	Whirlpool = RegisterHash("whirlpool", "Whirlpool", 128, whirlpool.New)
 	CRC32 = RegisterHash("crc32", "CRC-32", 8, func() hash.Hash { return crc32.NewIEEE() })
 	SHA256 = RegisterHash("sha256", "SHA-256", 64, sha256.New)
+	BLAKE3 = RegisterHash("blake3", "BLAKE3", 64, func() hash.Hash { return blake3.New() })
+	XXH3 = RegisterHash("xxh3", "XXH3", 16, func() hash.Hash { return xxh3.New() })
+	XXH128 = RegisterHash("xxh128", "XXH128", 32, func() hash.Hash { return &xxh128{xxh3.New()} })
+}
+
+// xxh128 is a hash.Hash returning the 128 bit XXH3 sum
+type xxh128 struct {
+	*xxh3.Hasher
+}
+
+// Size returns the number of bytes Sum will return
+func (h *xxh128) Size() int { return 16 }
+
+// Sum appends the 128 bit sum in big endian order to b
+func (h *xxh128) Sum(b []byte) []byte {
+	sum := h.Sum128().Bytes()
+	return append(b, sum[:]...)
 }
 
 // Supported returns a set of all the supported hashes by
@@ -33,11 +33,38 @@ func DirSorted(ctx context.Context, f fs.Fs, includeAll bool, dir string) (entri
 		fs.Debugf(dir, "Excluded")
 		return nil, nil
 	}
+	if !includeAll && fi.UsesIgnoreFiles() {
+		ignore, err := fi.IgnoreMatcher(ctx, f, dir, entries)
+		if err != nil {
+			return nil, err
+		}
+		entries = ignore.Filter(entries)
+	}
 	return filterAndSortDir(ctx, entries, includeAll, dir, fi.IncludeObject, fi.IncludeDirectory(ctx, f))
 }
 
 // filter (if required) and check the entries, then sort them
 func filterAndSortDir(ctx context.Context, entries fs.DirEntries, includeAll bool, dir string,
+	IncludeObject func(ctx context.Context, o fs.Object) bool,
+	IncludeDirectory func(remote string) (bool, error)) (newEntries fs.DirEntries, err error) {
+	entries, err = filterDir(ctx, entries, includeAll, dir, IncludeObject, IncludeDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort the directory entries by Remote
+	//
+	// We use a stable sort here just in case there are
+	// duplicates. Assuming the remote delivers the entries in a
+	// consistent order, this will give the best user experience
+	// in syncing as it will use the first entry for the sync
+	// comparison.
+	sort.Stable(entries)
+	return entries, nil
+}
+
+// filter (if required) and check the entries in place
+func filterDir(ctx context.Context, entries fs.DirEntries, includeAll bool, dir string,
 	IncludeObject func(ctx context.Context, o fs.Object) bool,
 	IncludeDirectory func(remote string) (bool, error)) (newEntries fs.DirEntries, err error) {
 	newEntries = entries[:0] // in place filter
@@ -90,15 +117,5 @@ func filterAndSortDir(ctx context.Context, entries fs.DirEntries, includeAll boo
 			newEntries = append(newEntries, entry)
 		}
 	}
-	entries = newEntries
-
-	// Sort the directory entries by Remote
-	//
-	// We use a stable sort here just in case there are
-	// duplicates. Assuming the remote delivers the entries in a
-	// consistent order, this will give the best user experience
-	// in syncing as it will use the first entry for the sync
-	// comparison.
-	sort.Stable(entries)
-	return entries, nil
+	return newEntries, nil
 }
@@ -0,0 +1,400 @@
+package list
+
+import (
+	"bufio"
+	"container/heap"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"golang.org/x/sync/errgroup"
+)
+
+// KeyFn turns an entry into a sort key
+type KeyFn func(entry fs.DirEntry) string
+
+// How many entries Sorter.Send sends in each tranche once the
+// listing has been sorted on disk
+const sorterBatch = 1000
+
+// Sorter sorts the entries of a directory by the key returned by a
+// KeyFn, keeping the order of entries with the same key.
+//
+// Up to --list-cutoff objects are kept in memory. Beyond that the
+// objects are sorted into runs which are written to disk and merged
+// when they are read back with Send. Only the remote of each object is
+// written so the objects are found again with NewObject. This is
+// slower but it means directories with millions of objects can be
+// sorted in a fixed amount of memory.
+//
+// Directories are always kept in memory.
+type Sorter struct {
+	ctx     context.Context
+	f       fs.Fs
+	keyFn   KeyFn
+	cutoff  int
+	objects []keyedEntry // objects not written to disk yet
+	dirs    []keyedEntry // directories
+	tmpDir  string       // directory the runs are written to
+	runs    []string     // sorted runs of objects on disk
+}
+
+// an entry with its sort key
+type keyedEntry struct {
+	key   string
+	entry fs.DirEntry
+}
+
+// sortRecord is how an object is stored in a run on disk
+type sortRecord struct {
+	Key    string
+	Remote string
+}
+
+// NewSorter makes a Sorter for the entries of f sorting them with keyFn.
+//
+// CleanUp should be called when the Sorter is finished with.
+func NewSorter(ctx context.Context, f fs.Fs, keyFn KeyFn) *Sorter {
+	return &Sorter{
+		ctx:    ctx,
+		f:      f,
+		keyFn:  keyFn,
+		cutoff: fs.GetConfig(ctx).ListCutoff,
+	}
+}
+
+// sortKeyed sorts the entries by key keeping the order of equal keys
+func sortKeyed(entries []keyedEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+}
+
+// Add entries to the Sorter, writing the objects to disk if there
+// are more than --list-cutoff of them.
+func (ls *Sorter) Add(entries fs.DirEntries) error {
+	for _, entry := range entries {
+		ke := keyedEntry{key: ls.keyFn(entry), entry: entry}
+		if _, isDir := entry.(fs.Directory); isDir {
+			ls.dirs = append(ls.dirs, ke)
+			continue
+		}
+		ls.objects = append(ls.objects, ke)
+		if ls.cutoff > 0 && len(ls.objects) >= ls.cutoff {
+			if err := ls.spill(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// spill sorts the objects in memory and writes them to disk as a run
+func (ls *Sorter) spill() (err error) {
+	if ls.tmpDir == "" {
+		ls.tmpDir, err = os.MkdirTemp("", "rclone-list-")
+		if err != nil {
+			return fmt.Errorf("failed to make directory to sort listing: %w", err)
+		}
+		fs.Debugf(ls.f, "More than %d objects in directory - sorting listing on disk", ls.cutoff)
+	}
+	sortKeyed(ls.objects)
+	name := filepath.Join(ls.tmpDir, fmt.Sprintf("run%d", len(ls.runs)))
+	file, err := os.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create sorted listing: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	enc := gob.NewEncoder(w)
+	for _, ke := range ls.objects {
+		err = enc.Encode(sortRecord{Key: ke.key, Remote: ke.entry.Remote()})
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write sorted listing: %w", err)
+	}
+	ls.runs = append(ls.runs, name)
+	clear(ls.objects)
+	ls.objects = ls.objects[:0]
+	return nil
+}
+
+// Spilled returns true if the listing was too big to keep in memory.
+func (ls *Sorter) Spilled() bool {
+	return len(ls.runs) > 0
+}
+
+// Entries returns all the entries sorted.
+//
+// This may only be called if Spilled returns false.
+func (ls *Sorter) Entries() fs.DirEntries {
+	if ls.Spilled() {
+		panic("list.Sorter: Entries called after spilling to disk")
+	}
+	all := make([]keyedEntry, 0, len(ls.objects)+len(ls.dirs))
+	all = append(all, ls.objects...)
+	all = append(all, ls.dirs...)
+	sortKeyed(all)
+	entries := make(fs.DirEntries, len(all))
+	for i, ke := range all {
+		entries[i] = ke.entry
+	}
+	return entries
+}
+
+// mergeSource is a sorted run of entries being merged
+type mergeSource struct {
+	index   int          // index of the run so equal keys keep their order
+	key     string       // key of the current entry
+	remote  string       // remote of the current entry
+	entry   fs.DirEntry  // current entry or nil if it must be found with NewObject
+	dec     *gob.Decoder // decoder for runs on disk
+	entries []keyedEntry // entries still to come for runs in memory
+}
+
+// next reads the next entry from the run returning false if there
+// are no more
+func (ms *mergeSource) next() (bool, error) {
+	if ms.dec == nil {
+		if len(ms.entries) == 0 {
+			return false, nil
+		}
+		ms.key, ms.entry = ms.entries[0].key, ms.entries[0].entry
+		ms.remote = ms.entry.Remote()
+		ms.entries = ms.entries[1:]
+		return true, nil
+	}
+	var record sortRecord
+	err := ms.dec.Decode(&record)
+	if errors.Is(err, io.EOF) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to read sorted listing: %w", err)
+	}
+	ms.key, ms.remote = record.Key, record.Remote
+	return true, nil
+}
+
+// mergeHeap is a heap of sources ordered by their current entry
+type mergeHeap []*mergeSource
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key < h[j].key
+	}
+	return h[i].index < h[j].index
+}
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x any)   { *h = append(*h, x.(*mergeSource)) }
+func (h *mergeHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// Send calls callback with tranches of the entries in sorted order.
+//
+// If the listing was sorted on disk the objects are found again with
+// NewObject. Any which have been deleted since they were listed are
+// left out.
+func (ls *Sorter) Send(callback fs.ListRCallback) (err error) {
+	if !ls.Spilled() {
+		entries := ls.Entries()
+		if len(entries) == 0 {
+			return nil
+		}
+		return callback(entries)
+	}
+	sortKeyed(ls.objects)
+	sortKeyed(ls.dirs)
+	h := make(mergeHeap, 0, len(ls.runs)+2)
+	add := func(ms *mergeSource) error {
+		ok, err := ms.next()
+		if ok {
+			h = append(h, ms)
+		}
+		return err
+	}
+	for i, name := range ls.runs {
+		file, openErr := os.Open(name)
+		if openErr != nil {
+			return fmt.Errorf("failed to open sorted listing: %w", openErr)
+		}
+		defer fs.CheckClose(file, &err)
+		if err = add(&mergeSource{index: i, dec: gob.NewDecoder(bufio.NewReader(file))}); err != nil {
+			return err
+		}
+	}
+	// The runs in memory come after the ones on disk as they were added last
+	_ = add(&mergeSource{index: len(ls.runs), entries: ls.objects})
+	_ = add(&mergeSource{index: len(ls.runs) + 1, entries: ls.dirs})
+	heap.Init(&h)
+
+	batch := make([]*mergeSource, 0, sorterBatch)
+	for h.Len() > 0 {
+		ms := h[0]
+		item := *ms
+		batch = append(batch, &item)
+		ok, err := ms.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+		if len(batch) >= sorterBatch {
+			if err = ls.sendBatch(batch, callback); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	return ls.sendBatch(batch, callback)
+}
+
+// sendBatch finds the objects in batch which were written to disk and
+// sends the entries to callback
+func (ls *Sorter) sendBatch(batch []*mergeSource, callback fs.ListRCallback) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	ci := fs.GetConfig(ls.ctx)
+	entries := make(fs.DirEntries, len(batch))
+	g, gCtx := errgroup.WithContext(ls.ctx)
+	g.SetLimit(ci.Checkers)
+	for i, item := range batch {
+		if item.entry != nil {
+			entries[i] = item.entry
+			continue
+		}
+		i, remote := i, item.remote
+		g.Go(func() error {
+			o, err := ls.f.NewObject(gCtx, remote)
+			if errors.Is(err, fs.ErrorObjectNotFound) {
+				fs.Debugf(remote, "Object not found since it was listed - ignoring")
+				return nil
+			} else if err != nil {
+				return err
+			}
+			entries[i] = o
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	newEntries := entries[:0]
+	for _, entry := range entries {
+		if entry != nil {
+			newEntries = append(newEntries, entry)
+		}
+	}
+	return callback(newEntries)
+}
+
+// CleanUp removes anything the Sorter wrote to disk
+func (ls *Sorter) CleanUp() {
+	if ls.tmpDir == "" {
+		return
+	}
+	err := os.RemoveAll(ls.tmpDir)
+	if err != nil {
+		fs.Errorf(ls.f, "Failed to remove sorted listing: %v", err)
+	}
+	ls.tmpDir = ""
+	ls.runs = nil
+}
+
+// errExcluded stops the listing of a directory with the exclude file in
+var errExcluded = errors.New("directory excluded")
+
+// DirSorter reads Object and *Dir into a Sorter for the given Fs.
+//
+// dir is the start directory, "" for root
+//
+// If includeAll is specified all files will be added, otherwise only
+// files and directories passing the filter will be added.
+//
+// This is like DirSorted but the listing is read in tranches with
+// ListP if the backend supports it and is sorted on disk if it is too
+// big to keep in memory. CleanUp should be called on the Sorter
+// returned when it is finished with.
+func DirSorter(ctx context.Context, f fs.Fs, includeAll bool, dir string, keyFn KeyFn) (ls *Sorter, err error) {
+	fi := filter.GetConfig(ctx)
+	includeDirectory := fi.IncludeDirectory(ctx, f)
+	needIgnore := !includeAll && fi.UsesIgnoreFiles()
+	var ignore filter.IgnoreMatcher
+	if needIgnore && f.Features().ListP != nil {
+		// The ignore files may not be in the first tranche so
+		// look for them first
+		ignore, err = fi.IgnoreMatcher(ctx, f, dir, nil)
+		if err != nil {
+			return nil, err
+		}
+		needIgnore = false
+	}
+	ls = NewSorter(ctx, f, keyFn)
+	err = listP(ctx, f, dir, func(entries fs.DirEntries) error {
+		if !includeAll && fi.ListContainsExcludeFile(entries) {
+			return errExcluded
+		}
+		if needIgnore {
+			// Without ListP this is the whole listing
+			var err error
+			ignore, err = fi.IgnoreMatcher(ctx, f, dir, entries)
+			if err != nil {
+				return err
+			}
+			needIgnore = false
+		}
+		entries = ignore.Filter(entries)
+		entries, err := filterDir(ctx, entries, includeAll, dir, fi.IncludeObject, includeDirectory)
+		if err != nil {
+			return err
+		}
+		return ls.Add(entries)
+	})
+	if err != nil {
+		ls.CleanUp()
+		if errors.Is(err, errExcluded) {
+			fs.Debugf(dir, "Excluded")
+			return NewSorter(ctx, f, keyFn), nil
+		}
+		return nil, err
+	}
+	return ls, nil
+}
+
+// listP lists dir on f in tranches with ListP if supported, otherwise
+// with List in one go
+func listP(ctx context.Context, f fs.Fs, dir string, callback fs.ListRCallback) error {
+	if doListP := f.Features().ListP; doListP != nil {
+		return doListP(ctx, dir, callback)
+	}
+	entries, err := f.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+	return callback(entries)
+}
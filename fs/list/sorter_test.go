@@ -0,0 +1,95 @@
+package list
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockdir"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/rclone/rclone/fstest/mockobject"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sort by Remote with the directories last
+func testKey(entry fs.DirEntry) string {
+	if _, isDir := entry.(fs.Directory); isDir {
+		return "1" + entry.Remote()
+	}
+	return "0" + entry.Remote()
+}
+
+// collect the remotes sent by ls
+func sendRemotes(t *testing.T, ls *Sorter) (remotes []string) {
+	require.NoError(t, ls.Send(func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			remotes = append(remotes, entry.Remote())
+		}
+		return nil
+	}))
+	return remotes
+}
+
+func TestSorterInMemory(t *testing.T) {
+	ctx := context.Background()
+	f, err := mockfs.NewFs(ctx, "mock", "/", nil)
+	require.NoError(t, err)
+	ls := NewSorter(ctx, f, testKey)
+	defer ls.CleanUp()
+	require.NoError(t, ls.Add(fs.DirEntries{mockobject.Object("c"), mockdir.New("a")}))
+	require.NoError(t, ls.Add(fs.DirEntries{mockobject.Object("b")}))
+	assert.False(t, ls.Spilled())
+	assert.Equal(t, []string{"b", "c", "a"}, sendRemotes(t, ls))
+}
+
+func TestSorterSpill(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.ListCutoff = 2
+	f, err := mockfs.NewFs(ctx, "mock", "/", nil)
+	require.NoError(t, err)
+	var objects fs.DirEntries
+	for _, remote := range []string{"e", "b", "d", "a", "c"} {
+		o := mockobject.Object(remote)
+		f.(*mockfs.Fs).AddObject(o)
+		objects = append(objects, o)
+	}
+	// An object which has been deleted since it was listed
+	objects = append(objects, mockobject.Object("gone"))
+
+	ls := NewSorter(ctx, f, testKey)
+	require.NoError(t, ls.Add(objects[:3]))
+	require.NoError(t, ls.Add(fs.DirEntries{mockdir.New("dir")}))
+	require.NoError(t, ls.Add(objects[3:]))
+	assert.True(t, ls.Spilled())
+	assert.Panics(t, func() { ls.Entries() })
+	tmpDir := ls.tmpDir
+	assert.DirExists(t, tmpDir)
+
+	assert.Equal(t, []string{"a", "b", "c", "d", "e", "dir"}, sendRemotes(t, ls))
+
+	ls.CleanUp()
+	_, err = os.Stat(tmpDir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDirSorter(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.ListCutoff = 1
+	f, err := mockfs.NewFs(ctx, "mock", "/", nil)
+	require.NoError(t, err)
+	for _, remote := range []string{"c", "a", "b"} {
+		f.(*mockfs.Fs).AddObject(mockobject.Object(remote))
+	}
+	ls, err := DirSorter(ctx, f, true, "", testKey)
+	require.NoError(t, err)
+	defer ls.CleanUp()
+	assert.True(t, ls.Spilled())
+	assert.Equal(t, []string{"a", "b", "c"}, sendRemotes(t, ls))
+
+	_, err = DirSorter(ctx, f, true, "missing", testKey)
+	assert.ErrorIs(t, err, fs.ErrorDirNotFound)
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/list"
 	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
 	"golang.org/x/text/unicode/norm"
 )
 
@@ -34,6 +35,8 @@ type March struct {
 	// internal state
 	srcListDir listDirFn // function to call to list a directory in the src
 	dstListDir listDirFn // function to call to list a directory in the dst
+	srcSorted  sortedFn  // function to call to list a directory in the src into a Sorter
+	dstSorted  sortedFn  // function to call to list a directory in the dst into a Sorter
 	transforms []matchTransformFn
 	limiter    chan struct{} // make sure we don't do too many operations at once
 }
@@ -52,9 +55,9 @@ type Marcher interface {
 // Note: this will flag filter-aware backends on the source side
 func (m *March) init(ctx context.Context) {
 	ci := fs.GetConfig(ctx)
-	m.srcListDir = m.makeListDir(ctx, m.Fsrc, m.SrcIncludeAll)
+	m.srcListDir, m.srcSorted = m.makeListDir(ctx, m.Fsrc, m.SrcIncludeAll)
 	if !m.NoTraverse {
-		m.dstListDir = m.makeListDir(ctx, m.Fdst, m.DstIncludeAll)
+		m.dstListDir, m.dstSorted = m.makeListDir(ctx, m.Fdst, m.DstIncludeAll)
 	}
 	// Now create the matching transform
 	// ..normalise the UTF8 first
@@ -77,17 +80,29 @@ func (m *March) init(ctx context.Context) {
 // list a directory into entries, err
 type listDirFn func(dir string) (entries fs.DirEntries, err error)
 
+// list a directory into a Sorter, err
+type sortedFn func(dir string) (ls *list.Sorter, err error)
+
 // makeListDir makes constructs a listing function for the given fs
 // and includeAll flags for marching through the file system.
+//
+// Only one of the functions returned is set. Directories are listed
+// into a Sorter unless --fast-list is in use so that directories too
+// big to keep in memory can be sorted on disk.
+//
 // Note: this will optionally flag filter-aware backends!
-func (m *March) makeListDir(ctx context.Context, f fs.Fs, includeAll bool) listDirFn {
+func (m *March) makeListDir(ctx context.Context, f fs.Fs, includeAll bool) (listDirFn, sortedFn) {
 	ci := fs.GetConfig(ctx)
 	fi := filter.GetConfig(ctx)
-	if !(ci.UseListR && f.Features().ListR != nil) && // !--fast-list active and
+	listCtx := m.Ctx
+	if f != m.Fsrc && fi.UsesIgnoreFiles() {
+		listCtx = filter.SetIgnoreFs(listCtx, m.Fsrc) // use the ignore files of the source
+	}
+	if !(ci.UseListR && f.Features().ListR != nil && !fi.UsesIgnoreFiles()) && // !--fast-list active and
 		!(ci.NoTraverse && fi.HaveFilesFrom()) { // !(--files-from and --no-traverse)
-		return func(dir string) (entries fs.DirEntries, err error) {
-			dirCtx := filter.SetUseFilter(m.Ctx, f.Features().FilterAware && !includeAll) // make filter-aware backends constrain List
-			return list.DirSorted(dirCtx, f, includeAll, dir)
+		return nil, func(dir string) (ls *list.Sorter, err error) {
+			dirCtx := filter.SetUseFilter(listCtx, f.Features().FilterAware && !includeAll) // make filter-aware backends constrain List
+			return list.DirSorter(dirCtx, f, includeAll, dir, m.sortKey)
 		}
 	}
 
@@ -103,7 +118,7 @@ func (m *March) makeListDir(ctx context.Context, f fs.Fs, includeAll bool) listD
 		mu.Lock()
 		defer mu.Unlock()
 		if !started {
-			dirCtx := filter.SetUseFilter(m.Ctx, f.Features().FilterAware && !includeAll) // make filter-aware backends constrain List
+			dirCtx := filter.SetUseFilter(listCtx, f.Features().FilterAware && !includeAll) // make filter-aware backends constrain List
 			dirs, dirsErr = walk.NewDirTree(dirCtx, f, m.Dir, includeAll, ci.MaxDepth)
 			started = true
 		}
@@ -117,7 +132,17 @@ func (m *March) makeListDir(ctx context.Context, f fs.Fs, includeAll bool) listD
 			delete(dirs, dir)
 		}
 		return entries, err
-	}
+	}, nil
+}
+
+// sortKey returns a key which sorts entry in the same order as
+// matchEntries.
+//
+// The parts are separated with \x00 which sorts before any other
+// character so shorter names come first as they do in matchEntries.
+func (m *March) sortKey(entry fs.DirEntry) string {
+	me := newMatchEntry(entry, m.transforms)
+	return me.name + "\x00" + me.leaf + "\x00" + entry.Remote() + "\x00" + fs.DirEntryType(entry)
 }
 
 // listDirJob describe a directory listing that needs to be done
@@ -274,17 +299,25 @@ func (es matchEntries) sort() {
 	sort.Stable(es)
 }
 
+// make a matchEntry from an entry
+func newMatchEntry(entry fs.DirEntry, transforms []matchTransformFn) matchEntry {
+	name := path.Base(entry.Remote())
+	me := matchEntry{
+		entry: entry,
+		leaf:  name,
+	}
+	for _, transform := range transforms {
+		name = transform(name)
+	}
+	me.name = name
+	return me
+}
+
 // make a matchEntries from a newMatch entries
 func newMatchEntries(entries fs.DirEntries, transforms []matchTransformFn) matchEntries {
 	es := make(matchEntries, len(entries))
 	for i := range es {
-		es[i].entry = entries[i]
-		name := path.Base(entries[i].Remote())
-		es[i].leaf = name
-		for _, transform := range transforms {
-			name = transform(name)
-		}
-		es[i].name = name
+		es[i] = newMatchEntry(entries[i], transforms)
 	}
 	es.sort()
 	return es
@@ -299,6 +332,21 @@ type matchPair struct {
 // comparison in matchListings.
 type matchTransformFn func(name string) string
 
+// matchStream returns the next matchEntry of a listing sorted as
+// matchEntries are, or false if there are no more
+type matchStream func() (me matchEntry, ok bool)
+
+// sliceStream returns a matchStream reading es
+func sliceStream(es matchEntries) matchStream {
+	return func() (me matchEntry, ok bool) {
+		if len(es) == 0 {
+			return me, false
+		}
+		me, es = es[0], es[1:]
+		return me, true
+	}
+}
+
 // Process the two listings, matching up the items in the two slices
 // using the transform function on each name first.
 //
@@ -308,73 +356,108 @@ type matchTransformFn func(name string) string
 //
 // This checks for duplicates and checks the list is sorted.
 func matchListings(srcListEntries, dstListEntries fs.DirEntries, transforms []matchTransformFn) (srcOnly fs.DirEntries, dstOnly fs.DirEntries, matches []matchPair) {
-	srcList := newMatchEntries(srcListEntries, transforms)
-	dstList := newMatchEntries(dstListEntries, transforms)
-
-	for iSrc, iDst := 0, 0; ; iSrc, iDst = iSrc+1, iDst+1 {
-		var src, dst fs.DirEntry
-		var srcName, dstName string
-		if iSrc < len(srcList) {
-			src = srcList[iSrc].entry
-			srcName = srcList[iSrc].name
-		}
-		if iDst < len(dstList) {
-			dst = dstList[iDst].entry
-			dstName = dstList[iDst].name
-		}
-		if src == nil && dst == nil {
-			break
-		}
-		if src != nil && iSrc > 0 {
-			prev := srcList[iSrc-1].entry
-			prevName := srcList[iSrc-1].name
-			if srcName == prevName && fs.DirEntryType(prev) == fs.DirEntryType(src) {
-				fs.Logf(src, "Duplicate %s found in source - ignoring", fs.DirEntryType(src))
-				iDst-- // ignore the src and retry the dst
+	matchStreams(
+		sliceStream(newMatchEntries(srcListEntries, transforms)),
+		sliceStream(newMatchEntries(dstListEntries, transforms)),
+		func(src fs.DirEntry) {
+			srcOnly = append(srcOnly, src)
+		},
+		func(dst fs.DirEntry) {
+			dstOnly = append(dstOnly, dst)
+		},
+		func(src, dst fs.DirEntry) {
+			matches = append(matches, matchPair{src: src, dst: dst})
+		},
+	)
+	return
+}
+
+// Process the two sorted streams, matching up the items in them and
+// calling srcOnly, dstOnly or match for each one as it goes.
+//
+// This checks for duplicates and checks the streams are sorted.
+func matchStreams(srcNext, dstNext matchStream, srcOnly, dstOnly func(fs.DirEntry), match func(src, dst fs.DirEntry)) {
+	var (
+		src, srcPrev             matchEntry
+		dst, dstPrev             matchEntry
+		srcOK, dstOK             bool
+		srcHavePrev, dstHavePrev bool
+	)
+	src, srcOK = srcNext()
+	dst, dstOK = dstNext()
+	nextSrc := func() {
+		srcPrev, srcHavePrev = src, true
+		src, srcOK = srcNext()
+	}
+	nextDst := func() {
+		dstPrev, dstHavePrev = dst, true
+		dst, dstOK = dstNext()
+	}
+	for srcOK || dstOK {
+		if srcOK && srcHavePrev {
+			if src.name == srcPrev.name && fs.DirEntryType(srcPrev.entry) == fs.DirEntryType(src.entry) {
+				fs.Logf(src.entry, "Duplicate %s found in source - ignoring", fs.DirEntryType(src.entry))
+				nextSrc() // ignore the src and retry the dst
 				continue
-			} else if srcName < prevName {
+			} else if src.name < srcPrev.name {
 				// this should never happen since we sort the listings
 				panic("Out of order listing in source")
 			}
 		}
-		if dst != nil && iDst > 0 {
-			prev := dstList[iDst-1].entry
-			prevName := dstList[iDst-1].name
-			if dstName == prevName && fs.DirEntryType(dst) == fs.DirEntryType(prev) {
-				fs.Logf(dst, "Duplicate %s found in destination - ignoring", fs.DirEntryType(dst))
-				iSrc-- // ignore the dst and retry the src
+		if dstOK && dstHavePrev {
+			if dst.name == dstPrev.name && fs.DirEntryType(dst.entry) == fs.DirEntryType(dstPrev.entry) {
+				fs.Logf(dst.entry, "Duplicate %s found in destination - ignoring", fs.DirEntryType(dst.entry))
+				nextDst() // ignore the dst and retry the src
 				continue
-			} else if dstName < prevName {
+			} else if dst.name < dstPrev.name {
 				// this should never happen since we sort the listings
 				panic("Out of order listing in destination")
 			}
 		}
-		if src != nil && dst != nil {
-			// we can't use CompareDirEntries because srcName, dstName could
-			// be different then src.Remote() or dst.Remote()
-			srcType := fs.DirEntryType(src)
-			dstType := fs.DirEntryType(dst)
-			if srcName > dstName || (srcName == dstName && srcType > dstType) {
-				src = nil
-				iSrc--
-			} else if srcName < dstName || (srcName == dstName && srcType < dstType) {
-				dst = nil
-				iDst--
-			}
-		}
-		// Debugf(nil, "src = %v, dst = %v", src, dst)
 		switch {
-		case src == nil && dst == nil:
-			// do nothing
-		case src == nil:
-			dstOnly = append(dstOnly, dst)
-		case dst == nil:
-			srcOnly = append(srcOnly, src)
+		case !srcOK:
+			dstOnly(dst.entry)
+			nextDst()
+		case !dstOK:
+			srcOnly(src.entry)
+			nextSrc()
 		default:
-			matches = append(matches, matchPair{src: src, dst: dst})
+			// we can't use CompareDirEntries because src.name, dst.name could
+			// be different then src.Remote() or dst.Remote()
+			srcType := fs.DirEntryType(src.entry)
+			dstType := fs.DirEntryType(dst.entry)
+			if src.name > dst.name || (src.name == dst.name && srcType > dstType) {
+				dstOnly(dst.entry)
+				nextDst()
+			} else if src.name < dst.name || (src.name == dst.name && srcType < dstType) {
+				srcOnly(src.entry)
+				nextSrc()
+			} else {
+				match(src.entry, dst.entry)
+				nextSrc()
+				nextDst()
+			}
 		}
 	}
-	return
+}
+
+// listDir lists dir with whichever of listDir and sorted is set.
+//
+// If the listing was too big to keep in memory the Sorter is returned
+// instead of the entries.
+func listDir(listDir listDirFn, sorted sortedFn, dir string) (fs.DirEntries, *list.Sorter, error) {
+	if sorted == nil {
+		entries, err := listDir(dir)
+		return entries, nil, err
+	}
+	ls, err := sorted(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ls.Spilled() {
+		return nil, ls, nil
+	}
+	return ls.Entries(), nil, nil
 }
 
 // processJob processes a listDirJob listing the source and
@@ -386,6 +469,7 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 	var (
 		jobs                   []listDirJob
 		srcList, dstList       fs.DirEntries
+		srcSorter, dstSorter   *list.Sorter
 		srcListErr, dstListErr error
 		wg                     sync.WaitGroup
 		mu                     sync.Mutex
@@ -396,19 +480,27 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			srcList, srcListErr = m.srcListDir(job.srcRemote)
+			srcList, srcSorter, srcListErr = listDir(m.srcListDir, m.srcSorted, job.srcRemote)
 		}()
 	}
 	if !m.NoTraverse && !job.noDst {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			dstList, dstListErr = m.dstListDir(job.dstRemote)
+			dstList, dstSorter, dstListErr = listDir(m.dstListDir, m.dstSorted, job.dstRemote)
 		}()
 	}
 
 	// Wait for listings to complete and report errors
 	wg.Wait()
+	defer func() {
+		if srcSorter != nil {
+			srcSorter.CleanUp()
+		}
+		if dstSorter != nil {
+			dstSorter.CleanUp()
+		}
+	}()
 	if srcListErr != nil {
 		if job.srcRemote != "" {
 			fs.Errorf(job.srcRemote, "error reading source directory: %v", srcListErr)
@@ -430,6 +522,12 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 		return nil, dstListErr
 	}
 
+	// If either listing was too big for memory, match them as they
+	// are read back from disk
+	if srcSorter != nil || dstSorter != nil {
+		return m.processSorted(job, srcList, srcSorter, dstList, dstSorter)
+	}
+
 	// If NoTraverse is set, then try to find a matching object
 	// for each item in the srcList to head dst object
 	if m.NoTraverse && !m.NoCheckDest {
@@ -438,14 +536,10 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 			m.limiter <- struct{}{}
 			go func(src fs.DirEntry) {
 				defer wg.Done()
-				if srcObj, ok := src.(fs.Object); ok {
-					leaf := path.Base(srcObj.Remote())
-					dstObj, err := m.Fdst.NewObject(m.Ctx, path.Join(job.dstRemote, leaf))
-					if err == nil {
-						mu.Lock()
-						dstList = append(dstList, dstObj)
-						mu.Unlock()
-					}
+				if dstObj := m.findDst(job, src); dstObj != nil {
+					mu.Lock()
+					dstList = append(dstList, dstObj)
+					mu.Unlock()
 				}
 				<-m.limiter
 			}(src)
@@ -459,44 +553,177 @@ func (m *March) processJob(job listDirJob) ([]listDirJob, error) {
 		if m.aborting() {
 			return nil, m.Ctx.Err()
 		}
-		recurse := m.Callback.SrcOnly(src)
-		if recurse && job.srcDepth > 0 {
-			jobs = append(jobs, listDirJob{
-				srcRemote: src.Remote(),
-				dstRemote: src.Remote(),
-				srcDepth:  job.srcDepth - 1,
-				noDst:     true,
-			})
-		}
-
+		jobs = m.srcOnly(job, src, jobs)
 	}
 	for _, dst := range dstOnly {
 		if m.aborting() {
 			return nil, m.Ctx.Err()
 		}
-		recurse := m.Callback.DstOnly(dst)
-		if recurse && job.dstDepth > 0 {
-			jobs = append(jobs, listDirJob{
-				srcRemote: dst.Remote(),
-				dstRemote: dst.Remote(),
-				dstDepth:  job.dstDepth - 1,
-				noSrc:     true,
-			})
-		}
+		jobs = m.dstOnly(job, dst, jobs)
 	}
 	for _, match := range matches {
 		if m.aborting() {
 			return nil, m.Ctx.Err()
 		}
-		recurse := m.Callback.Match(m.Ctx, match.dst, match.src)
-		if recurse && job.srcDepth > 0 && job.dstDepth > 0 {
-			jobs = append(jobs, listDirJob{
-				srcRemote: match.src.Remote(),
-				dstRemote: match.dst.Remote(),
-				srcDepth:  job.srcDepth - 1,
-				dstDepth:  job.dstDepth - 1,
-			})
-		}
+		jobs = m.match(job, match.src, match.dst, jobs)
+	}
+	return jobs, nil
+}
+
+// findDst finds the destination object for src when the destination
+// isn't being traversed, returning nil if there isn't one
+func (m *March) findDst(job listDirJob, src fs.DirEntry) fs.Object {
+	srcObj, ok := src.(fs.Object)
+	if !ok {
+		return nil
+	}
+	leaf := path.Base(srcObj.Remote())
+	dstObj, err := m.Fdst.NewObject(m.Ctx, path.Join(job.dstRemote, leaf))
+	if err != nil {
+		return nil
+	}
+	return dstObj
+}
+
+// srcOnly calls the callback for src which is only in the source,
+// adding a job to jobs if it should be recursed into
+func (m *March) srcOnly(job listDirJob, src fs.DirEntry, jobs []listDirJob) []listDirJob {
+	recurse := m.Callback.SrcOnly(src)
+	if recurse && job.srcDepth > 0 {
+		jobs = append(jobs, listDirJob{
+			srcRemote: src.Remote(),
+			dstRemote: src.Remote(),
+			srcDepth:  job.srcDepth - 1,
+			noDst:     true,
+		})
+	}
+	return jobs
+}
+
+// dstOnly calls the callback for dst which is only in the
+// destination, adding a job to jobs if it should be recursed into
+func (m *March) dstOnly(job listDirJob, dst fs.DirEntry, jobs []listDirJob) []listDirJob {
+	recurse := m.Callback.DstOnly(dst)
+	if recurse && job.dstDepth > 0 {
+		jobs = append(jobs, listDirJob{
+			srcRemote: dst.Remote(),
+			dstRemote: dst.Remote(),
+			dstDepth:  job.dstDepth - 1,
+			noSrc:     true,
+		})
+	}
+	return jobs
+}
+
+// match calls the callback for src and dst which match, adding a job
+// to jobs if they should be recursed into
+func (m *March) match(job listDirJob, src, dst fs.DirEntry, jobs []listDirJob) []listDirJob {
+	recurse := m.Callback.Match(m.Ctx, dst, src)
+	if recurse && job.srcDepth > 0 && job.dstDepth > 0 {
+		jobs = append(jobs, listDirJob{
+			srcRemote: src.Remote(),
+			dstRemote: dst.Remote(),
+			srcDepth:  job.srcDepth - 1,
+			dstDepth:  job.dstDepth - 1,
+		})
+	}
+	return jobs
+}
+
+// processSorted matches the source and destination listings of job
+// when one of them was too big to keep in memory and was sorted on
+// disk.
+//
+// The listings are merged as they are read back, calling the
+// callbacks as it goes rather than collecting the matches first.
+func (m *March) processSorted(job listDirJob, srcList fs.DirEntries, srcSorter *list.Sorter, dstList fs.DirEntries, dstSorter *list.Sorter) ([]listDirJob, error) {
+	var jobs []listDirJob
+	g, gCtx := errgroup.WithContext(m.Ctx)
+	srcNext := m.sorterStream(gCtx, g, srcList, srcSorter)
+	dstNext := m.sorterStream(gCtx, g, dstList, dstSorter)
+	findDst := m.NoTraverse && !m.NoCheckDest
+	// The streams end early if there is an error or the march is
+	// aborted so don't act on what is left
+	stopped := func() bool {
+		return gCtx.Err() != nil
+	}
+	matchStreams(srcNext, dstNext,
+		func(src fs.DirEntry) {
+			if stopped() {
+				return
+			}
+			if findDst {
+				if dst := m.findDst(job, src); dst != nil {
+					jobs = m.match(job, src, dst, jobs)
+					return
+				}
+			}
+			jobs = m.srcOnly(job, src, jobs)
+		},
+		func(dst fs.DirEntry) {
+			if stopped() {
+				return
+			}
+			jobs = m.dstOnly(job, dst, jobs)
+		},
+		func(src, dst fs.DirEntry) {
+			if stopped() {
+				return
+			}
+			jobs = m.match(job, src, dst, jobs)
+		},
+	)
+	err := g.Wait()
+	if m.aborting() {
+		return nil, m.Ctx.Err()
+	}
+	if err != nil {
+		fs.Errorf(m.Fsrc, "error reading sorted listing of directory %q: %v", job.srcRemote, err)
+		return nil, fs.CountError(m.Ctx, err)
 	}
 	return jobs, nil
 }
+
+// sorterStream returns a matchStream reading ls or entries if ls is
+// nil.
+//
+// The Sorter is read in the background in g, stopping if ctx is
+// cancelled.
+func (m *March) sorterStream(ctx context.Context, g *errgroup.Group, entries fs.DirEntries, ls *list.Sorter) matchStream {
+	if ls == nil {
+		return sliceStream(newMatchEntries(entries, m.transforms))
+	}
+	in := make(chan fs.DirEntries, 1)
+	g.Go(func() error {
+		err := ls.Send(func(entries fs.DirEntries) error {
+			select {
+			case in <- entries:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		// Only close in on success so a failed listing can't be
+		// mistaken for a short one
+		if err == nil {
+			close(in)
+		}
+		return err
+	})
+	var tranche fs.DirEntries
+	return func() (me matchEntry, ok bool) {
+		for len(tranche) == 0 {
+			select {
+			case tranche, ok = <-in:
+				if !ok {
+					return me, false
+				}
+			case <-ctx.Done():
+				return me, false
+			}
+		}
+		me = newMatchEntry(tranche[0], m.transforms)
+		tranche = tranche[1:]
+		return me, true
+	}
+}
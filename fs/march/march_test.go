@@ -282,6 +282,48 @@ func TestMarchNoTraverse(t *testing.T) {
 	}
 }
 
+func TestMarchListCutoff(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	// Sort all the listings on disk
+	ci.ListCutoff = 1
+	ctx, cancel := context.WithCancel(ctx)
+	r := fstest.NewRun(t)
+
+	srcOnly := []fstest.Item{
+		r.WriteFile("srcOnly", "hello world", t1),
+		r.WriteFile("srcOnlyDir/sub", "hello world", t1),
+	}
+	dstOnly := []fstest.Item{
+		r.WriteObject(ctx, "dstOnly", "hello world", t1),
+		r.WriteObject(ctx, "dstOnlyDir/sub", "hello world", t1),
+	}
+	match := []fstest.Item{
+		r.WriteBoth(ctx, "match", "hello world", t1),
+		r.WriteBoth(ctx, "match2", "hello world", t1),
+		r.WriteBoth(ctx, "matchDir/match file", "hello world", t1),
+	}
+
+	mt := &marchTester{
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	m := &March{
+		Ctx:      ctx,
+		Fdst:     r.Fremote,
+		Fsrc:     r.Flocal,
+		Callback: mt,
+	}
+	mt.processError(m.Run(ctx))
+	mt.cancel()
+	require.NoError(t, mt.currentError())
+
+	precision := fs.GetModifyWindow(ctx, r.Fremote, r.Flocal)
+	fstest.CompareItems(t, mt.srcOnly, srcOnly, []string{"srcOnlyDir"}, precision, "srcOnly")
+	fstest.CompareItems(t, mt.dstOnly, dstOnly, []string{"dstOnlyDir"}, precision, "dstOnly")
+	fstest.CompareItems(t, mt.match, match, []string{"matchDir"}, precision, "match")
+}
+
 func TestNewMatchEntries(t *testing.T) {
 	var (
 		a = mockobject.Object("path/a")
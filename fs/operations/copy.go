@@ -17,6 +17,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/lib/atexit"
@@ -366,6 +367,13 @@ func (c *copy) copy(ctx context.Context) (newDst fs.Object, err error) {
 		actionTaken = fmt.Sprintf("%s to: %s", actionTaken, newDst.String())
 	}
 	fs.Infof(c.src, "%s%s", actionTaken, fs.LogValueHide("size", fs.SizeSuffix(c.src.Size())))
+	if newDst != nil {
+		op := audit.OpCreate
+		if c.doUpdate {
+			op = audit.OpOverwrite
+		}
+		audit.Object(ctx, op, newDst, c.src)
+	}
 
 	return newDst, nil
 }
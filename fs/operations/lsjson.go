@@ -130,6 +130,7 @@ func newListJSON(ctx context.Context, fsrc fs.Fs, remote string, opt *ListJSONOp
 		if err != nil {
 			return nil, fmt.Errorf("ListJSON failed to make new crypt remote: %w", err)
 		}
+		lj.cipher.SetRoot(fsrc.Root())
 	}
 	features := fsrc.Features()
 	lj.canGetTier = features.GetTier
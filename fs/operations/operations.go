@@ -26,6 +26,7 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/filter"
@@ -344,6 +345,7 @@ func equal(ctx context.Context, src fs.ObjectInfo, dst fs.Object, opt equalOpt)
 				fs.Errorf(dst, "Failed to set modification time: %v", err)
 			} else {
 				fs.Infof(src, "Updated modification time in destination")
+				audit.Object(ctx, audit.OpSetMetadata, dst, nil)
 			}
 		}
 	}
@@ -474,6 +476,7 @@ func move(ctx context.Context, fdst fs.Fs, dst fs.Object, remote string, src fs.
 			} else {
 				fs.Infof(src, "Moved (server-side)")
 			}
+			audit.Object(ctx, audit.OpMove, newDst, src)
 			in.ServerSideMoveEnd(newDst.Size()) // account the bytes for the server-side transfer
 			_ = in.Close()
 			return newDst, nil
@@ -569,6 +572,9 @@ func DeleteFileWithBackupDir(ctx context.Context, dst fs.Object, backupDir fs.Fs
 		err = fs.CountError(ctx, err)
 	} else if !skip {
 		fs.Infof(dst, "%s", actioned)
+		if backupDir == nil {
+			audit.Object(ctx, audit.OpDelete, dst, nil)
+		}
 	}
 	return err
 }
@@ -1151,6 +1157,8 @@ func Purge(ctx context.Context, f fs.Fs, dir string) (err error) {
 		err = doPurge(ctx, dir)
 		if errors.Is(err, fs.ErrorCantPurge) {
 			doFallbackPurge = true
+		} else if err == nil {
+			audit.Dir(ctx, audit.OpPurge, f, dir, nil, "")
 		}
 	}
 	if doFallbackPurge {
@@ -1364,6 +1372,7 @@ func rcatSrc(ctx context.Context, fdst fs.Fs, dstFileName string, in io.ReadClos
 	}
 
 	ci := fs.GetConfig(ctx)
+	op := uploadOp(ctx, fdst, dstFileName)
 	tr := accounting.Stats(ctx).NewTransferRemoteSize(dstFileName, -1, nil, fdst)
 	defer func() {
 		tr.Done(ctx, err)
@@ -1478,9 +1487,22 @@ func rcatSrc(ctx context.Context, fdst fs.Fs, dstFileName string, in io.ReadClos
 		fs.Errorf(dst, "%v", err)
 		return dst, err
 	}
+	audit.Object(ctx, op, dst, nil)
 	return dst, nil
 }
 
+// uploadOp returns the audit log operation for uploading remote to f.
+//
+// This only looks to see if remote exists if the audit log is in use.
+func uploadOp(ctx context.Context, f fs.Fs, remote string) audit.Op {
+	if audit.Enabled() {
+		if _, err := f.NewObject(ctx, remote); err == nil {
+			return audit.OpOverwrite
+		}
+	}
+	return audit.OpCreate
+}
+
 // PublicLink adds a "readable by anyone with link" permission on the given file or folder.
 func PublicLink(ctx context.Context, f fs.Fs, remote string, expire fs.Duration, unlink bool) (string, error) {
 	doPublicLink := f.Features().PublicLink
@@ -1817,6 +1839,7 @@ func RcatSize(ctx context.Context, fdst fs.Fs, dstFileName string, in io.ReadClo
 			return nil, err
 		}
 
+		op := uploadOp(ctx, fdst, dstFileName)
 		info := object.NewStaticObjectInfo(dstFileName, modTime, size, true, nil, fdst).WithMetadata(meta)
 		obj, err = fdst.Put(ctx, in, info)
 		if err != nil {
@@ -1824,6 +1847,7 @@ func RcatSize(ctx context.Context, fdst fs.Fs, dstFileName string, in io.ReadClo
 
 			return nil, err
 		}
+		audit.Object(ctx, op, obj, nil)
 	} else {
 		// Size unknown use Rcat
 		obj, err = Rcat(ctx, fdst, dstFileName, in, modTime, meta)
@@ -2160,6 +2184,8 @@ func TouchDir(ctx context.Context, f fs.Fs, remote string, t time.Time, recursiv
 					err = fmt.Errorf("failed to touch: %w", err)
 					err = fs.CountError(ctx, err)
 					fs.Errorf(o, "%v", err)
+				} else {
+					audit.Object(ctx, audit.OpSetMetadata, o, nil)
 				}
 			}
 		})
@@ -2414,6 +2440,7 @@ func DirMove(ctx context.Context, f fs.Fs, srcRemote, dstRemote string) (err err
 		err = doDirMove(ctx, f, srcRemote, dstRemote)
 		if err == nil {
 			accounting.Stats(ctx).Renames(1)
+			audit.Dir(ctx, audit.OpMove, f, dstRemote, f, srcRemote)
 		}
 		if err != fs.ErrorCantDirMove && err != fs.ErrorDirExists {
 			return err
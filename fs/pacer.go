@@ -8,6 +8,9 @@ import (
 
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/lib/pacer"
+	"github.com/rclone/rclone/lib/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Pacer is a simple wrapper around a pacer.Pacer with logging.
@@ -85,10 +88,27 @@ func (p *Pacer) ModifyCalculator(f func(pacer.Calculator)) {
 }
 
 func pacerInvoker(try, retries int, f pacer.Paced) (retry bool, err error) {
+	start := time.Now()
 	retry, err = f()
 	if retry {
 		Debugf("pacer", "low level retry %d/%d (error %v)", try, retries, err)
+		traceRetry(start, try, retries, err)
 		err = fserrors.RetryError(err)
 	}
 	return
 }
+
+// traceRetry records a span for a call which needs retrying.
+//
+// The pacer doesn't know the context of the call so the span is
+// started under the span of the command.
+func traceRetry(start time.Time, try, retries int, err error) {
+	if !tracing.Enabled() {
+		return
+	}
+	_, span := tracing.Start(context.Background(), "pacer retry", trace.WithTimestamp(start), trace.WithAttributes(
+		attribute.Int("rclone.retry.try", try),
+		attribute.Int("rclone.retry.retries", retries),
+	))
+	tracing.End(span, err)
+}
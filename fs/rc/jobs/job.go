@@ -16,6 +16,9 @@ import (
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Fill in these to avoid circular dependencies
@@ -100,10 +103,15 @@ func (job *Job) OnFinish(fn func()) func() {
 
 // run the job until completion writing the return status
 func (job *Job) run(ctx context.Context, fn rc.Func, in rc.Params) {
+	ctx, span := tracing.Start(ctx, "rc job", trace.WithAttributes(
+		attribute.Int64("rclone.job.id", job.ID),
+		attribute.String("rclone.job.group", job.Group),
+	))
 	defer func() {
 		if r := recover(); r != nil {
 			job.finish(nil, fmt.Errorf("panic received: %v \n%s", r, string(debug.Stack())))
 		}
+		tracing.End(span, job.realErr)
 	}()
 	job.finish(fn(ctx, in))
 }
@@ -212,8 +220,9 @@ func getAsync(ctx context.Context, in rc.Params) (context.Context, bool, error)
 	}
 	delete(in, "_async") // remove the async parameter after parsing
 	if isAsync {
-		// unlink this job from the current context
-		ctx = context.Background()
+		// unlink this job from the current context but keep
+		// it in the same trace
+		ctx = tracing.Detach(ctx)
 	}
 	return ctx, isAsync, nil
 }
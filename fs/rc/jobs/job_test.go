@@ -293,6 +293,9 @@ func TestExecuteJobWithFilter(t *testing.T) {
 		fi := filter.GetConfig(ctx)
 		assert.Equal(t, fs.SizeSuffix(1024), fi.Opt.MaxSize)
 		assert.Equal(t, []string{"a", "b", "c"}, fi.Opt.IncludeRule)
+		assert.Equal(t, "size > 100", fi.Opt.FilterExpr)
+		assert.True(t, fi.Include("a", 500, time.Now(), nil))
+		assert.False(t, fi.Include("a", 50, time.Now(), nil))
 		called = true
 		return nil, nil
 	}
@@ -300,6 +303,7 @@ func TestExecuteJobWithFilter(t *testing.T) {
 		"_filter": rc.Params{
 			"IncludeRule": []string{"a", "b", "c"},
 			"MaxSize":     "1k",
+			"FilterExpr":  "size > 100",
 		},
 	})
 	require.NoError(t, err)
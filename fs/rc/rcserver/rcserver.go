@@ -27,7 +27,9 @@ import (
 	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/lib/http/serve"
 	"github.com/rclone/rclone/lib/random"
+	"github.com/rclone/rclone/lib/tracing"
 	"github.com/skratchdot/open-golang/open"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Start the remote control server if configured
@@ -261,6 +263,8 @@ func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, path string)
 	}
 
 	fs.Debugf(nil, "rc: %q: with parameters %+v", path, in)
+	ctx, span := tracing.StartRemote(ctx, r.Header, "rc "+path, trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
 	job, out, err := jobs.NewJob(ctx, call.Fn, in)
 	if job != nil {
 		w.Header().Add("x-rclone-jobid", fmt.Sprintf("%d", job.ID))
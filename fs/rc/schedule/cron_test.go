@@ -0,0 +1,67 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"x * * * *",
+		"@fortnightly",
+	} {
+		_, err := parseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// Friday 2024-03-15 10:17:30
+	start := time.Date(2024, 3, 15, 10, 17, 30, 0, time.UTC)
+	for _, test := range []struct {
+		expr string
+		want string
+	}{
+		{"* * * * *", "2024-03-15 10:18"},
+		{"*/15 * * * *", "2024-03-15 10:30"},
+		{"17 * * * *", "2024-03-15 11:17"},
+		{"0 2 * * *", "2024-03-16 02:00"},
+		{"30 2 * * mon-fri", "2024-03-18 02:30"},
+		{"0 0 * * 7", "2024-03-17 00:00"},
+		{"0 0 1 * *", "2024-04-01 00:00"},
+		{"0 0 1,15 * *", "2024-04-01 00:00"},
+		{"0 0 29 feb *", "2028-02-29 00:00"},
+		{"0 12 10-20/5 * *", "2024-03-15 12:00"},
+		// day of month or day of week when both are restricted
+		{"0 0 31 * sat", "2024-03-16 00:00"},
+		{"@hourly", "2024-03-15 11:00"},
+		{"@daily", "2024-03-16 00:00"},
+		{"@weekly", "2024-03-17 00:00"},
+		{"@monthly", "2024-04-01 00:00"},
+		{"@yearly", "2025-01-01 00:00"},
+	} {
+		c, err := parseCron(test.expr)
+		require.NoError(t, err, test.expr)
+		got, err := c.next(start)
+		require.NoError(t, err, test.expr)
+		assert.Equal(t, test.want, got.Format("2006-01-02 15:04"), test.expr)
+	}
+
+	c, err := parseCron("0 0 31 feb *")
+	require.NoError(t, err)
+	_, err = c.next(start)
+	assert.Equal(t, errNoCronTime, err)
+}
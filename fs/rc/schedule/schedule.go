@@ -0,0 +1,638 @@
+// Package schedule runs rc calls periodically inside rcd
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/rc/jobs"
+)
+
+// maxHistory is the number of runs kept for each schedule
+const maxHistory = 20
+
+// Run statuses
+const (
+	statusRunning = "running"
+	statusSuccess = "success"
+	statusError   = "error"
+	statusSkipped = "skipped"
+)
+
+var (
+	errNotRunning     = errors.New("the scheduler is only available in rcd")
+	errNotFound       = errors.New("schedule not found")
+	errAlreadyRunning = errors.New("previous run still in progress")
+)
+
+// Run describes a single run of a schedule
+type Run struct {
+	JobID    int64     `json:"jobid,omitempty"`
+	Trigger  string    `json:"trigger"` // "schedule" or "manual"
+	Start    time.Time `json:"startTime"`
+	End      time.Time `json:"endTime,omitempty"`
+	Duration float64   `json:"duration"`
+	Status   string    `json:"status"` // "running", "success", "error" or "skipped"
+	Error    string    `json:"error,omitempty"`
+}
+
+// Schedule is an rc call run periodically
+type Schedule struct {
+	Name    string    `json:"name"`
+	Command string    `json:"command"`
+	Params  rc.Params `json:"params,omitempty"`
+	Cron    string    `json:"cron,omitempty"`   // cron expression or
+	Every   string    `json:"every,omitempty"`  // interval between runs
+	Jitter  string    `json:"jitter,omitempty"` // maximum random delay added to each run
+	Created time.Time `json:"created"`
+	NextRun time.Time `json:"nextRun"`
+	Running bool      `json:"running"`
+	History []Run     `json:"history"` // most recent last
+
+	cron   *cronSpec
+	every  time.Duration
+	jitter time.Duration
+	due    time.Time // when the next run is due without jitter
+	timer  *time.Timer
+}
+
+// parse the timing fields of sch
+func (sch *Schedule) parse() (err error) {
+	if sch.Name == "" {
+		return errors.New("schedule needs a name")
+	}
+	if (sch.Cron == "") == (sch.Every == "") {
+		return errors.New("schedule needs one of cron or every")
+	}
+	sch.cron, sch.every, sch.jitter = nil, 0, 0
+	if sch.Cron != "" {
+		if sch.cron, err = parseCron(sch.Cron); err != nil {
+			return err
+		}
+		if _, err = sch.cron.next(time.Now()); err != nil {
+			return err
+		}
+	} else {
+		if sch.every, err = fs.ParseDuration(sch.Every); err != nil {
+			return fmt.Errorf("bad every: %w", err)
+		}
+		if sch.every < time.Second {
+			return errors.New("every must be at least 1s")
+		}
+	}
+	if sch.Jitter != "" {
+		if sch.jitter, err = fs.ParseDuration(sch.Jitter); err != nil {
+			return fmt.Errorf("bad jitter: %w", err)
+		}
+		if sch.jitter < 0 {
+			return errors.New("jitter can't be negative")
+		}
+	}
+	return nil
+}
+
+// check the command can be scheduled
+func checkCommand(command string) error {
+	call := rc.Calls.Get(command)
+	if call == nil {
+		return fmt.Errorf("couldn't find rc command %q", command)
+	}
+	if call.NeedsRequest || call.NeedsResponse {
+		return fmt.Errorf("rc command %q can't be scheduled as it needs an HTTP request", command)
+	}
+	if strings.HasPrefix(command, "schedule/") {
+		return fmt.Errorf("rc command %q can't be scheduled", command)
+	}
+	return nil
+}
+
+// schedule the next run of sch after now
+func (sch *Schedule) advance(now time.Time) {
+	if sch.cron != nil {
+		after := now
+		if sch.due.After(after) {
+			after = sch.due
+		}
+		due, err := sch.cron.next(after)
+		if err != nil {
+			// checked in parse so shouldn't happen
+			fs.Errorf(nil, "schedule %q: %v", sch.Name, err)
+			due = now.AddDate(100, 0, 0)
+		}
+		sch.due = due
+	} else {
+		sch.due = sch.due.Add(sch.every)
+		if !sch.due.After(now) {
+			sch.due = now.Add(sch.every)
+		}
+	}
+	sch.NextRun = sch.due
+	if sch.jitter > 0 {
+		sch.NextRun = sch.NextRun.Add(time.Duration(rand.Int63n(int64(sch.jitter))))
+	}
+}
+
+// addRun adds run to the history dropping the oldest runs
+func (sch *Schedule) addRun(run Run) {
+	sch.History = append(sch.History, run)
+	if len(sch.History) > maxHistory {
+		sch.History = append([]Run(nil), sch.History[len(sch.History)-maxHistory:]...)
+	}
+}
+
+// copy sch for returning to the user
+func (sch *Schedule) copy() *Schedule {
+	out := *sch
+	out.History = append([]Run{}, sch.History...)
+	out.Params = sch.Params.Copy()
+	out.timer = nil
+	return &out
+}
+
+// Scheduler runs the schedules
+type Scheduler struct {
+	mu        sync.Mutex
+	ctx       context.Context
+	path      string
+	schedules map[string]*Schedule
+	stopped   bool
+}
+
+var (
+	globalMu sync.Mutex
+	global   *Scheduler
+)
+
+// Start the scheduler loading the schedules from the state file at
+// path, or the default state file if path is empty.
+//
+// The schedule rc calls only work once this has been called.
+func Start(ctx context.Context, path string) (*Scheduler, error) {
+	if path == "" {
+		path = filepath.Join(config.GetCacheDir(), "schedule.json")
+	}
+	s := &Scheduler{
+		ctx:       ctx,
+		path:      path,
+		schedules: map[string]*Schedule{},
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	globalMu.Lock()
+	global = s
+	globalMu.Unlock()
+	return s, nil
+}
+
+// get the running scheduler
+func getScheduler() (*Scheduler, error) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	if global == nil {
+		return nil, errNotRunning
+	}
+	return global, nil
+}
+
+// Stop the scheduler. Runs in progress carry on.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	for _, sch := range s.schedules {
+		sch.timer.Stop()
+	}
+	globalMu.Lock()
+	if global == s {
+		global = nil
+	}
+	globalMu.Unlock()
+}
+
+// state file format
+type stateFile struct {
+	Schedules []*Schedule `json:"schedules"`
+}
+
+// load the schedules from the state file and start their timers
+func (s *Scheduler) load() error {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		fs.Debugf(nil, "schedule: no state file %q", s.path)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read schedule state: %w", err)
+	}
+	var state stateFile
+	if err = json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse schedule state %q: %w", s.path, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, sch := range state.Schedules {
+		if err := sch.parse(); err != nil {
+			fs.Errorf(nil, "schedule %q: ignoring: %v", sch.Name, err)
+			continue
+		}
+		// Runs which were in progress when rclone stopped are lost
+		sch.Running = false
+		for i := range sch.History {
+			if sch.History[i].Status == statusRunning {
+				sch.History[i].Status = statusError
+				sch.History[i].Error = "interrupted by rclone exiting"
+			}
+		}
+		s.arm(sch, now)
+	}
+	fs.Infof(nil, "schedule: loaded %d schedules from %q", len(s.schedules), s.path)
+	return nil
+}
+
+// save the schedules to the state file - call with the lock held
+func (s *Scheduler) save() {
+	state := stateFile{Schedules: s.sorted()}
+	data, err := json.MarshalIndent(&state, "", "\t")
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	}
+	if err == nil {
+		tmp := s.path + ".tmp"
+		err = os.WriteFile(tmp, data, 0600)
+		if err == nil {
+			err = os.Rename(tmp, s.path)
+		}
+	}
+	if err != nil {
+		fs.Errorf(nil, "schedule: failed to save state to %q: %v", s.path, err)
+	}
+}
+
+// sorted returns the schedules sorted by name - call with the lock held
+func (s *Scheduler) sorted() []*Schedule {
+	out := make([]*Schedule, 0, len(s.schedules))
+	for _, sch := range s.schedules {
+		out = append(out, sch)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// arm adds sch and starts its timer - call with the lock held
+func (s *Scheduler) arm(sch *Schedule, now time.Time) {
+	if old := s.schedules[sch.Name]; old != nil && old != sch {
+		old.timer.Stop()
+	}
+	s.schedules[sch.Name] = sch
+	sch.advance(now)
+	sch.timer = time.AfterFunc(time.Until(sch.NextRun), func() {
+		s.fire(sch)
+	})
+}
+
+// fire is called when the timer for sch goes off
+func (s *Scheduler) fire(sch *Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped || s.schedules[sch.Name] != sch {
+		return
+	}
+	_, err := s.run(sch, "schedule")
+	if err != nil {
+		fs.Errorf(nil, "schedule %q: %v", sch.Name, err)
+	}
+	sch.advance(time.Now())
+	sch.timer.Reset(time.Until(sch.NextRun))
+	s.save()
+}
+
+// run starts sch as an rc job returning its ID - call with the lock held
+func (s *Scheduler) run(sch *Schedule, trigger string) (jobID int64, err error) {
+	run := Run{
+		Trigger: trigger,
+		Start:   time.Now(),
+	}
+	if sch.Running {
+		if trigger == "schedule" {
+			run.Status = statusSkipped
+			run.Error = errAlreadyRunning.Error()
+			sch.addRun(run)
+		}
+		return 0, errAlreadyRunning
+	}
+	call := rc.Calls.Get(sch.Command)
+	if call == nil {
+		err = fmt.Errorf("couldn't find rc command %q", sch.Command)
+		run.Status = statusError
+		run.Error = err.Error()
+		sch.addRun(run)
+		return 0, err
+	}
+	in := sch.Params.Copy()
+	if in == nil {
+		in = rc.Params{}
+	}
+	in["_async"] = true
+	if _, ok := in["_group"]; !ok {
+		in["_group"] = "schedule/" + sch.Name
+	}
+	job, _, err := jobs.NewJob(s.ctx, call.Fn, in)
+	if err != nil {
+		run.Status = statusError
+		run.Error = err.Error()
+		sch.addRun(run)
+		return 0, err
+	}
+	fs.Infof(nil, "schedule %q: started %s as job %d", sch.Name, sch.Command, job.ID)
+	run.JobID = job.ID
+	run.Start = job.StartTime
+	run.Status = statusRunning
+	sch.Running = true
+	sch.addRun(run)
+	job.OnFinish(func() {
+		// The job fields are written before this is called
+		s.finished(sch, job.ID, job.EndTime, job.Error)
+	})
+	return job.ID, nil
+}
+
+// finished records the result of the job with jobID for sch
+func (s *Scheduler) finished(sch *Schedule, jobID int64, end time.Time, errString string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sch.Running = false
+	for i := range sch.History {
+		run := &sch.History[i]
+		if run.JobID != jobID {
+			continue
+		}
+		run.End = end
+		run.Duration = end.Sub(run.Start).Seconds()
+		if errString != "" {
+			run.Status = statusError
+			run.Error = errString
+			fs.Errorf(nil, "schedule %q: job %d failed: %s", sch.Name, jobID, errString)
+		} else {
+			run.Status = statusSuccess
+			fs.Infof(nil, "schedule %q: job %d finished", sch.Name, jobID)
+		}
+	}
+	if !s.stopped && s.schedules[sch.Name] == sch {
+		s.save()
+	}
+}
+
+// Add sch to the scheduler, replacing an existing schedule with the
+// same name if replace is set.
+func (s *Scheduler) Add(sch *Schedule, replace bool) (*Schedule, error) {
+	if err := sch.parse(); err != nil {
+		return nil, err
+	}
+	if err := checkCommand(sch.Command); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.schedules[sch.Name]
+	if old != nil && !replace {
+		return nil, fmt.Errorf("schedule %q already exists", sch.Name)
+	}
+	sch.Created = time.Now()
+	sch.History = nil
+	if old != nil {
+		sch.Created = old.Created
+		sch.History = old.History
+	}
+	s.arm(sch, time.Now())
+	s.save()
+	return sch.copy(), nil
+}
+
+// Remove the schedule called name. A run in progress carries on.
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sch := s.schedules[name]
+	if sch == nil {
+		return errNotFound
+	}
+	sch.timer.Stop()
+	delete(s.schedules, name)
+	s.save()
+	return nil
+}
+
+// Run the schedule called name now returning the job ID
+func (s *Scheduler) Run(name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sch := s.schedules[name]
+	if sch == nil {
+		return 0, errNotFound
+	}
+	jobID, err := s.run(sch, "manual")
+	s.save()
+	return jobID, err
+}
+
+// List returns copies of the schedules sorted by name
+func (s *Scheduler) List() []*Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	schedules := s.sorted()
+	for i, sch := range schedules {
+		schedules[i] = sch.copy()
+	}
+	return schedules
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "schedule/add",
+		AuthRequired: true,
+		Fn:           rcAdd,
+		Title:        "Add a schedule to run an rc command periodically",
+		Help: `This is only available when running rclone rcd.
+
+Parameters:
+
+- name - name of the schedule (string)
+- command - rc command to run, e.g. "sync/sync" (string)
+- params - parameters to pass to the command (object, optional)
+- cron - cron expression saying when to run, e.g. "30 2 * * *" (string)
+- every - interval between runs, e.g. "6h" (string)
+- jitter - maximum random delay added to each run, e.g. "5m" (string, optional)
+- replace - set to replace an existing schedule with this name (boolean, optional)
+
+Exactly one of cron or every must be given. The cron expression has
+the five standard fields - minute, hour, day of month, month and day
+of week - or may be one of @hourly, @daily, @weekly, @monthly or
+@yearly. It is interpreted in the local time zone.
+
+Each run is started as an async job in the stats group
+"schedule/NAME" unless params contains a _group. If the previous run
+is still going when a run is due then that run is skipped.
+
+Results:
+
+- schedule - the schedule as returned by schedule/list
+`,
+	})
+}
+
+// Add a schedule
+func rcAdd(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	s, err := getScheduler()
+	if err != nil {
+		return nil, err
+	}
+	sch := &Schedule{}
+	if sch.Name, err = in.GetString("name"); err != nil {
+		return nil, err
+	}
+	if sch.Command, err = in.GetString("command"); err != nil {
+		return nil, err
+	}
+	if err = in.GetStructMissingOK("params", &sch.Params); err != nil {
+		return nil, err
+	}
+	for key, value := range map[string]*string{
+		"cron":   &sch.Cron,
+		"every":  &sch.Every,
+		"jitter": &sch.Jitter,
+	} {
+		if *value, err = in.GetString(key); rc.NotErrParamNotFound(err) {
+			return nil, err
+		}
+	}
+	replace, err := in.GetBool("replace")
+	if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
+	sch, err = s.Add(sch, replace)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{"schedule": sch}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "schedule/list",
+		AuthRequired: true,
+		Fn:           rcList,
+		Title:        "List the schedules",
+		Help: `This is only available when running rclone rcd.
+
+Parameters: None.
+
+Results:
+
+- schedules - array of schedules sorted by name, each with
+    - name, command, params, cron, every, jitter - as passed to schedule/add
+    - created - when the schedule was added
+    - nextRun - when the schedule will next run
+    - running - true if a run is in progress
+    - history - array of the most recent runs, oldest first, each with
+        - jobid - id of the job, if one was started
+        - trigger - "schedule" or "manual"
+        - startTime, endTime, duration - when the run started and finished
+        - status - "running", "success", "error" or "skipped"
+        - error - error from the run, if any
+`,
+	})
+}
+
+// List the schedules
+func rcList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	s, err := getScheduler()
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{"schedules": s.List()}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "schedule/remove",
+		AuthRequired: true,
+		Fn:           rcRemove,
+		Title:        "Remove a schedule",
+		Help: `This is only available when running rclone rcd.
+
+A run in progress carries on until it finishes - use job/stopgroup to
+stop it.
+
+Parameters:
+
+- name - name of the schedule (string)
+`,
+	})
+}
+
+// Remove a schedule
+func rcRemove(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	s, err := getScheduler()
+	if err != nil {
+		return nil, err
+	}
+	name, err := in.GetString("name")
+	if err != nil {
+		return nil, err
+	}
+	return nil, s.Remove(name)
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "schedule/run",
+		AuthRequired: true,
+		Fn:           rcRun,
+		Title:        "Run a schedule now",
+		Help: `This is only available when running rclone rcd.
+
+This starts a run of the schedule straight away. It doesn't change
+when the schedule next runs. It returns an error if a run is already
+in progress.
+
+Parameters:
+
+- name - name of the schedule (string)
+
+Results:
+
+- jobid - id of the job started (integer)
+`,
+	})
+}
+
+// Run a schedule now
+func rcRun(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	s, err := getScheduler()
+	if err != nil {
+		return nil, err
+	}
+	name, err := in.GetString("name")
+	if err != nil {
+		return nil, err
+	}
+	jobID, err := s.Run(name)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{"jobid": jobID}, nil
+}
@@ -0,0 +1,182 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCalls receives the parameters of each call to test/schedule
+// which then waits for testRelease
+var (
+	testCalls   = make(chan rc.Params, 10)
+	testRelease = make(chan error)
+)
+
+func init() {
+	rc.Add(rc.Call{
+		Path: "test/schedule",
+		Fn: func(ctx context.Context, in rc.Params) (rc.Params, error) {
+			testCalls <- in
+			return nil, <-testRelease
+		},
+		Title: "Test call for the scheduler",
+	})
+}
+
+// call the rc function path
+func call(t *testing.T, path string, in rc.Params) (rc.Params, error) {
+	c := rc.Calls.Get(path)
+	require.NotNil(t, c, path)
+	return c.Fn(context.Background(), in)
+}
+
+// wait for a run of the schedule called name with status returning
+// the most recent one
+func waitStatus(t *testing.T, s *Scheduler, name, status string) Run {
+	var run Run
+	require.Eventually(t, func() bool {
+		for _, sch := range s.List() {
+			if sch.Name != name {
+				continue
+			}
+			for i := len(sch.History) - 1; i >= 0; i-- {
+				if sch.History[i].Status == status {
+					run = sch.History[i]
+					return true
+				}
+			}
+		}
+		return false
+	}, 10*time.Second, 10*time.Millisecond)
+	return run
+}
+
+func TestScheduleNotRunning(t *testing.T) {
+	_, err := call(t, "schedule/list", rc.Params{})
+	assert.Equal(t, errNotRunning, err)
+}
+
+func TestScheduleAddErrors(t *testing.T) {
+	s, err := Start(context.Background(), filepath.Join(t.TempDir(), "schedule.json"))
+	require.NoError(t, err)
+	defer s.Stop()
+
+	for _, in := range []rc.Params{
+		{"command": "test/schedule", "every": "1h"},
+		{"name": "a", "every": "1h"},
+		{"name": "a", "command": "test/schedule"},
+		{"name": "a", "command": "test/schedule", "every": "1h", "cron": "@daily"},
+		{"name": "a", "command": "test/schedule", "every": "potato"},
+		{"name": "a", "command": "test/schedule", "every": "10ms"},
+		{"name": "a", "command": "test/schedule", "every": "1h", "jitter": "-1s"},
+		{"name": "a", "command": "test/schedule", "cron": "* * *"},
+		{"name": "a", "command": "test/schedule", "cron": "0 0 30 feb *"},
+		{"name": "a", "command": "not/found", "every": "1h"},
+		{"name": "a", "command": "schedule/list", "every": "1h"},
+		{"name": "a", "command": "core/command", "every": "1h"},
+	} {
+		_, err := call(t, "schedule/add", in)
+		assert.Error(t, err, in)
+	}
+	assert.Len(t, s.List(), 0)
+}
+
+func TestSchedule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedule.json")
+	s, err := Start(context.Background(), path)
+	require.NoError(t, err)
+
+	// Add a schedule
+	out, err := call(t, "schedule/add", rc.Params{
+		"name":    "test",
+		"command": "test/schedule",
+		"params":  rc.Params{"potato": "yes"},
+		"cron":    "0 3 * * *",
+		"jitter":  "1m",
+	})
+	require.NoError(t, err)
+	sch := out["schedule"].(*Schedule)
+	assert.Equal(t, "test", sch.Name)
+	assert.Equal(t, 3, sch.NextRun.Hour())
+	assert.True(t, sch.NextRun.After(time.Now()))
+
+	_, err = call(t, "schedule/add", rc.Params{"name": "test", "command": "test/schedule", "every": "1h"})
+	assert.ErrorContains(t, err, "already exists")
+
+	// Run it by hand
+	out, err = call(t, "schedule/run", rc.Params{"name": "test"})
+	require.NoError(t, err)
+	jobID := out["jobid"].(int64)
+	in := <-testCalls
+	assert.Equal(t, "yes", in["potato"])
+	run := waitStatus(t, s, "test", statusRunning)
+	assert.Equal(t, jobID, run.JobID)
+	assert.Equal(t, "manual", run.Trigger)
+
+	// A second run while the first is going is refused
+	_, err = call(t, "schedule/run", rc.Params{"name": "test"})
+	assert.Equal(t, errAlreadyRunning, err)
+
+	// A scheduled run while the first is going is skipped
+	s.fire(s.schedules["test"])
+	run = waitStatus(t, s, "test", statusSkipped)
+	assert.Equal(t, "schedule", run.Trigger)
+
+	testRelease <- errors.New("boom")
+	run = waitStatus(t, s, "test", statusError)
+	assert.Equal(t, jobID, run.JobID)
+	assert.Contains(t, run.Error, "boom")
+
+	// Replace it with a quick interval schedule and check it runs
+	_, err = call(t, "schedule/add", rc.Params{
+		"name":    "test",
+		"command": "test/schedule",
+		"every":   "1s",
+		"replace": true,
+	})
+	require.NoError(t, err)
+	<-testCalls
+	testRelease <- nil
+	run = waitStatus(t, s, "test", statusSuccess)
+	assert.Equal(t, "schedule", run.Trigger)
+	assert.False(t, run.End.Before(run.Start))
+
+	// Slow it down again keeping the history
+	_, err = call(t, "schedule/add", rc.Params{
+		"name":    "test",
+		"command": "test/schedule",
+		"every":   "1h",
+		"replace": true,
+	})
+	require.NoError(t, err)
+
+	out, err = call(t, "schedule/list", rc.Params{})
+	require.NoError(t, err)
+	schedules := out["schedules"].([]*Schedule)
+	require.Len(t, schedules, 1)
+	assert.Equal(t, "1h", schedules[0].Every)
+	assert.Len(t, schedules[0].History, 3)
+	s.Stop()
+
+	// Check the schedules are reloaded
+	s, err = Start(context.Background(), path)
+	require.NoError(t, err)
+	defer s.Stop()
+	schedules = s.List()
+	require.Len(t, schedules, 1)
+	assert.Equal(t, "test/schedule", schedules[0].Command)
+	assert.Len(t, schedules[0].History, 3)
+
+	_, err = call(t, "schedule/remove", rc.Params{"name": "test"})
+	require.NoError(t, err)
+	_, err = call(t, "schedule/remove", rc.Params{"name": "test"})
+	assert.Equal(t, errNotFound, err)
+	assert.Len(t, s.List(), 0)
+}
@@ -0,0 +1,321 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/errcount"
+)
+
+// PlanVersion is the version of the plan file format
+const PlanVersion = 1
+
+// Plan actions in the order they are applied
+const (
+	PlanMkdir  = "mkdir"  // make the directory Path
+	PlanRename = "rename" // rename the destination file From to Path
+	PlanCopy   = "copy"   // copy the source file Path to the destination
+	PlanUpdate = "update" // overwrite the destination file Path with the source
+	PlanDelete = "delete" // delete the destination file Path
+	PlanRmdir  = "rmdir"  // remove the destination directory Path if empty
+)
+
+// The order actions are applied in
+var planActionOrder = map[string]int{
+	PlanMkdir:  0,
+	PlanRename: 1,
+	PlanCopy:   2,
+	PlanUpdate: 2,
+	PlanDelete: 3,
+	PlanRmdir:  4,
+}
+
+// ErrorPlanChanged is returned when a file has changed since the plan
+// was made
+var ErrorPlanChanged = errors.New("refusing as it has changed since the plan was made")
+
+// PlanAction is a single action of a Plan
+//
+// The fingerprints are made with planFingerprint and are checked
+// before the action is applied.
+type PlanAction struct {
+	Action     string `json:"action"`               // one of the Plan* constants
+	Path       string `json:"path"`                 // path relative to the roots
+	From       string `json:"from,omitempty"`       // path of the destination file being renamed
+	Src        string `json:"src,omitempty"`        // fingerprint of the source file
+	Dst        string `json:"dst,omitempty"`        // fingerprint of the destination file
+	ServerSide bool   `json:"serverSide,omitempty"` // set if the copy can be done server-side
+}
+
+// Plan records the actions a sync would take so they can be reviewed
+// and applied later with Apply
+type Plan struct {
+	Version int          `json:"version"`
+	Created time.Time    `json:"created"`
+	SrcFs   string       `json:"srcFs"` // config string of the source without any connection string parameters
+	DstFs   string       `json:"dstFs"` // config string of the destination without any connection string parameters
+	Actions []PlanAction `json:"actions"`
+
+	mu sync.Mutex
+}
+
+// Context key for the plan being recorded
+type planContextKeyType struct{}
+
+var planContextKey = planContextKeyType{}
+
+// getPlan returns the plan being recorded in ctx or nil if none
+func getPlan(ctx context.Context) *Plan {
+	p, _ := ctx.Value(planContextKey).(*Plan)
+	return p
+}
+
+// MakePlan does a dry run of syncing fsrc to fdst and returns the
+// actions it would have taken.
+//
+// SrcFs and DstFs are set to the config strings of fsrc and fdst. These
+// don't include connection string parameters as they may contain
+// credentials, so a plan for a remote made with them can only be
+// applied by passing the remotes to Apply again.
+func MakePlan(ctx context.Context, fdst, fsrc fs.Fs, copyEmptySrcDirs bool) (*Plan, error) {
+	ctx, ci := fs.AddConfig(ctx)
+	if ci.BackupDir != "" || len(ci.CompareDest) > 0 || len(ci.CopyDest) > 0 {
+		return nil, fserrors.FatalError(errors.New("can't make a plan with --backup-dir, --compare-dest or --copy-dest"))
+	}
+	ci.DryRun = true
+	p := &Plan{
+		Version: PlanVersion,
+		Created: time.Now(),
+		SrcFs:   fs.ConfigString(fsrc),
+		DstFs:   fs.ConfigString(fdst),
+		Actions: []PlanAction{},
+	}
+	ctx = context.WithValue(ctx, planContextKey, p)
+	err := Sync(ctx, fdst, fsrc, copyEmptySrcDirs)
+	if err != nil {
+		return nil, err
+	}
+	p.sort()
+	return p, nil
+}
+
+// sort the actions into the order they will be applied
+func (p *Plan) sort() {
+	sort.SliceStable(p.Actions, func(i, j int) bool {
+		a, b := p.Actions[i], p.Actions[j]
+		if planActionOrder[a.Action] != planActionOrder[b.Action] {
+			return planActionOrder[a.Action] < planActionOrder[b.Action]
+		}
+		if a.Action == PlanRmdir {
+			// Remove the deepest directories first
+			return a.Path > b.Path
+		}
+		return a.Path < b.Path
+	})
+}
+
+// planFingerprint returns the fingerprint of o recorded in the plan
+// and checked when it is applied.
+//
+// This is the slow fingerprint so it includes the modification time
+// and hash even on backends where they are expensive to read. Making a
+// plan with the local backend therefore reads every file to be
+// transferred, updated, renamed or deleted to hash it.
+func planFingerprint(ctx context.Context, o fs.ObjectInfo) string {
+	return fs.Fingerprint(ctx, o, false)
+}
+
+// add an action to the plan - p may be nil
+func (p *Plan) add(action PlanAction) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.Actions = append(p.Actions, action)
+	p.mu.Unlock()
+}
+
+// copy records src being copied over dst which may be nil
+func (p *Plan) copy(ctx context.Context, fdst fs.Fs, dst, src fs.Object) {
+	if p == nil {
+		return
+	}
+	action := PlanAction{
+		Action:     PlanCopy,
+		Path:       src.Remote(),
+		Src:        planFingerprint(ctx, src),
+		ServerSide: fdst.Features().Copy != nil && operations.SameConfig(src.Fs(), fdst),
+	}
+	if dst != nil {
+		action.Action = PlanUpdate
+		action.Dst = planFingerprint(ctx, dst)
+	}
+	p.add(action)
+}
+
+// rename records the destination file dst being renamed to remote
+func (p *Plan) rename(ctx context.Context, dst fs.Object, remote string) {
+	if p == nil {
+		return
+	}
+	p.add(PlanAction{
+		Action: PlanRename,
+		Path:   remote,
+		From:   dst.Remote(),
+		Dst:    planFingerprint(ctx, dst),
+	})
+}
+
+// delete records the destination file dst being deleted
+func (p *Plan) delete(ctx context.Context, dst fs.Object) {
+	if p == nil {
+		return
+	}
+	p.add(PlanAction{
+		Action: PlanDelete,
+		Path:   dst.Remote(),
+		Dst:    planFingerprint(ctx, dst),
+	})
+}
+
+// dir records a directory action on the destination
+func (p *Plan) dir(action string, dir string) {
+	p.add(PlanAction{
+		Action: action,
+		Path:   dir,
+	})
+}
+
+// Save writes the plan to the file name as JSON
+func (p *Plan) Save(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	err = os.WriteFile(name, append(data, '\n'), 0666)
+	if err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	return nil
+}
+
+// LoadPlan reads a plan written by Save from the file name
+func LoadPlan(name string) (*Plan, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	p := new(Plan)
+	err = json.Unmarshal(data, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode plan %q: %w", name, err)
+	}
+	if p.Version != PlanVersion {
+		return nil, fmt.Errorf("unsupported plan version %d in %q", p.Version, name)
+	}
+	return p, nil
+}
+
+// Apply does the actions in the plan to fdst reading from fsrc.
+//
+// Each file is checked against the fingerprint recorded in the plan
+// first and the action isn't done if it has changed. The other actions
+// are still done and an error is returned at the end.
+func Apply(ctx context.Context, fdst, fsrc fs.Fs, p *Plan) error {
+	errCount := errcount.New()
+	for _, action := range p.Actions {
+		if err := applyAction(ctx, fdst, fsrc, action); err != nil {
+			err = fs.CountError(ctx, err)
+			fs.Errorf(action.Path, "Failed to %s: %v", action.Action, err)
+			errCount.Add(err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return errCount.Err("failed to apply plan")
+}
+
+// applyAction does a single action of the plan
+func applyAction(ctx context.Context, fdst, fsrc fs.Fs, action PlanAction) error {
+	switch action.Action {
+	case PlanMkdir:
+		return operations.Mkdir(ctx, fdst, action.Path)
+	case PlanRmdir:
+		// Like sync, only delete the directory if it is empty
+		if err := operations.TryRmdir(ctx, fdst, action.Path); err != nil {
+			fs.Debugf(fs.LogDirName(fdst, action.Path), "Failed to Rmdir: %v", err)
+		}
+		return nil
+	case PlanCopy, PlanUpdate:
+		src, err := planObject(ctx, fsrc, action.Path, action.Src)
+		if err != nil {
+			return err
+		}
+		var dst fs.Object
+		if action.Action == PlanUpdate {
+			dst, err = planObject(ctx, fdst, action.Path, action.Dst)
+		} else {
+			err = planNoObject(ctx, fdst, action.Path)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = operations.Copy(ctx, fdst, dst, action.Path, src)
+		return err
+	case PlanRename:
+		dst, err := planObject(ctx, fdst, action.From, action.Dst)
+		if err != nil {
+			return err
+		}
+		if err = planNoObject(ctx, fdst, action.Path); err != nil {
+			return err
+		}
+		_, err = operations.Move(ctx, fdst, nil, action.Path, dst)
+		return err
+	case PlanDelete:
+		dst, err := planObject(ctx, fdst, action.Path, action.Dst)
+		if err != nil {
+			return err
+		}
+		return operations.DeleteFile(ctx, dst)
+	}
+	return fmt.Errorf("unknown plan action %q", action.Action)
+}
+
+// planObject finds remote on f and checks it still has the
+// fingerprint recorded in the plan
+func planObject(ctx context.Context, f fs.Fs, remote, fingerprint string) (fs.Object, error) {
+	o, err := f.NewObject(ctx, remote)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil, fmt.Errorf("%w: %v not found", ErrorPlanChanged, fs.LogDirName(f, remote))
+	} else if err != nil {
+		return nil, err
+	}
+	if planFingerprint(ctx, o) != fingerprint {
+		return nil, fmt.Errorf("%w: %v is different", ErrorPlanChanged, fs.LogDirName(f, remote))
+	}
+	return o, nil
+}
+
+// planNoObject checks remote still doesn't exist on f
+func planNoObject(ctx context.Context, f fs.Fs, remote string) error {
+	_, err := f.NewObject(ctx, remote)
+	if err == nil {
+		return fmt.Errorf("%w: %v exists", ErrorPlanChanged, fs.LogDirName(f, remote))
+	} else if !errors.Is(err, fs.ErrorObjectNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package sync
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// planActions returns the action and path of each action in the plan
+func planActions(p *Plan) (out [][2]string) {
+	for _, action := range p.Actions {
+		out = append(out, [2]string{action.Action, action.Path})
+	}
+	return out
+}
+
+func TestPlanApply(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteBoth(ctx, "file1", "same", t1)
+	file2 := r.WriteFile("new/file2", "new", t2)
+	file3 := r.WriteFile("file3", "newer contents", t2)
+	r.WriteObject(ctx, "file3", "old contents", t1)
+	file4 := r.WriteObject(ctx, "gone/file4", "gone", t1)
+
+	p, err := MakePlan(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	assert.Equal(t, PlanVersion, p.Version)
+	assert.Equal(t, fs.ConfigString(r.Flocal), p.SrcFs)
+	assert.Equal(t, fs.ConfigString(r.Fremote), p.DstFs)
+
+	// The remotes can be made again from the plan
+	fsrc, err := fs.NewFs(ctx, p.SrcFs)
+	require.NoError(t, err)
+	assert.Equal(t, r.Flocal.Root(), fsrc.Root())
+	assert.Equal(t, [][2]string{
+		{PlanUpdate, "file3"},
+		{PlanCopy, "new/file2"},
+		{PlanDelete, "gone/file4"},
+		{PlanRmdir, "gone"},
+	}, planActions(p))
+	assert.NotEqual(t, "", p.Actions[0].Src)
+	assert.NotEqual(t, "", p.Actions[0].Dst)
+
+	// The fingerprints include the hash even though it is slow to
+	// read on the local backend
+	require.True(t, r.Flocal.Features().SlowHash)
+	assert.Contains(t, p.Actions[0].Src, file3.Hashes[r.Flocal.Hashes().GetOne()])
+
+	// Making the plan doesn't change anything
+	r.CheckRemoteItems(t, file1, fstest.NewItem("file3", "old contents", t1), file4)
+
+	// Save and load the plan
+	name := filepath.Join(t.TempDir(), "plan.json")
+	require.NoError(t, p.Save(name))
+	p, err = LoadPlan(name)
+	require.NoError(t, err)
+
+	require.NoError(t, Apply(ctx, r.Fremote, r.Flocal, p))
+	r.CheckLocalItems(t, file1, file2, file3)
+	r.CheckRemoteListing(t, []fstest.Item{file1, file2, file3}, []string{"new"})
+}
+
+func TestPlanApplyChanged(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("file1", "file1", t1)
+	r.WriteFile("file2", "file2", t1)
+	r.Mkdir(ctx, r.Fremote)
+
+	p, err := MakePlan(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	assert.Equal(t, [][2]string{
+		{PlanCopy, "file1"},
+		{PlanCopy, "file2"},
+	}, planActions(p))
+
+	// Change a file after the plan was made
+	file2 := r.WriteFile("file2", "file2 changed", t2)
+
+	err = Apply(ctx, r.Fremote, r.Flocal, p)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrorPlanChanged)
+	accounting.GlobalStats().ResetCounters()
+
+	// Only the unchanged file was copied
+	r.CheckLocalItems(t, file1, file2)
+	r.CheckRemoteItems(t, file1)
+}
+
+func TestPlanTrackRenames(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.TrackRenames = true
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("renamed", "rename me", t1)
+	r.WriteObject(ctx, "original", "rename me", t1)
+
+	p, err := MakePlan(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	require.Equal(t, [][2]string{
+		{PlanRename, "renamed"},
+	}, planActions(p))
+	assert.Equal(t, "original", p.Actions[0].From)
+
+	require.NoError(t, Apply(ctx, r.Fremote, r.Flocal, p))
+	r.CheckRemoteItems(t, file1)
+}
+
+func TestPlanBackupDir(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	ci.BackupDir = "backup"
+	r := fstest.NewRun(t)
+	_, err := MakePlan(ctx, r.Fremote, r.Flocal, false)
+	assert.ErrorContains(t, err, "--backup-dir")
+}
+
+func TestLoadPlanBadVersion(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "plan.json")
+	p := &Plan{Version: PlanVersion + 1}
+	require.NoError(t, p.Save(name))
+	_, err := LoadPlan(name)
+	assert.ErrorContains(t, err, "unsupported plan version")
+}
@@ -2,6 +2,7 @@ package sync
 
 import (
 	"context"
+	"time"
 
 	"github.com/rclone/rclone/fs/rc"
 )
@@ -13,6 +14,16 @@ func init() {
 		if name == "move" {
 			moveHelp = "- deleteEmptySrcDirs - delete empty src directories if set\n"
 		}
+		if name == "sync" {
+			moveHelp = `- watch - keep running and sync changes as they happen if set
+- watchDebounce - sync once there have been no changes for this long (default 5s)
+- watchInterval - how often to sync everything if changes can't be notified (default 1m)
+
+With watch set this doesn't return until the job is stopped so run
+it with _async set. Use [sync/watch/list](#sync-watch-list) to see
+its state.
+`
+		}
 		rc.Add(rc.Call{
 			Path:         "sync/" + name,
 			AuthRequired: true,
@@ -48,6 +59,21 @@ func rcSyncCopyMove(ctx context.Context, in rc.Params, name string) (out rc.Para
 	}
 	switch name {
 	case "sync":
+		watch, err := in.GetBool("watch")
+		if rc.NotErrParamNotFound(err) {
+			return nil, err
+		}
+		if watch {
+			opt := DefaultWatchOptions
+			opt.CreateEmptySrcDirs = createEmptySrcDirs
+			if opt.Debounce, err = getDuration(in, "watchDebounce", opt.Debounce); err != nil {
+				return nil, err
+			}
+			if opt.PollInterval, err = getDuration(in, "watchInterval", opt.PollInterval); err != nil {
+				return nil, err
+			}
+			return nil, Watch(ctx, dstFs, srcFs, opt)
+		}
 		return nil, Sync(ctx, dstFs, srcFs, createEmptySrcDirs)
 	case "copy":
 		return nil, CopyDir(ctx, dstFs, srcFs, createEmptySrcDirs)
@@ -60,3 +86,55 @@ func rcSyncCopyMove(ctx context.Context, in rc.Params, name string) (out rc.Para
 	}
 	panic("unknown rcSyncCopyMove type")
 }
+
+// getDuration reads the optional duration key from in returning def
+// if it isn't present
+func getDuration(in rc.Params, key string, def time.Duration) (time.Duration, error) {
+	d, err := in.GetDuration(key)
+	if rc.IsErrParamNotFound(err) {
+		return def, nil
+	}
+	return d, err
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:         "sync/watch/list",
+		AuthRequired: true,
+		Fn:           rcWatchList,
+		Title:        "List the running sync watches",
+		Help: `This lists the syncs started with the watch flag which are running.
+
+It returns a list under the key "watches" with an entry for each like this:
+
+    {
+        "id": 1,
+        "srcFs": "/home/user/work",
+        "dstFs": "remote:work",
+        "srcNotify": true,
+        "dstNotify": false,
+        "state": "idle",
+        "pending": 0,
+        "notified": 12,
+        "syncs": 4,
+        "fullSyncs": 1,
+        "started": "2024-01-02T15:04:05.000000000Z",
+        "lastSync": "2024-01-02T15:10:10.000000000Z",
+        "lastError": ""
+    }
+
+- srcNotify and dstNotify are set if that side notifies its changes
+- state is one of "starting", "syncing" or "idle"
+- pending is the number of changed paths waiting to be synced
+- notified is the number of changes notified so far
+- syncs is the number of syncs of changed paths
+- fullSyncs is the number of syncs of everything
+- lastError is the error from the last sync or empty if it succeeded
+`,
+	})
+}
+
+// List the running watches
+func rcWatchList(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	return rc.Params{"watches": listWatches()}, nil
+}
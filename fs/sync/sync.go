@@ -13,12 +13,16 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/fserrors"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/march"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/lib/errcount"
+	"github.com/rclone/rclone/lib/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
@@ -94,6 +98,7 @@ type syncCopyMove struct {
 	setDirModTimes         []setDirModTime        // directories that need their modtime set
 	setDirModTimesMaxLevel int                    // max level of the directories to set
 	modifiedDirs           map[string]struct{}    // dirs with changed contents (if s.setDirModTimeAfter)
+	plan                   *Plan                  // if set record the actions here
 }
 
 // For keeping track of delayed modtime sets
@@ -154,6 +159,7 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 		trackRenames:           ci.TrackRenames,
 		commonHash:             fsrc.Hashes().Overlap(fdst.Hashes()).GetOne(),
 		modifyWindow:           fs.GetModifyWindow(ctx, fsrc, fdst),
+		plan:                   getPlan(ctx),
 		trackRenamesCh:         make(chan fs.Object, ci.Checkers),
 		checkFirst:             ci.CheckFirst,
 		setDirMetadata:         ci.Metadata && fsrc.Features().ReadDirMetadata && fdst.Features().WriteDirMetadata,
@@ -394,6 +400,7 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 					s.processError(err)
 				} else {
 					fs.Infof(pair.Dst, "Fixed case by renaming to: %s", src.Remote())
+					s.plan.rename(s.ctx, pair.Dst, src.Remote())
 					pair.Dst = newDst
 				}
 			}
@@ -490,16 +497,29 @@ func (s *syncCopyMove) pairCopyOrMove(ctx context.Context, in *pipe, fdst fs.Fs,
 		}
 		src := pair.Src
 		dst := pair.Dst
+		action := "copy"
 		if s.DoMove {
-			if src != dst {
-				_, err = operations.MoveTransfer(ctx, fdst, dst, src.Remote(), src)
-			} else {
-				// src == dst signals delete the src
-				err = operations.DeleteFile(ctx, src)
+			action = "move"
+			if src == dst {
+				action = "delete"
 			}
-		} else {
-			_, err = operations.Copy(ctx, fdst, dst, src.Remote(), src)
 		}
+		tctx, span := tracing.Start(ctx, "transfer", trace.WithAttributes(
+			attribute.String("rclone.action", action),
+			attribute.String("rclone.remote", src.Remote()),
+			attribute.Int64("rclone.size", src.Size()),
+		))
+		switch action {
+		case "move":
+			_, err = operations.MoveTransfer(tctx, fdst, dst, src.Remote(), src)
+		case "delete":
+			// src == dst signals delete the src
+			err = operations.DeleteFile(tctx, src)
+		default:
+			s.plan.copy(tctx, fdst, dst, src)
+			_, err = operations.Copy(tctx, fdst, dst, src.Remote(), src)
+		}
+		tracing.End(span, err)
 		s.processError(err)
 		if err != nil {
 			s.logger(ctx, operations.TransferError, src, dst, err)
@@ -641,6 +661,7 @@ func (s *syncCopyMove) deleteFiles(checkSrcMap bool) error {
 			if s.aborting() {
 				break
 			}
+			s.plan.delete(s.ctx, o)
 			select {
 			case <-s.ctx.Done():
 				break outer
@@ -675,6 +696,9 @@ func (s *syncCopyMove) deleteEmptyDirectories(ctx context.Context, f fs.Fs, entr
 		entry := entries[i]
 		dir, ok := entry.(fs.Directory)
 		if ok {
+			if f == s.fdst {
+				s.plan.dir(PlanRmdir, dir.Remote())
+			}
 			// TryRmdir only deletes empty directories
 			err := operations.TryRmdir(ctx, f, dir.Remote())
 			if err != nil {
@@ -910,6 +934,7 @@ func (s *syncCopyMove) tryRename(src fs.Object) bool {
 	s.dstFilesMu.Unlock()
 
 	fs.Infof(src, "Renamed from %q", dst.Remote())
+	s.plan.rename(s.ctx, dst, src.Remote())
 	return true
 }
 
@@ -1052,6 +1077,7 @@ func (s *syncCopyMove) DstOnly(dst fs.DirEntry) (recurse bool) {
 			s.dstFiles[x.Remote()] = x
 			s.dstFilesMu.Unlock()
 		case fs.DeleteModeDuring, fs.DeleteModeOnly:
+			s.plan.delete(s.ctx, x)
 			select {
 			case <-s.ctx.Done():
 				return
@@ -1259,6 +1285,9 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 		s.logger(s.ctx, operations.MissingOnDst, src, nil, fs.ErrorIsDir)
 
 		// Create the directory and make sure the Metadata/ModTime is correct
+		if s.copyEmptySrcDirs {
+			s.plan.dir(PlanMkdir, x.Remote())
+		}
 		s.copyDirMetadata(s.ctx, s.fdst, nil, x.Remote(), x)
 		s.markDirModified(x.Remote())
 		return true
@@ -1332,8 +1361,16 @@ func (s *syncCopyMove) Match(ctx context.Context, dst, src fs.DirEntry) (recurse
 // If DoMove is true then files will be moved instead of copied.
 //
 // dir is the start directory, "" for root
-func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool, copyEmptySrcDirs bool) error {
+func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool, copyEmptySrcDirs bool) (err error) {
 	ci := fs.GetConfig(ctx)
+	ctx, span := tracing.Start(ctx, "sync", trace.WithAttributes(
+		attribute.String("rclone.src", fs.ConfigString(fsrc)),
+		attribute.String("rclone.dst", fs.ConfigString(fdst)),
+		attribute.Bool("rclone.move", DoMove),
+	))
+	defer func() {
+		tracing.End(span, err)
+	}()
 	if deleteMode != fs.DeleteModeOff && DoMove {
 		return fserrors.FatalError(errors.New("can't delete and move at the same time"))
 	}
@@ -1397,6 +1434,7 @@ func MoveDir(ctx context.Context, fdst, fsrc fs.Fs, deleteEmptySrcDirs bool, cop
 			fs.Infof(fdst, "Server side directory move failed - fallback to file moves: %v", err)
 		case nil:
 			fs.Infof(fdst, "Server side directory move succeeded")
+			audit.Dir(ctx, audit.OpMove, fdst, "", fsrc, "")
 			return nil
 		default:
 			err = fs.CountError(ctx, err)
@@ -1381,6 +1381,33 @@ func TestSyncWithExclude(t *testing.T) {
 	r.CheckLocalItems(t, file2, file1, file3)
 }
 
+// Test with per directory ignore files
+func TestSyncWithIgnoreFile(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	ignore := r.WriteFile(".rcloneignore", "*.log\nbuild/\n", t1)
+	file1 := r.WriteFile("file1.txt", "file1", t1)
+	r.WriteFile("file2.log", "file2", t1)
+	r.WriteFile("build/file3", "file3", t1)
+	subIgnore := r.WriteFile("sub/.rcloneignore", "!keep.log\n", t1)
+	file4 := r.WriteFile("sub/keep.log", "file4", t1)
+	r.WriteFile("sub/file5.log", "file5", t1)
+	// These are ignored by the source's ignore files so mustn't be
+	// deleted even though the destination has no ignore files yet
+	file6 := r.WriteObject(ctx, "file6.log", "file6", t1)
+	file7 := r.WriteObject(ctx, "build/file7", "file7", t1)
+
+	fi, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	fi.Opt.IgnoreFile = []string{".rcloneignore"}
+	ctx = filter.ReplaceConfig(ctx, fi)
+
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, r.Fremote, r.Flocal, false)
+	require.NoError(t, err)
+	r.CheckRemoteItems(t, ignore, file1, subIgnore, file4, file6, file7)
+}
+
 // Test with exclude and delete excluded
 func TestSyncWithExcludeAndDeleteExcluded(t *testing.T) {
 	ctx := context.Background()
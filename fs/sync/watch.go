@@ -0,0 +1,403 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/fserrors"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// WatchOptions configures Watch
+type WatchOptions struct {
+	Debounce           time.Duration // sync once there have been no changes for this long
+	PollInterval       time.Duration // passed to ChangeNotify and how often to sync everything without it
+	CreateEmptySrcDirs bool          // create empty src directories on destination
+}
+
+// DefaultWatchOptions are the defaults for WatchOptions
+var DefaultWatchOptions = WatchOptions{
+	Debounce:     5 * time.Second,
+	PollInterval: time.Minute,
+}
+
+// Watcher states
+const (
+	watchStarting = "starting"
+	watchSyncing  = "syncing"
+	watchIdle     = "idle"
+)
+
+// watcher keeps a destination in sync with a source
+type watcher struct {
+	id   int64
+	fdst fs.Fs
+	fsrc fs.Fs
+	opt  WatchOptions
+	kick chan struct{} // sent to when a change is notified
+
+	mu        sync.Mutex
+	changes   map[string]fs.EntryType // changed paths waiting to be synced
+	srcNotify bool                    // set if the source notifies changes
+	dstNotify bool                    // set if the destination notifies changes
+	needFull  bool                    // set if everything needs syncing
+	state     string                  // what the watcher is doing
+	started   time.Time               // when the watcher started
+	lastSync  time.Time               // when the last sync finished
+	lastErr   error                   // error from the last sync
+	notified  int64                   // number of changes notified
+	syncs     int64                   // number of syncs of changes
+	fullSyncs int64                   // number of syncs of everything
+}
+
+// The active watchers for the rc
+var watches = struct {
+	mu     sync.Mutex
+	lastID int64
+	active map[int64]*watcher
+}{
+	active: make(map[int64]*watcher),
+}
+
+// Watch syncs fsrc to fdst then keeps running, syncing the changes
+// made to either until ctx is cancelled.
+//
+// Changes are found with ChangeNotify where the backends support it
+// and only the changed paths are synced. Changes are synced once
+// there have been none for opt.Debounce. If the source can't notify
+// changes then everything is synced every opt.PollInterval.
+func Watch(ctx context.Context, fdst, fsrc fs.Fs, opt WatchOptions) error {
+	if opt.PollInterval <= 0 {
+		return errors.New("watch poll interval must be greater than 0")
+	}
+	w := &watcher{
+		fdst:     fdst,
+		fsrc:     fsrc,
+		opt:      opt,
+		kick:     make(chan struct{}, 1),
+		changes:  make(map[string]fs.EntryType),
+		needFull: true,
+		state:    watchStarting,
+		started:  time.Now(),
+	}
+	watches.mu.Lock()
+	watches.lastID++
+	w.id = watches.lastID
+	watches.active[w.id] = w
+	watches.mu.Unlock()
+	defer func() {
+		watches.mu.Lock()
+		delete(watches.active, w.id)
+		watches.mu.Unlock()
+	}()
+
+	// Start watching before the first sync so no changes are missed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w.srcNotify = w.startNotify(ctx, fsrc)
+	w.dstNotify = w.startNotify(ctx, fdst)
+	if !w.srcNotify {
+		fs.Infof(fsrc, "Changes aren't notified - syncing everything every %v", opt.PollInterval)
+	}
+	return w.run(ctx)
+}
+
+// startNotify starts ChangeNotify on f if it is supported, returning
+// whether it was. It stops when ctx is cancelled.
+func (w *watcher) startNotify(ctx context.Context, f fs.Fs) bool {
+	doChangeNotify := f.Features().ChangeNotify
+	if doChangeNotify == nil {
+		return false
+	}
+	pollInterval := make(chan time.Duration, 1)
+	pollInterval <- w.opt.PollInterval
+	doChangeNotify(ctx, w.notify, pollInterval)
+	go func() {
+		<-ctx.Done()
+		close(pollInterval)
+	}()
+	return true
+}
+
+// notify is called by ChangeNotify with a changed path
+func (w *watcher) notify(remote string, entryType fs.EntryType) {
+	w.mu.Lock()
+	// A changed directory covers a changed object
+	if old, found := w.changes[remote]; !found || old != fs.EntryDirectory {
+		w.changes[remote] = entryType
+	}
+	w.notified++
+	w.mu.Unlock()
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+// takeChanges returns the changes waiting to be synced and clears them
+func (w *watcher) takeChanges() map[string]fs.EntryType {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	changes := w.changes
+	w.changes = make(map[string]fs.EntryType)
+	return changes
+}
+
+// run the sync loop until ctx is cancelled
+func (w *watcher) run(ctx context.Context) error {
+	ticker := time.NewTicker(w.opt.PollInterval)
+	defer ticker.Stop()
+	full := true
+	for {
+		w.setState(watchSyncing)
+		// Errors from previous syncs mustn't stop this one deleting
+		accounting.Stats(ctx).ResetErrors()
+		var err error
+		if full {
+			// Changes made from now on are found by the next sync
+			w.takeChanges()
+			err = Sync(ctx, w.fdst, w.fsrc, w.opt.CreateEmptySrcDirs)
+		} else {
+			err = w.syncChanges(ctx, w.takeChanges())
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if full && fserrors.IsFatalError(err) {
+			return err
+		}
+		w.finished(full, err)
+		var ok bool
+		full, ok = w.wait(ctx, ticker.C)
+		if !ok {
+			return nil
+		}
+	}
+}
+
+// finished records the result of a sync
+func (w *watcher) finished(full bool, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state = watchIdle
+	w.lastSync = time.Now()
+	w.lastErr = err
+	if full {
+		w.fullSyncs++
+		w.needFull = false
+	} else {
+		w.syncs++
+	}
+	if err != nil {
+		// We don't know what was missed so sync everything next time
+		w.needFull = true
+		fs.Errorf(w.fdst, "Watch: sync failed - will sync everything in %v: %v", w.opt.PollInterval, err)
+	}
+}
+
+// setState sets the state of the watcher
+func (w *watcher) setState(state string) {
+	w.mu.Lock()
+	w.state = state
+	w.mu.Unlock()
+}
+
+// wait until there is something to sync, returning whether
+// everything should be synced. It returns false for ok if ctx was
+// cancelled.
+func (w *watcher) wait(ctx context.Context, tick <-chan time.Time) (full bool, ok bool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return false, false
+		case <-tick:
+			w.mu.Lock()
+			full = w.needFull || !w.srcNotify
+			w.mu.Unlock()
+			if full {
+				return true, true
+			}
+		case <-w.kick:
+			return false, w.debounce(ctx)
+		}
+	}
+}
+
+// debounce waits until no changes have been notified for the debounce
+// time, or for at most the poll interval, returning false if ctx was
+// cancelled.
+func (w *watcher) debounce(ctx context.Context) bool {
+	timer := time.NewTimer(w.opt.Debounce)
+	defer timer.Stop()
+	deadline := time.NewTimer(max(w.opt.Debounce, w.opt.PollInterval))
+	defer deadline.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-w.kick:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(w.opt.Debounce)
+		case <-timer.C:
+			return true
+		case <-deadline.C:
+			return true
+		}
+	}
+}
+
+// syncChanges syncs only the changed paths.
+//
+// The files in changed directories are found by listing them on both
+// sides. The sync itself is run with the changed files as a
+// --files-from list so only they are checked.
+func (w *watcher) syncChanges(ctx context.Context, changes map[string]fs.EntryType) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if entryType, found := changes[""]; found && entryType == fs.EntryDirectory {
+		fs.Infof(w.fdst, "Watch: root changed - syncing everything")
+		return Sync(ctx, w.fdst, w.fsrc, w.opt.CreateEmptySrcDirs)
+	}
+	fi := filter.GetConfig(ctx)
+	files := make(map[string]struct{})
+	srcDirs := make(map[string]struct{})
+	dstDirs := make(map[string]struct{})
+	for remote, entryType := range changes {
+		if entryType == fs.EntryDirectory {
+			if err := listChanged(ctx, w.fsrc, remote, files, srcDirs); err != nil {
+				return fmt.Errorf("failed to list changed source directory %q: %w", remote, err)
+			}
+			if err := listChanged(ctx, w.fdst, remote, files, dstDirs); err != nil {
+				return fmt.Errorf("failed to list changed destination directory %q: %w", remote, err)
+			}
+		} else if w.includeFile(ctx, fi, remote) {
+			files[remote] = struct{}{}
+		}
+	}
+	if w.opt.CreateEmptySrcDirs {
+		for dir := range srcDirs {
+			if _, found := dstDirs[dir]; found {
+				continue
+			}
+			if err := operations.Mkdir(ctx, w.fdst, dir); err != nil {
+				return err
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+
+	// Sync only the changed files, keeping the other filter options
+	opt := fi.Opt
+	opt.FilesFrom = nil
+	opt.FilesFromRaw = nil
+	newFi, err := filter.NewFilter(&opt)
+	if err != nil {
+		return err
+	}
+	for remote := range files {
+		if err := newFi.AddFile(remote); err != nil {
+			return err
+		}
+	}
+	fs.Infof(w.fdst, "Watch: syncing %d changed files", len(files))
+	return Sync(filter.ReplaceConfig(ctx, newFi), w.fdst, w.fsrc, w.opt.CreateEmptySrcDirs)
+}
+
+// includeFile returns whether the changed file remote is included by
+// the filters
+func (w *watcher) includeFile(ctx context.Context, fi *filter.Filter, remote string) bool {
+	if !fi.IncludeRemote(remote) {
+		return false
+	}
+	if fi.InActive() {
+		return true
+	}
+	// Check the size, age and metadata filters if the file exists
+	o, err := w.fsrc.NewObject(ctx, remote)
+	if err != nil {
+		return true
+	}
+	return fi.IncludeObject(ctx, o)
+}
+
+// listChanged adds the files in the changed directory dir on f to
+// files and the directories, including dir, to dirs. It is not an
+// error if dir doesn't exist.
+func listChanged(ctx context.Context, f fs.Fs, dir string, files, dirs map[string]struct{}) error {
+	return walk.Walk(ctx, f, dir, false, -1, func(path string, entries fs.DirEntries, err error) error {
+		if err != nil {
+			if path == dir && errors.Is(err, fs.ErrorDirNotFound) {
+				// The directory has gone so there is nothing to add
+				return nil
+			}
+			return err
+		}
+		dirs[path] = struct{}{}
+		for _, entry := range entries {
+			if o, ok := entry.(fs.Object); ok {
+				files[o.Remote()] = struct{}{}
+			}
+		}
+		return nil
+	})
+}
+
+// status returns the state of the watcher for the rc
+func (w *watcher) status() rc.Params {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	lastError := ""
+	if w.lastErr != nil {
+		lastError = w.lastErr.Error()
+	}
+	return rc.Params{
+		"id":        w.id,
+		"srcFs":     fs.ConfigString(w.fsrc),
+		"dstFs":     fs.ConfigString(w.fdst),
+		"srcNotify": w.srcNotify,
+		"dstNotify": w.dstNotify,
+		"state":     w.state,
+		"pending":   len(w.changes),
+		"notified":  w.notified,
+		"syncs":     w.syncs,
+		"fullSyncs": w.fullSyncs,
+		"started":   w.started,
+		"lastSync":  w.lastSync,
+		"lastError": lastError,
+	}
+}
+
+// listWatches returns the status of the active watchers in id order
+func listWatches() []rc.Params {
+	watches.mu.Lock()
+	active := make([]*watcher, 0, len(watches.active))
+	for _, w := range watches.active {
+		active = append(active, w)
+	}
+	watches.mu.Unlock()
+	sort.Slice(active, func(i, j int) bool {
+		return active[i].id < active[j].id
+	})
+	out := make([]rc.Params, 0, len(active))
+	for _, w := range active {
+		out = append(out, w.status())
+	}
+	return out
+}
@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchSyncChanges(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteBoth(ctx, "file1", "file1 contents", t1)
+	file2 := r.WriteFile("file2", "file2 contents", t2)
+	file3 := r.WriteFile("dir/file3", "file3 contents", t2)
+	other := r.WriteFile("other", "not changed", t2)
+	r.WriteObject(ctx, "dir/file4", "file4 contents", t3)
+
+	w := &watcher{
+		fdst:    r.Fremote,
+		fsrc:    r.Flocal,
+		opt:     DefaultWatchOptions,
+		changes: make(map[string]fs.EntryType),
+	}
+	err := w.syncChanges(ctx, map[string]fs.EntryType{
+		"file2": fs.EntryObject,
+		"dir":   fs.EntryDirectory,
+	})
+	require.NoError(t, err)
+
+	// Only the changed paths are synced
+	r.CheckLocalItems(t, file1, file2, file3, other)
+	r.CheckRemoteItems(t, file1, file2, file3)
+}
+
+func TestWatchSyncChangesNothing(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	r.Mkdir(ctx, r.Fremote)
+
+	w := &watcher{
+		fdst: r.Fremote,
+		fsrc: r.Flocal,
+		opt:  DefaultWatchOptions,
+	}
+	require.NoError(t, w.syncChanges(ctx, nil))
+	// A changed directory which doesn't exist on either side is OK
+	require.NoError(t, w.syncChanges(ctx, map[string]fs.EntryType{
+		"missing": fs.EntryDirectory,
+	}))
+
+	r.CheckLocalItems(t, file1)
+	r.CheckRemoteItems(t)
+}
+
+func TestWatch(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping test on non local remote")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := fstest.NewRun(t)
+	file1 := r.WriteFile("file1", "file1 contents", t1)
+	r.Mkdir(ctx, r.Fremote)
+
+	errs := make(chan error)
+	go func() {
+		errs <- Watch(ctx, r.Fremote, r.Flocal, WatchOptions{
+			Debounce:     10 * time.Millisecond,
+			PollInterval: 100 * time.Millisecond,
+		})
+	}()
+	exists := func(remote string) func() bool {
+		return func() bool {
+			_, err := r.Fremote.NewObject(ctx, remote)
+			return err == nil
+		}
+	}
+
+	// The first sync copies everything
+	assert.Eventually(t, exists("file1"), 5*time.Second, 10*time.Millisecond)
+
+	// Then changes are synced
+	file2 := r.WriteFile("dir/file2", "file2 contents", t2)
+	assert.Eventually(t, exists("dir/file2"), 5*time.Second, 10*time.Millisecond)
+
+	// The watch is listed while running
+	watches := listWatches()
+	require.Equal(t, 1, len(watches))
+	assert.Equal(t, fs.ConfigString(r.Flocal), watches[0]["srcFs"])
+	assert.Equal(t, fs.ConfigString(r.Fremote), watches[0]["dstFs"])
+	assert.GreaterOrEqual(t, watches[0]["fullSyncs"], int64(1))
+
+	cancel()
+	require.NoError(t, <-errs)
+	assert.Equal(t, 0, len(listWatches()))
+	r.CheckRemoteItems(t, file1, file2)
+}
+
+func TestWatchBadInterval(t *testing.T) {
+	r := fstest.NewRun(t)
+	err := Watch(context.Background(), r.Fremote, r.Flocal, WatchOptions{})
+	assert.ErrorContains(t, err, "poll interval")
+}
+
+// sync/watch/list: list the running watches
+func TestRcWatchList(t *testing.T) {
+	_, call := rcNewRun(t, "sync/watch/list")
+	out, err := call.Fn(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"watches": []rc.Params{}}, out)
+}
@@ -210,6 +210,15 @@ type SetMetadataer interface {
 	SetMetadata(ctx context.Context, metadata Metadata) error
 }
 
+// RangeWriter is an optional interface for Object
+type RangeWriter interface {
+	// WriteRange overwrites the object's data at offset with p.
+	//
+	// It must not change the size or the modification time of
+	// the object, so p must lie entirely within the object.
+	WriteRange(ctx context.Context, p []byte, offset int64) error
+}
+
 // SetModTimer is an optional interface for Directory.
 //
 // Object implements this as part of its requires set of interfaces.
@@ -313,6 +322,9 @@ type ListRCallback func(entries DirEntries) error
 // ListRFn is defines the call used to recursively list a directory
 type ListRFn func(ctx context.Context, dir string, callback ListRCallback) error
 
+// ListPFn is defines the call used to list a directory in tranches
+type ListPFn func(ctx context.Context, dir string, callback ListRCallback) error
+
 // Flagger describes the interface rclone config types flags must satisfy
 type Flagger interface {
 	// These are from pflag.Value which we don't want to pull in here
@@ -20,6 +20,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -129,6 +130,16 @@ func objsToNames(objs []fs.Object) []string {
 	return names
 }
 
+// entriesToNames returns a sorted list of directory entry names
+func entriesToNames(entries fs.DirEntries) []string {
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, fstest.Normalize(entry.Remote()))
+	}
+	sort.Strings(names)
+	return names
+}
+
 // retry f() until no retriable error
 func retry(t *testing.T, what string, f func() error) {
 	const maxTries = 10
@@ -876,6 +887,7 @@ func Run(t *testing.T, opt *Opt) {
 			require.NoError(t, err)
 
 			pollInterval := make(chan time.Duration)
+			var changesMu sync.Mutex
 			dirChanges := map[string]struct{}{}
 			objChanges := map[string]struct{}{}
 			doChangeNotify(ctx, func(x string, e fs.EntryType) {
@@ -884,6 +896,8 @@ func Run(t *testing.T, opt *Opt) {
 					fs.Debugf(nil, "Ignoring notify for file1 or file2: %q, %v", x, e)
 					return
 				}
+				changesMu.Lock()
+				defer changesMu.Unlock()
 				if e == fs.EntryDirectory {
 					dirChanges[x] = struct{}{}
 				} else if e == fs.EntryObject {
@@ -914,6 +928,8 @@ func Run(t *testing.T, opt *Opt) {
 			// Looks for each item in wants in changes -
 			// if they are all found it returns true
 			contains := func(changes map[string]struct{}, wants []string) bool {
+				changesMu.Lock()
+				defer changesMu.Unlock()
 				for _, want := range wants {
 					_, ok := changes[want]
 					if !ok {
@@ -936,7 +952,9 @@ func Run(t *testing.T, opt *Opt) {
 				time.Sleep(3 * time.Second)
 			}
 			if !ok {
+				changesMu.Lock()
 				t.Errorf("%+v does not contain %+v or \n%+v does not contain %+v", dirChanges, wantDirChanges, objChanges, wantObjChanges)
+				changesMu.Unlock()
 			}
 
 			// tidy up afterwards
@@ -1105,6 +1123,32 @@ func Run(t *testing.T, opt *Opt) {
 				TestFsListLevel2(t)
 			})
 
+			// TestFsListP tests ListP returns the same entries as List
+			t.Run("FsListP", func(t *testing.T) {
+				skipIfNotOk(t)
+				doListP := f.Features().ListP
+				if doListP == nil {
+					t.Skip("FS has no ListP interface")
+				}
+				for _, dir := range []string{"", path.Dir(file2.Path)} {
+					want, err := f.List(ctx, dir)
+					require.NoError(t, err)
+					var got fs.DirEntries
+					err = doListP(ctx, dir, func(entries fs.DirEntries) error {
+						got = append(got, entries...)
+						return nil
+					})
+					require.NoError(t, err)
+					assert.Equal(t, entriesToNames(want), entriesToNames(got), dir)
+				}
+				err := doListP(ctx, "does not exist", func(entries fs.DirEntries) error {
+					return nil
+				})
+				if f.Features().CanHaveEmptyDirectories {
+					assert.ErrorIs(t, err, fs.ErrorDirNotFound)
+				}
+			})
+
 			// TestFsListFile1 tests file present
 			t.Run("FsListFile1", func(t *testing.T) {
 				skipIfNotOk(t)
@@ -199,27 +199,7 @@ func encryptFilesOnExit() {
 }
 
 func cleanShardFolderOnExit() error {
-	shardPath := filepath.Join(dis_operations.GetRcloneDirPath(), "shard")
-
-	entries, err := os.ReadDir(shardPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Folder doesn't exist, nothing to clean
-			return nil
-		}
-		return fmt.Errorf("failed to read shard folder: %w", err)
-	}
-
-	for _, entry := range entries {
-		if !entry.IsDir() {
-			fullPath := filepath.Join(shardPath, entry.Name())
-			if err := os.Remove(fullPath); err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
+	return dis_operations.CleanStaging()
 }
 
 func showMainGUIContent(w fyne.Window) {
@@ -246,6 +226,10 @@ func showMainGUIContent(w fyne.Window) {
 
 	modeSelect, sourceEntry, fileSelectButton, loadBalancerSelect, targetEntry, destinationEntry, destinationSelectButton := createInputFields(w)
 
+	remotesButton := widget.NewButtonWithIcon("Remotes", theme.SettingsIcon(), func() {
+		showRemotesWindow(fyne.CurrentApp())
+	})
+
 	startButton := widget.NewButton("Run", func() {
 		handleRunButton(
 			modeSelect, sourceEntry, loadBalancerSelect, targetEntry, destinationEntry,
@@ -259,6 +243,7 @@ func showMainGUIContent(w fyne.Window) {
 	modeSelect.OnChanged(modeSelect.Selected)
 
 	content := container.NewVBox(
+		remotesButton,
 		scrollableFileList,
 		modeSelect,
 		sourceEntry,
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/dis_operations"
+)
+
+// configOption is the subset of fs.Option returned by the config rc calls
+type configOption struct {
+	Name       string
+	Help       string
+	DefaultStr string
+	Type       string
+	Required   bool
+	IsPassword bool
+	Exclusive  bool
+	Examples   []struct {
+		Value string
+		Help  string
+	}
+}
+
+// configProvider is the subset of fs.RegInfo returned by config/providers
+type configProvider struct {
+	Name        string
+	Description string
+}
+
+// configOut is the question returned by a non interactive config/create
+// or config/update call
+type configOut struct {
+	State  string
+	Option *configOption
+	Error  string
+	Result string
+}
+
+// remoteUsage is the reply of operations/about
+type remoteUsage struct {
+	Total *int64 `json:"total"`
+	Used  *int64 `json:"used"`
+	Free  *int64 `json:"free"`
+}
+
+// rcCall runs the rc command path in a loopback rclone process and
+// decodes the JSON reply into out (if not nil)
+func rcCall(path string, in map[string]interface{}, out interface{}) error {
+	input, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("rclone", "rc", "--loopback", path, "--json", string(input))
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w\n%s", path, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if out == nil || len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(stdout.Bytes(), out); err != nil {
+		return fmt.Errorf("%s: failed to decode reply: %w", path, err)
+	}
+	return nil
+}
+
+func listRemoteNames() ([]string, error) {
+	var out struct {
+		Remotes []string `json:"remotes"`
+	}
+	if err := rcCall("config/listremotes", map[string]interface{}{}, &out); err != nil {
+		return nil, err
+	}
+	sort.Strings(out.Remotes)
+	return out.Remotes, nil
+}
+
+func listProviders() ([]configProvider, error) {
+	var out struct {
+		Providers []configProvider `json:"providers"`
+	}
+	if err := rcCall("config/providers", map[string]interface{}{}, &out); err != nil {
+		return nil, err
+	}
+	sort.Slice(out.Providers, func(i, j int) bool {
+		return out.Providers[i].Name < out.Providers[j].Name
+	})
+	return out.Providers, nil
+}
+
+func getRemoteUsage(name string) (remoteUsage, error) {
+	var usage remoteUsage
+	err := rcCall("operations/about", map[string]interface{}{"fs": name + ":"}, &usage)
+	return usage, err
+}
+
+// testRemote checks the remote is reachable by listing its root
+func testRemote(name string) error {
+	return rcCall("operations/list", map[string]interface{}{"fs": name + ":", "remote": ""}, nil)
+}
+
+func formatUsage(usage remoteUsage) string {
+	value := func(v *int64) string {
+		if v == nil {
+			return "-"
+		}
+		return formatBytes(*v)
+	}
+	return fmt.Sprintf("Used %s / Total %s (Free %s)", value(usage.Used), value(usage.Total), value(usage.Free))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// showRemotesWindow opens the remote configuration and management screen
+func showRemotesWindow(a fyne.App) {
+	w := a.NewWindow("Remotes")
+	w.Resize(fyne.NewSize(600, 500))
+
+	remoteListContainer := container.NewVBox()
+	scrollableRemoteList := container.NewVScroll(remoteListContainer)
+	scrollableRemoteList.SetMinSize(fyne.NewSize(580, 400))
+
+	var refresh func()
+	refresh = func() {
+		refreshRemoteList(remoteListContainer, w, refresh)
+	}
+
+	addButton := widget.NewButtonWithIcon("Add Remote", theme.ContentAddIcon(), func() {
+		showAddRemoteDialog(w, refresh)
+	})
+	refreshButton := widget.NewButtonWithIcon("Refresh", theme.ViewRefreshIcon(), refresh)
+
+	w.SetContent(container.NewBorder(
+		container.NewHBox(addButton, refreshButton), nil, nil, nil,
+		scrollableRemoteList,
+	))
+	w.Show()
+	refresh()
+}
+
+func refreshRemoteList(remoteListContainer *fyne.Container, w fyne.Window, refresh func()) {
+	remoteListContainer.Objects = nil
+	remoteListContainer.Add(widget.NewProgressBarInfinite())
+	remoteListContainer.Refresh()
+
+	go func() {
+		names, err := listRemoteNames()
+		remoteListContainer.Objects = nil
+		if err != nil {
+			remoteListContainer.Add(widget.NewLabel(fmt.Sprintf("❌ Failed to load remotes:\n%s", err)))
+			remoteListContainer.Refresh()
+			return
+		}
+		if len(names) == 0 {
+			remoteListContainer.Add(widget.NewLabel("No remotes configured yet. Use \"Add Remote\" to create one."))
+		}
+
+		for _, name := range names {
+			remoteListContainer.Add(newRemoteRow(name, w, refresh))
+		}
+		remoteListContainer.Refresh()
+	}()
+}
+
+func newRemoteRow(name string, w fyne.Window, refresh func()) fyne.CanvasObject {
+	usageLabel := widget.NewLabel("Usage: loading...")
+	go func() {
+		usage, err := getRemoteUsage(name)
+		if err != nil {
+			usageLabel.SetText("Usage: not available")
+			return
+		}
+		usageLabel.SetText(formatUsage(usage))
+	}()
+
+	enabledCheck := widget.NewCheck("Use for distribution", func(enabled bool) {
+		if err := dis_operations.SetRemoteEnabled(name, enabled); err != nil {
+			dialog.ShowError(err, w)
+		}
+	})
+	enabledCheck.SetChecked(dis_operations.IsRemoteEnabled(name))
+
+	testButton := widget.NewButtonWithIcon("", theme.MediaPlayIcon(), func() {
+		progress := dialog.NewCustomWithoutButtons("Testing "+name, widget.NewProgressBarInfinite(), w)
+		progress.Show()
+		go func() {
+			err := testRemote(name)
+			progress.Hide()
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("connection to %q failed: %w", name, err), w)
+				return
+			}
+			dialog.ShowInformation("Test Remote", fmt.Sprintf("🟢 Connection to %q is working.", name), w)
+		}()
+	})
+
+	editButton := widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), func() {
+		runConfigQuestions(w, "config/update", map[string]interface{}{
+			"name":       name,
+			"parameters": map[string]interface{}{},
+		}, name, refresh)
+	})
+
+	deleteButton := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+		dialog.ShowConfirm("Delete Remote", fmt.Sprintf("Delete remote '%s' from the config?\nShards stored on it will not be removed.", name), func(confirm bool) {
+			if !confirm {
+				return
+			}
+			if err := rcCall("config/delete", map[string]interface{}{"name": name}, nil); err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			refresh()
+		}, w)
+	})
+
+	title := widget.NewLabelWithStyle(name, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	buttons := container.NewHBox(enabledCheck, testButton, editButton, deleteButton)
+	return container.NewVBox(
+		container.NewBorder(nil, nil, title, buttons),
+		usageLabel,
+		widget.NewSeparator(),
+	)
+}
+
+func showAddRemoteDialog(w fyne.Window, refresh func()) {
+	providers, err := listProviders()
+	if err != nil {
+		dialog.ShowError(err, w)
+		return
+	}
+
+	descriptions := make([]string, 0, len(providers))
+	types := make(map[string]string, len(providers))
+	for _, provider := range providers {
+		description := fmt.Sprintf("%s (%s)", provider.Description, provider.Name)
+		descriptions = append(descriptions, description)
+		types[description] = provider.Name
+	}
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetPlaceHolder("Enter name for new remote")
+	typeSelect := widget.NewSelect(descriptions, nil)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Name", nameEntry),
+		widget.NewFormItem("Storage", typeSelect),
+	}
+	dialog.ShowForm("Add Remote", "Next", "Cancel", items, func(confirm bool) {
+		if !confirm {
+			return
+		}
+		name := strings.TrimSpace(nameEntry.Text)
+		remoteType := types[typeSelect.Selected]
+		if name == "" || remoteType == "" {
+			dialog.ShowError(fmt.Errorf("enter a name and choose a storage type"), w)
+			return
+		}
+		runConfigQuestions(w, "config/create", map[string]interface{}{
+			"name":       name,
+			"type":       remoteType,
+			"parameters": map[string]interface{}{},
+		}, name, refresh)
+	}, w)
+}
+
+// runConfigQuestions drives the config state machine of a remote.
+//
+// The first call is made to path with in, every question returned is
+// shown to the user and answered with config/update until the state
+// machine finishes. Answering yes to the "Use web browser" question
+// starts the OAuth flow in the rclone process, which opens the browser
+// and waits for the token on its local webserver.
+func runConfigQuestions(w fyne.Window, path string, in map[string]interface{}, name string, done func()) {
+	in["opt"] = map[string]interface{}{
+		"nonInteractive": true,
+		"all":            true,
+	}
+
+	progress := dialog.NewCustomWithoutButtons("Configuring "+name, widget.NewProgressBarInfinite(), w)
+	progress.Show()
+
+	go func() {
+		var out configOut
+		err := rcCall(path, in, &out)
+		progress.Hide()
+		if err != nil {
+			dialog.ShowError(err, w)
+			done()
+			return
+		}
+		showConfigQuestion(w, name, out, done)
+	}()
+}
+
+func showConfigQuestion(w fyne.Window, name string, out configOut, done func()) {
+	if out.State == "" {
+		if out.Error != "" {
+			dialog.ShowError(fmt.Errorf("%s", out.Error), w)
+		}
+		done()
+		return
+	}
+
+	if out.Option == nil {
+		// Nothing to ask, only an error to show before continuing
+		if out.Error != "" {
+			dialog.ShowError(fmt.Errorf("%s", out.Error), w)
+		}
+		continueConfig(w, name, out.State, out.Result, done)
+		return
+	}
+
+	option := out.Option
+	input, getResult := newOptionInput(option)
+
+	help := option.Help
+	if out.Error != "" {
+		help = "❌ " + out.Error + "\n\n" + help
+	}
+	helpLabel := widget.NewLabel(help)
+	helpLabel.Wrapping = fyne.TextWrapWord
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("", helpLabel),
+		widget.NewFormItem(option.Name, input),
+	}
+	form := dialog.NewForm("Configure "+name, "Next", "Cancel", items, func(confirm bool) {
+		if !confirm {
+			done()
+			return
+		}
+		result := getResult()
+		if option.Required && result == "" && option.DefaultStr == "" {
+			dialog.ShowError(fmt.Errorf("a value for %q is required", option.Name), w)
+			showConfigQuestion(w, name, out, done)
+			return
+		}
+		if option.IsPassword && result != "" {
+			result = obscure.MustObscure(result)
+		}
+		continueConfig(w, name, out.State, result, done)
+	}, w)
+	form.Resize(fyne.NewSize(500, 300))
+	form.Show()
+}
+
+// continueConfig answers the current question and shows the next one
+func continueConfig(w fyne.Window, name, state, result string, done func()) {
+	progress := dialog.NewCustomWithoutButtons("Configuring "+name, widget.NewProgressBarInfinite(), w)
+	progress.Show()
+
+	go func() {
+		var out configOut
+		err := rcCall("config/update", map[string]interface{}{
+			"name":       name,
+			"parameters": map[string]interface{}{},
+			"opt": map[string]interface{}{
+				"nonInteractive": true,
+				"continue":       true,
+				"state":          state,
+				"result":         result,
+			},
+		}, &out)
+		progress.Hide()
+		if err != nil {
+			dialog.ShowError(err, w)
+			done()
+			return
+		}
+		showConfigQuestion(w, name, out, done)
+	}()
+}
+
+// newOptionInput makes the widget used to answer a config question and
+// a function returning its value as the string the config expects
+func newOptionInput(option *configOption) (fyne.CanvasObject, func() string) {
+	if option.Type == "bool" {
+		check := widget.NewCheck("", nil)
+		check.SetChecked(option.DefaultStr == "true")
+		return check, func() string {
+			if check.Checked {
+				return "true"
+			}
+			return "false"
+		}
+	}
+
+	if option.IsPassword {
+		entry := widget.NewPasswordEntry()
+		return entry, func() string {
+			return entry.Text
+		}
+	}
+
+	if len(option.Examples) > 0 {
+		values := make([]string, 0, len(option.Examples))
+		labels := make(map[string]string, len(option.Examples))
+		for _, example := range option.Examples {
+			label := example.Value
+			if example.Help != "" {
+				label = fmt.Sprintf("%s - %s", example.Value, strings.SplitN(example.Help, "\n", 2)[0])
+			}
+			values = append(values, label)
+			labels[label] = example.Value
+		}
+		value := func(text string) string {
+			if v, ok := labels[text]; ok {
+				return v
+			}
+			return text
+		}
+
+		if option.Exclusive {
+			selectInput := widget.NewSelect(values, nil)
+			for label, v := range labels {
+				if v == option.DefaultStr {
+					selectInput.SetSelected(label)
+				}
+			}
+			return selectInput, func() string {
+				return value(selectInput.Selected)
+			}
+		}
+
+		selectEntry := widget.NewSelectEntry(values)
+		selectEntry.SetText(option.DefaultStr)
+		return selectEntry, func() string {
+			return value(selectEntry.Text)
+		}
+	}
+
+	entry := widget.NewEntry()
+	entry.SetText(option.DefaultStr)
+	return entry, func() string {
+		return entry.Text
+	}
+}
@@ -38,6 +38,7 @@ type Directory struct {
 	Breadcrumb   []Crumb
 	Sort         string
 	Order        string
+	Writable     bool // show the controls to upload, make directories and delete
 }
 
 // Crumb is a breadcrumb entry
@@ -18,6 +18,9 @@ import (
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/lib/readers"
+	"github.com/rclone/rclone/lib/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Client contains the info to sustain the API
@@ -238,6 +241,16 @@ func (api *Client) Call(ctx context.Context, opts *Opts) (resp *http.Response, e
 		return nil, errors.New("RootURL not set")
 	}
 	url += opts.Path
+	ctx, span := tracing.Start(ctx, "rest "+opts.Method, trace.WithAttributes(
+		attribute.String("http.request.method", opts.Method),
+		attribute.String("url.full", url),
+	))
+	defer func() {
+		if resp != nil {
+			span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		}
+		tracing.End(span, err)
+	}()
 	if len(opts.Parameters) > 0 {
 		url += "?" + opts.Parameters.Encode()
 	}
@@ -0,0 +1,175 @@
+// Package tracing provides OpenTelemetry tracing of rclone's
+// commands, transfers and backend calls.
+//
+// Tracing is off unless Init is called with somewhere to send the
+// spans, in which case starting spans is cheap.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation name for the tracer
+const tracerName = "github.com/rclone/rclone"
+
+var (
+	enabled atomic.Bool
+	rootMu  sync.Mutex
+	root    trace.SpanContext // parent of spans started without one
+)
+
+// Options configure Init
+type Options struct {
+	Endpoint    string  // OTLP/HTTP endpoint URL to send spans to
+	File        string  // file to write spans to as JSON
+	SampleRatio float64 // fraction of traces to sample
+	Version     string  // rclone version for the service resource
+}
+
+// Init starts tracing if opt says where to send the spans.
+//
+// It returns a function which flushes any outstanding spans and
+// stops tracing. This should be called before rclone exits.
+func Init(ctx context.Context, opt Options) (shutdown func(context.Context) error, err error) {
+	shutdown = func(context.Context) error { return nil }
+	if opt.Endpoint == "" && opt.File == "" {
+		return shutdown, nil
+	}
+	var (
+		exporters []sdktrace.SpanExporter
+		file      *os.File
+	)
+	if opt.Endpoint != "" {
+		exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(opt.Endpoint))
+		if err != nil {
+			return shutdown, fmt.Errorf("failed to make OTLP trace exporter: %w", err)
+		}
+		exporters = append(exporters, exporter)
+	}
+	if opt.File != "" {
+		file, err = os.Create(opt.File)
+		if err != nil {
+			return shutdown, fmt.Errorf("failed to make trace file: %w", err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+			return shutdown, fmt.Errorf("failed to make trace file exporter: %w", err)
+		}
+		exporters = append(exporters, exporter)
+	}
+
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "rclone"),
+			attribute.String("service.version", opt.Version),
+		)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opt.SampleRatio))),
+	}
+	for _, exporter := range exporters {
+		options = append(options, sdktrace.WithBatcher(exporter))
+	}
+	provider := sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	enabled.Store(true)
+
+	shutdown = func(ctx context.Context) error {
+		enabled.Store(false)
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			err = errors.Join(err, file.Close())
+		}
+		return err
+	}
+	return shutdown, nil
+}
+
+// Enabled returns true if spans are being recorded.
+//
+// Use this to avoid working out expensive attributes.
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Start a span called name.
+//
+// If ctx doesn't have a span then the span is started under the root
+// span set by StartRoot, if any.
+//
+// The span must be ended, usually with End.
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		rootMu.Lock()
+		parent := root
+		rootMu.Unlock()
+		if parent.IsValid() {
+			ctx = trace.ContextWithSpanContext(ctx, parent)
+		}
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// StartRoot starts a span called name which becomes the parent of
+// any spans started without one.
+//
+// This is used for the span of the command being run as most of
+// rclone doesn't pass its context down from the command.
+func StartRoot(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, name, opts...)
+	rootMu.Lock()
+	root = span.SpanContext()
+	rootMu.Unlock()
+	return ctx, span
+}
+
+// StartRemote starts a span called name continuing the trace passed
+// in the W3C trace context headers of an incoming request.
+//
+// If there are no such headers it starts a new trace.
+func StartRemote(ctx context.Context, header http.Header, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	ctx = propagation.TraceContext{}.Extract(ctx, propagation.HeaderCarrier(header))
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		opts = append(opts, trace.WithNewRoot())
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// End the span recording err if it isn't nil.
+//
+// If the span was started by StartRoot then spans started without a
+// parent aren't put under it any more.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	rootMu.Lock()
+	if root.Equal(span.SpanContext()) {
+		root = trace.SpanContext{}
+	}
+	rootMu.Unlock()
+	span.End()
+}
+
+// Detach returns a new background context which carries the span in
+// ctx but not its cancellation or values.
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
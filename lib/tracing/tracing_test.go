@@ -0,0 +1,99 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// span as written by the file exporter
+type fileSpan struct {
+	Name        string
+	SpanContext struct {
+		TraceID string
+		SpanID  string
+	}
+	Parent struct {
+		TraceID string
+		SpanID  string
+	}
+	Status struct {
+		Code string
+	}
+}
+
+func TestTracing(t *testing.T) {
+	ctx := context.Background()
+
+	// Disabled unless there is somewhere to send spans
+	shutdown, err := Init(ctx, Options{})
+	require.NoError(t, err)
+	assert.False(t, Enabled())
+	require.NoError(t, shutdown(ctx))
+
+	file := filepath.Join(t.TempDir(), "trace.json")
+	shutdown, err = Init(ctx, Options{File: file, SampleRatio: 1})
+	require.NoError(t, err)
+	assert.True(t, Enabled())
+
+	_, root := StartRoot(ctx, "command")
+	// A span started without a parent goes under the root
+	_, orphan := Start(context.Background(), "orphan")
+	End(orphan, errors.New("boom"))
+	// Detached contexts stay in the same trace
+	childCtx, child := Start(ctx, "child")
+	_, detached := Start(Detach(childCtx), "detached")
+	detached.End()
+	child.End()
+	// Incoming requests continue their trace or start a new one
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, remote := StartRemote(ctx, header, "remote")
+	remote.End()
+	_, fresh := StartRemote(ctx, http.Header{}, "fresh")
+	fresh.End()
+	End(root, nil)
+	// Ending the root stops spans being put under it
+	_, after := Start(context.Background(), "after")
+	after.End()
+
+	require.NoError(t, shutdown(ctx))
+	assert.False(t, Enabled())
+
+	in, err := os.Open(file)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, in.Close())
+	}()
+	spans := map[string]fileSpan{}
+	dec := json.NewDecoder(in)
+	for {
+		var span fileSpan
+		err := dec.Decode(&span)
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		spans[span.Name] = span
+	}
+	require.Len(t, spans, 7)
+
+	rootSpan := spans["command"]
+	assert.Equal(t, rootSpan.SpanContext.SpanID, spans["orphan"].Parent.SpanID)
+	assert.Equal(t, "Error", spans["orphan"].Status.Code)
+	assert.Equal(t, rootSpan.SpanContext.SpanID, spans["child"].Parent.SpanID)
+	assert.Equal(t, spans["child"].SpanContext.SpanID, spans["detached"].Parent.SpanID)
+	assert.Equal(t, rootSpan.SpanContext.TraceID, spans["detached"].SpanContext.TraceID)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans["remote"].SpanContext.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", spans["remote"].Parent.SpanID)
+	assert.NotEqual(t, rootSpan.SpanContext.TraceID, spans["fresh"].SpanContext.TraceID)
+	assert.NotEqual(t, rootSpan.SpanContext.TraceID, spans["after"].SpanContext.TraceID)
+}
@@ -0,0 +1,300 @@
+package reedsolomon
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/rclone/rclone/lib/random"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Files are encrypted in chunks so they can be streamed through a
+// small buffer rather than read into memory for cipher.AEAD.
+//
+// An encrypted file is a header of cryptMagic and a random salt,
+// followed by the plaintext split into cryptChunkSize chunks, each
+// sealed separately with AES-GCM. The key is derived from the password
+// and the salt so it is different for every file, and the nonce of
+// each chunk is its number plus a flag marking the last chunk, so
+// chunks which are reordered, dropped or truncated fail to
+// authenticate. The header is authenticated as additional data.
+//
+// Files without the header were written by older versions in
+// filecrypt's format, a nonce followed by the whole file sealed with
+// AES-GCM. These can still be decrypted, but only in memory.
+
+const (
+	minPasswordLength = 4
+	gcmNonceSize      = 12
+	gcmTagSize        = 16
+	cryptMagic        = "RSCRYPT\x01"
+	cryptSaltSize     = 16
+	cryptHeaderSize   = len(cryptMagic) + cryptSaltSize
+	cryptChunkSize    = 64 * 1024
+	cryptKeyInfo      = "rclone reedsolomon file key"
+)
+
+var errAuthFailed = errors.New("could not decrypt file: cipher: message authentication failed")
+
+// masterKey returns the key made from password
+//
+// This is the AES-256 key filecrypt uses.
+func masterKey(password string) ([]byte, error) {
+	if len(password) < minPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters in length", minPasswordLength)
+	}
+	sum := md5.Sum([]byte(password))
+	return []byte(hex.EncodeToString(sum[:])), nil
+}
+
+// newBlock returns the AES cipher for password as used by filecrypt
+func newBlock(password string) (cipher.Block, error) {
+	key, err := masterKey(password)
+	if err != nil {
+		return nil, err
+	}
+	return aes.NewCipher(key)
+}
+
+// newChunkAEAD returns the AEAD for the chunks of a file with salt
+func newChunkAEAD(password string, salt []byte) (cipher.AEAD, error) {
+	key, err := masterKey(password)
+	if err != nil {
+		return nil, err
+	}
+	fileKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key, salt, []byte(cryptKeyInfo)), fileKey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// chunkNonce sets nonce for chunk n
+func chunkNonce(nonce []byte, n uint64, last bool) []byte {
+	binary.BigEndian.PutUint64(nonce, n)
+	nonce[8], nonce[9], nonce[10], nonce[11] = 0, 0, 0, 0
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// readChunk reads up to len(buf) bytes from r into buf and reports
+// whether r is exhausted afterwards
+func readChunk(r *bufio.Reader, buf []byte) (n int, last bool, err error) {
+	n, err = io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return n, true, nil
+	}
+	if err != nil {
+		return n, false, err
+	}
+	if _, err = r.Peek(1); err == io.EOF {
+		return n, true, nil
+	}
+	return n, false, err
+}
+
+// encryptFile encrypts src with password into dst
+func encryptFile(ctx context.Context, src, dst, password string) (err error) {
+	header := make([]byte, cryptHeaderSize)
+	copy(header, cryptMagic)
+	if _, err := io.ReadFull(rand.Reader, header[len(cryptMagic):]); err != nil {
+		return fmt.Errorf("could not get salt: %w", err)
+	}
+	aead, err := newChunkAEAD(password, header[len(cryptMagic):])
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("could not read file [%s]: %w", src, err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("could not write file [%s]: %w", dst, err)
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil && closeErr != nil {
+			err = fmt.Errorf("could not write file [%s]: %w", dst, closeErr)
+		}
+	}()
+
+	r := bufio.NewReaderSize(in, cryptChunkSize)
+	w := bufio.NewWriterSize(out, cryptChunkSize+gcmTagSize)
+	if _, err := w.Write(header); err != nil {
+		return fmt.Errorf("could not write file [%s]: %w", dst, err)
+	}
+	nonce := make([]byte, gcmNonceSize)
+	buf := make([]byte, cryptChunkSize, cryptChunkSize+gcmTagSize)
+	for i := uint64(0); ; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, last, err := readChunk(r, buf[:cryptChunkSize])
+		if err != nil {
+			return fmt.Errorf("could not read file [%s]: %w", src, err)
+		}
+		sealed := aead.Seal(buf[:0], chunkNonce(nonce, i, last), buf[:n], header)
+		if _, err := w.Write(sealed); err != nil {
+			return fmt.Errorf("could not write file [%s]: %w", dst, err)
+		}
+		if last {
+			break
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("could not write file [%s]: %w", dst, err)
+	}
+	return nil
+}
+
+// decryptFile decrypts src with password into dst
+//
+// The plaintext is written to a hidden temporary file next to dst and
+// only renamed into place once every chunk has been authenticated, so
+// unauthenticated or partial plaintext is never left under the final
+// name.
+func decryptFile(ctx context.Context, src, dst, password string) (err error) {
+	// Check the password before doing anything
+	if _, err := masterKey(password); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("could not read input file [%s]: %w", src, err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+	r := bufio.NewReaderSize(in, cryptChunkSize+gcmTagSize)
+
+	tmp, err := createPartial(dst, 0666)
+	if err != nil {
+		return fmt.Errorf("could not write file [%s]: %w", dst, err)
+	}
+	done := removeOnExit(tmp.Name())
+	defer done()
+	defer func() {
+		_ = tmp.Close()
+	}()
+	w := bufio.NewWriterSize(tmp, cryptChunkSize)
+
+	header, err := r.Peek(cryptHeaderSize)
+	if err == nil && string(header[:len(cryptMagic)]) == cryptMagic {
+		err = decryptChunks(ctx, r, w, password)
+	} else {
+		err = decryptLegacy(r, w, password)
+	}
+	if err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return errors.New("could not decrypt file: data too short")
+		}
+		if err == errAuthFailed || ctx.Err() != nil {
+			return err
+		}
+		return fmt.Errorf("could not decrypt file [%s]: %w", src, err)
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("could not write file [%s]: %w", dst, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write file [%s]: %w", dst, err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("could not rename file [%s]: %w", dst, err)
+	}
+	return nil
+}
+
+// decryptChunks decrypts the chunked format from r into w
+func decryptChunks(ctx context.Context, r *bufio.Reader, w io.Writer, password string) error {
+	header := make([]byte, cryptHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	aead, err := newChunkAEAD(password, header[len(cryptMagic):])
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcmNonceSize)
+	buf := make([]byte, cryptChunkSize+gcmTagSize)
+	for i := uint64(0); ; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, last, err := readChunk(r, buf)
+		if err != nil {
+			return err
+		}
+		opened, err := aead.Open(buf[:0], chunkNonce(nonce, i, last), buf[:n], header)
+		if err != nil {
+			return errAuthFailed
+		}
+		if _, err := w.Write(opened); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// decryptLegacy decrypts a file in filecrypt's format from r into w
+//
+// cipher.AEAD needs the whole message, so this reads it into memory.
+func decryptLegacy(r io.Reader, w io.Writer, password string) error {
+	block, err := newBlock(password)
+	if err != nil {
+		return err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if len(data) < gcmNonceSize+gcmTagSize {
+		return io.ErrUnexpectedEOF
+	}
+	opened, err := gcm.Open(data[gcmNonceSize:gcmNonceSize], data[:gcmNonceSize], data[gcmNonceSize:], nil)
+	if err != nil {
+		return errAuthFailed
+	}
+	_, err = w.Write(opened)
+	return err
+}
+
+// createPartial creates a new hidden temporary file next to dst
+func createPartial(dst string, perm os.FileMode) (f *os.File, err error) {
+	for tries := 0; tries < 10; tries++ {
+		name := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+"."+random.String(8)+".partial")
+		f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+		if !os.IsExist(err) {
+			break
+		}
+	}
+	return f, err
+}
@@ -0,0 +1,156 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCryptRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	for _, size := range []int{0, 1, 15, 16, 17, 1000, cryptChunkSize - 1, cryptChunkSize, cryptChunkSize + 17, 3 * cryptChunkSize} {
+		data := make([]byte, size)
+		fillRandom(data)
+		src := filepath.Join(dir, "src")
+		if err := os.WriteFile(src, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		enc := filepath.Join(dir, "enc")
+		if err := encryptFile(ctx, src, enc, testPassword); err != nil {
+			t.Fatal(err)
+		}
+		dst := filepath.Join(dir, "dst")
+		if err := decryptFile(ctx, enc, dst, testPassword); err != nil {
+			t.Fatalf("%d: %v", size, err)
+		}
+		got, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%d: decrypted data differs", size)
+		}
+	}
+}
+
+// TestDecryptFileLegacy checks files sealed whole with cipher.AEAD by
+// filecrypt and older versions can still be decrypted
+func TestDecryptFileLegacy(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	block, err := newBlock(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, size := range []int{0, 1, 1000, cryptChunkSize + 17} {
+		data := make([]byte, size)
+		fillRandom(data)
+		nonce := make([]byte, gcmNonceSize)
+		fillRandom(nonce)
+		enc := filepath.Join(dir, "enc")
+		if err := os.WriteFile(enc, gcm.Seal(nonce, nonce, data, nil), 0600); err != nil {
+			t.Fatal(err)
+		}
+		dst := filepath.Join(dir, "dst")
+		if err := decryptFile(ctx, enc, dst, testPassword); err != nil {
+			t.Fatalf("%d: %v", size, err)
+		}
+		got, err := os.ReadFile(dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%d: decrypted data differs", size)
+		}
+	}
+}
+
+func TestDecryptFileTampered(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	data := make([]byte, 2*cryptChunkSize+100)
+	fillRandom(data)
+	if err := os.WriteFile(src, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	enc := filepath.Join(dir, "enc")
+	if err := encryptFile(ctx, src, enc, testPassword); err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := os.ReadFile(enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const sealedChunk = cryptChunkSize + gcmTagSize
+	chunk := func(i int) []byte {
+		return sealed[cryptHeaderSize+i*sealedChunk : cryptHeaderSize+(i+1)*sealedChunk]
+	}
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	flipped := bytes.Clone(sealed)
+	flipped[cryptHeaderSize] ^= 1
+	for _, test := range []struct {
+		name     string
+		data     []byte
+		password string
+	}{
+		{"flipped", flipped, testPassword},
+		{"truncated", sealed[:cryptHeaderSize+2*sealedChunk], testPassword},
+		{"reordered", join(sealed[:cryptHeaderSize], chunk(1), chunk(0), sealed[cryptHeaderSize+2*sealedChunk:]), testPassword},
+		{"wrong password", sealed, "wrong password"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tampered := filepath.Join(t.TempDir(), "enc")
+			if err := os.WriteFile(tampered, test.data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			dst := filepath.Join(dir, "dst")
+			if err := decryptFile(ctx, tampered, dst, test.password); err != errAuthFailed {
+				t.Fatalf("expected %v, got %v", errAuthFailed, err)
+			}
+		})
+	}
+
+	// Nothing is left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("unexpected files %v", entries)
+	}
+}
+
+func TestCryptCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.WriteFile(src, []byte("hello world"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	enc := filepath.Join(dir, "enc")
+	if err := encryptFile(ctx, src, enc, testPassword); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if err := encryptFile(context.Background(), src, enc, testPassword); err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, "dst")
+	if err := decryptFile(ctx, enc, dst, testPassword); err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("expected no output, got %v", err)
+	}
+}
@@ -0,0 +1,649 @@
+package reedsolomon
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+const fileCryptExtension string = ".fcef"
+
+// Default shard counts used by EncodeFile if none are given
+const (
+	defaultDataShards   = 170
+	minShardSize        = 10 * 1024 * 1024
+	leopardShardSize    = 4 * 1024 * 1024
+	leopardMinShards    = 5
+	leopardMaxDataShard = leopardMaxShards * 2 / 3
+)
+
+// Codec is the erasure code EncodeFile splits files with
+type Codec string
+
+// Codecs supported by EncodeFile and DecodeFile
+const (
+	// CodecStream is the classic Vandermonde Reed-Solomon codec
+	// limited to 256 shards. This is used if no codec is given.
+	CodecStream Codec = "stream"
+	// CodecLeopard is the Leopard GF(2^16) codec which allows
+	// up to 65536 shards for wide stripes of small shards.
+	CodecLeopard Codec = "leopard"
+)
+
+// newCodecStream returns the StreamEncoder for codec
+func newCodecStream(codec Codec, dataShards, parityShards int) (StreamEncoder, error) {
+	switch codec {
+	case "", CodecStream:
+		return NewStream(dataShards, parityShards)
+	case CodecLeopard:
+		return NewLeopardStream(dataShards, parityShards)
+	}
+	return nil, fmt.Errorf("unknown erasure codec %q", codec)
+}
+
+// Stage is a step of EncodeFile or DecodeFile reported to a ProgressFunc
+type Stage string
+
+// Stages of EncodeFile and DecodeFile
+const (
+	StageEncrypt     Stage = "encrypt"
+	StageSplit       Stage = "split"
+	StageEncode      Stage = "encode"
+	StageVerify      Stage = "verify"
+	StageReconstruct Stage = "reconstruct"
+	StageJoin        Stage = "join"
+	StageDecrypt     Stage = "decrypt"
+)
+
+// ProgressFunc is called with the number of bytes done out of total
+// as each stage of EncodeFile or DecodeFile runs.
+//
+// It may be called from several goroutines at once.
+type ProgressFunc func(stage Stage, done, total int64)
+
+// EncodeOptions controls EncodeFile
+type EncodeOptions struct {
+	Codec        Codec        // erasure code to use - CodecStream if empty
+	DataShards   int          // number of data shards - if 0 chosen from the file size
+	ParityShards int          // number of parity shards - if 0 half the data shards
+	Password     string       // password the file is encrypted with before splitting
+	Progress     ProgressFunc // if set called as the encode progresses
+}
+
+// EncodeResult describes the shards written by EncodeFile
+type EncodeResult struct {
+	Codec        Codec    // erasure code used
+	Paths        []string // paths of the shards, data shards first
+	Checksums    []string // SHA-256 of each shard in the same order as Paths
+	ShardSize    int64    // size of each shard
+	Padding      int64    // zero bytes added to fill the last data shard
+	DataShards   int      // number of data shards
+	ParityShards int      // number of parity shards
+}
+
+// DecodeOptions controls DecodeFile
+type DecodeOptions struct {
+	Codec        Codec             // erasure code the file was encoded with
+	DataShards   int               // number of data shards the file was encoded with
+	ParityShards int               // number of parity shards the file was encoded with
+	Padding      int64             // padding returned by EncodeFile
+	Checksums    map[string]string // expected SHA-256 of each shard by shard name
+	Password     string            // password the file was encrypted with
+	Progress     ProgressFunc      // if set called as the decode progresses
+	ShardDir     string            // directory the shards are in - the shard directory if empty
+}
+
+// DecodeResult describes the file written by DecodeFile
+type DecodeResult struct {
+	Path          string   // path of the decoded file
+	Discarded     []string // shards removed because their checksum didn't match
+	Reconstructed bool     // set if missing shards had to be reconstructed
+}
+
+// progress counts the bytes read by a stage and reports them
+type progress struct {
+	fn    ProgressFunc
+	stage Stage
+	total int64
+	done  atomic.Int64
+}
+
+func newProgress(fn ProgressFunc, stage Stage, total int64) *progress {
+	p := &progress{fn: fn, stage: stage, total: total}
+	p.add(0)
+	return p
+}
+
+func (p *progress) add(n int64) {
+	if p.fn != nil {
+		p.fn(p.stage, p.done.Add(n), p.total)
+	}
+}
+
+// progressReader stops reading once ctx is cancelled and counts the
+// bytes read into p
+type progressReader struct {
+	ctx context.Context
+	in  io.Reader
+	p   *progress
+}
+
+func (r *progressReader) Read(buf []byte) (n int, err error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err = r.in.Read(buf)
+	if n > 0 {
+		r.p.add(int64(n))
+	}
+	return n, err
+}
+
+// wrapReaders wraps the non nil readers in progressReaders sharing p
+func wrapReaders(ctx context.Context, readers []io.Reader, p *progress) []io.Reader {
+	out := make([]io.Reader, len(readers))
+	for i, in := range readers {
+		if in != nil {
+			out[i] = &progressReader{ctx: ctx, in: in, p: p}
+		}
+	}
+	return out
+}
+
+// ctxErr returns the context error in preference to err as the stream
+// functions wrap it
+func ctxErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+// calculateShardsNum picks the number of data and parity shards for a
+// file of size bytes
+func calculateShardsNum(size int64) (dataShards, parityShards int) {
+	if size < minShardSize {
+		return 5, 3
+	}
+	dataShards = defaultDataShards
+	for size/int64(dataShards) < minShardSize && dataShards > 10 {
+		dataShards -= 10
+	}
+	return dataShards, dataShards / 2
+}
+
+// calculateLeopardShardsNum picks the number of data and parity shards
+// for a file of size bytes encoded with CodecLeopard, aiming for
+// shards of leopardShardSize
+func calculateLeopardShardsNum(size int64) (dataShards, parityShards int) {
+	n := (size + leopardShardSize - 1) / leopardShardSize
+	switch {
+	case n < leopardMinShards:
+		n = leopardMinShards
+	case n > leopardMaxDataShard:
+		n = leopardMaxDataShard
+	}
+	dataShards = int(n)
+	return dataShards, (dataShards + 1) / 2
+}
+
+// EncodeFile encrypts fname and splits it into data and parity shards
+// in a new directory inside the shard directory.
+//
+// The shards are called after the file with the encrypted extension
+// and the shard number appended. Each call writes to its own
+// directory so files with the same name can be encoded at once - the
+// caller should move the shards out and remove it. If an error is
+// returned, including when ctx is cancelled, the directory is removed.
+func EncodeFile(ctx context.Context, fname string, opt EncodeOptions) (res *EncodeResult, err error) {
+	shardPath, err := GetShardDir()
+	if err != nil {
+		return nil, err
+	}
+	work, err := GetWorkDir()
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	codec := opt.Codec
+	if codec == "" {
+		codec = CodecStream
+	}
+	dataShards, parityShards := opt.DataShards, opt.ParityShards
+	if dataShards == 0 {
+		if codec == CodecLeopard {
+			dataShards, parityShards = calculateLeopardShardsNum(fi.Size())
+		} else {
+			dataShards, parityShards = calculateShardsNum(fi.Size())
+		}
+	} else if parityShards == 0 {
+		parityShards = (dataShards + 1) / 2
+	}
+	enc, err := newCodecStream(codec, dataShards, parityShards)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Encrypt the file into the work dir, never next to the source
+	base := filepath.Base(fname) + fileCryptExtension
+	tmp, err := os.CreateTemp(work, base+".*")
+	if err != nil {
+		return nil, err
+	}
+	encFile := tmp.Name()
+	removeEncFile := removeOnExit(encFile)
+	defer removeEncFile()
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	encrypt := newProgress(opt.Progress, StageEncrypt, fi.Size())
+	if err := encryptFile(ctx, fname, encFile, opt.Password); err != nil {
+		return nil, err
+	}
+	encrypt.add(fi.Size())
+
+	f, err := os.Open(encFile)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	instat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	outDir, err := os.MkdirTemp(shardPath, base+".*")
+	if err != nil {
+		return nil, err
+	}
+	res = &EncodeResult{
+		Codec:        codec,
+		DataShards:   dataShards,
+		ParityShards: parityShards,
+	}
+	out := make([]*os.File, dataShards+parityShards)
+	defer func() {
+		for _, o := range out {
+			if o != nil {
+				_ = o.Close()
+			}
+		}
+		if err != nil {
+			if removeErr := os.RemoveAll(outDir); removeErr != nil {
+				fmt.Fprintf(os.Stderr, "Error removing shards %s: %v\n", outDir, removeErr)
+			}
+			res = nil
+		}
+	}()
+
+	// Create the resulting files.
+	for i := range out {
+		out[i], err = os.Create(filepath.Join(outDir, fmt.Sprintf("%s.%d", base, i)))
+		if err != nil {
+			return res, err
+		}
+		res.Paths = append(res.Paths, out[i].Name())
+	}
+
+	// Split into the data shards.
+	data := make([]io.Writer, dataShards)
+	for i := range data {
+		data[i] = out[i]
+	}
+	split := newProgress(opt.Progress, StageSplit, instat.Size())
+	res.Padding, err = enc.Split(&progressReader{ctx: ctx, in: f, p: split}, data, instat.Size())
+	if err != nil {
+		return res, ctxErr(ctx, err)
+	}
+
+	// Close and re-open the data shards to read them.
+	input := make([]io.Reader, dataShards)
+	for i := range input {
+		if err = out[i].Close(); err != nil {
+			out[i] = nil
+			return res, err
+		}
+		out[i] = nil
+		in, err := os.Open(res.Paths[i])
+		if err != nil {
+			return res, err
+		}
+		defer func() {
+			_ = in.Close()
+		}()
+		input[i] = in
+	}
+	shardInfo, err := os.Stat(res.Paths[0])
+	if err != nil {
+		return res, err
+	}
+	res.ShardSize = shardInfo.Size()
+
+	// Encode the parity shards.
+	parity := make([]io.Writer, parityShards)
+	for i := range parity {
+		parity[i] = out[dataShards+i]
+	}
+	encode := newProgress(opt.Progress, StageEncode, res.ShardSize*int64(dataShards))
+	err = enc.Encode(wrapReaders(ctx, input, encode), parity)
+	if err != nil {
+		return res, ctxErr(ctx, err)
+	}
+	for i := range parity {
+		o := out[dataShards+i]
+		out[dataShards+i] = nil
+		if err = o.Close(); err != nil {
+			return res, err
+		}
+	}
+
+	for _, path := range res.Paths {
+		checksum, err := calculateChecksum(path)
+		if err != nil {
+			return res, err
+		}
+		res.Checksums = append(res.Checksums, checksum)
+	}
+	return res, nil
+}
+
+// DecodeFile joins the shards of name in the shard directory and
+// decrypts them into outDir.
+//
+// Shards whose checksums don't match are removed and reconstructed
+// from the parity shards along with any which are missing. The shards
+// are left in the shard directory for the caller to remove.
+func DecodeFile(ctx context.Context, name, outDir string, opt DecodeOptions) (res *DecodeResult, err error) {
+	fname := name + fileCryptExtension
+	shardPath := opt.ShardDir
+	if shardPath == "" {
+		shardPath, err = GetShardDir()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Create Dir to save Decoded file
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, err
+	}
+
+	res = &DecodeResult{}
+	res.Discarded, err = discardCorruptShards(shardPath, fname, opt.Checksums)
+	if err != nil {
+		return nil, err
+	}
+
+	enc, err := newCodecStream(opt.Codec, opt.DataShards, opt.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the shards
+	shards, size, err := openInput(shardPath, opt.DataShards, opt.ParityShards, fname)
+	if err != nil {
+		return nil, err
+	}
+	verify := newProgress(opt.Progress, StageVerify, size*int64(countShards(shards)))
+	ok, err := enc.Verify(wrapReaders(ctx, shards, verify))
+	closeInput(shards)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err != nil {
+		if !needsReconstruction(err) {
+			return nil, fmt.Errorf("verification failed: %w", err)
+		}
+		ok = false
+	}
+
+	if !ok {
+		res.Reconstructed = true
+		if err := reconstructShards(ctx, enc, shardPath, fname, opt); err != nil {
+			return nil, err
+		}
+	}
+
+	// Join the encrypted file in the work dir so only the decrypted
+	// file is written to the destination
+	work, err := GetWorkDir()
+	if err != nil {
+		return nil, err
+	}
+	shards, size, err = openInput(shardPath, opt.DataShards, opt.ParityShards, fname)
+	if err != nil {
+		return nil, err
+	}
+	defer closeInput(shards)
+	outSize := int64(opt.DataShards)*size - opt.Padding
+	if outSize < 0 {
+		return nil, fmt.Errorf("padding %d is larger than the data", opt.Padding)
+	}
+
+	f, err := os.CreateTemp(work, fname+".*")
+	if err != nil {
+		return nil, err
+	}
+	joined := f.Name()
+	removeJoined := removeOnExit(joined)
+	defer removeJoined()
+	join := newProgress(opt.Progress, StageJoin, outSize)
+	err = enc.Join(f, wrapReaders(ctx, shards, join), outSize)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, ctxErr(ctx, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	res.Path = filepath.Join(outDir, strings.TrimSuffix(fname, fileCryptExtension))
+	decrypt := newProgress(opt.Progress, StageDecrypt, outSize)
+	if err := decryptFile(ctx, joined, res.Path, opt.Password); err != nil {
+		return nil, err
+	}
+	decrypt.add(outSize)
+	return res, nil
+}
+
+// reconstructShards recreates the missing shards of fname and checks
+// the result
+func reconstructShards(ctx context.Context, enc StreamEncoder, shardPath, fname string, opt DecodeOptions) error {
+	shards, size, err := openInput(shardPath, opt.DataShards, opt.ParityShards, fname)
+	if err != nil {
+		return err
+	}
+
+	// Create out destination writers
+	out := make([]io.Writer, len(shards))
+	var created []*os.File
+	for i := range out {
+		if shards[i] != nil {
+			continue
+		}
+		o, err := os.Create(filepath.Join(shardPath, fmt.Sprintf("%s.%d", fname, i)))
+		if err != nil {
+			closeInput(shards)
+			closeFiles(created)
+			return err
+		}
+		created = append(created, o)
+		out[i] = o
+	}
+	reconstruct := newProgress(opt.Progress, StageReconstruct, size*int64(countShards(shards)))
+	err = enc.Reconstruct(wrapReaders(ctx, shards, reconstruct), out)
+	closeInput(shards)
+	if closeErr := closeFiles(created); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("reconstruct failed: %w", ctxErr(ctx, err))
+	}
+
+	shards, size, err = openInput(shardPath, opt.DataShards, opt.ParityShards, fname)
+	if err != nil {
+		return err
+	}
+	defer closeInput(shards)
+	verify := newProgress(opt.Progress, StageVerify, size*int64(countShards(shards)))
+	ok, err := enc.Verify(wrapReaders(ctx, shards, verify))
+	if err != nil {
+		return fmt.Errorf("verification failed after reconstruction: %w", ctxErr(ctx, err))
+	}
+	if !ok {
+		return errors.New("verification failed after reconstruction, data likely corrupted")
+	}
+	return nil
+}
+
+// needsReconstruction returns true if err from Verify means shards are
+// missing or unreadable rather than that verifying can't work at all
+func needsReconstruction(err error) bool {
+	var readErr StreamReadError
+	return errors.As(err, &readErr) || errors.Is(err, ErrTooFewShards) || errors.Is(err, ErrShardSize)
+}
+
+// discardCorruptShards removes the shards of fname in dir whose
+// checksum doesn't match the one expected, returning their names
+func discardCorruptShards(dir, fname string, checksums map[string]string) (discarded []string, err error) {
+	for i := 0; i < len(checksums); i++ {
+		shardName := fmt.Sprintf("%s.%d", fname, i)
+		shardFile := filepath.Join(dir, shardName)
+		checksum, err := calculateChecksum(shardFile)
+		if err != nil {
+			// missing shards are reconstructed
+			continue
+		}
+		if checksum == checksums[shardName] {
+			continue
+		}
+		if err := os.Remove(shardFile); err != nil && !os.IsNotExist(err) {
+			return discarded, fmt.Errorf("delete failed for %s: %w", shardFile, err)
+		}
+		discarded = append(discarded, shardName)
+	}
+	return discarded, nil
+}
+
+// openInput opens the shards of fname in path, leaving missing and
+// empty ones nil
+func openInput(path string, dataShards, parShards int, fname string) (shards []io.Reader, size int64, err error) {
+	shards = make([]io.Reader, dataShards+parShards)
+	for i := range shards {
+		f, err := os.Open(filepath.Join(path, fmt.Sprintf("%s.%d", fname, i)))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			closeInput(shards)
+			return nil, 0, err
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			closeInput(shards)
+			return nil, 0, err
+		}
+		if stat.Size() == 0 {
+			_ = f.Close()
+			continue
+		}
+		size = stat.Size()
+		shards[i] = f
+	}
+	return shards, size, nil
+}
+
+// countShards returns the number of shards which are present
+func countShards(shards []io.Reader) (n int) {
+	for _, r := range shards {
+		if r != nil {
+			n++
+		}
+	}
+	return n
+}
+
+func closeInput(shards []io.Reader) {
+	for _, r := range shards {
+		if f, ok := r.(*os.File); ok {
+			_ = f.Close()
+		}
+	}
+}
+
+func closeFiles(files []*os.File) (err error) {
+	for _, f := range files {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+func calculateChecksum(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for checksum: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to compute checksum: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// DeleteShardWithFileNames removes the named shards from the shard
+// directory
+func DeleteShardWithFileNames(fileNames []string) {
+	dir, _ := GetShardDir()
+	for _, fileName := range fileNames {
+		filePath := filepath.Join(dir, filepath.Base(fileName))
+		if err := os.Remove(filePath); err != nil {
+			fmt.Printf("Error deleting file %s: %v\n", filePath, err)
+		}
+	}
+}
+
+// DeleteShardDir removes everything in the shard directory
+func DeleteShardDir() {
+	dir, err := GetShardDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting shard directory: %v\n", err)
+		return
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading shard directory: %v\n", err)
+		return
+	}
+
+	for _, file := range files {
+		filePath := filepath.Join(dir, file.Name())
+		if err := os.RemoveAll(filePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error deleting file %s: %v\n", filePath, err)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package reedsolomon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+const testPassword = "password"
+
+// setupFileTest points the staging dir at a temporary directory and
+// writes a random file of size bytes to encode
+func setupFileTest(t *testing.T, name string, size int) (src string, data []byte) {
+	dir := t.TempDir()
+	old := GetStagingDir()
+	SetStagingDir(filepath.Join(dir, "staging"))
+	t.Cleanup(func() {
+		SetStagingDir(old)
+	})
+
+	data = make([]byte, size)
+	fillRandom(data)
+	src = filepath.Join(dir, name)
+	if err := os.WriteFile(src, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return src, data
+}
+
+func decodeOptions(res *EncodeResult) DecodeOptions {
+	checksums := make(map[string]string, len(res.Paths))
+	for i, path := range res.Paths {
+		checksums[filepath.Base(path)] = res.Checksums[i]
+	}
+	return DecodeOptions{
+		Codec:        res.Codec,
+		DataShards:   res.DataShards,
+		ParityShards: res.ParityShards,
+		Padding:      res.Padding,
+		Checksums:    checksums,
+		Password:     testPassword,
+		ShardDir:     filepath.Dir(res.Paths[0]),
+	}
+}
+
+func checkDecoded(t *testing.T, path string, want []byte) {
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("decoded file differs: got %d bytes, want %d bytes", len(got), len(want))
+	}
+}
+
+func TestEncodeDecodeFile(t *testing.T) {
+	ctx := context.Background()
+	src, data := setupFileTest(t, "file.bin", 123457)
+
+	stages := map[Stage]bool{}
+	var mu sync.Mutex
+	progress := func(stage Stage, done, total int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		if done > total {
+			t.Errorf("%s: done %d > total %d", stage, done, total)
+		}
+		stages[stage] = true
+	}
+
+	res, err := EncodeFile(ctx, src, EncodeOptions{Password: testPassword, Progress: progress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.DataShards != 5 || res.ParityShards != 3 {
+		t.Errorf("unexpected shards %d+%d", res.DataShards, res.ParityShards)
+	}
+	if len(res.Paths) != 8 || len(res.Checksums) != 8 {
+		t.Fatalf("unexpected number of shards %d, checksums %d", len(res.Paths), len(res.Checksums))
+	}
+	for _, stage := range []Stage{StageEncrypt, StageSplit, StageEncode} {
+		if !stages[stage] {
+			t.Errorf("no progress for %s", stage)
+		}
+	}
+
+	outDir := filepath.Join(t.TempDir(), "out")
+	opt := decodeOptions(res)
+	opt.Progress = progress
+	decoded, err := DecodeFile(ctx, "file.bin", outDir, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Reconstructed || len(decoded.Discarded) != 0 {
+		t.Errorf("unexpected repair %+v", decoded)
+	}
+	checkDecoded(t, decoded.Path, data)
+	for _, stage := range []Stage{StageVerify, StageJoin, StageDecrypt} {
+		if !stages[stage] {
+			t.Errorf("no progress for %s", stage)
+		}
+	}
+}
+
+func TestDecodeFileRepair(t *testing.T) {
+	ctx := context.Background()
+	src, data := setupFileTest(t, "file.bin", 54321)
+
+	res, err := EncodeFile(ctx, src, EncodeOptions{DataShards: 4, ParityShards: 2, Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Lose one shard and corrupt another
+	if err := os.Remove(res.Paths[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(res.Paths[3], []byte("corrupt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeFile(ctx, "file.bin", t.TempDir(), decodeOptions(res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Reconstructed {
+		t.Error("expected reconstruction")
+	}
+	if len(decoded.Discarded) != 1 || decoded.Discarded[0] != filepath.Base(res.Paths[3]) {
+		t.Errorf("unexpected discarded shards %v", decoded.Discarded)
+	}
+	checkDecoded(t, decoded.Path, data)
+
+	// Too many shards lost returns an error rather than exiting
+	for _, path := range res.Paths[:3] {
+		if err := os.Remove(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = DecodeFile(ctx, "file.bin", t.TempDir(), decodeOptions(res))
+	if err == nil {
+		t.Fatal("expected error decoding with too few shards")
+	}
+}
+
+func TestEncodeDecodeFileLeopard(t *testing.T) {
+	ctx := context.Background()
+	src, data := setupFileTest(t, "file.bin", 200001)
+
+	// More shards than the stream codec allows
+	res, err := EncodeFile(ctx, src, EncodeOptions{Codec: CodecLeopard, DataShards: 300, ParityShards: 60, Password: testPassword})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Codec != CodecLeopard || len(res.Paths) != 360 {
+		t.Fatalf("unexpected result codec %q with %d shards", res.Codec, len(res.Paths))
+	}
+	if res.ShardSize%64 != 0 {
+		t.Errorf("shard size %d not a multiple of 64", res.ShardSize)
+	}
+
+	// Lose data and parity shards and corrupt one
+	for _, i := range []int{0, 1, 17, 299, 300, 359} {
+		if err := os.Remove(res.Paths[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(res.Paths[42], make([]byte, res.ShardSize), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeFile(ctx, "file.bin", t.TempDir(), decodeOptions(res))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Reconstructed || len(decoded.Discarded) != 1 {
+		t.Errorf("unexpected repair %+v", decoded)
+	}
+	checkDecoded(t, decoded.Path, data)
+
+	// The stream codec can't decode it
+	opt := decodeOptions(res)
+	opt.Codec = CodecStream
+	_, err = DecodeFile(ctx, "file.bin", t.TempDir(), opt)
+	if err != ErrMaxShardNum {
+		t.Errorf("expected %v, got %v", ErrMaxShardNum, err)
+	}
+}
+
+func TestCalculateShardsNum(t *testing.T) {
+	for _, test := range []struct {
+		codec     Codec
+		size      int64
+		data, par int
+	}{
+		{CodecStream, 1024, 5, 3},
+		{CodecStream, 100 << 20, 10, 5},
+		{CodecStream, 10 << 30, 170, 85},
+		{CodecLeopard, 1024, 5, 3},
+		{CodecLeopard, 10 << 30, 2560, 1280},
+		{CodecLeopard, 1 << 40, leopardMaxDataShard, leopardMaxShards / 3},
+	} {
+		var data, par int
+		if test.codec == CodecLeopard {
+			data, par = calculateLeopardShardsNum(test.size)
+		} else {
+			data, par = calculateShardsNum(test.size)
+		}
+		if data != test.data || par != test.par {
+			t.Errorf("%s %d: got %d+%d, want %d+%d", test.codec, test.size, data, par, test.data, test.par)
+		}
+	}
+}
+
+func TestEncodeFileErrors(t *testing.T) {
+	ctx := context.Background()
+	src, _ := setupFileTest(t, "file.bin", 1024)
+
+	_, err := EncodeFile(ctx, src, EncodeOptions{DataShards: 200, ParityShards: 100, Password: testPassword})
+	if err != ErrMaxShardNum {
+		t.Errorf("expected %v, got %v", ErrMaxShardNum, err)
+	}
+	_, err = EncodeFile(ctx, src, EncodeOptions{Codec: "unknown", Password: testPassword})
+	if err == nil {
+		t.Error("expected error with unknown codec")
+	}
+	_, err = EncodeFile(ctx, src, EncodeOptions{Password: "x"})
+	if err == nil {
+		t.Error("expected error with short password")
+	}
+	_, err = EncodeFile(ctx, src+".missing", EncodeOptions{Password: testPassword})
+	if !os.IsNotExist(err) {
+		t.Errorf("expected not exist error, got %v", err)
+	}
+}
+
+func TestEncodeFileCancel(t *testing.T) {
+	src, _ := setupFileTest(t, "file.bin", 1<<20)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	progress := func(stage Stage, done, total int64) {
+		if stage == StageSplit && done > 0 {
+			cancel()
+		}
+	}
+	_, err := EncodeFile(ctx, src, EncodeOptions{Password: testPassword, Progress: progress})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+
+	// The partial shards and the encrypted file are removed
+	for _, dir := range []string{shardDir, workDir} {
+		entries, err := os.ReadDir(filepath.Join(GetStagingDir(), dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("%s not empty: %v", dir, entries)
+		}
+	}
+}
+
+func TestEncodeFileConcurrent(t *testing.T) {
+	ctx := context.Background()
+	src, _ := setupFileTest(t, "file.bin", 0)
+
+	// Files with the same name in different directories
+	const n = 4
+	const name = "file.bin"
+	want := make([][]byte, n)
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		dir := filepath.Join(filepath.Dir(src), fmt.Sprint(i))
+		if err := os.Mkdir(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		want[i] = make([]byte, 10000+i*1000)
+		_, _ = rand.Read(want[i])
+		if err := os.WriteFile(filepath.Join(dir, name), want[i], 0600); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := EncodeFile(ctx, filepath.Join(dir, name), EncodeOptions{DataShards: 3 + i, Password: testPassword})
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			decoded, err := DecodeFile(ctx, name, filepath.Join(dir, "out"), decodeOptions(res))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			got, err := os.ReadFile(decoded.Path)
+			if err == nil && !bytes.Equal(got, want[i]) {
+				err = fmt.Errorf("%s: decoded file differs", dir)
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+}
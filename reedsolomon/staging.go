@@ -0,0 +1,212 @@
+package reedsolomon
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gofrs/flock"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/lib/atexit"
+	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/lib/random"
+)
+
+// Layout of the staging directory
+//
+//	<staging>/shard - shards waiting to be uploaded or just downloaded
+//	<staging>/work  - encrypted copies being written, removed when done
+//	<staging>/users - a lock file held by each command using the directory
+//	<staging>/lock  - held while the directory is cleaned or a user added
+const (
+	defaultStagingName = "rclone-dis"
+	shardDir           = "shard"
+	workDir            = "work"
+	usersDir           = "users"
+	lockName           = "lock"
+)
+
+// StaleAge is how old files in the staging directory must be before
+// they are cleaned while another command is using it
+const StaleAge = 24 * time.Hour
+
+var (
+	stagingMu  sync.Mutex
+	stagingDir string
+)
+
+// SetStagingDir sets the directory shards and temporary files are
+// written to.
+//
+// An empty dir selects the default, a directory called "rclone-dis"
+// in the rclone temp dir (set with --temp-dir).
+func SetStagingDir(dir string) {
+	stagingMu.Lock()
+	defer stagingMu.Unlock()
+	stagingDir = dir
+}
+
+// GetStagingDir returns the directory shards and temporary files are
+// written to
+func GetStagingDir() string {
+	stagingMu.Lock()
+	defer stagingMu.Unlock()
+	if stagingDir != "" {
+		return stagingDir
+	}
+	return filepath.Join(config.GetTempDir(), defaultStagingName)
+}
+
+// makeStagingSubDir returns the named directory in the staging
+// directory, creating it if necessary
+func makeStagingSubDir(name string) (string, error) {
+	dir := filepath.Join(GetStagingDir(), name)
+	if err := file.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	return dir, nil
+}
+
+// GetShardDir returns the directory shards are staged in
+func GetShardDir() (string, error) {
+	return makeStagingSubDir(shardDir)
+}
+
+// GetWorkDir returns the directory temporary encrypted files are
+// written to
+func GetWorkDir() (string, error) {
+	return makeStagingSubDir(workDir)
+}
+
+// lockStagingDir takes the staging directory lock, waiting for it if
+// necessary
+func lockStagingDir() (*flock.Flock, error) {
+	if err := file.MkdirAll(GetStagingDir(), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	lock := flock.New(filepath.Join(GetStagingDir(), lockName))
+	if err := lock.Lock(); err != nil {
+		return nil, fmt.Errorf("failed to lock staging directory: %w", err)
+	}
+	return lock, nil
+}
+
+// UseStaging marks the staging directory as in use by this command
+// until the returned function is called, so other commands don't
+// clean up the files it is writing.
+func UseStaging() (release func(), err error) {
+	// Wait for any clean up to finish before adding ourselves
+	lock, err := lockStagingDir()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = lock.Unlock()
+	}()
+	dir, err := makeStagingSubDir(usersDir)
+	if err != nil {
+		return nil, err
+	}
+	user := flock.New(filepath.Join(dir, fmt.Sprintf("%d-%s", os.Getpid(), random.String(8))))
+	locked, err := user.TryLock()
+	if err == nil && !locked {
+		err = fmt.Errorf("%s is locked already", user.Path())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark staging directory in use: %w", err)
+	}
+	return func() {
+		_ = user.Unlock()
+		_ = os.Remove(user.Path())
+	}, nil
+}
+
+// LockStaging locks the staging directory so it can be cleaned.
+//
+// It returns whether another command is using the directory, in which
+// case only files older than StaleAge should be removed. The lock
+// files of users which have exited are removed. Call unlock when the
+// clean up is done.
+func LockStaging() (unlock func(), inUse bool, err error) {
+	lock, err := lockStagingDir()
+	if err != nil {
+		return nil, false, err
+	}
+	unlock = func() {
+		_ = lock.Unlock()
+	}
+	dir, err := makeStagingSubDir(usersDir)
+	if err != nil {
+		unlock()
+		return nil, false, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		unlock()
+		return nil, false, fmt.Errorf("failed to read staging users: %w", err)
+	}
+	for _, entry := range entries {
+		user := flock.New(filepath.Join(dir, entry.Name()))
+		locked, err := user.TryLock()
+		if err != nil || !locked {
+			// Still running
+			inUse = true
+			continue
+		}
+		_ = os.Remove(user.Path())
+		_ = user.Unlock()
+	}
+	return unlock, inUse, nil
+}
+
+// IsStale returns whether the staging file described by fi can be
+// removed when inUse is as returned by LockStaging
+func IsStale(fi os.FileInfo, inUse bool) bool {
+	return !inUse || time.Since(fi.ModTime()) > StaleAge
+}
+
+// CleanWorkDir removes the temporary files left behind by an
+// interrupted encode or decode.
+//
+// It must be called with the lock from LockStaging held.
+func CleanWorkDir(inUse bool) error {
+	dir, err := GetWorkDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read work directory: %w", err)
+	}
+	for _, entry := range entries {
+		fi, err := entry.Info()
+		if err != nil || !IsStale(fi, inUse) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return fmt.Errorf("failed to remove stale temporary file: %w", err)
+		}
+	}
+	return nil
+}
+
+// removeOnExit removes paths if rclone is interrupted by a signal.
+//
+// Call the returned function to remove them and deregister the
+// handler once they are no longer needed.
+func removeOnExit(paths ...string) func() {
+	remove := func() {
+		for _, path := range paths {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "Error removing temporary file %s: %v\n", path, err)
+			}
+		}
+	}
+	handle := atexit.Register(remove)
+	return func() {
+		atexit.Unregister(handle)
+		remove()
+	}
+}
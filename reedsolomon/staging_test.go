@@ -0,0 +1,29 @@
+package reedsolomon
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/rclone/rclone/fs/config"
+)
+
+func TestGetStagingDirDefault(t *testing.T) {
+	old := GetStagingDir()
+	SetStagingDir("")
+	t.Cleanup(func() {
+		SetStagingDir(old)
+	})
+	oldTemp := config.GetTempDir()
+	t.Setenv("TMPDIR", oldTemp)
+	t.Cleanup(func() {
+		_ = config.SetTempDir(oldTemp)
+	})
+
+	dir := t.TempDir()
+	if err := config.SetTempDir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := GetStagingDir(), filepath.Join(dir, defaultStagingName); got != want {
+		t.Errorf("want staging dir %q got %q", want, got)
+	}
+}
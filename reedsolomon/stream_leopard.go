@@ -0,0 +1,210 @@
+package reedsolomon
+
+import (
+	"io"
+)
+
+// Limits of the Leopard GF(2^16) stream
+const (
+	leopardMaxShards      = 65536
+	leopardShardMultiple  = 64
+	leopardMaxBlockSize   = 4 << 20
+	leopardMaxBlockMemory = 64 << 20
+)
+
+// leopardStream is a StreamEncoder using the Leopard GF(2^16) codec.
+//
+// NewStream is limited to 256 shards as it uses the classic
+// Vandermonde codec. This reads a block of every shard at a time into
+// memory and encodes it with the in-memory Leopard Encoder which
+// supports up to 65536 shards. Leopard needs shard sizes to be a
+// multiple of 64 bytes so Split pads the shards to a multiple of that.
+type leopardStream struct {
+	enc          Encoder
+	dataShards   int
+	parityShards int
+	totalShards  int
+	blockSize    int
+}
+
+// NewLeopardStream creates a StreamEncoder using the Leopard GF(2^16)
+// codec for up to 65536 data and parity shards.
+//
+// At least one parity shard is required. Streams written by it can't
+// be read by NewStream and vice versa.
+func NewLeopardStream(dataShards, parityShards int) (StreamEncoder, error) {
+	if dataShards <= 0 || parityShards <= 0 {
+		return nil, ErrInvShardNum
+	}
+	totalShards := dataShards + parityShards
+	if totalShards > leopardMaxShards {
+		return nil, ErrMaxShardNum
+	}
+	enc, err := New(dataShards, parityShards, WithLeopardGF16(true))
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep a block of every shard within leopardMaxBlockMemory
+	blockSize := leopardMaxBlockMemory / totalShards
+	blockSize -= blockSize % leopardShardMultiple
+	if blockSize > leopardMaxBlockSize {
+		blockSize = leopardMaxBlockSize
+	} else if blockSize < leopardShardMultiple {
+		blockSize = leopardShardMultiple
+	}
+
+	return &leopardStream{
+		enc:          enc,
+		dataShards:   dataShards,
+		parityShards: parityShards,
+		totalShards:  totalShards,
+		blockSize:    blockSize,
+	}, nil
+}
+
+// readBlock reads the next block of each of in into all, which is
+// reset to the block size first
+func (r *leopardStream) readBlock(all [][]byte, in []io.Reader) error {
+	for i := range all {
+		if cap(all[i]) < r.blockSize {
+			// replaced by a shorter shard by the Encoder
+			all[i] = make([]byte, r.blockSize)
+		}
+		all[i] = all[i][:r.blockSize]
+	}
+	return readShards(all, in)
+}
+
+// Encode parity shards for a set of data shards.
+func (r *leopardStream) Encode(data []io.Reader, parity []io.Writer) error {
+	if len(data) != r.dataShards || len(parity) != r.parityShards {
+		return ErrTooFewShards
+	}
+
+	all := AllocAligned(r.totalShards, r.blockSize)
+	read := 0
+	for {
+		err := r.readBlock(all[:r.dataShards], data)
+		switch err {
+		case nil:
+		case io.EOF:
+			if read == 0 {
+				return ErrShardNoData
+			}
+			return nil
+		default:
+			return err
+		}
+		size := shardSize(all[:r.dataShards])
+		read += size
+		out := all[r.dataShards:]
+		for i := range out {
+			out[i] = out[i][:size]
+		}
+		err = r.enc.Encode(all)
+		if err != nil {
+			return err
+		}
+		err = writeShards(parity, out)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Verify returns true if the parity shards contain correct data.
+func (r *leopardStream) Verify(shards []io.Reader) (bool, error) {
+	if len(shards) != r.totalShards {
+		return false, ErrTooFewShards
+	}
+
+	all := AllocAligned(r.totalShards, r.blockSize)
+	read := 0
+	for {
+		err := r.readBlock(all, shards)
+		if err == io.EOF {
+			if read == 0 {
+				return false, ErrShardNoData
+			}
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		read += shardSize(all)
+		ok, err := r.enc.Verify(all)
+		if !ok || err != nil {
+			return ok, err
+		}
+	}
+}
+
+// Reconstruct will recreate the missing shards if possible.
+func (r *leopardStream) Reconstruct(valid []io.Reader, fill []io.Writer) error {
+	if len(valid) != r.totalShards || len(fill) != r.totalShards {
+		return ErrTooFewShards
+	}
+
+	reconDataOnly := true
+	for i := range valid {
+		if valid[i] != nil && fill[i] != nil {
+			return ErrReconstructMismatch
+		}
+		if i >= r.dataShards && fill[i] != nil {
+			reconDataOnly = false
+		}
+	}
+
+	all := AllocAligned(r.totalShards, r.blockSize)
+	read := 0
+	for {
+		err := r.readBlock(all, valid)
+		if err == io.EOF {
+			if read == 0 {
+				return ErrShardNoData
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		read += shardSize(all)
+		all = trimShards(all, shardSize(all))
+
+		if reconDataOnly {
+			err = r.enc.ReconstructData(all)
+		} else {
+			err = r.enc.Reconstruct(all)
+		}
+		if err != nil {
+			return err
+		}
+		err = writeShards(fill, all)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Split an input stream into the data shards, padding each shard to a
+// multiple of 64 bytes.
+func (r *leopardStream) Split(data io.Reader, dst []io.Writer, size int64) (int64, error) {
+	if size == 0 {
+		return 0, ErrShortData
+	}
+	if len(dst) != r.dataShards {
+		return 0, ErrInvShardNum
+	}
+	perShard := (size + int64(r.dataShards) - 1) / int64(r.dataShards)
+	perShard = ((perShard + leopardShardMultiple - 1) / leopardShardMultiple) * leopardShardMultiple
+	return splitStream(data, dst, size, perShard)
+}
+
+// Join the data shards and write the data segment to dst.
+func (r *leopardStream) Join(dst io.Writer, shards []io.Reader, outSize int64) error {
+	return joinStream(dst, shards, r.dataShards, outSize)
+}
+
+// Check the interfaces are satisfied
+var _ StreamEncoder = (*leopardStream)(nil)
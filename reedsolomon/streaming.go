@@ -8,436 +8,12 @@
 package reedsolomon
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
-	"flag"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
 	"sync"
-
-	v2 "github.com/flew-software/filecrypt"
-	"github.com/rclone/rclone/fs/config"
 )
 
-var shardDir = "shard"
-
-var dataShards = flag.Int("data", 170, "Number of shards to split the data into, must be below 257.")
-var parShards = flag.Int("par", 85, "Number of parity shards")
-
-const fileCryptExtension string = ".fcef"
-
-var outFile = flag.String("out", "", "Alternative output path/file")
-
-var app = v2.App{
-	FileCryptExtension: fileCryptExtension,
-	Overwrite:          true,
-}
-
-func init() {
-	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "  %s [-flags] filename.ext\n\n", os.Args[0])
-		fmt.Fprintf(os.Stderr, "Valid flags:\n")
-		flag.PrintDefaults()
-	}
-}
-func GetShardDir() (string, error) {
-	fullConfigPath := config.GetConfigPath()
-	path := filepath.Dir(fullConfigPath)
-	filepath := filepath.Join(path, "shard")
-
-	return filepath, nil
-}
-
-func DeleteShardWithFileNames(fileNames []string) {
-	dir, _ := GetShardDir()
-	for _, fileName := range fileNames {
-		filePath := filepath.Join(dir, fileName)
-
-		err := os.Remove(filePath)
-		if err != nil {
-			fmt.Printf("Error deleting file %s: %v\n", filePath, err)
-			continue
-		}
-	}
-}
-func DeleteShardDir() {
-
-	dir, err := GetShardDir()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error getting shard directory: %v\n", err)
-		return
-	}
-
-	files, err := os.ReadDir(dir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading shard directory: %v\n", err)
-		return
-	}
-
-	for _, file := range files {
-		filePath := filepath.Join(dir, file.Name())
-		if err := os.RemoveAll(filePath); err != nil {
-			fmt.Fprintf(os.Stderr, "Error deleting file %s: %v\n", filePath, err)
-			continue
-		}
-	}
-}
-
-func calculateShardsNum(filename string) {
-	const minSize = 10 * 1024 * 1024
-
-	fileInfo, err := os.Stat(filename)
-	checkErr(err)
-
-	fileSize := fileInfo.Size()
-
-	if fileSize < minSize {
-		*dataShards = 5
-		*parShards = 3
-	} else {
-
-		for fileSize/int64(*dataShards) < minSize && *dataShards > 10 {
-			*dataShards -= 10
-		}
-
-		*parShards = *dataShards / 2
-	}
-}
-
-func DoEncode(fname string, password string) ([]string, []string, int64, int64, int, int) {
-	var paths []string
-	var checksums []string
-	var padding int64
-
-	// Create Dir to save shards
-	path, _ := GetShardDir()
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		err := os.Mkdir(path, 0755)
-		checkErr(err)
-	}
-
-	calculateShardsNum(fname)
-
-	// Encrypt the file
-	encFile, err := app.Encrypt(fname, v2.Passphrase(password))
-	checkErr(err)
-
-	if (*dataShards + *parShards) > 256 {
-		fmt.Fprintf(os.Stderr, "Error: sum of data and parity shards cannot exceed 256\n")
-		os.Exit(1)
-	}
-
-	// Create encoding matrix.
-	enc, err := NewStream(*dataShards, *parShards)
-	checkErr(err)
-
-	fmt.Println("Opening", encFile)
-	f, err := os.Open(encFile)
-	checkErr(err)
-
-	instat, err := f.Stat()
-	checkErr(err)
-
-	shards := *dataShards + *parShards
-	out := make([]*os.File, shards)
-
-	// Create the resulting files.
-	_, file := filepath.Split(encFile)
-
-	// Get path and checksum of all shards
-	for i := range out {
-		outfn := fmt.Sprintf("%s.%d", file, i)
-		fmt.Println("Creating", outfn)
-		out[i], err = os.Create(filepath.Join(path, outfn))
-		checkErr(err)
-
-		paths = append(paths, out[i].Name())
-		fmt.Printf("name : %s \n", out[i].Name())
-	}
-
-	// Split into files.
-	data := make([]io.Writer, *dataShards)
-	for i := range data {
-		data[i] = out[i]
-	}
-	// Do the split
-	padding, err = enc.Split(f, data, instat.Size())
-	fmt.Printf("Padding : %d\n", padding)
-	checkErr(err)
-
-	// Close and re-open the files.
-	input := make([]io.Reader, *dataShards)
-
-	for i := range data {
-		out[i].Close()
-		f, err := os.Open(out[i].Name())
-		checkErr(err)
-		input[i] = f
-
-		defer f.Close()
-		checksum, err := calculateChecksum(out[i].Name())
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: calculating checksum\n")
-			os.Exit(1)
-		}
-		checksums = append(checksums, checksum)
-	}
-
-	// Create parity output writers
-	parity := make([]io.Writer, *parShards)
-	for i := range parity {
-		parity[i] = out[*dataShards+i]
-		// defer out[*dataShards+i].Close()
-	}
-
-	// Calculate the size Per Shard
-	fileShard, err := os.Open(paths[1])
-	checkErr(err)
-
-	fInfo, err := fileShard.Stat()
-	checkErr(err)
-
-	sizePerShard := int64(fInfo.Size())
-
-	fileShard.Close()
-
-	// Encode parity
-	err = enc.Encode(input, parity)
-	checkErr(err)
-	fmt.Printf("File split into %d data + %d parity shards.\n", *dataShards, *parShards)
-
-	//Calculate Shard Checksums.
-	for i := range parity {
-		out[*dataShards+i].Close()
-		checksum, err := calculateChecksum(out[*dataShards+i].Name())
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error: calculating checksum\n")
-			os.Exit(1)
-		}
-		checksums = append(checksums, checksum)
-	}
-
-	// Remove the Encrypted file
-	err = os.Remove(encFile)
-	checkErr(err)
-
-	return paths, checksums, sizePerShard, padding, *dataShards, *parShards
-}
-
-func trimPadding(f *os.File, trimSize int64) {
-	_, err := f.Seek(0, io.SeekEnd)
-	checkErr(err)
-
-	// Get the current size of the file
-	stat, err := f.Stat()
-	checkErr(err)
-	fmt.Printf("trimSize : %d\n", trimSize)
-	// Check if file size is larger than expected size
-	if stat.Size() > trimSize {
-		buf := make([]byte, trimSize)
-		_, err = f.Seek(-trimSize, io.SeekEnd)
-		checkErr(err)
-
-		n, err := f.Read(buf)
-		checkErr(err)
-
-		// Count how many null bytes are at the end of the file
-		var nullByteCount int64 // Change to int64
-		for _, b := range buf[:n] {
-			if b == 0x00 {
-				nullByteCount++
-			} else {
-				break
-			}
-		}
-
-		// If we found enough null bytes, we should trim them
-		if nullByteCount == trimSize {
-			err := f.Truncate(stat.Size() - trimSize)
-			checkErr(err)
-			fmt.Printf("Trimmed %d null bytes from the end of the file\n", trimSize)
-		} else {
-			// If we don't find enough null bytes, just trim excess bytes
-			err := f.Truncate(trimSize)
-			checkErr(err)
-			fmt.Printf("Trimmed excess bytes, keeping only %d bytes\n", trimSize)
-		}
-	}
-}
-
-func DoDecode(fname string, outfn string, padding int64, confChecksums map[string]string, downloadshard int, downloadparity int, password string) error {
-	// ConfChecksums is the checksums from configfile
-
-	fname = fmt.Sprintf("%s%s", fname, fileCryptExtension)
-	shardDir, _ := GetShardDir()
-	fmt.Printf("outfn: %s, fname: %s\n", outfn, fname)
-
-	// Create Dir to save Decoded file
-	if _, err := os.Stat(outfn); os.IsNotExist(err) {
-		err := os.Mkdir(outfn, 0755)
-		return err
-	}
-
-	// Caclulate downloaded Checksum of Shards
-	shardChecksums := make(map[string]string)
-	for i := 0; i < len(confChecksums); i++ {
-		tmpPath := fmt.Sprintf("%s/%s.%d", shardDir, fname, i)
-		fileName := fmt.Sprintf("%s.%d", fname, i)
-		fmt.Println("===" + tmpPath + "===")
-		tmpChecksum, _ := calculateChecksum(tmpPath)
-		fmt.Println(tmpPath + "'s checksum is ::: " + tmpChecksum)
-		shardChecksums[fileName] = tmpChecksum
-	}
-	tmpPath := fmt.Sprintf("%s/%s", shardDir, fname)
-
-	// Compare Two shard dir and Delete if error occured
-	compareandDeleteChecksum(shardChecksums, confChecksums, tmpPath)
-
-	// Create matrix
-	enc, err := NewStream(downloadshard, downloadparity)
-	if err != nil {
-		return err
-	}
-
-	// Open the inputs
-	shards, size, err := openInput(downloadshard, downloadparity, fname)
-	if err != nil {
-		return err
-	}
-
-	// Verify the shards
-	ok, err := enc.Verify(shards)
-	if ok {
-		closeInput(shards)
-		fmt.Println("No reconstruction needed")
-	} else {
-		fmt.Println("Verification failed. Reconstructing data")
-		closeInput(shards)
-
-		shards, size, err = openInput(downloadshard, downloadparity, fname)
-		if err != nil {
-			return err
-		}
-
-		// Create out destination writers
-		out := make([]io.Writer, len(shards))
-		for i := range out {
-			if shards[i] == nil {
-				path, _ := GetShardDir()
-				outfn := filepath.Join(path, fmt.Sprintf("%s.%d", fname, i))
-				fmt.Println("Creating", outfn)
-				out[i], err = os.Create(outfn)
-				if err != nil {
-					return err
-				}
-			}
-		}
-		err = enc.Reconstruct(shards, out)
-		if err != nil {
-			fmt.Println("Reconstruct failed -", err)
-			return err
-		}
-		// Close output.
-		for i := range out {
-			if out[i] != nil {
-				err := out[i].(*os.File).Close()
-				if err != nil {
-					return err
-				}
-			}
-		}
-		shards, size, err = openInput(downloadshard, downloadparity, fname)
-		ok, err = enc.Verify(shards)
-		if !ok {
-			fmt.Println("Verification failed after reconstruction, data likely corrupted:", err)
-			return err
-		}
-
-		if err != nil {
-			return err
-		}
-
-	}
-	outfn = filepath.Join(outfn, fname)
-
-	fmt.Println("Writing data to", outfn)
-	f, err := os.Create(outfn)
-	if err != nil {
-		return err
-	}
-
-	shards, size, err = openInput(downloadshard, downloadparity, fname)
-	if err != nil {
-		return err
-	}
-
-	// We don't know the exact filesize.
-	err = enc.Join(f, shards, int64(downloadshard)*size)
-	if err != nil {
-		return err
-	}
-	if padding > 0 {
-		trimPadding(f, padding)
-	}
-	originFile, err := app.Decrypt(outfn, v2.Passphrase(password))
-	fmt.Println("====  origin file Location ", originFile)
-	if err != nil {
-		return err
-	}
-	f.Close()
-
-	// Remove the Decodeded file
-	err = os.Remove(outfn)
-	if err != nil {
-		return err
-	}
-
-	closeInput(shards)
-
-	return nil
-}
-
-func openInput(dataShards, parShards int, fname string) (r []io.Reader, size int64, err error) {
-	// Create shards and load the data.
-	shards := make([]io.Reader, dataShards+parShards)
-	for i := range shards {
-		path, err := GetShardDir()
-		infn := filepath.Join(path, fmt.Sprintf("%s.%d", fname, i))
-		fmt.Println("Opening", infn)
-		f, err := os.Open(infn)
-		if err != nil {
-			fmt.Println("Error reading file", err)
-			shards[i] = nil
-			continue
-		} else {
-			shards[i] = f
-		}
-		stat, err := f.Stat()
-		checkErr(err)
-		if stat.Size() > 0 {
-			size = stat.Size()
-		} else {
-			shards[i] = nil
-		}
-	}
-	return shards, size, nil
-}
-
-func closeInput(shards []io.Reader) {
-	for _, r := range shards {
-		if f, ok := r.(*os.File); ok {
-			err := f.Close()
-			if err != nil {
-				fmt.Println("Error closing file:", err)
-			}
-		}
-	}
-}
-
 // StreamEncoder is an interface to encode Reed-Salomon parity sets for your data.
 // It provides a fully streaming interface, and processes data in blocks of up to 4MB.
 //
@@ -952,13 +528,18 @@ func (r *rsStream) Reconstruct(valid []io.Reader, fill []io.Writer) error {
 // If there are to few shards given, ErrTooFewShards will be returned.
 // If the total data size is less than outSize, ErrShortData will be returned.
 func (r *rsStream) Join(dst io.Writer, shards []io.Reader, outSize int64) error {
+	return joinStream(dst, shards, r.r.dataShards, outSize)
+}
+
+// joinStream writes outSize bytes of the first dataShards shards to dst
+func joinStream(dst io.Writer, shards []io.Reader, dataShards int, outSize int64) error {
 	// Do we have enough shards?
-	if len(shards) < r.r.dataShards {
+	if len(shards) < dataShards {
 		return ErrTooFewShards
 	}
 
 	// Trim off parity shards if any
-	shards = shards[:r.r.dataShards]
+	shards = shards[:dataShards]
 	for i := range shards {
 		if shards[i] == nil {
 			return StreamReadError{Err: ErrShardNoData, Stream: i}
@@ -1006,9 +587,15 @@ func (r *rsStream) Split(data io.Reader, dst []io.Writer, size int64) (int64, er
 
 	// Calculate number of bytes per shard.
 	perShard := (size + int64(r.r.dataShards) - 1) / int64(r.r.dataShards)
+	return splitStream(data, dst, size, perShard)
+}
 
+// splitStream copies size bytes of data into dst, perShard bytes to
+// each, filling the last with zeros. It returns the number of zero
+// bytes added.
+func splitStream(data io.Reader, dst []io.Writer, size, perShard int64) (int64, error) {
 	// Calculate padding size.
-	paddingSize := (int64(r.r.totalShards) * perShard) - size
+	paddingSize := (int64(len(dst)) * perShard) - size
 
 	// Create zeroPaddingReader to track padding bytes.
 	paddingReader := &zeroPaddingReader{}
@@ -1042,45 +629,3 @@ func (t *zeroPaddingReader) Read(p []byte) (n int, err error) {
 	t.totalBytes += int64(n)
 	return n, nil
 }
-
-func checkErr(err error) {
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error: %s", err.Error())
-		os.Exit(2)
-	}
-}
-
-func calculateChecksum(filePath string) (string, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to open file for checksum: %v", err)
-	}
-	defer file.Close()
-
-	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", fmt.Errorf("failed to compute checksum: %v", err)
-	}
-	return hex.EncodeToString(hash.Sum(nil)), nil
-}
-
-func compareandDeleteChecksum(serverChecksum map[string]string, confChecksum map[string]string, path string) error {
-
-	fname := filepath.Base(path)
-	numShards := len(confChecksum)
-
-	for i := 0; i < numShards; i++ {
-		fileName := fmt.Sprint("%s.%d", fname, i)
-
-		if serverChecksum[fileName] != confChecksum[fileName] {
-			fileToDelete := fmt.Sprintf("%s.%d", path, i)
-			fmt.Printf("Mismatch for file %s: server checksum %s, conf checksum %s\n", fileToDelete, serverChecksum[fileName], confChecksum[fileName])
-			fmt.Println("Deleting mismatched shard...")
-			if err := os.Remove(fileToDelete); err != nil {
-				return fmt.Errorf("delete failed for %s: %w", fileToDelete, err)
-			}
-		}
-	}
-
-	return nil
-}
@@ -267,6 +267,7 @@ func (d *Dir) forgetDirPath(relativePath string) {
 
 // invalidateDir invalidates the directory cache for absPath relative to the root
 func (d *Dir) invalidateDir(absPath string) {
+	d.vfs.forgetStoredDir(absPath, false)
 	node := d.vfs.root.cachedNode(absPath)
 	if dir, ok := node.(*Dir); ok {
 		dir.mu.Lock()
@@ -308,6 +309,7 @@ func (d *Dir) ForgetPath(relativePath string, entryType fs.EntryType) {
 		d.invalidateDir(vfscommon.FindParent(absPath))
 	}
 	if entryType == fs.EntryDirectory {
+		d.vfs.forgetStoredDir(absPath, true)
 		d.forgetDirPath(relativePath)
 	}
 }
@@ -410,6 +412,7 @@ func (d *Dir) rename(newParent *Dir, fsDir fs.Directory) {
 	d.parent.items[name(d.path)] = d
 	d.read = time.Time{}
 	d.mu.Unlock()
+	d.vfs.forgetStoredDir(oldPath, true)
 
 	// Rename any remaining items in the tree that we couldn't forget
 	d.renameTree(d.path)
@@ -451,7 +454,9 @@ func (d *Dir) addObject(node Node) {
 	d.virtual[leaf] = vAdd
 	d.setHasVirtual(true)
 	fs.Debugf(d.path, "Added virtual directory entry %v: %q", vAdd, leaf)
+	dPath := d.path
 	d.mu.Unlock()
+	d.vfs.forgetStoredDir(dPath, false)
 }
 
 // AddVirtual adds a virtual object of name and size to the directory
@@ -505,7 +510,10 @@ func (d *Dir) delObject(leaf string) {
 	d.virtual[leaf] = vDel
 	d.setHasVirtual(true)
 	fs.Debugf(d.path, "Added virtual directory entry %v: %q", vDel, leaf)
+	dPath := d.path
 	d.mu.Unlock()
+	d.vfs.forgetStoredDir(dPath, false)
+	d.vfs.forgetStoredDir(path.Join(dPath, leaf), true)
 }
 
 // DelVirtual removes an object from the directory listing
@@ -529,6 +537,15 @@ func (d *Dir) _readDir() error {
 	} else {
 		return nil
 	}
+	if d.read.IsZero() && d._readDirFromStore(when) {
+		return nil
+	}
+	return d._listDir(when)
+}
+
+// list the directory from the remote and set d.items and the last read
+// time to when - must be called with the lock held
+func (d *Dir) _listDir(when time.Time) error {
 	entries, err := list.DirSorted(context.TODO(), d.f, false, d.path)
 	if err == fs.ErrorDirNotFound {
 		// We treat directory not found as empty because we
@@ -573,10 +590,54 @@ func (d *Dir) _readDir() error {
 
 	d.read = when
 	d.cleanupTimer.Reset(time.Duration(d.vfs.Opt.DirCacheTime * 2))
+	d.vfs.storeDirs(map[string]fs.DirEntries{d.path: entries}, when)
 
 	return nil
 }
 
+// read the directory from the persistent directory cache if it is in
+// use and has a listing of it, returning true if it was read - must be
+// called with the lock held
+//
+// If the stored listing is older than the directory cache time it is
+// used anyway and refreshed from the remote in the background.
+func (d *Dir) _readDirFromStore(when time.Time) bool {
+	if d.vfs.dirCache == nil {
+		return false
+	}
+	entries, read, found := d.vfs.dirCache.Get(d.path)
+	if !found {
+		return false
+	}
+	if err := d._readDirFromEntries(entries, nil, time.Time{}); err != nil {
+		fs.Debugf(d.path, "Failed to use stored directory listing: %v", err)
+		return false
+	}
+	d.read = read
+	if age, stale := d._age(when); stale {
+		fs.Debugf(d.path, "Using stored directory listing (%v old) while refreshing it", age)
+		d.read = when
+		go d.refreshStored()
+	}
+	d.cleanupTimer.Reset(time.Duration(d.vfs.Opt.DirCacheTime * 2))
+	return true
+}
+
+// refreshStored lists a directory read from the persistent directory
+// cache from the remote, limiting the number of refreshes running at
+// once
+func (d *Dir) refreshStored() {
+	d.vfs.dirRefresh <- struct{}{}
+	defer func() {
+		<-d.vfs.dirRefresh
+	}()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d._listDir(time.Now()); err != nil {
+		fs.Errorf(d.path, "Failed to refresh stored directory listing: %v", err)
+	}
+}
+
 // update d.items for each dir in the DirTree below this one and
 // set the last read time - must be called with the lock held
 func (d *Dir) _readDirFromDirTree(dirTree dirtree.DirTree, when time.Time) error {
@@ -794,6 +855,7 @@ func (d *Dir) readDirTree() error {
 	if err != nil {
 		return err
 	}
+	d.vfs.storeDirs(dt, when)
 	fs.Debugf(d.path, "Reading directory tree done in %s", time.Since(when))
 	d.read = when
 	d.cleanupTimer.Reset(time.Duration(d.vfs.Opt.DirCacheTime * 2))
@@ -805,7 +867,7 @@ func (d *Dir) readDir() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.read = time.Time{}
-	return d._readDir()
+	return d._listDir(time.Now())
 }
 
 // stat a single item in the directory
@@ -1011,6 +1073,9 @@ func (d *Dir) Mkdir(name string) (*Dir, error) {
 		fs.Errorf(d, "Dir.Mkdir failed to read directory: %v", err)
 		return nil, err
 	}
+	if err = d.vfs.checkLock(path, false); err != nil {
+		return nil, err
+	}
 	// fs.Debugf(path, "Dir.Mkdir")
 	err = d.f.Mkdir(context.TODO(), path)
 	if err != nil {
@@ -1043,6 +1108,9 @@ func (d *Dir) Remove() error {
 		fs.Errorf(d, "Dir.Remove not empty")
 		return ENOTEMPTY
 	}
+	if err = d.vfs.checkLock(d.path, false); err != nil {
+		return err
+	}
 	// remove directory
 	err = d.f.Rmdir(context.TODO(), d.path)
 	if err != nil {
@@ -1061,6 +1129,10 @@ func (d *Dir) RemoveAll() error {
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
+	// Don't remove anything if something in the directory is locked
+	if err := d.vfs.checkLock(d.path, true); err != nil {
+		return err
+	}
 	// Remove contents of the directory
 	nodes, err := d.ReadDirAll()
 	if err != nil {
@@ -1116,6 +1188,12 @@ func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
 		fs.Errorf(oldPath, "Dir.Rename error: %v", err)
 		return err
 	}
+	if err = d.vfs.checkLock(oldPath, true); err != nil {
+		return err
+	}
+	if err = d.vfs.checkLock(newPath, true); err != nil {
+		return err
+	}
 	switch x := oldNode.DirEntry().(type) {
 	case nil:
 		if oldFile, ok := oldNode.(*File); ok {
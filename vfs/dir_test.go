@@ -3,6 +3,7 @@ package vfs
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"sort"
 	"testing"
@@ -10,8 +11,12 @@ import (
 	"unsafe"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/rclone/rclone/vfs/vfsdircache"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -607,3 +612,81 @@ func TestDirRename(t *testing.T) {
 func TestDirStructSize(t *testing.T) {
 	t.Logf("Dir struct has size %d bytes", unsafe.Sizeof(Dir{}))
 }
+
+func TestDirPersistentCache(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("persistent directory cache not supported on this OS")
+	}
+	ctx := context.Background()
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	defer func() {
+		_ = config.SetCacheDir(oldCacheDir)
+	}()
+	r := fstest.NewRun(t)
+
+	// Hold the database open between the VFSes as it is removed
+	// when it is first opened by a test binary
+	held, err := vfsdircache.New(ctx, r.Fremote)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, held.Close())
+	}()
+
+	file1 := r.WriteObject(ctx, "dir/file1", "file1 contents", t1)
+	file2 := r.WriteObject(ctx, "dir/file2", "file2- contents", t2)
+	r.CheckRemoteItems(t, file1, file2)
+
+	opt := vfscommon.Opt
+	opt.DirCachePersist = true
+	opt.DirCacheTime = fs.Duration(time.Hour)
+	opt.PollInterval = 0
+	vfs := New(r.Fremote, &opt)
+	node, err := vfs.Stat("dir")
+	require.NoError(t, err)
+	checkListing(t, node.(*Dir), []string{"file1,14,false", "file2,15,false"})
+	assert.Equal(t, 2, vfs.dirCache.Len())
+	cleanupVFS(t, vfs)
+
+	// Change the remote behind the VFS's back
+	obj, err := r.Fremote.NewObject(ctx, "dir/file2")
+	require.NoError(t, err)
+	require.NoError(t, obj.Remove(ctx))
+	file3 := r.WriteObject(ctx, "dir/file3", "file3-- contents", t3)
+	r.CheckRemoteItems(t, file1, file3)
+
+	// A new VFS uses the stored listing without listing the remote
+	vfs = New(r.Fremote, &opt)
+	defer cleanupVFS(t, vfs)
+	node, err = vfs.Stat("dir")
+	require.NoError(t, err)
+	dir := node.(*Dir)
+	checkListing(t, dir, []string{"file1,14,false", "file2,15,false"})
+
+	// Files from the stored listing can be read
+	fd, err := vfs.Open("dir/file1")
+	require.NoError(t, err)
+	data, err := io.ReadAll(fd)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+	assert.Equal(t, "file1 contents", string(data))
+
+	// Change notifications remove the stored listing
+	vfs.root.changeNotify("dir/file3", fs.EntryObject)
+	assert.Equal(t, 1, vfs.dirCache.Len())
+	checkListing(t, dir, []string{"file1,14,false", "file3,16,false"})
+	assert.Equal(t, 2, vfs.dirCache.Len())
+
+	// A stale stored listing is used then refreshed in the background
+	vfs.FlushDirCache()
+	assert.Equal(t, 0, vfs.dirCache.Len())
+	require.NoError(t, vfs.dirCache.Put("dir", fs.DirEntries{fs.NewDir("dir/old", t1)}, time.Now().Add(-2*time.Hour)))
+	node, err = vfs.Stat("dir")
+	require.NoError(t, err)
+	dir = node.(*Dir)
+	checkListing(t, dir, []string{"old,0,true"})
+	assert.Eventually(t, func() bool {
+		nodes, err := dir.ReadDirAll()
+		return err == nil && len(nodes) == 2 && nodes[0].Name() == "file1" && nodes[1].Name() == "file3"
+	}, 10*time.Second, 10*time.Millisecond)
+}
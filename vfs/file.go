@@ -13,9 +13,11 @@ import (
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/audit"
 	"github.com/rclone/rclone/fs/log"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/rclone/rclone/vfs/vfsdircache"
 )
 
 // The File object is tightly coupled to the Dir object. Since they
@@ -263,6 +265,16 @@ func (f *File) rename(ctx context.Context, destDir *Dir, newName string) error {
 				return nil // no need to rename
 			}
 
+			// find the real object if it came from a stored listing
+			// so the backend can move it server-side
+			if stored, ok := o.(*vfsdircache.Object); ok {
+				o, err = stored.Resolve(ctx)
+				if err != nil {
+					fs.Errorf(f.Path(), "File.Rename error: %v", err)
+					return err
+				}
+			}
+
 			// do the move of the remote object
 			dstOverwritten, _ := d.Fs().NewObject(ctx, newPath)
 			newObject, err = operations.Move(ctx, d.Fs(), dstOverwritten, newPath, o)
@@ -460,6 +472,9 @@ func (f *File) SetModTime(modTime time.Time) error {
 	if f.d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
+	if err := f.d.vfs.checkLock(f._path(), false); err != nil {
+		return err
+	}
 
 	f.pendingModTime = modTime
 
@@ -501,6 +516,7 @@ func (f *File) _applyPendingModTime() error {
 	switch err {
 	case nil:
 		fs.Debugf(f.o, "Applied pending mod time %v OK", f.pendingModTime)
+		audit.Object(context.TODO(), audit.OpSetMetadata, f.o, nil)
 	case fs.ErrorCantSetModTime, fs.ErrorCantSetModTimeWithoutDelete:
 		// do nothing, in order to not break "touch somefile" if it exists already
 	default:
@@ -670,6 +686,9 @@ func (f *File) Remove() (err error) {
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
+	if err := d.vfs.checkLock(f.Path(), false); err != nil {
+		return err
+	}
 
 	// Remove the object from the cache
 	wasWriting := false
@@ -681,6 +700,9 @@ func (f *File) Remove() (err error) {
 	f.mu.Lock()   // deadlock in RWFileHandle.openPending and .close
 	if f.o != nil {
 		err = f.o.Remove(context.TODO())
+		if err == nil {
+			audit.Object(context.TODO(), audit.OpDelete, f.o, nil)
+		}
 	}
 	f.mu.Unlock()
 	f.muRW.Unlock()
@@ -888,6 +910,11 @@ func (f *File) Open(flags int) (fd Handle, err error) {
 	f.mu.RLock()
 	d := f.d
 	f.mu.RUnlock()
+	if write {
+		if err := d.vfs.checkLock(f.Path(), false); err != nil {
+			return nil, err
+		}
+	}
 	CacheMode := d.vfs.Opt.CacheMode
 	if CacheMode >= vfscommon.CacheModeMinimal && (d.vfs.cache.InUse(f.CachePath()) || d.vfs.cache.Exists(f.CachePath())) {
 		fd, err = f.openRW(flags)
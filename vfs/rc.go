@@ -73,6 +73,9 @@ starting with dir will refresh that directory, e.g.
 
 If the parameter recursive=true is given the whole directory tree
 will get refreshed. This refresh will use --fast-list if enabled.
+
+With --vfs-cache-mode full any new or changed pinned files in the
+refreshed directories are downloaded into the cache.
 ` + getVFSHelp,
 	})
 }
@@ -133,6 +136,9 @@ func rcRefresh(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 			result[""] = err.Error()
 		} else {
 			result[""] = "OK"
+			if vfs.cache != nil {
+				vfs.cache.Changed("")
+			}
 		}
 	} else {
 		for k, v := range in {
@@ -154,6 +160,9 @@ func rcRefresh(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 						result[path] = err.Error()
 					} else {
 						result[path] = "OK"
+						if vfs.cache != nil {
+							vfs.cache.Changed(dir.Path())
+						}
 					}
 				}
 			} else {
@@ -204,7 +213,7 @@ func rcForget(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 
 	forgotten := []string{}
 	if len(in) == 0 {
-		root.ForgetAll()
+		vfs.FlushDirCache()
 	} else {
 		for k, v := range in {
 			path, ok := v.(string)
@@ -401,6 +410,8 @@ This returns stats for the selected VFS.
     {
         // Status of the disk cache - only present if --vfs-cache-mode > off
         "diskCache": {
+            "bytesDirty": 0,
+            "bytesPinned": 0,
             "bytesUsed": 0,
             "erroredFiles": 0,
             "files": 0,
@@ -408,6 +419,7 @@ This returns stats for the selected VFS.
             "outOfSpace": false,
             "path": "/home/user/.cache/rclone/vfs/local/mnt/a",
             "pathMeta": "/home/user/.cache/rclone/vfsMeta/local/mnt/a",
+            "pins": [],
             "uploadsInProgress": 0,
             "uploadsQueued": 0
         },
@@ -546,3 +558,89 @@ func rcQueueSetExpiry(ctx context.Context, in rc.Params) (out rc.Params, err err
 	err = vfs.cache.QueueSetExpiry(writeback.Handle(id), expiryTime)
 	return nil, err
 }
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vfs/pin",
+		Title: "Pin a path in the VFS cache.",
+		Help: strings.ReplaceAll(`
+This pins a file or directory so it is downloaded into the VFS cache
+in the background and is never evicted from it. Everything inside a
+pinned directory is pinned, including files added to it later.
+
+This needs |--vfs-cache-mode full|.
+
+    rclone rc vfs/pin path=projects/thesis
+
+If |path| is not supplied then it just returns the pinned paths.
+
+    {
+        "pins": [
+            "projects/thesis"
+        ]
+    }
+
+Pins are remembered between runs. Use |vfs/unpin| to remove them and
+|vfs/stats| to see how many bytes of the cache are pinned.
+`, "|", "`") + getVFSHelp,
+		Fn: rcPin,
+	})
+}
+
+func rcPin(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	vfs, err := getVFS(in)
+	if err != nil {
+		return nil, err
+	}
+	if vfs.cache == nil {
+		return nil, rc.NewErrParamInvalid(errors.New("can't call this unless using the VFS cache"))
+	}
+	name, err := in.GetString("path")
+	if err == nil {
+		err = vfs.cache.Pin(name)
+		if err != nil {
+			return nil, err
+		}
+	} else if !rc.IsErrParamNotFound(err) {
+		return nil, err
+	}
+	return rc.Params{"pins": vfs.cache.Pins()}, nil
+}
+
+func init() {
+	rc.Add(rc.Call{
+		Path:  "vfs/unpin",
+		Title: "Unpin a path in the VFS cache.",
+		Help: strings.ReplaceAll(`
+This unpins a path pinned with |vfs/pin| so it can be evicted from
+the VFS cache as normal. The files already downloaded stay in the
+cache until |--vfs-cache-max-age| or |--vfs-cache-max-size| removes
+them.
+
+    rclone rc vfs/unpin path=projects/thesis
+
+It returns the remaining pinned paths in the same format as |vfs/pin|.
+Paths pinned with |--vfs-cache-pin| can't be unpinned.
+`, "|", "`") + getVFSHelp,
+		Fn: rcUnpin,
+	})
+}
+
+func rcUnpin(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	vfs, err := getVFS(in)
+	if err != nil {
+		return nil, err
+	}
+	if vfs.cache == nil {
+		return nil, rc.NewErrParamInvalid(errors.New("can't call this unless using the VFS cache"))
+	}
+	name, err := in.GetString("path")
+	if err != nil {
+		return nil, err
+	}
+	err = vfs.cache.Unpin(name)
+	if err != nil {
+		return nil, err
+	}
+	return rc.Params{"pins": vfs.cache.Pins()}, nil
+}
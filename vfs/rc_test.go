@@ -97,7 +97,8 @@ func TestRcPollInterval(t *testing.T) {
 	}
 	out, err := call.Fn(context.Background(), nil)
 	require.NoError(t, err)
-	assert.Equal(t, rc.Params{}, out)
+	assert.Equal(t, true, out["enabled"])
+	assert.Equal(t, true, out["supported"])
 	// FIXME needs more tests
 }
 
@@ -125,3 +126,43 @@ func TestRcStats(t *testing.T) {
 	assert.Equal(t, 1, out["metadataCache"].(rc.Params)["dirs"])
 	assert.Equal(t, vfs.Opt, out["opt"].(vfscommon.Options))
 }
+
+func TestRcPin(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping test on non local remote")
+	}
+	ctx := context.Background()
+	pin := rc.Calls.Get("vfs/pin")
+
+	// Needs the cache
+	_, _ = newTestVFS(t)
+	_, err := pin.Fn(ctx, rc.Params{"path": "dir"})
+	assert.ErrorContains(t, err, "VFS cache")
+}
+
+func TestRcPinCache(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping test on non local remote")
+	}
+	ctx := context.Background()
+	pin := rc.Calls.Get("vfs/pin")
+	unpin := rc.Calls.Get("vfs/unpin")
+	opt := vfscommon.Opt
+	opt.CacheMode = vfscommon.CacheModeFull
+	_, _ = newTestVFSOpt(t, &opt)
+
+	out, err := pin.Fn(ctx, rc.Params{"path": "dir"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"pins": []string{"dir"}}, out)
+
+	out, err = pin.Fn(ctx, rc.Params{})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"pins": []string{"dir"}}, out)
+
+	_, err = unpin.Fn(ctx, rc.Params{"path": "other"})
+	assert.Error(t, err)
+
+	out, err = unpin.Fn(ctx, rc.Params{"path": "dir"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{"pins": []string{}}, out)
+}
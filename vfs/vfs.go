@@ -23,6 +23,7 @@ package vfs
 import (
 	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -41,6 +42,8 @@ import (
 	"github.com/rclone/rclone/fs/walk"
 	"github.com/rclone/rclone/vfs/vfscache"
 	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/rclone/rclone/vfs/vfsdircache"
+	"github.com/rclone/rclone/vfs/vfslock"
 )
 
 //go:embed vfs.md
@@ -178,6 +181,9 @@ type VFS struct {
 	Opt         vfscommon.Options
 	cache       *vfscache.Cache
 	cancelCache context.CancelFunc
+	dirCache    *vfsdircache.Cache // persistent directory listings - may be nil
+	dirRefresh  chan struct{}      // limits background refreshes of stored listings
+	locks       *vfslock.Locks     // locks to respect - may be nil
 	usageMu     sync.Mutex
 	usageTime   time.Time
 	usage       *fs.Usage
@@ -224,6 +230,15 @@ func New(f fs.Fs, opt *vfscommon.Options) *VFS {
 	// Put the VFS into the active cache
 	active[configName] = append(active[configName], vfs)
 
+	// Open the persistent directory cache before anything is listed
+	if vfs.Opt.DirCachePersist {
+		vfs.openDirCache()
+	}
+
+	if vfs.Opt.RespectLocks {
+		vfs.openLocks()
+	}
+
 	// Create root directory
 	vfs.root = newDir(vfs, f, nil, fsDir)
 
@@ -231,7 +246,7 @@ func New(f fs.Fs, opt *vfscommon.Options) *VFS {
 	features := vfs.f.Features()
 	if do := features.ChangeNotify; do != nil {
 		vfs.pollChan = make(chan time.Duration)
-		do(context.TODO(), vfs.root.changeNotify, vfs.pollChan)
+		do(context.TODO(), vfs.changeNotify, vfs.pollChan)
 		vfs.pollChan <- time.Duration(vfs.Opt.PollInterval)
 	} else if vfs.Opt.PollInterval > 0 {
 		fs.Infof(f, "poll-interval is not supported by this remote")
@@ -263,6 +278,14 @@ func New(f fs.Fs, opt *vfscommon.Options) *VFS {
 	return vfs
 }
 
+// changeNotify is called by the remote when relativePath changes
+func (vfs *VFS) changeNotify(relativePath string, entryType fs.EntryType) {
+	vfs.root.changeNotify(relativePath, entryType)
+	if vfs.cache != nil {
+		vfs.cache.Changed(relativePath)
+	}
+}
+
 // refresh the directory cache for all directories
 func (vfs *VFS) refresh() {
 	fs.Debugf(vfs.f, "Refreshing VFS directory cache")
@@ -272,6 +295,70 @@ func (vfs *VFS) refresh() {
 	}
 }
 
+// openDirCache opens the persistent directory cache, disabling it on error
+func (vfs *VFS) openDirCache() {
+	ctx := context.Background()
+	dirCache, err := vfsdircache.New(ctx, vfs.f)
+	if err != nil {
+		fs.Errorf(vfs.f, "Failed to open persistent directory cache - disabling: %v", err)
+		vfs.Opt.DirCachePersist = false
+		return
+	}
+	vfs.dirCache = dirCache
+	vfs.dirRefresh = make(chan struct{}, fs.GetConfig(ctx).Checkers)
+}
+
+// openLocks opens the lock database, disabling lock checks on error
+func (vfs *VFS) openLocks() {
+	locks, err := vfslock.New(context.Background(), vfs.f)
+	if err != nil {
+		fs.Errorf(vfs.f, "Failed to open lock database - not respecting locks: %v", err)
+		vfs.Opt.RespectLocks = false
+		return
+	}
+	vfs.locks = locks
+}
+
+// checkLock returns EPERM if name, or anything below it if recursive
+// is set, is locked and locks are being respected
+func (vfs *VFS) checkLock(name string, recursive bool) error {
+	if vfs.locks == nil {
+		return nil
+	}
+	err := vfs.locks.Check(time.Now(), name, recursive)
+	if errors.Is(err, vfslock.ErrLocked) {
+		fs.Infof(name, "Refusing to change: %v", err)
+		return EPERM
+	} else if err != nil {
+		fs.Errorf(name, "Failed to check locks: %v", err)
+		return err
+	}
+	return nil
+}
+
+// storeDirs saves the listings of the directories in the persistent
+// directory cache if it is in use
+func (vfs *VFS) storeDirs(listings map[string]fs.DirEntries, when time.Time) {
+	if vfs.dirCache == nil {
+		return
+	}
+	if err := vfs.dirCache.PutAll(listings, when); err != nil {
+		fs.Errorf(vfs.f, "Failed to store %d directory listings: %v", len(listings), err)
+	}
+}
+
+// forgetStoredDir removes the stored listing of dir, and of the
+// directories below it if recursive is set, from the persistent
+// directory cache if it is in use
+func (vfs *VFS) forgetStoredDir(dir string, recursive bool) {
+	if vfs.dirCache == nil {
+		return
+	}
+	if err := vfs.dirCache.Remove(dir, recursive); err != nil {
+		fs.Errorf(dir, "Failed to remove stored directory listing: %v", err)
+	}
+}
+
 // Stats returns info about the VFS
 func (vfs *VFS) Stats() (out rc.Params) {
 	out = make(rc.Params)
@@ -291,6 +378,9 @@ func (vfs *VFS) Stats() (out rc.Params) {
 	out["metadataCache"] = inf
 	inf["dirs"] = dirs
 	inf["files"] = files
+	if vfs.dirCache != nil {
+		inf["storedDirs"] = vfs.dirCache.Len()
+	}
 
 	if vfs.cache != nil {
 		out["diskCache"] = vfs.cache.Stats()
@@ -365,6 +455,18 @@ func (vfs *VFS) Shutdown() {
 	activeMu.Unlock()
 
 	vfs.shutdownCache()
+
+	if vfs.dirCache != nil {
+		if err := vfs.dirCache.Close(); err != nil {
+			fs.Errorf(vfs.f, "Failed to close persistent directory cache: %v", err)
+		}
+	}
+
+	if vfs.locks != nil {
+		if err := vfs.locks.Close(); err != nil {
+			fs.Errorf(vfs.f, "Failed to close lock database: %v", err)
+		}
+	}
 }
 
 // CleanUp deletes the contents of the on disk cache
@@ -375,8 +477,10 @@ func (vfs *VFS) CleanUp() error {
 	return vfs.cache.CleanUp()
 }
 
-// FlushDirCache empties the directory cache
+// FlushDirCache empties the directory cache including any listings
+// kept on disk
 func (vfs *VFS) FlushDirCache() {
+	vfs.forgetStoredDir("", true)
 	vfs.root.ForgetAll()
 }
 
@@ -13,8 +13,11 @@ import (
 
 	_ "github.com/rclone/rclone/backend/all" // import all the backends
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
 	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/kv"
 	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/rclone/rclone/vfs/vfslock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -487,3 +490,59 @@ func TestFillInMissingSizes(t *testing.T) {
 		})
 	}
 }
+
+func TestVFSRespectLocks(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("locks not supported on this OS")
+	}
+	ctx := context.Background()
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	defer func() {
+		_ = config.SetCacheDir(oldCacheDir)
+	}()
+	r := fstest.NewRun(t)
+	file1 := r.WriteObject(ctx, "dir/file1", "file1 contents", t1)
+	file2 := r.WriteObject(ctx, "dir/file2", "file2- contents", t2)
+	r.CheckRemoteItems(t, file1, file2)
+
+	// Lock a file as a WebDAV server would
+	locks, err := vfslock.New(ctx, r.Fremote)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, locks.Close())
+	}()
+	lock, err := locks.Create(time.Now(), vfslock.Lock{Root: "dir/file1", ZeroDepth: true, Duration: time.Hour})
+	require.NoError(t, err)
+
+	opt := vfscommon.Opt
+	opt.RespectLocks = true
+	vfs := New(r.Fremote, &opt)
+	defer cleanupVFS(t, vfs)
+
+	// The locked file can be read but not changed
+	fd, err := vfs.OpenFile("dir/file1", os.O_RDONLY, 0)
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+	_, err = vfs.OpenFile("dir/file1", os.O_WRONLY|os.O_TRUNC, 0)
+	assert.Equal(t, EPERM, err)
+	assert.Equal(t, EPERM, vfs.Remove("dir/file1"))
+	assert.Equal(t, EPERM, vfs.Rename("dir/file1", "dir/file3"))
+	assert.Equal(t, EPERM, vfs.Rename("dir/file2", "dir/file1"))
+	assert.Equal(t, EPERM, vfs.Rename("dir", "dir2"))
+	node, err := vfs.Stat("dir")
+	require.NoError(t, err)
+	assert.Equal(t, EPERM, node.RemoveAll())
+	node, err = vfs.Stat("dir/file1")
+	require.NoError(t, err)
+	assert.Equal(t, EPERM, node.SetModTime(t2))
+
+	// Other files can be changed
+	require.NoError(t, vfs.Remove("dir/file2"))
+	r.CheckRemoteItems(t, file1)
+
+	// Once unlocked the file can be changed
+	require.NoError(t, locks.Unlock(time.Now(), lock.Token))
+	require.NoError(t, vfs.Remove("dir/file1"))
+	r.CheckRemoteItems(t)
+}
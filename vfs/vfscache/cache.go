@@ -51,6 +51,7 @@ type Cache struct {
 	hashOption *fs.HashesOption     // corresponding OpenOption
 	writeback  *writeback.WriteBack // holds Items for writeback
 	avFn       AddVirtualFn         // if set, can be called to add dir entries
+	pins       *pins                // paths to keep downloaded
 
 	mu            sync.Mutex       // protects the following variables
 	cond          sync.Cond        // cond lock for synchronous cache cleaning
@@ -106,6 +107,16 @@ func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVir
 	fs.Debugf(nil, "vfs cache: data root is %q", dataOSPath)
 	fs.Debugf(nil, "vfs cache: metadata root is %q", metaOSPath)
 
+	// Load the pinned paths
+	pinOSPath, err := createRootDir(parentOSPath, "vfsPin", relativeDirOSPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pin directory: %w", err)
+	}
+	pins, err := newPins(pinOSPath, opt.CachePin, opt.CachePinListAll)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get (create) cache backends
 	var fdata, fmeta fs.Fs
 	if fdata, fmeta, err = getBackends(ctx, parentPath, relativeDirPath); err != nil {
@@ -127,6 +138,7 @@ func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVir
 		hashOption: hashOption,
 		writeback:  writeback.New(ctx, opt),
 		avFn:       avFn,
+		pins:       pins,
 	}
 
 	// load in the cache and metadata off disk
@@ -144,6 +156,11 @@ func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVir
 
 	go c.cleaner(ctx)
 
+	// Only full mode can read files from the cache while offline
+	if opt.CacheMode >= vfscommon.CacheModeFull {
+		go c.prefetcher(ctx)
+	}
+
 	return c, nil
 }
 
@@ -167,6 +184,19 @@ func (c *Cache) Stats() (out rc.Params) {
 	out["bytesUsed"] = c.used
 	out["outOfSpace"] = c.outOfSpace
 
+	var bytesPinned, bytesDirty int64
+	for name, item := range c.item {
+		if c.isPinned(name) {
+			bytesPinned += item.getDiskSize()
+		}
+		if item.IsDirty() {
+			bytesDirty += item.getDiskSize()
+		}
+	}
+	out["bytesPinned"] = bytesPinned
+	out["bytesDirty"] = bytesDirty
+	out["pins"] = c.pins.list()
+
 	return out
 }
 
@@ -499,10 +529,14 @@ func (c *Cache) SetModTime(name string, modTime time.Time) {
 func (c *Cache) CleanUp() error {
 	err1 := os.RemoveAll(c.root)
 	err2 := os.RemoveAll(c.metaRoot)
+	err3 := os.RemoveAll(c.pinsDir())
 	if err1 != nil {
 		return err1
 	}
-	return err2
+	if err2 != nil {
+		return err2
+	}
+	return err3
 }
 
 // walk walks the cache calling the function
@@ -583,6 +617,9 @@ func (c *Cache) KickCleaner() {
 // removeNotInUse removes items not in use with a possible maxAge cutoff
 // called with cache mutex locked and up-to-date c.used (as we update it directly here)
 func (c *Cache) removeNotInUse(item *Item, maxAge time.Duration, emptyOnly bool) {
+	if c.isPinned(item.name) {
+		return
+	}
 	removed, spaceFreed := item.RemoveNotInUse(maxAge, emptyOnly)
 	// The item space might be freed even if we get an error after the cache file is removed
 	// The item will not be removed or reset the cache data is dirty (DataDirty)
@@ -631,9 +668,9 @@ func (c *Cache) purgeClean() {
 
 	var items Items
 
-	// Make a slice of clean cache files
+	// Make a slice of clean cache files which aren't pinned
 	for _, item := range c.item {
-		if !item.IsDirty() {
+		if !item.IsDirty() && !c.isPinned(item.name) {
 			items = append(items, item)
 		}
 	}
@@ -759,9 +796,9 @@ func (c *Cache) purgeOverQuota() {
 
 	var items Items
 
-	// Make a slice of unused files
+	// Make a slice of unused files which aren't pinned
 	for _, item := range c.item {
-		if !item.inUse() {
+		if !item.inUse() && !c.isPinned(item.name) {
 			items = append(items, item)
 		}
 	}
@@ -511,6 +511,27 @@ func (item *Item) Open(o fs.Object) (err error) {
 	return err
 }
 
+// Prefetch downloads the whole of o into the item unless it is
+// already present, returning when it is done.
+func (item *Item) Prefetch(o fs.Object) (err error) {
+	err = item.Open(o)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		closeErr := item.Close(nil)
+		if err == nil {
+			err = closeErr
+		}
+	}()
+	item.mu.Lock()
+	defer item.mu.Unlock()
+	if item._present() {
+		return nil
+	}
+	return item._ensure(0, item.info.Size)
+}
+
 // Open the local file from the object passed in (which may be nil)
 // which implies we are about to create the file
 func (item *Item) open(o fs.Object) (err error) {
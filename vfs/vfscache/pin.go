@@ -0,0 +1,428 @@
+package vfscache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/vfs/vfscommon"
+)
+
+// pinsFile is the name of the file the pinned paths are saved in
+const pinsFile = "pins.json"
+
+// ErrNotPinned is returned by Unpin if the path wasn't pinned
+var ErrNotPinned = errors.New("path is not pinned")
+
+// pins holds the paths which are kept fully downloaded in the cache
+// and are never evicted from it.
+type pins struct {
+	osPath     string           // file the pinned paths are saved in
+	globs      []*regexp.Regexp // patterns from --vfs-cache-pin
+	roots      []string         // directories to walk for the patterns
+	unanchored bool             // set if any pattern can match anywhere on the remote
+	kick       chan struct{}    // kicks the prefetcher to start
+
+	mu      sync.Mutex          // protects the following variables
+	paths   map[string]struct{} // files and directories pinned with Pin
+	all     bool                // set if all the pinned paths need checking
+	changed map[string]struct{} // paths changed on the remote since the last prefetch
+}
+
+// prefetchRoot is a path to look for pinned files in
+type prefetchRoot struct {
+	path  string // file or directory
+	depth int    // how many levels of directory to list, -1 for all
+}
+
+// newPins reads the pinned paths from the pins file in dir and
+// compiles the comma separated glob patterns passed in.
+//
+// The patterns use CSV quoting so patterns containing commas can be
+// quoted.
+//
+// Patterns which don't start with "/" and a directory can match
+// anywhere so finding all their files means listing the whole remote.
+// This is only done if listAll is set, otherwise their files are only
+// found in the pinned directories and in directories which change.
+func newPins(dir string, patterns string, listAll bool) (*pins, error) {
+	p := &pins{
+		osPath:  filepath.Join(dir, pinsFile),
+		kick:    make(chan struct{}, 1),
+		paths:   make(map[string]struct{}),
+		changed: make(map[string]struct{}),
+	}
+	var list fs.CommaSepList
+	if err := list.Set(patterns); err != nil {
+		return nil, fmt.Errorf("bad --vfs-cache-pin: %w", err)
+	}
+	for _, pattern := range list {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		re, err := filter.GlobPathToRegexp(pattern, false)
+		if err != nil {
+			return nil, fmt.Errorf("bad --vfs-cache-pin pattern %q: %w", pattern, err)
+		}
+		p.globs = append(p.globs, re)
+		root := globRoot(pattern)
+		if root == "" && !listAll {
+			p.unanchored = true
+			continue
+		}
+		p.roots = append(p.roots, root)
+	}
+	data, err := os.ReadFile(p.osPath)
+	if os.IsNotExist(err) {
+		return p, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read pins: %w", err)
+	}
+	var paths []string
+	if err = json.Unmarshal(data, &paths); err != nil {
+		return nil, fmt.Errorf("failed to decode pins: %w", err)
+	}
+	for _, name := range paths {
+		p.paths[clean(name)] = struct{}{}
+	}
+	return p, nil
+}
+
+// globRoot returns the deepest directory a glob pattern can only
+// match below.
+//
+// Patterns which aren't anchored with a leading "/" can match at any
+// level so return the root.
+func globRoot(pattern string) string {
+	if !strings.HasPrefix(pattern, "/") {
+		return ""
+	}
+	var dirs []string
+	segments := strings.Split(pattern[1:], "/")
+	for _, segment := range segments[:len(segments)-1] {
+		if strings.ContainsAny(segment, `*?[{\`) {
+			break
+		}
+		dirs = append(dirs, segment)
+	}
+	return strings.Join(dirs, "/")
+}
+
+// pinsDir returns the directory the pins file is kept in
+func (c *Cache) pinsDir() string {
+	return filepath.Dir(c.pins.osPath)
+}
+
+// _save writes the pinned paths to the pins file
+//
+// call with the lock held
+func (p *pins) _save() error {
+	data, err := json.Marshal(p._list())
+	if err != nil {
+		return fmt.Errorf("failed to encode pins: %w", err)
+	}
+	tmp := p.osPath + ".tmp"
+	if err = os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write pins: %w", err)
+	}
+	if err = os.Rename(tmp, p.osPath); err != nil {
+		return fmt.Errorf("failed to save pins: %w", err)
+	}
+	return nil
+}
+
+// _list returns the pinned paths sorted
+//
+// call with the lock held
+func (p *pins) _list() []string {
+	paths := make([]string, 0, len(p.paths))
+	for name := range p.paths {
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// list returns the pinned paths sorted
+func (p *pins) list() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p._list()
+}
+
+// isPinned returns true if name is pinned or is inside a pinned
+// directory or matches a pinned pattern
+func (p *pins) isPinned(name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for dir := name; ; dir = vfscommon.FindParent(dir) {
+		if _, found := p.paths[dir]; found {
+			return true
+		}
+		if dir == "" {
+			break
+		}
+	}
+	for _, re := range p.globs {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkRoots returns the paths which need walking to find all the
+// pinned files, leaving out any inside another one
+func (p *pins) walkRoots() (roots []string) {
+	all := append(p.list(), p.roots...)
+	sort.Strings(all)
+	for _, name := range all {
+		covered := false
+		for _, root := range roots {
+			if isInside(name, root) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			roots = append(roots, name)
+		}
+	}
+	return roots
+}
+
+// isInside returns true if name is dir or is inside it
+func isInside(name, dir string) bool {
+	return dir == "" || name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+// changedRoots returns the paths which need listing to find the
+// pinned files affected by the changed paths.
+//
+// A changed path inside a walk root is listed completely, as is a
+// walk root inside a changed directory. Otherwise, if there are
+// unanchored patterns, only the changed path itself is listed so
+// the whole remote is never listed for them.
+func (p *pins) changedRoots(changed []string) (roots []prefetchRoot) {
+	walkRoots := p.walkRoots()
+outer:
+	for _, name := range changed {
+		for _, root := range walkRoots {
+			if isInside(name, root) {
+				roots = append(roots, prefetchRoot{path: name, depth: -1})
+				continue outer
+			}
+		}
+		for _, root := range walkRoots {
+			if isInside(root, name) {
+				roots = append(roots, prefetchRoot{path: root, depth: -1})
+			}
+		}
+		if p.unanchored {
+			roots = append(roots, prefetchRoot{path: name, depth: 1})
+		}
+	}
+	return roots
+}
+
+// take returns the paths to look for pinned files in and resets them
+func (p *pins) take() (roots []prefetchRoot) {
+	p.mu.Lock()
+	all := p.all
+	changed := make([]string, 0, len(p.changed))
+	for name := range p.changed {
+		changed = append(changed, name)
+	}
+	sort.Strings(changed)
+	p.all = false
+	p.changed = make(map[string]struct{})
+	p.mu.Unlock()
+	if !all {
+		return p.changedRoots(changed)
+	}
+	for _, root := range p.walkRoots() {
+		roots = append(roots, prefetchRoot{path: root, depth: -1})
+	}
+	// Only the changed paths listed for unanchored patterns aren't
+	// inside the walk roots
+	for _, root := range p.changedRoots(changed) {
+		if root.depth >= 0 {
+			roots = append(roots, root)
+		}
+	}
+	return roots
+}
+
+// Pin name so it is downloaded in the background and is never
+// evicted from the cache.
+//
+// If name is a directory then everything inside it is pinned. This
+// needs --vfs-cache-mode full.
+//
+// name should be a remote path not an osPath
+func (c *Cache) Pin(name string) error {
+	if c.opt.CacheMode < vfscommon.CacheModeFull {
+		return errors.New("pinning needs --vfs-cache-mode full")
+	}
+	name = clean(name)
+	c.pins.mu.Lock()
+	c.pins.paths[name] = struct{}{}
+	err := c.pins._save()
+	c.pins.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	fs.Infof(name, "vfs cache: pinned")
+	c.kickPrefetcher(true)
+	return nil
+}
+
+// Unpin name so it can be evicted from the cache as normal.
+//
+// It returns ErrNotPinned if name wasn't pinned with Pin.
+//
+// name should be a remote path not an osPath
+func (c *Cache) Unpin(name string) error {
+	name = clean(name)
+	c.pins.mu.Lock()
+	defer c.pins.mu.Unlock()
+	if _, found := c.pins.paths[name]; !found {
+		return ErrNotPinned
+	}
+	delete(c.pins.paths, name)
+	err := c.pins._save()
+	if err != nil {
+		return err
+	}
+	fs.Infof(name, "vfs cache: unpinned")
+	return nil
+}
+
+// Pins returns the paths pinned with Pin sorted
+func (c *Cache) Pins() []string {
+	return c.pins.list()
+}
+
+// isPinned returns true if the item called name should not be
+// evicted from the cache
+//
+// name should be a remote path not an osPath
+func (c *Cache) isPinned(name string) bool {
+	return c.pins.isPinned(name)
+}
+
+// Changed should be called when name has changed on the remote, or
+// has been re-read, so any new or changed pinned files in it are
+// downloaded.
+//
+// name should be a remote path not an osPath
+func (c *Cache) Changed(name string) {
+	if c.opt.CacheMode < vfscommon.CacheModeFull {
+		return
+	}
+	c.pins.mu.Lock()
+	c.pins.changed[clean(name)] = struct{}{}
+	c.pins.mu.Unlock()
+	c.kickPrefetcher(false)
+}
+
+// kickPrefetcher starts the prefetcher if it isn't already running
+//
+// If all is set then all the pinned paths are checked, otherwise only
+// the paths passed to Changed.
+func (c *Cache) kickPrefetcher(all bool) {
+	if all {
+		c.pins.mu.Lock()
+		c.pins.all = true
+		c.pins.mu.Unlock()
+	}
+	select {
+	case c.pins.kick <- struct{}{}:
+	default:
+	}
+}
+
+// prefetcher downloads the pinned files on start up, when paths are
+// pinned, when the remote changes and every --vfs-cache-pin-interval
+//
+// doesn't return until context is cancelled
+func (c *Cache) prefetcher(ctx context.Context) {
+	var tick <-chan time.Time
+	if c.opt.CachePinInterval > 0 {
+		ticker := time.NewTicker(time.Duration(c.opt.CachePinInterval))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	c.kickPrefetcher(true)
+	for {
+		select {
+		case <-c.pins.kick:
+		case <-tick:
+			c.pins.mu.Lock()
+			c.pins.all = true
+			c.pins.mu.Unlock()
+		case <-ctx.Done():
+			fs.Debugf(nil, "vfs cache: prefetcher exiting")
+			return
+		}
+		c.prefetch(ctx, c.pins.take())
+	}
+}
+
+// prefetch downloads all the pinned files in roots which aren't fully
+// in the cache
+func (c *Cache) prefetch(ctx context.Context, roots []prefetchRoot) {
+	for _, root := range roots {
+		if root.path != "" {
+			// The path might be a file rather than a directory
+			o, err := c.fremote.NewObject(ctx, root.path)
+			if err == nil {
+				if c.isPinned(o.Remote()) {
+					c.prefetchObject(o)
+				}
+				continue
+			}
+		}
+		err := walk.ListR(ctx, c.fremote, root.path, true, root.depth, walk.ListObjects, func(entries fs.DirEntries) error {
+			for _, entry := range entries {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if o, ok := entry.(fs.Object); ok && c.isPinned(o.Remote()) {
+					c.prefetchObject(o)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			// The remote may well be offline so don't make a fuss
+			fs.Debugf(root.path, "vfs cache: prefetch failed to list: %v", err)
+		}
+	}
+}
+
+// prefetchObject downloads o into the cache if it isn't there already
+func (c *Cache) prefetchObject(o fs.Object) {
+	name := o.Remote()
+	item, _ := c.get(name)
+	if item.IsDirty() {
+		// Local changes take precedence over the remote
+		return
+	}
+	err := item.Prefetch(o)
+	if err != nil {
+		fs.Debugf(name, "vfs cache: prefetch failed: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package vfscache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCachePin(t *testing.T, patterns string, listAll bool) (r *fstest.Run, c *Cache, present func(name string) bool) {
+	opt := vfscommon.Opt
+	opt.CacheMode = vfscommon.CacheModeFull
+	opt.CachePollInterval = 0
+	opt.CachePinInterval = 0
+	opt.CachePinListAll = listAll
+	opt.WriteBack = 0
+	opt.CachePin = patterns
+	r, c = newTestCacheOpt(t, opt)
+
+	ctx := context.Background()
+	t1 := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	r.WriteObject(ctx, "project/a.txt", "apple", t1)
+	r.WriteObject(ctx, "project/sub/b.txt", "banana", t1)
+	r.WriteObject(ctx, "other/c.txt", "cherry", t1)
+	r.WriteObject(ctx, "other/d.doc", "date", t1)
+
+	present = func(name string) bool {
+		c.mu.Lock()
+		item := c.item[name]
+		c.mu.Unlock()
+		return item != nil && item.present()
+	}
+	return r, c, present
+}
+
+func TestCachePin(t *testing.T) {
+	_, c, present := newTestCachePin(t, "", false)
+
+	assert.Equal(t, []string{}, c.Pins())
+	require.NoError(t, c.Pin("/project/"))
+	assert.Equal(t, []string{"project"}, c.Pins())
+
+	// The prefetcher downloads the pinned files only
+	assert.Eventually(t, func() bool {
+		return present("project/a.txt") && present("project/sub/b.txt")
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.False(t, present("other/c.txt"))
+
+	assert.True(t, c.isPinned("project"))
+	assert.True(t, c.isPinned("project/sub/b.txt"))
+	assert.False(t, c.isPinned("projects"))
+	assert.False(t, c.isPinned("other/c.txt"))
+
+	// Pinned items are not evicted
+	c.purgeOld(-10 * time.Second)
+	assert.True(t, present("project/a.txt"))
+
+	out := c.Stats()
+	assert.Equal(t, int64(11), out["bytesPinned"])
+	assert.Equal(t, int64(0), out["bytesDirty"])
+	assert.Equal(t, []string{"project"}, out["pins"])
+
+	// Pins are saved
+	p, err := newPins(c.pinsDir(), "", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"project"}, p.list())
+
+	// Until they are unpinned
+	assert.Equal(t, ErrNotPinned, c.Unpin("project/sub"))
+	require.NoError(t, c.Unpin("project"))
+	assert.Equal(t, []string{}, c.Pins())
+	c.purgeOld(-10 * time.Second)
+	assert.False(t, present("project/a.txt"))
+	p, err = newPins(c.pinsDir(), "", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{}, p.list())
+}
+
+func TestCachePinFile(t *testing.T) {
+	_, c, present := newTestCachePin(t, "", false)
+
+	require.NoError(t, c.Pin("other/d.doc"))
+	assert.Eventually(t, func() bool {
+		return present("other/d.doc")
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.False(t, present("other/c.txt"))
+}
+
+func TestCachePinPattern(t *testing.T) {
+	_, c, present := newTestCachePin(t, `*.txt,"/{other,another}/*.doc"`, false)
+
+	// The patterns could match anywhere so only changed
+	// directories are listed for them
+	c.Changed("other")
+	assert.Eventually(t, func() bool {
+		return present("other/c.txt") && present("other/d.doc")
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.False(t, present("project/sub/b.txt"))
+
+	c.Changed("project/sub")
+	assert.Eventually(t, func() bool {
+		return present("project/sub/b.txt")
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.False(t, present("project/a.txt"))
+
+	assert.True(t, c.isPinned("project/a.txt"))
+	assert.True(t, c.isPinned("other/d.doc"))
+	assert.False(t, c.isPinned("project/d.doc"))
+
+	// Patterns can't be unpinned
+	assert.Equal(t, ErrNotPinned, c.Unpin("other/d.doc"))
+}
+
+func TestCachePinPatternListAll(t *testing.T) {
+	_, c, present := newTestCachePin(t, `*.txt`, true)
+
+	c.kickPrefetcher(true)
+	assert.Eventually(t, func() bool {
+		return present("project/a.txt") && present("project/sub/b.txt") && present("other/c.txt")
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.False(t, present("other/d.doc"))
+}
+
+func TestCachePinChanged(t *testing.T) {
+	r, c, present := newTestCachePin(t, "", false)
+
+	require.NoError(t, c.Pin("project"))
+	assert.Eventually(t, func() bool {
+		return present("project/a.txt")
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// New files are only looked for when the remote says they changed
+	t1 := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	r.WriteObject(context.Background(), "project/sub/e.txt", "elderberry", t1)
+	c.Changed("other")
+	time.Sleep(100 * time.Millisecond)
+	assert.False(t, present("project/sub/e.txt"))
+
+	c.Changed("project/sub")
+	assert.Eventually(t, func() bool {
+		return present("project/sub/e.txt")
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestCachePinNeedsFullMode(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.CacheMode = vfscommon.CacheModeWrites
+	opt.CachePollInterval = 0
+	_, c := newTestCacheOpt(t, opt)
+
+	assert.Error(t, c.Pin("project"))
+	assert.Equal(t, []string{}, c.Pins())
+}
+
+func TestCachePinBadPattern(t *testing.T) {
+	_, err := newPins(t.TempDir(), "[", false)
+	assert.ErrorContains(t, err, "bad --vfs-cache-pin pattern")
+}
+
+func TestGlobRoot(t *testing.T) {
+	for _, test := range []struct {
+		pattern string
+		want    string
+	}{
+		{"*.txt", ""},
+		{"project/*.txt", ""},
+		{"/*.txt", ""},
+		{"/project/*.txt", "project"},
+		{"/project/sub/**", "project/sub"},
+		{"/project/s*/a/b", "project"},
+		{"/project/{a,b}/c", "project"},
+		{"/project/file", "project"},
+	} {
+		assert.Equal(t, test.want, globRoot(test.pattern), test.pattern)
+	}
+}
+
+func TestPinsWalkRoots(t *testing.T) {
+	p, err := newPins(t.TempDir(), "/a/b/*.txt,/c/**", false)
+	require.NoError(t, err)
+	p.paths["a"] = struct{}{}
+	p.paths["c/d"] = struct{}{}
+	p.paths["e"] = struct{}{}
+	assert.Equal(t, []string{"a", "c", "e"}, p.walkRoots())
+
+	p.paths[""] = struct{}{}
+	assert.Equal(t, []string{""}, p.walkRoots())
+}
+
+func TestPinsChangedRoots(t *testing.T) {
+	p, err := newPins(t.TempDir(), "/a/b/*.txt", false)
+	require.NoError(t, err)
+	p.paths["c"] = struct{}{}
+	assert.Equal(t, []prefetchRoot(nil), p.changedRoots([]string{"d", "a/c"}))
+	assert.Equal(t, []prefetchRoot{
+		{path: "a/b/x.txt", depth: -1},
+		{path: "c/d", depth: -1},
+		{path: "a/b", depth: -1},
+		{path: "c", depth: -1},
+	}, p.changedRoots([]string{"a/b/x.txt", "c/d", ""}))
+
+	// Unanchored patterns only list the changed paths
+	p, err = newPins(t.TempDir(), "*.txt,/a/*.txt", false)
+	require.NoError(t, err)
+	assert.Equal(t, []prefetchRoot{
+		{path: "a/x.txt", depth: -1},
+		{path: "d", depth: 1},
+		{path: "a", depth: -1},
+		{path: "", depth: 1},
+	}, p.changedRoots([]string{"a/x.txt", "d", ""}))
+
+	// Unless the whole remote can be listed
+	p, err = newPins(t.TempDir(), "*.txt", true)
+	require.NoError(t, err)
+	assert.Equal(t, []prefetchRoot{
+		{path: "d", depth: -1},
+	}, p.changedRoots([]string{"d"}))
+}
@@ -30,6 +30,16 @@ var OptionsInfo = fs.Options{{
 	Default: fs.Duration(5 * 60 * time.Second),
 	Help:    "Time to cache directory entries for",
 	Groups:  "VFS",
+}, {
+	Name:    "vfs_dir_cache_persist",
+	Default: false,
+	Help:    "Keep directory listings on disk so they can be used straight away after a restart",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_respect_locks",
+	Default: false,
+	Help:    "Refuse to change files locked by rclone serve webdav --lock-system persistent",
+	Groups:  "VFS",
 }, {
 	Name:    "vfs_refresh",
 	Default: false,
@@ -75,6 +85,21 @@ var OptionsInfo = fs.Options{{
 	Default: fs.SizeSuffix(-1),
 	Help:    "Target minimum free space on the disk containing the cache",
 	Groups:  "VFS",
+}, {
+	Name:    "vfs_cache_pin",
+	Default: "",
+	Help:    "Comma separated list of glob patterns of paths to keep downloaded in the cache",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_cache_pin_interval",
+	Default: fs.Duration(6 * time.Hour),
+	Help:    "Interval to check the remote for new or changed pinned files",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_cache_pin_list_all",
+	Default: false,
+	Help:    "List the whole remote to find files for --vfs-cache-pin patterns which can match anywhere",
+	Groups:  "VFS",
 }, {
 	Name:    "vfs_read_chunk_size",
 	Default: 128 * fs.Mebi,
@@ -173,13 +198,15 @@ func init() {
 
 // Options is options for creating the vfs
 type Options struct {
-	NoSeek             bool          `config:"no_seek"`        // don't allow seeking if set
-	NoChecksum         bool          `config:"no_checksum"`    // don't check checksums if set
-	ReadOnly           bool          `config:"read_only"`      // if set VFS is read only
-	Links              bool          `config:"vfs_links"`      // if set interpret link files
-	NoModTime          bool          `config:"no_modtime"`     // don't read mod times for files
-	DirCacheTime       fs.Duration   `config:"dir_cache_time"` // how long to consider directory listing cache valid
-	Refresh            bool          `config:"vfs_refresh"`    // refreshes the directory listing recursively on start
+	NoSeek             bool          `config:"no_seek"`               // don't allow seeking if set
+	NoChecksum         bool          `config:"no_checksum"`           // don't check checksums if set
+	ReadOnly           bool          `config:"read_only"`             // if set VFS is read only
+	Links              bool          `config:"vfs_links"`             // if set interpret link files
+	NoModTime          bool          `config:"no_modtime"`            // don't read mod times for files
+	DirCacheTime       fs.Duration   `config:"dir_cache_time"`        // how long to consider directory listing cache valid
+	DirCachePersist    bool          `config:"vfs_dir_cache_persist"` // keep directory listings on disk between runs
+	RespectLocks       bool          `config:"vfs_respect_locks"`     // refuse to change locked files
+	Refresh            bool          `config:"vfs_refresh"`           // refreshes the directory listing recursively on start
 	PollInterval       fs.Duration   `config:"poll_interval"`
 	Umask              FileMode      `config:"umask"`
 	UID                uint32        `config:"uid"`
@@ -194,6 +221,9 @@ type Options struct {
 	CacheMaxAge        fs.Duration   `config:"vfs_cache_max_age"`
 	CacheMaxSize       fs.SizeSuffix `config:"vfs_cache_max_size"`
 	CacheMinFreeSpace  fs.SizeSuffix `config:"vfs_cache_min_free_space"`
+	CachePin           string        `config:"vfs_cache_pin"`          // glob patterns of paths to keep downloaded
+	CachePinInterval   fs.Duration   `config:"vfs_cache_pin_interval"` // how often to check for changed pinned files
+	CachePinListAll    bool          `config:"vfs_cache_pin_list_all"` // list the whole remote for unanchored patterns
 	CachePollInterval  fs.Duration   `config:"vfs_cache_poll_interval"`
 	CaseInsensitive    bool          `config:"vfs_case_insensitive"`
 	BlockNormDupes     bool          `config:"vfs_block_norm_dupes"`
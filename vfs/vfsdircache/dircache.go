@@ -0,0 +1,282 @@
+// Package vfsdircache keeps VFS directory listings on disk so they
+// can be used straight away when the VFS is restarted.
+package vfsdircache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// facility is the name of the database the listings are stored in
+const facility = "vfsdir"
+
+// Cache stores directory listings of an Fs in a key-value database.
+//
+// Listings are keyed by their path from the root of the remote so
+// VFSes with different roots on the same remote share them.
+type Cache struct {
+	f    fs.Fs
+	root string
+
+	mu   sync.Mutex
+	db   *kv.DB              // nil once closed
+	keys map[string]struct{} // keys of the stored listings
+}
+
+// entry is the stored form of a directory entry
+type entry struct {
+	Name    string
+	Dir     bool
+	Size    int64
+	ModTime time.Time
+}
+
+// record is the stored form of a directory listing
+type record struct {
+	Read    time.Time
+	Entries []entry
+}
+
+// New opens the directory cache for f, creating it if necessary.
+func New(ctx context.Context, f fs.Fs) (*Cache, error) {
+	if !kv.Supported() {
+		return nil, kv.ErrUnsupported
+	}
+	db, err := kv.Start(ctx, facility, f)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cache{
+		f:    f,
+		root: strings.Trim(f.Root(), "/"),
+		db:   db,
+		keys: map[string]struct{}{},
+	}
+	op := &opKeys{keys: c.keys}
+	if err := db.Do(false, op); err != nil && err != kv.ErrEmpty {
+		_ = db.Stop(false)
+		return nil, fmt.Errorf("failed to read directory cache: %w", err)
+	}
+	fs.Debugf(f, "Directory cache %q has %d listings", db.Path(), len(c.keys))
+	return c, nil
+}
+
+// key returns the database key for dir
+func (c *Cache) key(dir string) string {
+	return "/" + path.Join(c.root, dir)
+}
+
+// do runs op on the database, doing nothing if the cache is closed
+func (c *Cache) do(write bool, op kv.Op) error {
+	c.mu.Lock()
+	db := c.db
+	c.mu.Unlock()
+	if db == nil {
+		return nil
+	}
+	return db.Do(write, op)
+}
+
+// Get returns the stored listing of dir and the time it was read.
+//
+// found is false if there is no listing of dir stored. The objects
+// returned are *Object which find the real object on the remote when
+// needed.
+func (c *Cache) Get(dir string) (entries fs.DirEntries, read time.Time, found bool) {
+	key := c.key(dir)
+	c.mu.Lock()
+	_, found = c.keys[key]
+	c.mu.Unlock()
+	if !found {
+		return nil, read, false
+	}
+	op := &opGet{key: key}
+	if err := c.do(false, op); err != nil {
+		fs.Debugf(dir, "Failed to read stored directory listing: %v", err)
+		return nil, read, false
+	}
+	if op.data == nil {
+		return nil, read, false
+	}
+	var r record
+	if err := gob.NewDecoder(bytes.NewReader(op.data)).Decode(&r); err != nil {
+		fs.Debugf(dir, "Failed to decode stored directory listing: %v", err)
+		return nil, read, false
+	}
+	entries = make(fs.DirEntries, 0, len(r.Entries))
+	for _, e := range r.Entries {
+		remote := path.Join(dir, e.Name)
+		if e.Dir {
+			entries = append(entries, fs.NewDir(remote, e.ModTime).SetSize(e.Size))
+		} else {
+			entries = append(entries, &Object{
+				f:       c.f,
+				remote:  remote,
+				size:    e.Size,
+				modTime: e.ModTime,
+			})
+		}
+	}
+	return entries, r.Read, true
+}
+
+// Put stores the listing of dir read at the time read
+func (c *Cache) Put(dir string, entries fs.DirEntries, read time.Time) error {
+	return c.PutAll(map[string]fs.DirEntries{dir: entries}, read)
+}
+
+// PutAll stores the listings of all the directories in listings, keyed
+// by directory, read at the time read in a single transaction.
+func (c *Cache) PutAll(listings map[string]fs.DirEntries, read time.Time) error {
+	ctx := context.Background()
+	op := &opPut{records: make(map[string][]byte, len(listings))}
+	for dir, entries := range listings {
+		r := record{
+			Read:    read,
+			Entries: make([]entry, 0, len(entries)),
+		}
+		for _, item := range entries {
+			_, isDir := item.(fs.Directory)
+			r.Entries = append(r.Entries, entry{
+				Name:    path.Base(item.Remote()),
+				Dir:     isDir,
+				Size:    item.Size(),
+				ModTime: item.ModTime(ctx),
+			})
+		}
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(&r); err != nil {
+			return fmt.Errorf("failed to encode listing of %q: %w", dir, err)
+		}
+		op.records[c.key(dir)] = buf.Bytes()
+	}
+	if err := c.do(true, op); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	for key := range op.records {
+		c.keys[key] = struct{}{}
+	}
+	c.mu.Unlock()
+	return nil
+}
+
+// Remove the stored listing of dir, and of all the directories below
+// it if recursive is set.
+func (c *Cache) Remove(dir string, recursive bool) error {
+	key := c.key(dir)
+	prefix := key + "/"
+	if key == "/" {
+		prefix = key
+	}
+	var keys []string
+	c.mu.Lock()
+	if _, found := c.keys[key]; found {
+		keys = append(keys, key)
+	}
+	if recursive {
+		for k := range c.keys {
+			if strings.HasPrefix(k, prefix) && k != key {
+				keys = append(keys, k)
+			}
+		}
+	}
+	c.mu.Unlock()
+	if len(keys) == 0 {
+		return nil
+	}
+	if err := c.do(true, &opDelete{keys: keys}); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	for _, k := range keys {
+		delete(c.keys, k)
+	}
+	c.mu.Unlock()
+	fs.Debugf(dir, "Removed %d stored directory listings", len(keys))
+	return nil
+}
+
+// Len returns the number of stored directory listings
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.keys)
+}
+
+// Close the cache. Further operations on it do nothing.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	db := c.db
+	c.db = nil
+	c.mu.Unlock()
+	if db == nil {
+		return nil
+	}
+	return db.Stop(false)
+}
+
+// opKeys: read all the keys in the database
+type opKeys struct {
+	keys map[string]struct{}
+}
+
+func (op *opKeys) Do(ctx context.Context, b kv.Bucket) error {
+	return b.ForEach(func(bkey, _ []byte) error {
+		op.keys[string(bkey)] = struct{}{}
+		return nil
+	})
+}
+
+// opGet: read a single record
+type opGet struct {
+	key  string
+	data []byte
+}
+
+func (op *opGet) Do(ctx context.Context, b kv.Bucket) error {
+	// data is only valid for the life of the transaction so copy it
+	if data := b.Get([]byte(op.key)); data != nil {
+		op.data = append([]byte(nil), data...)
+	}
+	return nil
+}
+
+// opPut: write records
+type opPut struct {
+	records map[string][]byte
+}
+
+func (op *opPut) Do(ctx context.Context, b kv.Bucket) error {
+	for key, data := range op.records {
+		if err := b.Put([]byte(key), data); err != nil {
+			return fmt.Errorf("put failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// opDelete: delete records
+type opDelete struct {
+	keys []string
+}
+
+func (op *opDelete) Do(ctx context.Context, b kv.Bucket) error {
+	var errs []error
+	for _, key := range op.keys {
+		if err := b.Delete([]byte(key)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
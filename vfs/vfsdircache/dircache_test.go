@@ -0,0 +1,156 @@
+//go:build !plan9 && !js
+
+package vfsdircache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var t1 = fstest.Time("2001-02-03T04:05:06.499999999Z")
+
+// newTestCache makes a remote with some files in and opens a cache
+// for it with the database in a temporary directory
+func newTestCache(t *testing.T) (f fs.Fs, c *Cache) {
+	ctx := context.Background()
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "file.txt"), []byte("hello"), 0666))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "sub", "file.txt"), t1, t1))
+
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	c, err = New(ctx, f)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, c.Close())
+		_ = config.SetCacheDir(oldCacheDir)
+	})
+	return f, c
+}
+
+func listing(entries fs.DirEntries) (out []string) {
+	for _, entry := range entries {
+		_, isDir := entry.(fs.Directory)
+		out = append(out, fmt.Sprintf("%s,%d,%v", entry.Remote(), entry.Size(), isDir))
+	}
+	return out
+}
+
+func TestCachePutGet(t *testing.T) {
+	ctx := context.Background()
+	f, c := newTestCache(t)
+
+	_, _, found := c.Get("sub")
+	assert.False(t, found)
+
+	entries, err := f.List(ctx, "sub")
+	require.NoError(t, err)
+	read := time.Now()
+	require.NoError(t, c.Put("sub", entries, read))
+	assert.Equal(t, 1, c.Len())
+
+	got, gotRead, found := c.Get("sub")
+	require.True(t, found)
+	assert.True(t, read.Equal(gotRead))
+	assert.ElementsMatch(t, listing(entries), listing(got))
+
+	// Files are described as listed and read from the remote
+	var obj *Object
+	for _, entry := range got {
+		if o, ok := entry.(*Object); ok {
+			obj = o
+		}
+	}
+	require.NotNil(t, obj)
+	assert.Equal(t, "sub/file.txt", obj.Remote())
+	assert.True(t, t1.Equal(obj.ModTime(ctx)))
+	in, err := obj.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "hello", string(data))
+
+	// Optional interfaces are passed on to the real object
+	real := fs.UnWrapObject(obj)
+	assert.NotEqual(t, fs.Object(obj), real)
+	assert.Equal(t, "sub/file.txt", real.Remote())
+	assert.Equal(t, "text/plain; charset=utf-8", fs.MimeType(ctx, obj))
+	metadata, err := obj.Metadata(ctx)
+	require.NoError(t, err)
+	assert.NotEmpty(t, metadata["mtime"])
+
+	// Changes are reflected in the size and modification time
+	t2 := fstest.Time("2011-12-25T12:59:59.123456789Z")
+	require.NoError(t, obj.SetModTime(ctx, t2))
+	assert.True(t, t2.Equal(obj.ModTime(ctx)))
+	src := object.NewStaticObjectInfo("sub/file.txt", t1, 11, true, nil, f)
+	require.NoError(t, obj.Update(ctx, strings.NewReader("hello world"), src))
+	assert.Equal(t, int64(11), obj.Size())
+	assert.True(t, t1.Equal(obj.ModTime(ctx)))
+}
+
+func TestCacheRemove(t *testing.T) {
+	ctx := context.Background()
+	f, c := newTestCache(t)
+	read := time.Now()
+	require.NoError(t, c.PutAll(map[string]fs.DirEntries{
+		"":         {fs.NewDir("sub", t1)},
+		"sub":      {fs.NewDir("sub/deep", t1)},
+		"sub/deep": {},
+		"subway":   {},
+	}, read))
+	assert.Equal(t, 4, c.Len())
+
+	require.NoError(t, c.Remove("sub", false))
+	_, _, found := c.Get("sub")
+	assert.False(t, found)
+	_, _, found = c.Get("sub/deep")
+	assert.True(t, found)
+
+	require.NoError(t, c.Remove("sub", true))
+	_, _, found = c.Get("sub/deep")
+	assert.False(t, found)
+	_, _, found = c.Get("subway")
+	assert.True(t, found)
+	assert.Equal(t, 2, c.Len())
+
+	// Removing the root removes everything
+	require.NoError(t, c.Remove("", true))
+	assert.Equal(t, 0, c.Len())
+
+	// A cache rooted lower down shares the listings
+	require.NoError(t, c.Put("sub/deep", fs.DirEntries{}, read))
+	fsub, err := fs.NewFs(ctx, filepath.Join(f.Root(), "sub"))
+	require.NoError(t, err)
+	csub, err := New(ctx, fsub)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, csub.Close())
+	}()
+	_, _, found = csub.Get("deep")
+	assert.True(t, found)
+
+	// A closed cache does nothing
+	require.NoError(t, csub.Close())
+	_, _, found = csub.Get("deep")
+	assert.False(t, found)
+	assert.NoError(t, csub.Put("deep", fs.DirEntries{}, read))
+}
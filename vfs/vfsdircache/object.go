@@ -0,0 +1,240 @@
+package vfsdircache
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Object is a file read from a stored directory listing.
+//
+// It describes the file as it was when the listing was stored. The
+// real object is found on the remote the first time it is needed to
+// read, change or hash the file, or for any of the optional object
+// interfaces, which are passed on to it.
+type Object struct {
+	f      fs.Fs
+	remote string
+
+	mu      sync.Mutex
+	size    int64
+	modTime time.Time
+	o       fs.Object // the real object once found
+}
+
+// Resolve returns the object on the remote that o describes
+func (o *Object) Resolve(ctx context.Context) (fs.Object, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.o != nil {
+		return o.o, nil
+	}
+	obj, err := o.f.NewObject(ctx, o.remote)
+	if err != nil {
+		return nil, err
+	}
+	o.o = obj
+	return obj, nil
+}
+
+// Fs returns the Fs the object is in
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// String returns a description of the Object
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// ModTime returns the modification time of the object when it was
+// listed or last changed
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.modTime
+}
+
+// Size returns the size of the object when it was listed or last
+// changed
+func (o *Object) Size() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.size
+}
+
+// Storable returns whether the object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Hash returns the selected checksum of the file on the remote
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	obj, err := o.Resolve(ctx)
+	if err != nil {
+		return "", err
+	}
+	return obj.Hash(ctx, ht)
+}
+
+// SetModTime sets the modification time of the file on the remote
+func (o *Object) SetModTime(ctx context.Context, t time.Time) error {
+	obj, err := o.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	err = obj.SetModTime(ctx, t)
+	if err != nil {
+		return err
+	}
+	o.mu.Lock()
+	o.modTime = t
+	o.mu.Unlock()
+	return nil
+}
+
+// Open the file on the remote for read
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	obj, err := o.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return obj.Open(ctx, options...)
+}
+
+// Update the file on the remote with the contents of in
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	obj, err := o.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	err = obj.Update(ctx, in, src, options...)
+	if err != nil {
+		return err
+	}
+	size, modTime := obj.Size(), obj.ModTime(ctx)
+	o.mu.Lock()
+	o.size, o.modTime = size, modTime
+	o.mu.Unlock()
+	return nil
+}
+
+// Remove the file from the remote
+func (o *Object) Remove(ctx context.Context) error {
+	obj, err := o.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	return obj.Remove(ctx)
+}
+
+// resolve returns the real object for the optional interfaces which
+// don't take a context, or nil if it can't be found
+func (o *Object) resolve() fs.Object {
+	obj, err := o.Resolve(context.Background())
+	if err != nil {
+		fs.Debugf(o, "Failed to find object: %v", err)
+		return nil
+	}
+	return obj
+}
+
+// UnWrap returns the object on the remote or nil if it can't be found
+func (o *Object) UnWrap() fs.Object {
+	return o.resolve()
+}
+
+// MimeType returns the content type of the Object if known
+func (o *Object) MimeType(ctx context.Context) (mimeType string) {
+	obj, err := o.Resolve(ctx)
+	if err != nil {
+		return ""
+	}
+	if do, ok := obj.(fs.MimeTyper); ok {
+		mimeType = do.MimeType(ctx)
+	}
+	return mimeType
+}
+
+// ID returns the ID of the Object if known, or "" if not
+func (o *Object) ID() string {
+	do, ok := o.resolve().(fs.IDer)
+	if !ok {
+		return ""
+	}
+	return do.ID()
+}
+
+// GetTier returns storage tier or class of the Object
+func (o *Object) GetTier() string {
+	do, ok := o.resolve().(fs.GetTierer)
+	if !ok {
+		return ""
+	}
+	return do.GetTier()
+}
+
+// SetTier performs changing storage tier of the Object if
+// multiple storage classes supported
+func (o *Object) SetTier(tier string) error {
+	do, ok := o.resolve().(fs.SetTierer)
+	if !ok {
+		return errors.New("underlying remote does not support SetTier")
+	}
+	return do.SetTier(tier)
+}
+
+// Metadata returns metadata for an object
+//
+// It should return nil if there is no Metadata
+func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	obj, err := o.Resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	do, ok := obj.(fs.Metadataer)
+	if !ok {
+		return nil, nil
+	}
+	return do.Metadata(ctx)
+}
+
+// SetMetadata sets metadata for an Object
+//
+// It should return fs.ErrorNotImplemented if it can't set metadata
+func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	obj, err := o.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	do, ok := obj.(fs.SetMetadataer)
+	if !ok {
+		return fs.ErrorNotImplemented
+	}
+	return do.SetMetadata(ctx, metadata)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Object          = (*Object)(nil)
+	_ fs.ObjectUnWrapper = (*Object)(nil)
+	_ fs.MimeTyper       = (*Object)(nil)
+	_ fs.IDer            = (*Object)(nil)
+	_ fs.GetTierer       = (*Object)(nil)
+	_ fs.SetTierer       = (*Object)(nil)
+	_ fs.Metadataer      = (*Object)(nil)
+	_ fs.SetMetadataer   = (*Object)(nil)
+)
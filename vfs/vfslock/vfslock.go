@@ -0,0 +1,397 @@
+// Package vfslock keeps WebDAV style write locks on the files of a
+// remote in a key-value database.
+//
+// The database is shared by every rclone process using the same cache
+// directory, so locks taken by one server survive a restart and are
+// respected by the others.
+package vfslock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// facility is the name of the database the locks are stored in
+const facility = "vfslock"
+
+// Errors returned
+var (
+	ErrLocked     = errors.New("locked")
+	ErrNoSuchLock = errors.New("no such lock")
+)
+
+// Lock describes a single exclusive write lock
+type Lock struct {
+	Token     string        `json:"token"`              // opaque lock token
+	Root      string        `json:"root"`               // path locked, relative to the root of the Locks
+	ZeroDepth bool          `json:"zeroDepth"`          // if unset the lock covers everything below Root too
+	OwnerXML  string        `json:"ownerXML,omitempty"` // owner as supplied by the client
+	Duration  time.Duration `json:"duration"`           // timeout of the lock - negative means infinite
+	Expiry    time.Time     `json:"expiry"`             // when the lock expires - zero means never
+	Created   time.Time     `json:"created"`            // when the lock was taken
+}
+
+// expired returns true if the lock has expired at now
+func (l *Lock) expired(now time.Time) bool {
+	return !l.Expiry.IsZero() && !now.Before(l.Expiry)
+}
+
+// Covers returns true if the lock applies to name
+func (l *Lock) Covers(name string) bool {
+	if name == l.Root {
+		return true
+	}
+	if l.ZeroDepth {
+		return false
+	}
+	return l.Root == "" || strings.HasPrefix(name, l.Root+"/")
+}
+
+// Conflicts returns true if a lock on name, covering everything
+// below it unless zeroDepth is set, can't be taken while l is held.
+func (l *Lock) Conflicts(name string, zeroDepth bool) bool {
+	if l.Covers(name) {
+		return true
+	}
+	return !zeroDepth && (name == "" || strings.HasPrefix(l.Root, name+"/"))
+}
+
+// Locks stores the locks of an Fs in a key-value database.
+//
+// Locks are stored by their path from the root of the remote so
+// Locks with different roots on the same remote share them.
+type Locks struct {
+	f    fs.Fs
+	root string
+
+	mu sync.Mutex
+	db *kv.DB // nil once closed
+}
+
+// New opens the lock database for f, creating it if necessary.
+func New(ctx context.Context, f fs.Fs) (*Locks, error) {
+	if !kv.Supported() {
+		return nil, kv.ErrUnsupported
+	}
+	db, err := kv.Start(ctx, facility, f)
+	if err != nil {
+		return nil, err
+	}
+	fs.Debugf(f, "Using lock database %q", db.Path())
+	return &Locks{
+		f:    f,
+		root: strings.Trim(f.Root(), "/"),
+		db:   db,
+	}, nil
+}
+
+// clean returns name relative to the root with no leading or
+// trailing slashes
+func clean(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+// toStored converts l from being relative to the root to being
+// relative to the root of the remote
+func (ls *Locks) toStored(l Lock) Lock {
+	l.Root = strings.Trim(path.Join(ls.root, l.Root), "/")
+	return l
+}
+
+// fromStored converts l from being relative to the root of the remote
+// to being relative to the root. ok is false if l is outside the root
+// and doesn't cover it.
+func (ls *Locks) fromStored(l Lock) (_ Lock, ok bool) {
+	switch {
+	case ls.root == "":
+	case l.Root == ls.root:
+		l.Root = ""
+	case strings.HasPrefix(l.Root, ls.root+"/"):
+		l.Root = l.Root[len(ls.root)+1:]
+	case l.Covers(ls.root):
+		// lock on a parent of the root covers all of it
+		l.Root = ""
+	default:
+		return l, false
+	}
+	return l, true
+}
+
+// do runs op on the database, returning an error if it is closed
+func (ls *Locks) do(write bool, op kv.Op) error {
+	ls.mu.Lock()
+	db := ls.db
+	ls.mu.Unlock()
+	if db == nil {
+		return kv.ErrInactive
+	}
+	err := db.Do(write, op)
+	if err == kv.ErrEmpty {
+		err = nil
+	}
+	return err
+}
+
+// all returns the unexpired locks at now, with their paths relative
+// to the root of the remote
+func (ls *Locks) all(now time.Time) ([]Lock, error) {
+	op := &opRead{now: now}
+	if err := ls.do(false, op); err != nil {
+		return nil, err
+	}
+	return op.locks, nil
+}
+
+// Create takes a new lock described by l at now returning it with
+// its Token, Expiry and Created filled in.
+//
+// It returns ErrLocked if an existing lock conflicts with it.
+func (ls *Locks) Create(now time.Time, l Lock) (Lock, error) {
+	l.Root = clean(l.Root)
+	l.Token = "opaquelocktoken:" + uuid.New().String()
+	l.Created = now
+	l.Expiry = time.Time{}
+	if l.Duration >= 0 {
+		l.Expiry = now.Add(l.Duration)
+	}
+	if err := ls.do(true, &opCreate{now: now, lock: ls.toStored(l)}); err != nil {
+		return Lock{}, err
+	}
+	fs.Debugf(l.Root, "Created lock %s", l.Token)
+	return l, nil
+}
+
+// Refresh sets the timeout of the lock with token to duration from
+// now returning the updated lock.
+func (ls *Locks) Refresh(now time.Time, token string, duration time.Duration) (Lock, error) {
+	op := &opRefresh{now: now, token: token, duration: duration}
+	if err := ls.do(true, op); err != nil {
+		return Lock{}, err
+	}
+	l, _ := ls.fromStored(op.lock)
+	return l, nil
+}
+
+// Unlock removes the lock with token
+func (ls *Locks) Unlock(now time.Time, token string) error {
+	if err := ls.do(true, &opUnlock{now: now, token: token}); err != nil {
+		return err
+	}
+	fs.Debugf(nil, "Removed lock %s", token)
+	return nil
+}
+
+// Get returns the lock with token. ok is false if it doesn't exist,
+// has expired or is outside the root.
+func (ls *Locks) Get(now time.Time, token string) (l Lock, ok bool, err error) {
+	op := &opGet{now: now, token: token}
+	if err := ls.do(false, op); err != nil {
+		return l, false, err
+	}
+	if op.lock == nil {
+		return l, false, nil
+	}
+	l, ok = ls.fromStored(*op.lock)
+	return l, ok, nil
+}
+
+// Find returns the locks covering name
+func (ls *Locks) Find(now time.Time, name string) ([]Lock, error) {
+	all, err := ls.all(now)
+	if err != nil {
+		return nil, err
+	}
+	stored := strings.Trim(path.Join(ls.root, clean(name)), "/")
+	var locks []Lock
+	for _, l := range all {
+		if !l.Covers(stored) {
+			continue
+		}
+		if l, ok := ls.fromStored(l); ok {
+			locks = append(locks, l)
+		}
+	}
+	return locks, nil
+}
+
+// Check returns ErrLocked if name is locked, or if recursive is set,
+// if anything below name is locked.
+func (ls *Locks) Check(now time.Time, name string, recursive bool) error {
+	all, err := ls.all(now)
+	if err != nil {
+		return err
+	}
+	stored := strings.Trim(path.Join(ls.root, clean(name)), "/")
+	for _, l := range all {
+		if l.Conflicts(stored, !recursive) {
+			return fmt.Errorf("%q: %w by %s", name, ErrLocked, l.Token)
+		}
+	}
+	return nil
+}
+
+// Close the lock database. Further operations on it return errors.
+func (ls *Locks) Close() error {
+	ls.mu.Lock()
+	db := ls.db
+	ls.db = nil
+	ls.mu.Unlock()
+	if db == nil {
+		return nil
+	}
+	return db.Stop(false)
+}
+
+// decode a stored lock
+func decode(data []byte) (l Lock, err error) {
+	err = json.Unmarshal(data, &l)
+	return l, err
+}
+
+// opRead: read all the unexpired locks
+type opRead struct {
+	now   time.Time
+	locks []Lock
+}
+
+func (op *opRead) Do(ctx context.Context, b kv.Bucket) error {
+	return b.ForEach(func(key, data []byte) error {
+		l, err := decode(data)
+		if err != nil {
+			fs.Debugf(nil, "Ignoring bad lock %q: %v", key, err)
+			return nil
+		}
+		if !l.expired(op.now) {
+			op.locks = append(op.locks, l)
+		}
+		return nil
+	})
+}
+
+// opGet: read a single unexpired lock
+type opGet struct {
+	now   time.Time
+	token string
+	lock  *Lock
+}
+
+func (op *opGet) Do(ctx context.Context, b kv.Bucket) error {
+	data := b.Get([]byte(op.token))
+	if data == nil {
+		return nil
+	}
+	l, err := decode(data)
+	if err != nil {
+		return err
+	}
+	if !l.expired(op.now) {
+		op.lock = &l
+	}
+	return nil
+}
+
+// removeExpired deletes the expired locks returning the rest
+func removeExpired(now time.Time, b kv.Bucket) (locks []Lock, err error) {
+	var expired [][]byte
+	err = b.ForEach(func(key, data []byte) error {
+		l, err := decode(data)
+		if err != nil || l.expired(now) {
+			expired = append(expired, append([]byte(nil), key...))
+			return nil
+		}
+		locks = append(locks, l)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range expired {
+		if err := b.Delete(key); err != nil {
+			return nil, err
+		}
+	}
+	return locks, nil
+}
+
+// put stores l
+func put(b kv.Bucket, l Lock) error {
+	data, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(l.Token), data)
+}
+
+// opCreate: check for conflicts then store a new lock
+type opCreate struct {
+	now  time.Time
+	lock Lock
+}
+
+func (op *opCreate) Do(ctx context.Context, b kv.Bucket) error {
+	locks, err := removeExpired(op.now, b)
+	if err != nil {
+		return err
+	}
+	for _, l := range locks {
+		if l.Conflicts(op.lock.Root, op.lock.ZeroDepth) {
+			return ErrLocked
+		}
+	}
+	return put(b, op.lock)
+}
+
+// opRefresh: update the expiry of a lock
+type opRefresh struct {
+	now      time.Time
+	token    string
+	duration time.Duration
+	lock     Lock
+}
+
+func (op *opRefresh) Do(ctx context.Context, b kv.Bucket) error {
+	if _, err := removeExpired(op.now, b); err != nil {
+		return err
+	}
+	data := b.Get([]byte(op.token))
+	if data == nil {
+		return ErrNoSuchLock
+	}
+	l, err := decode(data)
+	if err != nil {
+		return err
+	}
+	l.Duration = op.duration
+	l.Expiry = time.Time{}
+	if l.Duration >= 0 {
+		l.Expiry = op.now.Add(l.Duration)
+	}
+	op.lock = l
+	return put(b, l)
+}
+
+// opUnlock: remove a lock
+type opUnlock struct {
+	now   time.Time
+	token string
+}
+
+func (op *opUnlock) Do(ctx context.Context, b kv.Bucket) error {
+	if _, err := removeExpired(op.now, b); err != nil {
+		return err
+	}
+	if b.Get([]byte(op.token)) == nil {
+		return ErrNoSuchLock
+	}
+	return b.Delete([]byte(op.token))
+}
@@ -0,0 +1,138 @@
+//go:build !plan9 && !js
+
+package vfslock
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestLocks makes a remote and opens the locks for it and for its
+// subdirectory sub with the database in a temporary directory
+func newTestLocks(t *testing.T) (ls, sub *Locks) {
+	ctx := context.Background()
+	oldCacheDir := config.GetCacheDir()
+	require.NoError(t, config.SetCacheDir(t.TempDir()))
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0777))
+
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	ls, err = New(ctx, f)
+	require.NoError(t, err)
+	fSub, err := fs.NewFs(ctx, filepath.Join(dir, "sub"))
+	require.NoError(t, err)
+	sub, err = New(ctx, fSub)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		assert.NoError(t, sub.Close())
+		assert.NoError(t, ls.Close())
+		_ = config.SetCacheDir(oldCacheDir)
+	})
+	return ls, sub
+}
+
+func TestLockCovers(t *testing.T) {
+	for _, test := range []struct {
+		root      string
+		zeroDepth bool
+		name      string
+		covers    bool
+		conflicts bool // with an infinite depth lock on name
+	}{
+		{"a/b", true, "a/b", true, true},
+		{"a/b", true, "a/b/c", false, false},
+		{"a/b", false, "a/b/c", true, true},
+		{"a/b", false, "a/bc", false, false},
+		{"a/b", true, "a", false, true},
+		{"a/b", true, "", false, true},
+		{"", false, "a/b", true, true},
+		{"", true, "a/b", false, false},
+	} {
+		l := Lock{Root: test.root, ZeroDepth: test.zeroDepth}
+		assert.Equal(t, test.covers, l.Covers(test.name), "%+v", test)
+		assert.Equal(t, test.covers, l.Conflicts(test.name, true), "%+v", test)
+		assert.Equal(t, test.conflicts, l.Conflicts(test.name, false), "%+v", test)
+	}
+}
+
+func TestLocks(t *testing.T) {
+	ls, sub := newTestLocks(t)
+	now := time.Now()
+
+	l, err := ls.Create(now, Lock{Root: "/sub/file.txt", ZeroDepth: true, OwnerXML: "<D:href>me</D:href>", Duration: time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, "sub/file.txt", l.Root)
+	assert.Contains(t, l.Token, "opaquelocktoken:")
+	assert.Equal(t, now.Add(time.Minute), l.Expiry)
+
+	// Conflicting locks can't be taken
+	_, err = ls.Create(now, Lock{Root: "sub/file.txt", ZeroDepth: true, Duration: -1})
+	assert.ErrorIs(t, err, ErrLocked)
+	_, err = ls.Create(now, Lock{Root: "sub", Duration: -1})
+	assert.ErrorIs(t, err, ErrLocked)
+	other, err := ls.Create(now, Lock{Root: "sub", ZeroDepth: true, Duration: -1})
+	require.NoError(t, err)
+	assert.True(t, other.Expiry.IsZero())
+
+	// Locks are shared by different roots on the same remote
+	got, ok, err := sub.Get(now, l.Token)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "file.txt", got.Root)
+	assert.Equal(t, l.OwnerXML, got.OwnerXML)
+	got, ok, err = sub.Get(now, other.Token)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "", got.Root)
+
+	found, err := sub.Find(now, "file.txt")
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	assert.Equal(t, l.Token, found[0].Token)
+	found, err = ls.Find(now, "sub2")
+	require.NoError(t, err)
+	assert.Len(t, found, 0)
+
+	// Check
+	assert.ErrorIs(t, ls.Check(now, "sub/file.txt", false), ErrLocked)
+	assert.ErrorIs(t, sub.Check(now, "file.txt", false), ErrLocked)
+	assert.NoError(t, sub.Check(now, "other.txt", false))
+	assert.ErrorIs(t, ls.Check(now, "sub", false), ErrLocked)
+	assert.NoError(t, ls.Check(now, "sub2", true))
+	assert.ErrorIs(t, sub.Check(now, "", true), ErrLocked)
+
+	// Locks expire
+	later := now.Add(2 * time.Minute)
+	assert.NoError(t, sub.Check(later, "file.txt", false))
+	_, ok, err = ls.Get(later, l.Token)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Refreshing extends the lock
+	got, err = sub.Refresh(now.Add(30*time.Second), l.Token, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "file.txt", got.Root)
+	assert.Equal(t, now.Add(90*time.Second), got.Expiry)
+	assert.ErrorIs(t, sub.Check(now.Add(80*time.Second), "file.txt", false), ErrLocked)
+
+	// Expired locks are removed
+	_, err = ls.Refresh(now.Add(time.Hour), l.Token, time.Minute)
+	assert.ErrorIs(t, err, ErrNoSuchLock)
+
+	// Unlock
+	require.NoError(t, ls.Unlock(now, other.Token))
+	err = ls.Unlock(now, other.Token)
+	assert.True(t, errors.Is(err, ErrNoSuchLock))
+	assert.NoError(t, ls.Check(later, "", true))
+}